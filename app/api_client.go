@@ -0,0 +1,884 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var httpClient = &http.Client{
+	Timeout: 20 * time.Second,
+}
+
+// API centralizes all server HTTP calls.
+type API struct {
+	baseURL    string
+	instanceID string
+	hostArch   string
+	client     *http.Client
+
+	saveCipher    *SaveCipher
+	compressSaves bool
+	saveDir       string
+
+	outbox  *Outbox
+	errors  *errorBatcher
+	breaker *circuitBreaker
+
+	heartbeatBusy atomic.Bool
+	// pingFromHeartbeat times heartbeats for the reported ping instead
+	// of the lighter Ping (see ping.go).
+	pingFromHeartbeat atomic.Bool
+	// nextHeartbeat is the interval in seconds the last heartbeat response
+	// asked for, or 0 to use the configured one.
+	nextHeartbeat atomic.Int64
+	// onCommands runs commands piggybacked on heartbeat responses.
+	onCommands atomic.Pointer[func([]WSMessage)]
+	// onResult observes every request's outcome (see apistats.go).
+	onResult atomic.Pointer[func(status int, err error)]
+	// logHTTP logs every request made through do (see apilog.go).
+	logHTTP bool
+
+	// bearer is replaced when the token is refreshed after a 401; reauth
+	// serializes refreshes so concurrent 401s trigger only one.
+	bearerMu sync.RWMutex
+	bearer   string
+	reauthMu sync.Mutex
+	reauth   func(ctx context.Context) (string, error)
+}
+
+// NewAPI constructs an API helper for the provided config.
+func NewAPI(cfg *Config) *API {
+	base := strings.TrimRight(cfg.ServerURL, "/")
+	a := &API{
+		baseURL:    base,
+		bearer:     cfg.BearerToken,
+		instanceID: cfg.InstanceID,
+		hostArch:   cfg.HostArch,
+		client:     httpClient,
+
+		compressSaves: cfg.CompressSaves,
+		saveDir:       cfg.SaveDir,
+
+		logHTTP: cfg.LogHTTP || verbose,
+	}
+	a.outbox = NewOutbox(a)
+	a.errors = &errorBatcher{send: a.sendClientErrors, now: time.Now}
+	a.breaker = newCircuitBreaker(cfg)
+	a.pingFromHeartbeat.Store(cfg.PingViaHeartbeat)
+	return a
+}
+
+// Outbox returns the queue holding reports the server has not yet accepted.
+func (a *API) Outbox() *Outbox {
+	return a.outbox
+}
+
+// Token returns the bearer token requests are currently sent with.
+func (a *API) Token() string {
+	a.bearerMu.RLock()
+	defer a.bearerMu.RUnlock()
+	return a.bearer
+}
+
+// SetToken replaces the bearer token sent with subsequent requests, e.g.
+// after registering.
+func (a *API) SetToken(token string) {
+	a.bearerMu.Lock()
+	a.bearer = token
+	a.bearerMu.Unlock()
+}
+
+// OnUnauthorized installs fn to obtain a new token when an authenticated
+// request is answered with 401. The request is then retried once.
+func (a *API) OnUnauthorized(fn func(ctx context.Context) (string, error)) {
+	a.reauthMu.Lock()
+	a.reauth = fn
+	a.reauthMu.Unlock()
+}
+
+// reauthKey marks requests sent with the API's own token, the only ones a
+// refresh can fix.
+type reauthKey struct{}
+
+type requestOptions struct {
+	skipAuth bool
+	token    string
+}
+
+func (a *API) newRequest(
+	ctx context.Context,
+	method, path string,
+	payload any,
+	opts ...requestOptions,
+) (*http.Request, error) {
+	var body io.Reader
+	compressed := false
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("marshal payload: %w", err)
+		}
+		if len(b) >= gzipRequestThreshold {
+			if b, err = gzipBytes(b); err != nil {
+				return nil, fmt.Errorf("compress payload: %w", err)
+			}
+			compressed = true
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, a.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("%s request error: %w", path, err)
+	}
+
+	// Apply options
+	var opt requestOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+
+	if !opt.skipAuth {
+		token := opt.token
+		if token == "" {
+			token = a.Token()
+			req = req.WithContext(context.WithValue(ctx, reauthKey{}, true))
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("User-Agent", userAgent())
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	return req, nil
+}
+
+func (a *API) do(req *http.Request) (resp *http.Response, rtt time.Duration, err error) {
+	if !a.breaker.allow() {
+		return nil, 0, ErrCircuitOpen
+	}
+	// Runs last, so the logged body is already decompressed.
+	if a.logHTTP {
+		defer func() { a.logExchange(req, resp, rtt, err) }()
+	}
+	defer func() {
+		if err == nil {
+			err = gunzipResponse(resp)
+		}
+	}()
+	defer func() {
+		a.breaker.record(resp, err)
+		if fn := a.onResult.Load(); fn != nil {
+			status := 0
+			if resp != nil {
+				status = resp.StatusCode
+			}
+			(*fn)(status, err)
+		}
+	}()
+
+	start := time.Now()
+	resp, err = a.client.Do(req)
+	rtt = time.Since(start)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || req.Context().Value(reauthKey{}) == nil {
+		return resp, rtt, err
+	}
+	// A body that cannot be read again would be resent empty.
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, rtt, err
+	}
+
+	token, rerr := a.refreshAfter401(req)
+	if rerr != nil {
+		log.Printf("Re-authentication failed: %v", rerr)
+		return resp, rtt, err
+	}
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, berr := req.GetBody()
+		if berr != nil {
+			return resp, rtt, err
+		}
+		retry.Body = body
+	}
+	retry.Header.Set("Authorization", "Bearer "+token)
+	resp.Body.Close()
+
+	start = time.Now()
+	resp, err = a.client.Do(retry)
+	return resp, time.Since(start), err
+}
+
+// refreshAfter401 obtains a fresh token for a request rejected with 401.
+// When another request already refreshed the token since req was built,
+// that token is reused instead of refreshing again.
+func (a *API) refreshAfter401(req *http.Request) (string, error) {
+	a.reauthMu.Lock()
+	defer a.reauthMu.Unlock()
+	if a.reauth == nil {
+		return "", errors.New("no re-authentication configured")
+	}
+	if current := a.Token(); current != "" && req.Header.Get("Authorization") != "Bearer "+current {
+		return current, nil
+	}
+	token, err := a.reauth(req.Context())
+	if err != nil {
+		return "", err
+	}
+	a.SetToken(token)
+	return token, nil
+}
+
+// readErrorBody safely reads the response body for inclusion in an error message.
+func readErrorBody(r io.Reader) string {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Sprintf("(failed to read body: %v)", err)
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// heartbeatTimeout caps one heartbeat independently of httpClient.
+const heartbeatTimeout = 8 * time.Second
+
+// ErrHeartbeatInFlight is returned when a heartbeat is skipped because the
+// previous one has not been answered yet.
+var ErrHeartbeatInFlight = errors.New("previous heartbeat still in flight")
+
+// Heartbeat posts a heartbeat carrying the extended snapshot and returns
+// measured ping (ms). It returns ErrHeartbeatInFlight without sending
+// while the previous heartbeat is unanswered.
+func (a *API) Heartbeat(
+	ctx context.Context,
+	state *ClientState,
+	payload SnapshotExtended,
+) (int, error) {
+	if !a.heartbeatBusy.CompareAndSwap(false, true) {
+		state.AddSkippedHeartbeat()
+		return 0, ErrHeartbeatInFlight
+	}
+	defer a.heartbeatBusy.Store(false)
+	ctx, cancel := context.WithTimeout(ctx, heartbeatTimeout)
+	defer cancel()
+
+	req, err := a.newRequest(ctx, http.MethodPost, "/api/heartbeat", payload)
+	if err != nil {
+		return 0, err
+	}
+	resp, rtt, err := a.do(req)
+	if err != nil {
+		return 0, fmt.Errorf("heartbeat send error: %w", err)
+	}
+	if resp == nil {
+		return 0, fmt.Errorf("nil heartbeat response")
+	}
+	defer resp.Body.Close()
+
+	newPing := int(rtt.Milliseconds())
+	if resp.StatusCode == http.StatusConflict {
+		if err := parseInstanceConflict(resp.Body); err != nil {
+			return newPing, err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return newPing, newAPIError("heartbeat", resp)
+	}
+
+	var body struct {
+		LogDirective
+		NextIntervalSeconds int `json:"next_interval_seconds"`
+		// Commands are low-priority commands delivered without Pusher.
+		// A retried heartbeat can repeat them; dispatch skips ids it has
+		// already run.
+		Commands []WSMessage `json:"commands"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err == nil {
+		body.LogDirective.apply()
+		a.nextHeartbeat.Store(int64(body.NextIntervalSeconds))
+		if fn := a.onCommands.Load(); fn != nil && len(body.Commands) > 0 {
+			(*fn)(body.Commands)
+		}
+	}
+
+	state.MarkHeartbeat()
+	state.RecordHeartbeatRTT(rtt)
+	if a.pingFromHeartbeat.Load() {
+		state.SetPing(newPing)
+	}
+	return newPing, nil
+}
+
+// OnCommands installs fn to run the commands a heartbeat response
+// carries. fn must not block the heartbeat.
+func (a *API) OnCommands(fn func([]WSMessage)) {
+	a.onCommands.Store(&fn)
+}
+
+// NextHeartbeatInterval returns the interval the server last asked for, or
+// 0 if it did not ask.
+func (a *API) NextHeartbeatInterval() time.Duration {
+	return time.Duration(a.nextHeartbeat.Load()) * time.Second
+}
+
+// Ready notifies the server that the client is ready.
+func (a *API) Ready(
+	ctx context.Context,
+	state *ClientState,
+	caps Capabilities,
+) error {
+	payload := map[string]any{
+		"capabilities":   caps,
+		"instance_id":    a.instanceID,
+		"os_arch":        a.hostArch,
+		"client_arch":    runtime.GOARCH,
+		"client_version": version,
+	}
+	since := state.Versions()
+	req, err := a.newRequest(ctx, http.MethodPost, "/api/ready", payload)
+	if err != nil {
+		return err
+	}
+	resp, _, err := a.do(req)
+	if err != nil {
+		return fmt.Errorf("ready send error: %w", err)
+	}
+	if resp == nil {
+		return fmt.Errorf("nil ready response")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		if err := parseInstanceConflict(resp.Body); err != nil {
+			warnInstanceConflict(err)
+			return err
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError("ready", resp)
+	}
+
+	if err := applySessionState(resp.Body, state, "ready", since); err != nil {
+		return err
+	}
+	state.SetReady(true)
+	return nil
+}
+
+// applySessionState decodes the server's view of the current game and
+// scheduled state and applies it to the local state, unless a local
+// update (a swap or state change event) superseded it after since.
+func applySessionState(r io.Reader, state *ClientState, endpoint string, since StateVersions) error {
+	var data struct {
+		GameFile     *string `json:"game_file"`
+		State        string  `json:"state"`
+		StateAt      int64   `json:"state_at"`
+		SaveTemplate string  `json:"save_template"`
+		Hardcore     *bool   `json:"hardcore"`
+	}
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return fmt.Errorf("decode %s response: %w", endpoint, err)
+	}
+
+	if data.SaveTemplate != "" {
+		if _, err := RenderSavePath(data.SaveTemplate, SaveMeta{Session: "s", Round: 1, Game: "g"}); err != nil {
+			log.Printf("Ignoring server save template: %v", err)
+		} else if data.SaveTemplate != state.GetSaveTemplate() {
+			log.Printf("Using server save template %q", data.SaveTemplate)
+			state.SetSaveTemplate(data.SaveTemplate)
+		}
+	}
+
+	if data.Hardcore != nil {
+		state.SetHardcore(*data.Hardcore)
+	}
+
+	game := ""
+	if data.GameFile != nil {
+		game = *data.GameFile
+	}
+	if !state.ApplyCurrentGameIfNewer(game, since) {
+		log.Printf("Ignoring %s game %q: a newer local change happened meanwhile", endpoint, game)
+	}
+	stateTime := time.Unix(data.StateAt, 0)
+	if !state.ApplyStateIfNewer(stateTime, data.State, since) {
+		log.Printf("Ignoring %s state %q: a newer local change happened meanwhile", endpoint, data.State)
+		return nil
+	}
+	log.Printf(
+		"Scheduled %s at %s (%d)",
+		data.State,
+		stateTime.Format(time.RFC3339),
+		data.StateAt,
+	)
+	return nil
+}
+
+// SessionState re-fetches the current game and scheduled state.
+func (a *API) SessionState(ctx context.Context, state *ClientState) error {
+	since := state.Versions()
+	req, err := a.newRequest(ctx, http.MethodGet, "/api/session-state", nil)
+	if err != nil {
+		return err
+	}
+	resp, _, err := a.do(req)
+	if err != nil {
+		return fmt.Errorf("session-state send error: %w", err)
+	}
+	if resp == nil {
+		return fmt.Errorf("nil session-state response")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError("session-state", resp)
+	}
+	return applySessionState(resp.Body, state, "session-state", since)
+}
+
+// ReportSkippedAction tells the server a scheduled action was too old to
+// execute on arrival and was replaced by a resync. Delivery goes through the
+// outbox.
+func (a *API) ReportSkippedAction(
+	ctx context.Context,
+	action string,
+	dueAt time.Time,
+	age time.Duration,
+) error {
+	payload := map[string]any{
+		"action":      action,
+		"due_at":      dueAt.Unix(),
+		"age_seconds": int64(age.Seconds()),
+	}
+	return a.outbox.Submit(ctx, ReportSkippedAction, "/api/skipped-action", payload)
+}
+
+// ReportRejectedGame tells the server a swap named a game outside the
+// session and was refused. Delivery goes through the outbox.
+func (a *API) ReportRejectedGame(ctx context.Context, game string, round int) error {
+	payload := map[string]any{
+		"game":         game,
+		"round_number": round,
+		"reason":       "not_in_session",
+	}
+	return a.outbox.Submit(ctx, ReportRejectedGame, "/api/rejected-game", payload)
+}
+
+// ReportStaleState tells the server a change_game_state event arrived
+// after a newer one and was ignored. Delivery goes through the outbox.
+func (a *API) ReportStaleState(ctx context.Context, state string, stateAt time.Time, seq int64, current StateOrder) error {
+	payload := map[string]any{
+		"state":            state,
+		"state_at":         stateAt.Unix(),
+		"seq":              seq,
+		"current_state_at": current.At.Unix(),
+		"current_seq":      current.Seq,
+	}
+	return a.outbox.Submit(ctx, ReportStaleState, "/api/stale-state", payload)
+}
+
+// ReportRoleRejected tells the server an event or role change was refused
+// because of the client's role. Delivery goes through the outbox.
+func (a *API) ReportRoleRejected(ctx context.Context, event, role, reason string) error {
+	payload := map[string]any{
+		"event":  event,
+		"role":   role,
+		"reason": reason,
+	}
+	return a.outbox.Submit(ctx, ReportRoleRejected, "/api/role-rejected", payload)
+}
+
+// SwapComplete notifies server that a swap finished. Delivery goes through
+// the outbox.
+func (a *API) SwapComplete(ctx context.Context, roundNumber int) error {
+	payload := map[string]any{"round_number": roundNumber}
+	return a.outbox.Submit(ctx, ReportSwapComplete, "/api/swap-complete", payload)
+}
+
+// SwapFailed tells the server the swap for roundNumber did not complete
+// and why, in place of swap-complete. Delivery goes through the outbox.
+func (a *API) SwapFailed(ctx context.Context, roundNumber int, reason string) error {
+	payload := map[string]any{"round_number": roundNumber, "reason": reason}
+	return a.outbox.Submit(ctx, ReportSwapFailed, "/api/swap-failed", payload)
+}
+
+// GameStarted tells the server which ROM BizHawk is actually running.
+// round is nil outside a swap. Delivery goes through the outbox.
+func (a *API) GameStarted(ctx context.Context, gameName string, round *int) error {
+	payload := map[string]any{"game_name": gameName}
+	if round != nil {
+		payload["round_number"] = *round
+	}
+	return a.outbox.Submit(ctx, ReportGameStarted, "/api/game-started", payload)
+}
+
+// GameStopped notifies server that the game stopped. Delivery goes through
+// the outbox.
+func (a *API) GameStopped(ctx context.Context) error {
+	return a.outbox.Submit(ctx, ReportGameStopped, "/api/game-stopped", nil)
+}
+
+// RegisterPlayer registers a player and returns bearer token + app key.
+func (a *API) RegisterPlayer(
+	ctx context.Context,
+	playerName string,
+) (string, string, error) {
+	payload := map[string]string{"name": playerName}
+	// Registration should not send an existing bearer token.
+	req, err := a.newRequest(
+		ctx,
+		http.MethodPost,
+		"/api/register-player",
+		payload,
+		requestOptions{skipAuth: true},
+	)
+	if err != nil {
+		return "", "", err
+	}
+
+	resp, _, err := a.do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("register send error: %w", err)
+	}
+	if resp == nil {
+		return "", "", fmt.Errorf("nil register response")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", newAPIError("register", resp)
+	}
+	var data struct {
+		BearerToken  string `json:"bearer_token"`
+		ReverbAppKey string `json:"reverb_app_key"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", "", fmt.Errorf("decode register response: %w", err)
+	}
+	return data.BearerToken, data.ReverbAppKey, nil
+}
+
+// RefreshToken exchanges the current bearer token for a new one and
+// returns it with the (possibly unchanged) Reverb app key.
+func (a *API) RefreshToken(ctx context.Context) (string, string, error) {
+	req, err := a.newRequest(
+		ctx,
+		http.MethodPost,
+		"/api/refresh-token",
+		nil,
+		requestOptions{token: a.Token()},
+	)
+	if err != nil {
+		return "", "", err
+	}
+
+	resp, _, err := a.do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("refresh-token send error: %w", err)
+	}
+	if resp == nil {
+		return "", "", fmt.Errorf("nil refresh-token response")
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", "", ErrEndpointUnsupported
+	default:
+		return "", "", newAPIError("refresh-token", resp)
+	}
+	var data struct {
+		BearerToken  string `json:"bearer_token"`
+		ReverbAppKey string `json:"reverb_app_key"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", "", fmt.Errorf("decode refresh-token response: %w", err)
+	}
+	if data.BearerToken == "" {
+		return "", "", fmt.Errorf("refresh-token response has no token")
+	}
+	return data.BearerToken, data.ReverbAppKey, nil
+}
+
+// CheckTokenExists validates a token.
+func (a *API) CheckTokenExists(ctx context.Context, token string) (bool, error) {
+	req, err := a.newRequest(
+		ctx,
+		http.MethodPost,
+		"/api/check-token",
+		nil,
+		requestOptions{token: token},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	resp, _, err := a.do(req)
+	if err != nil {
+		return false, fmt.Errorf("check-token send error: %w", err)
+	}
+	if resp == nil {
+		return false, fmt.Errorf("nil check-token response")
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, newAPIError("check-token", resp)
+	}
+}
+
+// CheckSessionExists reports whether the session exists and returns the
+// server's canonical form of its name (which may differ in case or
+// spacing from what the user typed).
+func (a *API) CheckSessionExists(
+	ctx context.Context,
+	sessionName string,
+) (string, bool, error) {
+	path := "/api/check-session/" + url.PathEscape(sessionName)
+	req, err := a.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return "", false, err
+	}
+	resp, _, err := a.do(req)
+	if err != nil {
+		return "", false, fmt.Errorf("check-session send error: %w", err)
+	}
+	if resp == nil {
+		return "", false, fmt.Errorf("nil check-session response")
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var data struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&data); err != nil || data.Name == "" {
+			return sessionName, true, nil
+		}
+		return data.Name, true, nil
+	case http.StatusNotFound:
+		return "", false, nil
+	default:
+		return "", false, newAPIError("check-session", resp)
+	}
+}
+
+// SessionInfo is an open session as listed by the server.
+type SessionInfo struct {
+	Name    string `json:"name"`
+	Players int    `json:"player_count"`
+	Status  string `json:"status"`
+}
+
+// ListSessions returns the sessions open for joining. It returns
+// ErrEndpointUnsupported if the server cannot list them.
+func (a *API) ListSessions(ctx context.Context) ([]SessionInfo, error) {
+	req, err := a.newRequest(ctx, http.MethodGet, "/api/sessions", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, _, err := a.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sessions send error: %w", err)
+	}
+	if resp == nil {
+		return nil, fmt.Errorf("nil sessions response")
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var data struct {
+			Sessions []SessionInfo `json:"sessions"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+			return nil, fmt.Errorf("decode sessions response: %w", err)
+		}
+		return data.Sessions, nil
+	case http.StatusNotFound:
+		return nil, ErrEndpointUnsupported
+	default:
+		return nil, newAPIError("sessions", resp)
+	}
+}
+
+// JoinSession joins a session and returns its game manifest.
+func (a *API) JoinSession(
+	ctx context.Context,
+	sessionName string,
+) (*SessionManifest, error) {
+	path := "/api/join-session/" + url.PathEscape(sessionName)
+	req, err := a.newRequest(ctx, http.MethodPost, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, _, err := a.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("join-session send error: %w", err)
+	}
+	if resp == nil {
+		return nil, fmt.Errorf("nil join-session response")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError("join-session", resp)
+	}
+	return decodeManifest(resp.Body, sessionName, "join-session")
+}
+
+// leaveSessionTimeout bounds the leave-session call at shutdown.
+const leaveSessionTimeout = 3 * time.Second
+
+// LeaveSession tells the server this player is leaving the session, so it
+// need not wait for heartbeats to time out.
+func (a *API) LeaveSession(ctx context.Context) error {
+	req, err := a.newRequest(ctx, http.MethodPost, "/api/leave-session", nil)
+	if err != nil {
+		return err
+	}
+	resp, _, err := a.do(req)
+	if err != nil {
+		return fmt.Errorf("leave-session send error: %w", err)
+	}
+	if resp == nil {
+		return fmt.Errorf("nil leave-session response")
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return ErrEndpointUnsupported
+	default:
+		return newAPIError("leave-session", resp)
+	}
+}
+
+func decodeManifest(r io.Reader, sessionName, endpoint string) (*SessionManifest, error) {
+	var session struct {
+		Games              []ManifestGame      `json:"games"`
+		RoundLengthSeconds int                 `json:"round_length_seconds"`
+		BizHawk            *BizHawkRequirement `json:"bizhawk"`
+	}
+	if err := json.NewDecoder(r).Decode(&session); err != nil {
+		return nil, fmt.Errorf("decode %s response: %w", endpoint, err)
+	}
+	return &SessionManifest{
+		SessionName:        sessionName,
+		Games:              session.Games,
+		RoundLengthSeconds: session.RoundLengthSeconds,
+		BizHawk:            session.BizHawk,
+	}, nil
+}
+
+// ErrEndpointUnsupported is returned when the server predates an endpoint.
+var ErrEndpointUnsupported = errors.New("endpoint not supported by server")
+
+// MySession returns the session the server has this player joined to, or
+// "" if none.
+func (a *API) MySession(ctx context.Context) (string, error) {
+	req, err := a.newRequest(ctx, http.MethodGet, "/api/my-session", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, _, err := a.do(req)
+	if err != nil {
+		return "", fmt.Errorf("my-session send error: %w", err)
+	}
+	if resp == nil {
+		return "", fmt.Errorf("nil my-session response")
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", ErrEndpointUnsupported
+	default:
+		return "", newAPIError("my-session", resp)
+	}
+	var data struct {
+		SessionName *string `json:"session_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", fmt.Errorf("decode my-session response: %w", err)
+	}
+	if data.SessionName == nil {
+		return "", nil
+	}
+	return *data.SessionName, nil
+}
+
+// SessionManifest fetches the game list without (re)joining the session.
+func (a *API) SessionManifest(
+	ctx context.Context,
+	sessionName string,
+) (*SessionManifest, error) {
+	path := "/api/session-manifest/" + url.PathEscape(sessionName)
+	req, err := a.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, _, err := a.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("session-manifest send error: %w", err)
+	}
+	if resp == nil {
+		return nil, fmt.Errorf("nil session-manifest response")
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrEndpointUnsupported
+	default:
+		return nil, newAPIError("session-manifest", resp)
+	}
+	return decodeManifest(resp.Body, sessionName, "session-manifest")
+}
+
+// ReadyCheckResponse answers a host-initiated ready check. Delivery goes
+// through the outbox.
+func (a *API) ReadyCheckResponse(
+	ctx context.Context,
+	checkID string,
+	confirmed bool,
+	latency time.Duration,
+) error {
+	payload := map[string]any{
+		"id":         checkID,
+		"confirmed":  confirmed,
+		"latency_ms": latency.Milliseconds(),
+	}
+	return a.outbox.Submit(ctx, ReportReadyCheck, "/api/ready-check-response", payload)
+}
@@ -0,0 +1,270 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rotatingServer accepts only its current token and records the token
+// each request was sent with, per path.
+type rotatingServer struct {
+	mu     sync.Mutex
+	token  string
+	tokens map[string][]string
+}
+
+func (s *rotatingServer) rotate(token string) {
+	s.mu.Lock()
+	s.token = token
+	s.mu.Unlock()
+}
+
+func (s *rotatingServer) sent(path string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens[path]
+}
+
+func (s *rotatingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	s.tokens[r.URL.Path] = append(s.tokens[r.URL.Path], got)
+	ok := got == s.token
+	s.mu.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	_, _ = w.Write([]byte("ok"))
+}
+
+func TestTokenChangeReachesLaterRequests(t *testing.T) {
+	rs := &rotatingServer{token: "first", tokens: map[string][]string{}}
+	srv := httptest.NewServer(rs)
+	defer srv.Close()
+	ctx := context.Background()
+
+	cfg := &Config{ServerURL: srv.URL, BearerToken: "first"}
+	a := NewAPI(cfg)
+	refreshes := 0
+	a.OnUnauthorized(func(ctx context.Context) (string, error) {
+		refreshes++
+		return "second", nil
+	})
+	downloads := NewDownloadManager(http.DefaultClient, NewClientState(), cfg)
+	downloads.UseToken(a.Token)
+	dest := t.TempDir()
+
+	if err := a.LeaveSession(ctx); err != nil {
+		t.Fatalf("LeaveSession with the first token: %v", err)
+	}
+
+	// The server revokes the token mid-run; the next request is refused
+	// once, refreshes the token and is retried with the new one.
+	rs.rotate("second")
+	if err := a.LeaveSession(ctx); err != nil {
+		t.Fatalf("LeaveSession after the rotation: %v", err)
+	}
+	if refreshes != 1 || a.Token() != "second" {
+		t.Fatalf("%d refreshes, token %q; want one refresh to %q", refreshes, a.Token(), "second")
+	}
+
+	// Later API calls, outbox reports and downloads carry the new token
+	// without another refresh.
+	if err := a.LeaveSession(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Outbox().Submit(ctx, ReportGameStarted, "/api/game-started", map[string]string{"game": "mario.nes"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := downloads.Fetch(DownloadUrgent, srv.URL+"/api/roms/mario.nes", filepath.Join(dest, "mario.nes")); err != nil {
+		t.Fatalf("download after the rotation: %v", err)
+	}
+	if refreshes != 1 {
+		t.Errorf("%d refreshes; later requests should reuse the new token", refreshes)
+	}
+	// The refused request is the second "first"; its retry and every
+	// later request use "second".
+	want := map[string][]string{
+		"/api/leave-session":  {"first", "first", "second", "second"},
+		"/api/game-started":   {"second"},
+		"/api/roms/mario.nes": {"second"},
+	}
+	for path, tokens := range want {
+		if got := rs.sent(path); strings.Join(got, ",") != strings.Join(tokens, ",") {
+			t.Errorf("%s sent with %v; want %v", path, got, tokens)
+		}
+	}
+
+	// Registration swaps the token in place too.
+	rs.rotate("registered")
+	a.SetToken("registered")
+	if err := a.LeaveSession(ctx); err != nil {
+		t.Fatalf("LeaveSession after SetToken: %v", err)
+	}
+	if refreshes != 1 {
+		t.Errorf("SetToken led to %d refreshes; want none", refreshes-1)
+	}
+}
+
+func TestSessionPathsEscaped(t *testing.T) {
+	var mu sync.Mutex
+	var uris []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		uris = append(uris, r.Method+" "+r.RequestURI)
+		mu.Unlock()
+		if strings.HasPrefix(r.URL.Path, "/api/check-session/") {
+			_, _ = w.Write([]byte(`{"name":"relay #1? 50%"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"games":[{"file":"mario.nes"}]}`))
+	}))
+	defer srv.Close()
+	a := NewAPI(&Config{ServerURL: srv.URL, BearerToken: "t"})
+	ctx := context.Background()
+
+	const name = "Relay #1? 50%"
+	canonical, ok, err := a.CheckSessionExists(ctx, name)
+	if err != nil || !ok || canonical != "relay #1? 50%" {
+		t.Errorf("CheckSessionExists = %q, %v, %v; want the server's name", canonical, ok, err)
+	}
+	if _, err := a.JoinSession(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.SessionManifest(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"GET /api/check-session/Relay%20%231%3F%2050%25",
+		"POST /api/join-session/Relay%20%231%3F%2050%25",
+		"GET /api/session-manifest/Relay%20%231%3F%2050%25",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(uris, want) {
+		t.Errorf("requests =\n%s\nwant\n%s", strings.Join(uris, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCheckSessionKeepsTypedNameWithoutCanonical(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/check-session/gone" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	a := NewAPI(&Config{ServerURL: srv.URL, BearerToken: "t"})
+
+	if name, ok, err := a.CheckSessionExists(context.Background(), "Relay"); name != "Relay" || !ok || err != nil {
+		t.Errorf("older server: CheckSessionExists = %q, %v, %v; want the typed name", name, ok, err)
+	}
+	if _, ok, err := a.CheckSessionExists(context.Background(), "gone"); ok || err != nil {
+		t.Errorf("missing session: ok = %v, err = %v", ok, err)
+	}
+}
+
+func TestRomURLEscaped(t *testing.T) {
+	got, err := romURL("https://example.com", "Zelda #3 (50% off?).sfc")
+	if want := "https://example.com/api/roms/Zelda%20%233%20%2850%25%20off%3F%29.sfc"; err != nil || got != want {
+		t.Errorf("romURL = %s, %v; want %s", got, err, want)
+	}
+	for _, bad := range []string{"", "..", "a/b.nes", `a\b.nes`} {
+		if _, err := romURL("https://example.com", bad); err == nil {
+			t.Errorf("romURL(%q) accepted", bad)
+		}
+	}
+}
+
+func TestAPIErrorStatuses(t *testing.T) {
+	retryAt := time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat)
+	tests := []struct {
+		status     int
+		body       string
+		retryAfter string
+		temporary  bool
+		wait       time.Duration // expected RetryAfter, to the second
+	}{
+		{http.StatusBadRequest, "session name required\n", "", false, 0},
+		{http.StatusUnauthorized, "", "", false, 0},
+		{http.StatusForbidden, "banned", "", false, 0},
+		{http.StatusNotFound, "no such session", "", false, 0},
+		{http.StatusConflict, "session full", "", false, 0},
+		{http.StatusTooManyRequests, "slow down", "7", true, 7 * time.Second},
+		{http.StatusInternalServerError, "boom", "", true, 0},
+		{http.StatusBadGateway, "", "", true, 0},
+		{http.StatusServiceUnavailable, "maintenance", retryAt, true, 90 * time.Second},
+		{http.StatusGatewayTimeout, "", "soon", true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.status), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+			a := NewAPI(&Config{ServerURL: srv.URL, BearerToken: "t"})
+
+			_, err := a.JoinSession(context.Background(), "relay")
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("JoinSession = %v; want an APIError", err)
+			}
+			status := fmt.Sprintf("%d %s", tt.status, http.StatusText(tt.status))
+			if apiErr.Endpoint != "join-session" || apiErr.StatusCode != tt.status || apiErr.Status != status {
+				t.Errorf("APIError = %+v", apiErr)
+			}
+			body := strings.TrimSpace(tt.body)
+			if apiErr.Body != body {
+				t.Errorf("Body = %q; want %q", apiErr.Body, body)
+			}
+			want := "join-session failed: " + status
+			if body != "" {
+				want += ": " + body
+			}
+			if err.Error() != want {
+				t.Errorf("Error() = %q; want %q", err, want)
+			}
+			if apiErr.Temporary() != tt.temporary {
+				t.Errorf("Temporary() = %v; want %v", apiErr.Temporary(), tt.temporary)
+			}
+			if (apiErr.RetryAfter - tt.wait).Abs() > time.Second {
+				t.Errorf("RetryAfter = %s; want %s", apiErr.RetryAfter, tt.wait)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := goldenTime
+	for v, want := range map[string]time.Duration{
+		"":   0,
+		"30": 30 * time.Second,
+		"0":  0,
+		"-5": 0,
+		now.Add(2 * time.Minute).Format(http.TimeFormat):  2 * time.Minute,
+		now.Add(-2 * time.Minute).Format(http.TimeFormat): 0,
+		"tomorrow": 0,
+	} {
+		if got := parseRetryAfter(v, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %s; want %s", v, got, want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// APIError is a non-success HTTP response from the server. Callers branch
+// on it with errors.As, e.g. re-registering on 401 but retrying on 5xx.
+type APIError struct {
+	Endpoint   string
+	StatusCode int
+	Status     string
+	Body       string
+	// RetryAfter is the server's Retry-After hint, or 0 if none.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("%s failed: %s", e.Endpoint, e.Status)
+	}
+	return fmt.Sprintf("%s failed: %s: %s", e.Endpoint, e.Status, e.Body)
+}
+
+// Temporary reports whether the request may succeed if retried later.
+func (e *APIError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// newAPIError builds an APIError from resp, consuming its body.
+func newAPIError(endpoint string, resp *http.Response) *APIError {
+	return &APIError{
+		Endpoint:   endpoint,
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       readErrorBody(resp.Body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// parseRetryAfter accepts both forms of Retry-After: delay seconds or an
+// HTTP date.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// httpLogBodyMax is how much of a response body HTTP logging shows.
+const httpLogBodyMax = 512
+
+const redacted = "[REDACTED]"
+
+var (
+	// tokenFieldRe also matches a value cut off before its closing quote.
+	tokenFieldRe  = regexp.MustCompile(`("(?:bearer_token|token|access_token)"\s*:\s*)"[^"]*"?`)
+	bearerValueRe = regexp.MustCompile(`(?i)(bearer\s+)[^\s"',]+`)
+)
+
+// logExchange logs one request made through do: method, path, status,
+// latency and the start of the response body. The Authorization header
+// is never logged, and tokens in the body or error are redacted. The body
+// is peeked and put back for the caller.
+func (a *API) logExchange(req *http.Request, resp *http.Response, rtt time.Duration, err error) {
+	secrets := []string{a.Token(), strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")}
+	rtt = rtt.Round(time.Millisecond)
+	if err != nil {
+		log.Printf("[HTTP] %s %s failed after %s: %s", req.Method, req.URL.Path, rtt, redactSecrets(err.Error(), secrets...))
+		return
+	}
+	head, _ := io.ReadAll(io.LimitReader(resp.Body, httpLogBodyMax+1))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+	// Redact before truncating, so a token cut off at the end still
+	// matches.
+	body := redactSecrets(string(head), secrets...)
+	if len(head) > httpLogBodyMax {
+		body = body[:min(len(body), httpLogBodyMax)] + "..."
+	}
+	log.Printf("[HTTP] %s %s -> %d in %s: %s", req.Method, req.URL.Path, resp.StatusCode, rtt, body)
+}
+
+// redactSecrets masks token fields, Bearer credentials and the given
+// secrets wherever they appear in s.
+func redactSecrets(s string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, redacted)
+		}
+	}
+	s = tokenFieldRe.ReplaceAllString(s, `$1"`+redacted+`"`)
+	return bearerValueRe.ReplaceAllString(s, "${1}"+redacted)
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testToken = "tok-7f3a9c2e51"
+
+func TestRedactSecrets(t *testing.T) {
+	tests := []struct {
+		name, in string
+	}{
+		{"token field", `{"bearer_token":"` + testToken + `"}`},
+		{"spaced field", `{"bearer_token" : "` + testToken + `"}`},
+		{"other field names", `{"token":"` + testToken + `","access_token":"` + testToken + `"}`},
+		{"field cut off", `{"player":"p","bearer_token":"` + testToken[:6]},
+		{"bearer credential", `Authorization: Bearer ` + testToken},
+		{"lower-case bearer", `auth=bearer ` + testToken + `, next`},
+		{"bare secret", `your key is ` + testToken + ` keep it`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := redactSecrets(tt.in, testToken)
+			if strings.Contains(got, testToken[:6]) {
+				t.Errorf("redactSecrets(%q) = %q, still has the token", tt.in, got)
+			}
+			if !strings.Contains(got, redacted) {
+				t.Errorf("redactSecrets(%q) = %q, nothing marked redacted", tt.in, got)
+			}
+		})
+	}
+	if got := redactSecrets(`{"player":"p"}`, testToken); got != `{"player":"p"}` {
+		t.Errorf("redactSecrets changed a body without secrets: %q", got)
+	}
+}
+
+// captureLog collects log output for the duration of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	out, flags := log.Writer(), log.Flags()
+	log.SetOutput(&buf)
+	t.Cleanup(func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+	})
+	return &buf
+}
+
+func TestLogExchangeNeverLogsTokens(t *testing.T) {
+	// In "straddling" the truncation limit cuts the token after 8 bytes.
+	pad := strings.Repeat("x", httpLogBodyMax-len(`{"pad":"`)-len(`","bearer_token":"`)-8)
+	tests := []struct {
+		name string
+		body func(r *http.Request) string
+	}{
+		{"token field", func(*http.Request) string { return `{"bearer_token":"` + testToken + `"}` }},
+		{"echoed header", func(r *http.Request) string { return `{"seen":"` + r.Header.Get("Authorization") + `"}` }},
+		{"bare token", func(*http.Request) string { return "registered " + testToken }},
+		{"straddling", func(*http.Request) string { return `{"pad":"` + pad + `","bearer_token":"` + testToken + `"}` }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sent = tt.body(r)
+				io.WriteString(w, sent)
+			}))
+			defer srv.Close()
+			logs := captureLog(t)
+
+			a := NewAPI(&Config{ServerURL: srv.URL, BearerToken: testToken, LogHTTP: true})
+			req, err := a.newRequest(context.Background(), http.MethodGet, "/api/check", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, _, err := a.do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if string(got) != sent {
+				t.Errorf("caller read %q, want the whole body %q", got, sent)
+			}
+			if !strings.Contains(logs.String(), "[HTTP] GET /api/check -> 200") {
+				t.Errorf("no request line logged: %s", logs)
+			}
+			if strings.Contains(logs.String(), testToken[:6]) {
+				t.Errorf("token in log: %s", logs)
+			}
+		})
+	}
+}
+
+func TestLogExchangeRedactsErrors(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	logs := captureLog(t)
+
+	a := NewAPI(&Config{ServerURL: srv.URL, BearerToken: testToken, LogHTTP: true})
+	req, err := a.newRequest(context.Background(), http.MethodGet, "/api/check?token="+testToken, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := a.do(req); err == nil {
+		t.Fatal("request to a closed server succeeded")
+	}
+	if !strings.Contains(logs.String(), "[HTTP] GET /api/check failed") {
+		t.Errorf("failure not logged: %s", logs)
+	}
+	if strings.Contains(logs.String(), testToken) {
+		t.Errorf("token in log: %s", logs)
+	}
+}
+
+func TestLogExchangeOff(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "{}")
+	}))
+	defer srv.Close()
+	logs := captureLog(t)
+
+	a := NewAPI(&Config{ServerURL: srv.URL})
+	req, _ := a.newRequest(context.Background(), http.MethodGet, "/api/check", nil)
+	resp, _, err := a.do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if logs.Len() != 0 {
+		t.Errorf("logged with log_http off: %s", logs)
+	}
+}
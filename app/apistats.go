@@ -0,0 +1,75 @@
+package app
+
+import (
+	"net/http"
+	"time"
+)
+
+// heartbeatRTTSamples is how many recent heartbeat round trips the
+// average in APIStats covers.
+const heartbeatRTTSamples = 10
+
+// APIStats counts this run's server calls for runtime_state.json, for
+// working out after the fact what the connection was like.
+type APIStats struct {
+	Calls      int64 `json:"calls"`
+	Failures   int64 `json:"failures"`
+	LastStatus int   `json:"last_status,omitempty"`
+	// HeartbeatRTTMS averages the last heartbeatRTTSamples heartbeats.
+	HeartbeatRTTMS int64 `json:"heartbeat_rtt_ms,omitempty"`
+}
+
+// apiCounters is the ClientState side of APIStats.
+type apiCounters struct {
+	calls      int64
+	failures   int64
+	lastStatus int
+	rtts       []time.Duration
+}
+
+// RecordAPICall counts one API request. A transport error or a status of
+// 400 or more is a failure.
+func (s *ClientState) RecordAPICall(status int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.api.calls++
+	if status != 0 {
+		s.api.lastStatus = status
+	}
+	if err != nil || status >= http.StatusBadRequest {
+		s.api.failures++
+	}
+}
+
+// RecordHeartbeatRTT adds an answered heartbeat's round trip to the
+// rolling average.
+func (s *ClientState) RecordHeartbeatRTT(rtt time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.api.rtts = append(s.api.rtts, rtt)
+	if len(s.api.rtts) > heartbeatRTTSamples {
+		s.api.rtts = s.api.rtts[1:]
+	}
+}
+
+func (s *ClientState) apiStatsLocked() APIStats {
+	st := APIStats{
+		Calls:      s.api.calls,
+		Failures:   s.api.failures,
+		LastStatus: s.api.lastStatus,
+	}
+	if n := len(s.api.rtts); n > 0 {
+		var sum time.Duration
+		for _, d := range s.api.rtts {
+			sum += d
+		}
+		st.HeartbeatRTTMS = (sum / time.Duration(n)).Milliseconds()
+	}
+	return st
+}
+
+// OnResult installs fn to observe the outcome of every API request; status
+// is 0 when no response arrived.
+func (a *API) OnResult(fn func(status int, err error)) {
+	a.onResult.Store(&fn)
+}
@@ -0,0 +1,712 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// App encapsulates all the components of the application.
+type App struct {
+	cfg      *Config
+	state    *ClientState
+	api      *API
+	ipc      *BizhawkIPC
+	handlers *Handlers
+	status   *StatusServer
+	logFile  *os.File
+
+	// pusher is set once the handlers are wired up; a token refresh can
+	// read it from any goroutine before then.
+	pusher atomic.Pointer[PusherClient]
+
+	// bizhawk is nil while a spectator has BizHawk closed; bizhawkLaunch
+	// counts the launches, telling a relaunched emulator from the last.
+	emulator      EmulatorBackend
+	bizhawkMu     sync.Mutex
+	bizhawk       Emulator
+	bizhawkLaunch int
+
+	conflictWarned atomic.Bool
+	// heartbeatHold is when (unix nanoseconds) heartbeats may resume
+	// after the server rate-limited them.
+	heartbeatHold atomic.Int64
+	bizhawkPID    atomic.Int64
+	disk          atomic.Pointer[DiskStatus]
+	recoveries    chan recoveryRequest
+
+	// control is set once Run has wired up the parts it drives.
+	control atomic.Pointer[Control]
+	ready   chan struct{}
+
+	running  atomic.Bool
+	quit     chan struct{}
+	quitOnce sync.Once
+	done     chan struct{}
+
+	started    time.Time
+	stop       context.CancelFunc
+	exitMu     sync.Mutex
+	exitCause  ExitCause
+	exitDetail string
+}
+
+// recordExit remembers the first termination cause; later causes (such as
+// the interrupt triggered by our own stop) do not overwrite it.
+func (a *App) recordExit(cause ExitCause, detail string) {
+	a.exitMu.Lock()
+	defer a.exitMu.Unlock()
+	if a.exitCause == CauseNone {
+		a.exitCause = cause
+		a.exitDetail = detail
+	}
+}
+
+// terminate records the cause and optionally triggers shutdown.
+func (a *App) terminate(cause ExitCause, detail string, stop bool) {
+	a.recordExit(cause, detail)
+	if stop && a.stop != nil {
+		a.stop()
+	}
+}
+
+// ExitStatus summarizes how the app terminated given Run's error.
+func (a *App) ExitStatus(runErr error) ExitStatus {
+	a.exitMu.Lock()
+	cause, detail := a.exitCause, a.exitDetail
+	a.exitMu.Unlock()
+	if runErr != nil {
+		cause, detail = causeOf(runErr), runErr.Error()
+	}
+	rounds := 0
+	if a.handlers != nil {
+		rounds = a.handlers.RoundsPlayed()
+	}
+	status := newExitStatus(cause, detail, a.cfg.SessionName, rounds, a.started)
+	status.PlaytimeSeconds = playtimeSeconds(a.state.Playtime())
+	return status
+}
+
+// New prepares a client for cfg; Run starts it. See Options for how the
+// client can be embedded in another program.
+func New(cfg *Config, opts Options) (*App, error) {
+	if opts.StateDir != "" {
+		if err := os.MkdirAll(opts.StateDir, 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.Chdir(opts.StateDir); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Logger != nil {
+		log.SetOutput(opts.Logger.Writer())
+		log.SetFlags(opts.Logger.Flags())
+		log.SetPrefix(opts.Logger.Prefix())
+	}
+	emulator := opts.EmulatorBackend
+	if emulator == nil {
+		emulator = bizhawkBackend{}
+	}
+
+	app := &App{
+		cfg:        cfg,
+		emulator:   emulator,
+		started:    time.Now(),
+		recoveries: make(chan recoveryRequest, 1),
+		ready:      make(chan struct{}),
+		quit:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	messages = NewMessageCatalog(cfg.Messages)
+
+	if err := configureTLS(cfg); err != nil {
+		return nil, err
+	}
+	if err := configureProxy(cfg); err != nil {
+		return nil, err
+	}
+	configureIPCTimings(cfg)
+
+	var err error
+	cfg.InstanceID, err = LoadOrCreateInstanceID()
+	if err != nil {
+		log.Printf("Instance ID unavailable: %v", err)
+	}
+
+	if cfg.StatusPort > 0 && cfg.ControlToken == "" {
+		if cfg.ControlToken, err = newUUID(); err != nil {
+			log.Printf("Control token unavailable; status page controls disabled: %v", err)
+		}
+	}
+
+	cfg.HostArch = HostArch()
+	log.Printf("Host architecture: %s (client built for %s)", cfg.HostArch, runtime.GOARCH)
+
+	app.state = NewClientState()
+	app.state.StartGraceWindows(startupGrace(cfg), swapGrace(cfg))
+	if err := app.state.LoadFromFile("runtime_state.json"); err == nil {
+		log.Println("Loaded runtime state")
+	} else {
+		log.Printf("No previous runtime state: %v", err)
+	}
+
+	return app, nil
+}
+
+// bootstrap runs Bootstrap, answering its questions through the web UI
+// when there is no console.
+func (a *App) bootstrap(ctx context.Context) (*StartupReport, error) {
+	if !hidden {
+		return Bootstrap(ctx, a.cfg, a.state, a.api, a.installsBizHawk())
+	}
+	wp := newWebPrompter(a.cfg.ControlToken)
+	prompter = wp
+	formCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		addr := statusAddr(a.cfg)
+		if err := servePrompts(formCtx, wp, addr); err != nil {
+			log.Printf("Setup form unavailable: %v", err)
+		}
+	}()
+	defer func() {
+		// Free the port for the status server.
+		cancel()
+		<-done
+	}()
+	return Bootstrap(ctx, a.cfg, a.state, a.api, a.installsBizHawk())
+}
+
+// installsBizHawk reports whether the client launches BizHawk itself, and
+// so has to install it, rather than an embedder's emulator backend.
+func (a *App) installsBizHawk() bool {
+	_, ok := a.emulator.(bizhawkBackend)
+	return ok
+}
+
+// Run starts the client and blocks until ctx is cancelled, Shutdown is
+// called or the session ends it, then shuts the client down. It may only
+// be called once.
+func (a *App) Run(ctx context.Context) (err error) {
+	if !a.running.CompareAndSwap(false, true) {
+		return errors.New("client already run")
+	}
+	defer close(a.done)
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	a.stop = stop
+	go func() {
+		select {
+		case <-a.quit:
+			stop()
+		case <-ctx.Done():
+		}
+	}()
+
+	// One API for the whole run: Bootstrap's registration and later token
+	// refreshes update its token in place.
+	a.api = NewAPI(a.cfg)
+	a.api.OnCircuitChange(a.circuitChanged)
+	a.api.OnResult(a.state.RecordAPICall)
+
+	startup, err := a.bootstrap(ctx)
+	if err != nil && ctx.Err() != nil {
+		return withCause(CauseInterrupted, fmt.Errorf("%w: %v", ErrStartupCancelled, err))
+	}
+	if err != nil {
+		return withCause(CauseBootstrapError, fmt.Errorf("bootstrap failed: %w", err))
+	}
+
+	// From here on goroutines run and BizHawk may be up, so a failed
+	// startup is cleaned up like an interrupt.
+	defer func() {
+		if err != nil {
+			log.Printf("Startup failed: %v", err)
+			stop()
+			a.shutdown()
+		}
+	}()
+
+	a.api.OnUnauthorized(a.reauthenticate)
+	a.api.Outbox().Restore(a.state.GetPendingReports())
+	goSafe("outbox", func() { a.api.Outbox().Run(ctx) })
+
+	// Swap and state times arrive on the server clock; measure how far
+	// ours is off before any are scheduled.
+	syncCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	if sample, err := a.api.TimeSync(syncCtx); err != nil {
+		log.Printf("Clock sync failed, using the local clock: %v", err)
+	} else {
+		a.state.SetClockOffset(sample.Offset)
+		debugf("Clock offset %s, rtt %s", sample.Offset, sample.RTT)
+	}
+	cancel()
+
+	// Start IPC listener for BizHawk Lua (now requires state for SYNC)
+	a.ipc = NewBizhawkIPC(a.cfg.BizhawkIPCHost, a.cfg.BizhawkIPCPort, a.state)
+	a.ipc.SetScriptPath(a.cfg.LuaScript)
+	a.ipc.OnEscalation(func(cmd, reason string, retryErr error) {
+		msg := fmt.Sprintf("%s NACKed %d times (%s); script reloaded", cmd, nackEscalateAfter, reason)
+		if retryErr != nil {
+			msg += fmt.Sprintf("; retry failed: %v", retryErr)
+		}
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if err := a.api.ReportError(ctx, ErrorIPC, msg); err != nil {
+			log.Printf("client-error report error: %v", err)
+		}
+	})
+	goSafe("ipc", func() {
+		if err := a.ipc.Listen(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("IPC listener exited with error: %v", err)
+		}
+	})
+
+	// Handlers and Pusher
+	a.handlers = NewHandlers(HandlerDeps{
+		API:          a.api,
+		Reports:      a.api,
+		Clock:        a.api,
+		IPC:          a.ipc,
+		Config:       a.cfg,
+		State:        a.state,
+		ManifestPath: manifestFile,
+		HTTPClient:   downloadClient,
+		GameMetadata: a.api.GameMetadata,
+	})
+	if a.handlers.saves != nil {
+		a.api.SetSaveCipher(a.handlers.saves)
+	}
+	a.ipc.SetLocalNames(a.handlers.emulatorFile)
+	a.control.Store(newControl(a.state, a.ipc, a.handlers.Downloads()))
+	a.handlers.Downloads().UseToken(a.api.Token)
+	a.handlers.exit = a.terminate
+	a.handlers.recover = a.requestRecovery
+	a.handlers.closeEmulator = a.closeBizHawk
+	a.handlers.launchEmulator = a.reopenBizHawk
+	a.api.OnCommands(func(cmds []WSMessage) {
+		goSafe("heartbeat commands", func() {
+			for _, msg := range cmds {
+				a.handlers.dispatch(msg)
+			}
+		})
+	})
+	goSafe("disconnect watch", func() { watchDisconnects(a.state, a.handlers.notify, disconnectNotifyWait, ctx.Done()) })
+	goSafe("disk space", func() { a.watchDiskSpace(ctx) })
+	goSafe("hardcore", func() { a.ipc.followHardcore(ctx) })
+	goSafe("state schedule", func() { trackStateSchedule(a.state, a.handlers.Schedule(), ctx.Done()) })
+	goSafe("schedule publish", func() { a.ipc.PublishSchedule(ctx, a.handlers.Schedule()) })
+	if a.cfg.StatusPort > 0 {
+		a.status = NewStatusServer(a.cfg, a.state, a.ipc, a.handlers.Downloads(), a.Snapshot)
+		if hidden {
+			url := "http://" + statusAddr(a.cfg) + "/"
+			if err := writeHiddenAccess(url, a.cfg.ControlToken); err != nil {
+				log.Printf("Could not write %s: %v", hiddenAccessFile, err)
+			}
+		}
+		goSafe("status server", func() {
+			if err := a.status.Run(ctx); err != nil {
+				log.Printf("Status server exited with error: %v", err)
+			}
+		})
+	}
+	pusher := NewPusherClient(a.cfg, a.state, a.handlers)
+	a.pusher.Store(pusher)
+	goSafe("pusher", func() {
+		if err := pusher.ConnectAndListen(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Pusher client exited with error: %v", err)
+			a.terminate(CauseServerError, fmt.Sprintf("pusher: %v", err), true)
+		}
+	})
+
+	// The heartbeat, ping and watchdog loops read the handlers and status
+	// server, so they start only once those are wired up.
+	goSafe("heartbeat loop", func() { a.startHeartbeatLoop(ctx) })
+	goSafe("ping loop", func() { a.startPingLoop(ctx) })
+	goSafe("watchdog", func() { a.startWatchdog(ctx) })
+
+	// Launch BizHawk
+	if err := a.reopenBizHawk(); err != nil {
+		return withCause(CauseBizHawkCrashed, fmt.Errorf("failed to launch BizHawk: %w", err))
+	}
+
+	// Notify server we are ready
+	if err := waitForServer(ctx, a.api); err != nil {
+		return withCause(CauseServerError, err)
+	}
+	if err := a.api.Ready(ctx, a.state, a.capabilities()); err != nil {
+		return withCause(CauseServerError, fmt.Errorf("ready error: %w", err))
+	}
+	a.ipc.SendSync()
+	close(a.ready)
+	if err := a.api.ReportStartupWarnings(ctx, startup); err != nil {
+		log.Printf("startup-warnings report error: %v", err)
+	}
+	a.ipc.OnCapabilitiesChanged(func([]string) {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		if err := a.api.UpdateCapabilities(ctx, a.capabilities()); err != nil {
+			log.Printf("capabilities update error: %v", err)
+		}
+	})
+
+	goSafe("recoveries", func() { a.runRecoveries(ctx) })
+	goSafe("command poll", func() { a.pollCommands(ctx) })
+
+	a.ipc.SendText(MsgWelcome, nil)
+
+	<-ctx.Done()
+	a.recordExit(CauseInterrupted, "")
+	a.shutdown()
+	return nil
+}
+
+// Snapshot returns the consolidated extended view of the running client.
+func (a *App) Snapshot() SnapshotExtended {
+	src := SnapshotSources{
+		State:  a.state,
+		Config: a.cfg,
+		BizHawkPID: func() int {
+			return int(a.bizhawkPID.Load())
+		},
+		Disk: a.disk.Load,
+	}
+	// The other parts are only complete once Run has wired them up.
+	if a.control.Load() != nil {
+		src.IPC = a.ipc
+		src.Outbox = a.api.Outbox()
+		src.Rounds = a.handlers.RoundsPlayed
+		src.Schedule = a.handlers.Schedule()
+		src.GameMeta = a.handlers.GameMeta()
+	}
+	return BuildSnapshotExtended(src)
+}
+
+func (a *App) capabilities() Capabilities {
+	return BuildCapabilities(a.handlers.registry, a.ipc.Capabilities(), a.cfg)
+}
+
+// shutdown leaves the session, stops BizHawk and saves what the next run
+// needs.
+func (a *App) shutdown() {
+	log.Println("Shutdown requested...")
+
+	// Close IPC first so no command races BizHawk going away.
+	if a.ipc != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), ipcCloseGrace)
+		if err := a.ipc.Close(ctx); err != nil {
+			log.Printf("IPC shutdown incomplete: %v", err)
+		}
+		cancel()
+	}
+
+	a.bizhawkMu.Lock()
+	emu := a.bizhawk
+	a.bizhawkMu.Unlock()
+	if emu != nil {
+		log.Println("Terminating BizHawk process...")
+		if err := emu.Kill(); err != nil {
+			log.Printf("Failed to terminate BizHawk process: %v", err)
+		} else {
+			log.Println("BizHawk process terminated.")
+		}
+	}
+
+	if a.api != nil && a.cfg.SessionName != "" && !a.state.SessionEnded() {
+		ctx, cancel := context.WithTimeout(context.Background(), leaveSessionTimeout)
+		if err := a.api.LeaveSession(ctx); err != nil {
+			log.Printf("leave-session error: %v", err)
+		} else {
+			log.Println("Left session.")
+		}
+		cancel()
+	}
+
+	if a.handlers != nil {
+		a.handlers.Shutdown()
+	}
+
+	rounds := 0
+	if a.handlers != nil {
+		rounds = a.handlers.RoundsPlayed()
+	}
+	sendUsageReport(a.cfg, buildUsageReport(a.cfg.TelemetryID, time.Since(a.started), rounds))
+
+	if a.api != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), outboxFlushGrace)
+		if err := a.api.FlushErrors(ctx); err != nil {
+			log.Printf("client-error report error: %v", err)
+		}
+		a.api.Outbox().Flush(ctx)
+		cancel()
+		a.state.SetPendingReports(a.api.Outbox().Durable())
+	}
+
+	log.Println("Saving runtime state...")
+	if err := a.state.SaveToFile("runtime_state.json"); err != nil {
+		log.Printf("Failed to save runtime state: %v", err)
+	} else {
+		log.Println("Runtime state saved.")
+	}
+
+	log.Println("Client exiting.")
+	if a.logFile != nil {
+		_ = a.logFile.Close()
+	}
+	time.Sleep(200 * time.Millisecond) // Allow logs to flush
+}
+
+const (
+	defaultHeartbeatInterval = 10 * time.Second
+	minHeartbeatInterval     = 5 * time.Second
+	maxHeartbeatInterval     = 5 * time.Minute
+)
+
+// heartbeatInterval is the interval the server last asked for, else the
+// configured one, clamped to a sane range.
+func (a *App) heartbeatInterval() time.Duration {
+	d := time.Duration(a.cfg.HeartbeatSeconds) * time.Second
+	if d <= 0 {
+		d = defaultHeartbeatInterval
+	}
+	if a.api != nil {
+		if next := a.api.NextHeartbeatInterval(); next > 0 {
+			d = next
+		}
+	}
+	return min(max(d, minHeartbeatInterval), maxHeartbeatInterval)
+}
+
+// jitterAround spreads d by ±20% so clients started together drift apart.
+func jitterAround(d time.Duration) time.Duration {
+	return d - d/5 + jitter(2*d/5)
+}
+
+func (a *App) startHeartbeatLoop(ctx context.Context) {
+	timer := time.NewTimer(jitterAround(a.heartbeatInterval()))
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			// Heartbeats run off the timer so a slow one cannot delay
+			// the next tick; Heartbeat itself skips overlapping calls.
+			if time.Now().UnixNano() < a.heartbeatHold.Load() {
+				debugf("Heartbeat skipped: rate-limited by the server")
+			} else {
+				goSafe("heartbeat", func() { a.heartbeat(ctx) })
+			}
+			timer.Reset(jitterAround(a.heartbeatInterval()))
+		}
+	}
+}
+
+func (a *App) heartbeat(ctx context.Context) {
+	_, err := a.api.Heartbeat(ctx, a.state, a.Snapshot())
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests:
+		// Retrying on the next tick would only prolong the penalty, so
+		// hold off for the server's window and warn once for all of it.
+		wait := max(apiErr.RetryAfter, a.heartbeatInterval())
+		a.heartbeatHold.Store(time.Now().Add(wait).UnixNano())
+		log.Printf("WARNING: heartbeats rate-limited by the server; pausing them for %s", wait.Round(time.Second))
+	case errors.Is(err, ErrHeartbeatInFlight):
+		log.Println("Heartbeat skipped: previous one still pending")
+	case errors.Is(err, ErrCircuitOpen):
+		// Logged once when the circuit opened.
+		debugf("Heartbeat held back: %v", err)
+	case errors.Is(err, ErrInstanceConflict):
+		if a.conflictWarned.CompareAndSwap(false, true) {
+			warnInstanceConflict(err)
+			a.ipc.SendText(MsgTokenInUse, nil)
+			if a.handlers != nil {
+				a.handlers.notify.Notify(NotifyInstanceClash, messages.Render(MsgNotifyTokenInUse, nil), err.Error())
+			}
+		}
+	case err != nil:
+		log.Printf("Heartbeat error: %v", err)
+		a.state.SetLastError("heartbeat", err)
+	default:
+		a.conflictWarned.Store(false)
+		a.state.SetPendingReports(a.api.Outbox().Durable())
+		if err := a.state.SaveToFile("runtime_state.json"); err != nil {
+			log.Printf("Runtime state save failed: %v", err)
+		}
+	}
+}
+
+// reauthenticate replaces a bearer token the server rejected: it asks the
+// server to refresh it and, failing that, registers the saved player name
+// again. The new token is saved and the websocket reconnects with it.
+func (a *App) reauthenticate(ctx context.Context) (string, error) {
+	token, appKey, err := a.api.RefreshToken(ctx)
+	if err != nil {
+		log.Printf("Token refresh failed, re-registering as %s: %v", a.cfg.PlayerName, err)
+		a.cfg.BearerToken, a.cfg.AppKey = "", ""
+		if err := ensurePlayerRegistered(ctx, a.cfg, a.api, false); err != nil {
+			return "", err
+		}
+		token = a.cfg.BearerToken
+	} else {
+		a.cfg.BearerToken = token
+		if appKey != "" {
+			a.cfg.AppKey = appKey
+		}
+	}
+	log.Println("Bearer token renewed")
+	if err := SaveConfig(a.cfg, "config.json"); err != nil {
+		log.Printf("Config save failed: %v", err)
+	}
+	if p := a.pusher.Load(); p != nil {
+		p.Reconnect()
+	}
+	return token, nil
+}
+
+func (a *App) startWatchdog(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	escalated := false
+	lost := false // marked disconnected here, so a restore is a reconnect
+	// restartDown records that the server went quiet during an announced
+	// restart, so fresh heartbeats mean it is back early.
+	restartDown := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			snap := a.state.Snapshot()
+			// A rate-limited server is still reachable; only count the
+			// silence from when heartbeats may resume.
+			last := snap.LastHeartbeat
+			if hold := time.Unix(0, a.heartbeatHold.Load()); hold.After(last) {
+				last = hold
+			}
+			silent := time.Since(last)
+			interval := a.heartbeatInterval()
+			if silent > interval*3/2 {
+				if g := a.state.Grace(); g != nil {
+					restartDown = restartDown || g.Window == GraceServerRestart
+					debugf("No recent heartbeat; %s grace until %s", g.Window, g.Until.Format(time.TimeOnly))
+					continue
+				}
+				if snap.Connected {
+					log.Println("No recent heartbeat; marking disconnected")
+					a.state.SetConnected(false)
+					lost = true
+				}
+				// A long outage gets the same recovery as waking from sleep.
+				if silent > max(time.Minute, 4*interval) && !escalated && !snap.LastHeartbeat.IsZero() {
+					escalated = true
+					a.requestRecovery(TriggerWatchdog, silent)
+				}
+			} else {
+				escalated = false
+				if restartDown {
+					restartDown = false
+					if a.state.EndServerRestartGrace() {
+						log.Println("Server back before the announced restart window ended")
+						a.requestRecovery(TriggerServerRestart, 0)
+					}
+				}
+				if !snap.Connected && !a.api.CircuitOpen() {
+					log.Println("Heartbeat restored; marking connected")
+					if lost {
+						usage.reconnects.Add(1)
+						lost = false
+					}
+					a.state.SetConnected(true)
+				}
+			}
+		}
+	}
+}
+
+// circuitChanged drives the connected flag from the API circuit breaker:
+// tripping marks the client disconnected, and only a successful probe
+// marks it connected again.
+func (a *App) circuitChanged(from, to string) {
+	a.state.ReportCircuit(from, to)
+	switch {
+	case to == CircuitOpen && from == CircuitClosed:
+		a.state.SetConnected(false)
+	case to == CircuitClosed:
+		log.Println("Server reachable again; marking connected")
+		a.state.SetConnected(true)
+	}
+}
+
+// reopenBizHawk launches BizHawk unless it is already running.
+func (a *App) reopenBizHawk() error {
+	a.bizhawkMu.Lock()
+	defer a.bizhawkMu.Unlock()
+	if a.bizhawk != nil {
+		return nil
+	}
+	emu, err := a.emulator.Start(a.cfg)
+	if err != nil {
+		return err
+	}
+	a.bizhawk = emu
+	a.bizhawkLaunch++
+	launch := a.bizhawkLaunch
+	a.bizhawkPID.Store(int64(emu.PID()))
+	launched := time.Now()
+	goSafe("bizhawk watch", func() { a.watchBizHawkProcess(emu, launch, launched) })
+	return nil
+}
+
+// closeBizHawk stops BizHawk for a spectator without ending the client.
+func (a *App) closeBizHawk() error {
+	a.bizhawkMu.Lock()
+	emu := a.bizhawk
+	a.bizhawk = nil
+	a.bizhawkMu.Unlock()
+	if emu == nil {
+		return nil
+	}
+	log.Println("Closing BizHawk for spectating")
+	return emu.Kill()
+}
+
+// watchBizHawkProcess shuts the client down when BizHawk exits, unless it
+// was closed on purpose by closeBizHawk.
+func (a *App) watchBizHawkProcess(emu Emulator, launch int, launched time.Time) {
+	err := emu.Wait()
+	a.bizhawkMu.Lock()
+	closed := a.bizhawk == nil || a.bizhawkLaunch != launch
+	if a.bizhawk == nil {
+		a.bizhawkPID.Store(0)
+	}
+	a.bizhawkMu.Unlock()
+	if closed {
+		log.Println("BizHawk closed while spectating")
+		return
+	}
+	if err != nil {
+		log.Printf("BizHawk exited with error: %v", err)
+		suggestPrereqs(a.cfg, time.Since(launched))
+		a.recordExit(CauseBizHawkCrashed, err.Error())
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := a.api.ReportError(ctx, ErrorBizHawk, fmt.Sprintf("BizHawk exited: %v", err)); err != nil {
+			log.Printf("client-error report error: %v", err)
+		}
+		cancel()
+	} else {
+		log.Println("BizHawk exited normally")
+		a.recordExit(CauseBizHawkExited, "")
+	}
+	a.stop() // Trigger application shutdown
+}
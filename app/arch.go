@@ -0,0 +1,29 @@
+package app
+
+import (
+	"log"
+	"runtime"
+)
+
+// HostArch returns the native OS architecture (GOARCH naming). It can
+// differ from runtime.GOARCH when this binary runs under emulation, such
+// as an amd64 build on Windows on ARM.
+func HostArch() string {
+	if a := nativeArch(); a != "" {
+		return a
+	}
+	return runtime.GOARCH
+}
+
+// selectBizHawkURL picks the BizHawk download for the host architecture,
+// falling back to the default (x64) URL. It reports whether the chosen
+// build will run under emulation.
+func selectBizHawkURL(cfg *Config, hostArch string) (url string, emulated bool) {
+	if u, ok := cfg.BizHawkDownloadURLs[hostArch]; ok && u != "" {
+		return u, false
+	}
+	if hostArch == "386" {
+		log.Printf("WARNING: no 32-bit BizHawk configured; the x64 build will not run on this machine")
+	}
+	return cfg.BizHawkDownloadURL, hostArch != "amd64"
+}
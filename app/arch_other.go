@@ -0,0 +1,8 @@
+//go:build !windows
+
+package app
+
+// nativeArch defers to runtime.GOARCH outside Windows.
+func nativeArch() string {
+	return ""
+}
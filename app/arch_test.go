@@ -0,0 +1,36 @@
+package app
+
+import "testing"
+
+func TestSelectBizHawkURL(t *testing.T) {
+	const x64 = "https://example.com/BizHawk-win-x64.zip"
+	cfg := &Config{
+		BizHawkDownloadURL: x64,
+		BizHawkDownloadURLs: map[string]string{
+			"arm64": "https://example.com/BizHawk-win-arm64.zip",
+			"386":   "",
+		},
+	}
+	tests := []struct {
+		arch         string
+		wantURL      string
+		wantEmulated bool
+	}{
+		{"amd64", x64, false},
+		{"arm64", "https://example.com/BizHawk-win-arm64.zip", false},
+		// An empty override falls back like a missing one.
+		{"386", x64, true},
+		{"riscv64", x64, true},
+	}
+	for _, tt := range tests {
+		url, emulated := selectBizHawkURL(cfg, tt.arch)
+		if url != tt.wantURL || emulated != tt.wantEmulated {
+			t.Errorf("selectBizHawkURL(%s) = %s, %v; want %s, %v", tt.arch, url, emulated, tt.wantURL, tt.wantEmulated)
+		}
+	}
+
+	// Without per-arch URLs, an ARM host runs the x64 build emulated.
+	if url, emulated := selectBizHawkURL(&Config{BizHawkDownloadURL: x64}, "arm64"); url != x64 || !emulated {
+		t.Errorf("arm64 without overrides = %s, %v; want %s, true", url, emulated, x64)
+	}
+}
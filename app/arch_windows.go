@@ -0,0 +1,45 @@
+//go:build windows
+
+package app
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	imageFileMachineI386  = 0x014c
+	imageFileMachineAMD64 = 0x8664
+	imageFileMachineARM64 = 0xAA64
+)
+
+// nativeArch asks IsWow64Process2 for the native machine type. It returns
+// "" on Windows versions that lack the call.
+func nativeArch() string {
+	proc := syscall.NewLazyDLL("kernel32.dll").NewProc("IsWow64Process2")
+	if proc.Find() != nil {
+		return ""
+	}
+	h, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return ""
+	}
+	var processMachine, nativeMachine uint16
+	r, _, _ := proc.Call(
+		uintptr(h),
+		uintptr(unsafe.Pointer(&processMachine)),
+		uintptr(unsafe.Pointer(&nativeMachine)),
+	)
+	if r == 0 {
+		return ""
+	}
+	switch nativeMachine {
+	case imageFileMachineARM64:
+		return "arm64"
+	case imageFileMachineAMD64:
+		return "amd64"
+	case imageFileMachineI386:
+		return "386"
+	}
+	return ""
+}
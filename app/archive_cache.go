@@ -0,0 +1,256 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	archiveCacheDir       = "cache"
+	archiveCacheIndex     = "index.json"
+	defaultArchiveCacheMB = 2048
+)
+
+// archiveEntry records one cached download. Blobs are stored under their
+// SHA-256 so identical archives from different URLs share one file.
+type archiveEntry struct {
+	URL      string    `json:"url"`
+	SHA256   string    `json:"sha256"`
+	ETag     string    `json:"etag,omitempty"`
+	Size     int64     `json:"size"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+// ArchiveCache is a content-addressed, LRU-bounded cache for large archives
+// such as BizHawk releases, the BizhawkFiles overlay, and firmware packs.
+type ArchiveCache struct {
+	dir      string
+	maxBytes int64
+	client   *http.Client
+
+	mu      sync.Mutex
+	entries map[string]*archiveEntry // keyed by URL
+}
+
+// NewArchiveCache opens (or creates) the cache directory.
+func NewArchiveCache(cfg *Config, client *http.Client) *ArchiveCache {
+	mb := int64(cfg.ArchiveCacheMB)
+	if mb <= 0 {
+		mb = defaultArchiveCacheMB
+	}
+	c := &ArchiveCache{
+		dir:      archiveCacheDir,
+		maxBytes: mb << 20,
+		client:   client,
+		entries:  make(map[string]*archiveEntry),
+	}
+	c.load()
+	return c
+}
+
+func (c *ArchiveCache) blobPath(sum string) string {
+	return filepath.Join(c.dir, sum)
+}
+
+func (c *ArchiveCache) load() {
+	f, err := os.Open(filepath.Join(c.dir, archiveCacheIndex))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	var list []*archiveEntry
+	if err := json.NewDecoder(f).Decode(&list); err != nil {
+		log.Printf("Archive cache index unreadable, starting empty: %v", err)
+		return
+	}
+	for _, e := range list {
+		c.entries[e.URL] = e
+	}
+}
+
+func (c *ArchiveCache) saveLocked() error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	list := make([]*archiveEntry, 0, len(c.entries))
+	for _, e := range c.entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].URL < list[j].URL })
+	f, err := os.Create(filepath.Join(c.dir, archiveCacheIndex))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(list)
+}
+
+// verify reports whether the blob on disk still matches its recorded hash.
+func (c *ArchiveCache) verify(e *archiveEntry) bool {
+	sum, err := fileSHA256(c.blobPath(e.SHA256))
+	return err == nil && sum == e.SHA256
+}
+
+// Fetch returns a local path holding the archive at url, downloading only
+// when the cached copy is missing, corrupt, or stale per the server's ETag.
+func (c *ArchiveCache) Fetch(ctx context.Context, url string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entries[url]
+	if entry != nil && !c.verify(entry) {
+		log.Printf("Archive cache entry for %s is corrupt; re-downloading", url)
+		_ = os.Remove(c.blobPath(entry.SHA256))
+		delete(c.entries, url)
+		entry = nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	if entry != nil && entry.ETag != "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		if entry != nil && ctx.Err() == nil {
+			log.Printf("Archive fetch failed, using cached copy: %v", err)
+			return c.touchLocked(entry)
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && entry != nil:
+		log.Printf("Archive cache hit: %s", url)
+		return c.touchLocked(entry)
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("download failed: %s (status: %s)", url, resp.Status)
+	}
+
+	// The archive is extracted next to the cache, so it needs room twice.
+	if resp.ContentLength > 0 {
+		if err := checkFreeSpace("download "+filepath.Base(url), c.dir, 2*uint64(resp.ContentLength)); err != nil {
+			return "", err
+		}
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(c.dir, "download-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), resp.Body)
+	tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	if err := replaceFile(tmp.Name(), c.blobPath(sum)); err != nil {
+		return "", err
+	}
+
+	entry = &archiveEntry{
+		URL:    url,
+		SHA256: sum,
+		ETag:   resp.Header.Get("ETag"),
+		Size:   size,
+	}
+	c.entries[url] = entry
+	path, err := c.touchLocked(entry)
+	c.evictLocked()
+	return path, err
+}
+
+func (c *ArchiveCache) touchLocked(e *archiveEntry) (string, error) {
+	e.LastUsed = time.Now()
+	if err := c.saveLocked(); err != nil {
+		log.Printf("Archive cache index save failed: %v", err)
+	}
+	return c.blobPath(e.SHA256), nil
+}
+
+// evictLocked removes least recently used blobs until under the size cap.
+// Blobs shared by several URLs are counted once and removed together.
+func (c *ArchiveCache) evictLocked() {
+	type blob struct {
+		sum      string
+		size     int64
+		lastUsed time.Time
+	}
+	blobs := map[string]*blob{}
+	var total int64
+	for _, e := range c.entries {
+		b, ok := blobs[e.SHA256]
+		if !ok {
+			b = &blob{sum: e.SHA256, size: e.Size}
+			blobs[e.SHA256] = b
+			total += e.Size
+		}
+		if e.LastUsed.After(b.lastUsed) {
+			b.lastUsed = e.LastUsed
+		}
+	}
+	if total <= c.maxBytes {
+		return
+	}
+	order := make([]*blob, 0, len(blobs))
+	for _, b := range blobs {
+		order = append(order, b)
+	}
+	sort.Slice(order, func(i, j int) bool { return order[i].lastUsed.Before(order[j].lastUsed) })
+	// Never evict the most recently used blob, which was just fetched.
+	for _, b := range order[:len(order)-1] {
+		if total <= c.maxBytes {
+			break
+		}
+		log.Printf("Evicting cached archive %s (%d bytes)", b.sum, b.size)
+		_ = os.Remove(c.blobPath(b.sum))
+		for url, e := range c.entries {
+			if e.SHA256 == b.sum {
+				delete(c.entries, url)
+			}
+		}
+		total -= b.size
+	}
+	if err := c.saveLocked(); err != nil {
+		log.Printf("Archive cache index save failed: %v", err)
+	}
+}
+
+// CleanArchiveCache deletes the whole archive cache directory.
+func CleanArchiveCache() error {
+	return os.RemoveAll(archiveCacheDir)
+}
+
+// fileSHA256 returns the hex SHA-256 of a file's contents.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,200 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// archiveServer serves the path as the body, with a strong ETag, and
+// answers a matching If-None-Match with 304. It records whether each
+// request was conditional.
+type archiveServer struct {
+	mu   sync.Mutex
+	gets []string // "GET path" or "COND path"
+}
+
+func (s *archiveServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	etag := `"` + r.URL.Path + `"`
+	s.mu.Lock()
+	if r.Header.Get("If-None-Match") != "" {
+		s.gets = append(s.gets, "COND "+r.URL.Path)
+	} else {
+		s.gets = append(s.gets, "GET "+r.URL.Path)
+	}
+	s.mu.Unlock()
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	_, _ = io.WriteString(w, "archive "+r.URL.Path)
+}
+
+func (s *archiveServer) Gets() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.gets)
+}
+
+func newTestArchiveCache(t *testing.T, maxBytes int64) *ArchiveCache {
+	t.Helper()
+	return &ArchiveCache{
+		dir:      t.TempDir(),
+		maxBytes: maxBytes,
+		client:   http.DefaultClient,
+		entries:  make(map[string]*archiveEntry),
+	}
+}
+
+func fetchArchive(t *testing.T, c *ArchiveCache, url string) string {
+	t.Helper()
+	path, err := c.Fetch(context.Background(), url)
+	if err != nil {
+		t.Fatalf("Fetch(%s): %v", url, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	if filepath.Base(path) != hex.EncodeToString(sum[:]) {
+		t.Errorf("blob %s is not named by its SHA-256", path)
+	}
+	return string(data)
+}
+
+func TestArchiveCacheHitAndMiss(t *testing.T) {
+	s := &archiveServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	c := newTestArchiveCache(t, 1<<20)
+
+	if got := fetchArchive(t, c, srv.URL+"/a.zip"); got != "archive /a.zip" {
+		t.Errorf("first fetch = %q", got)
+	}
+	if got := fetchArchive(t, c, srv.URL+"/a.zip"); got != "archive /a.zip" {
+		t.Errorf("cached fetch = %q", got)
+	}
+	want := []string{"GET /a.zip", "COND /a.zip"}
+	if got := s.Gets(); !slices.Equal(got, want) {
+		t.Errorf("requests = %v; want %v", got, want)
+	}
+
+	// The index survives a reopen.
+	reopened := &ArchiveCache{dir: c.dir, entries: make(map[string]*archiveEntry)}
+	reopened.load()
+	if e := reopened.entries[srv.URL+"/a.zip"]; e == nil || e.ETag != `"/a.zip"` {
+		t.Errorf("reloaded entry = %+v", e)
+	}
+
+	// With the server gone the cached copy is still served.
+	srv.Close()
+	if got := fetchArchive(t, c, srv.URL+"/a.zip"); got != "archive /a.zip" {
+		t.Errorf("offline fetch = %q", got)
+	}
+	if _, err := c.Fetch(context.Background(), srv.URL+"/b.zip"); err == nil {
+		t.Error("offline fetch of an uncached archive succeeded")
+	}
+}
+
+func TestArchiveCacheCorruptBlob(t *testing.T) {
+	s := &archiveServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	c := newTestArchiveCache(t, 1<<20)
+
+	path, err := c.Fetch(context.Background(), srv.URL+"/a.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("bit rot"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A corrupt blob is dropped and fetched unconditionally.
+	if got := fetchArchive(t, c, srv.URL+"/a.zip"); got != "archive /a.zip" {
+		t.Errorf("fetch after corruption = %q", got)
+	}
+	want := []string{"GET /a.zip", "GET /a.zip"}
+	if got := s.Gets(); !slices.Equal(got, want) {
+		t.Errorf("requests = %v; want %v", got, want)
+	}
+}
+
+func TestArchiveCacheCorruptIndex(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(archiveCacheDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(archiveCacheDir, archiveCacheIndex), []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := &archiveServer{}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	c := NewArchiveCache(&Config{}, http.DefaultClient)
+	if len(c.entries) != 0 || c.maxBytes != defaultArchiveCacheMB<<20 {
+		t.Fatalf("cache opened with %d entries, %d bytes cap", len(c.entries), c.maxBytes)
+	}
+	if got := fetchArchive(t, c, srv.URL+"/a.zip"); got != "archive /a.zip" {
+		t.Errorf("fetch = %q", got)
+	}
+	// The unreadable index is replaced by a valid one.
+	reopened := NewArchiveCache(&Config{}, http.DefaultClient)
+	if len(reopened.entries) != 1 {
+		t.Errorf("rewritten index holds %d entries; want 1", len(reopened.entries))
+	}
+}
+
+func TestArchiveCacheEviction(t *testing.T) {
+	srv := httptest.NewServer(&archiveServer{})
+	defer srv.Close()
+	// Each body is 14 bytes; room for two.
+	c := newTestArchiveCache(t, 30)
+
+	for _, name := range []string{"/a.zip", "/b.zip"} {
+		fetchArchive(t, c, srv.URL+name)
+	}
+	// The same content under another URL shares the blob and costs nothing.
+	c.mu.Lock()
+	shared := *c.entries[srv.URL+"/a.zip"]
+	shared.URL = srv.URL + "/mirror/a.zip"
+	c.entries[shared.URL] = &shared
+	// Make a the most recently used so b is the eviction candidate.
+	base := time.Now().Add(-time.Hour)
+	c.entries[srv.URL+"/b.zip"].LastUsed = base
+	c.entries[srv.URL+"/a.zip"].LastUsed = base.Add(time.Minute)
+	shared.LastUsed = base
+	c.evictLocked()
+	if len(c.entries) != 3 {
+		t.Errorf("evicted under the cap: %d entries left", len(c.entries))
+	}
+	c.mu.Unlock()
+
+	fetchArchive(t, c, srv.URL+"/c.zip")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, url := range []string{"/a.zip", "/mirror/a.zip", "/c.zip"} {
+		if c.entries[srv.URL+url] == nil {
+			t.Errorf("%s was evicted", url)
+		}
+	}
+	b := c.entries[srv.URL+"/b.zip"]
+	if b != nil {
+		t.Fatal("least recently used archive was kept")
+	}
+	sum := sha256.Sum256([]byte("archive /b.zip"))
+	if _, err := os.Stat(c.blobPath(hex.EncodeToString(sum[:]))); !os.IsNotExist(err) {
+		t.Errorf("evicted blob still on disk: %v", err)
+	}
+}
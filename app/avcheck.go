@@ -0,0 +1,107 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// avVerifyDelay is how long a freshly written file must survive unchanged.
+// Real-time scanners usually act within a few hundred milliseconds.
+const avVerifyDelay = 750 * time.Millisecond
+
+// Hooks used by verifyWritten; tests replace them to simulate a scanner
+// deleting or rewriting a file.
+var (
+	avHashFile = fileSHA256
+	avSleep    = time.Sleep
+)
+
+// AVInterferenceError reports a file that vanished or changed right after
+// the client wrote it, which is what antivirus quarantine looks like.
+type AVInterferenceError struct {
+	Path   string
+	Reason string
+}
+
+func (e *AVInterferenceError) Error() string {
+	dir, err := filepath.Abs(filepath.Dir(e.Path))
+	if err != nil {
+		dir = filepath.Dir(e.Path)
+	}
+	return fmt.Sprintf(
+		"%s %s right after it was written; antivirus software may be quarantining it. "+
+			"Consider adding an exclusion for %s",
+		filepath.Base(e.Path), e.Reason, dir,
+	)
+}
+
+// verifyWritten re-reads path after a short delay and checks it still
+// exists with the same contents it had when written.
+func verifyWritten(path string) error {
+	before, err := avHashFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &AVInterferenceError{Path: path, Reason: "disappeared"}
+		}
+		return err
+	}
+	avSleep(avVerifyDelay)
+	after, err := avHashFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return &AVInterferenceError{Path: path, Reason: "disappeared"}
+	case err != nil:
+		return err
+	case after != before:
+		return &AVInterferenceError{Path: path, Reason: "changed"}
+	}
+	return nil
+}
+
+// verifyPresent checks that a file written by another process (BizHawk
+// writing a savestate) is still there after the delay. Its contents may
+// legitimately still be changing, so only disappearance counts.
+func verifyPresent(path string) error {
+	avSleep(avVerifyDelay)
+	if _, err := avHashFile(path); errors.Is(err, os.ErrNotExist) {
+		return &AVInterferenceError{Path: path, Reason: "disappeared"}
+	}
+	return nil
+}
+
+// fetchVerified downloads with fetch and verifies the result. When the file
+// is interfered with, it downloads once more under a different name and
+// moves it into place, which tells a scanner keyed on the path apart from
+// one keyed on the content.
+func fetchVerified(fetch func(dest string) error, dest string) error {
+	if err := fetch(dest); err != nil {
+		return err
+	}
+	err := verifyWritten(dest)
+	var av *AVInterferenceError
+	if !errors.As(err, &av) {
+		return err
+	}
+	log.Printf("WARNING: %v; retrying download under a temporary name", err)
+
+	tmp := fmt.Sprintf("%s.verify-%d", dest, time.Now().UnixNano())
+	if err := fetch(tmp); err != nil {
+		return fmt.Errorf("%w (retry failed: %v)", av, err)
+	}
+	if err := verifyWritten(tmp); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("%w (confirmed on retry)", av)
+	}
+	if err := replaceFile(tmp, dest); err != nil {
+		return err
+	}
+	if err := verifyWritten(dest); err != nil {
+		return fmt.Errorf("%w (the scanner targets the file name)", av)
+	}
+	log.Printf("Download of %s survived under a temporary name; the scanner may have been transient", filepath.Base(dest))
+	return nil
+}
@@ -0,0 +1,154 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeScanner stands in for real-time antivirus: during each verify delay
+// it calls act for every file in dir, which may delete or rewrite it.
+func fakeScanner(t *testing.T, dir string, act func(path string, pass int)) {
+	t.Helper()
+	old := avSleep
+	t.Cleanup(func() { avSleep = old })
+	pass := 0
+	avSleep = func(d time.Duration) {
+		if d != avVerifyDelay {
+			t.Errorf("slept %s; want avVerifyDelay", d)
+		}
+		pass++
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			act(filepath.Join(dir, e.Name()), pass)
+		}
+	}
+}
+
+func writeTestFile(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func avReason(err error) string {
+	var av *AVInterferenceError
+	if !errors.As(err, &av) {
+		return ""
+	}
+	return av.Reason
+}
+
+func TestVerifyWritten(t *testing.T) {
+	tests := []struct {
+		name   string
+		act    func(path string, pass int)
+		reason string
+	}{
+		{"left alone", func(string, int) {}, ""},
+		{"quarantined", func(p string, _ int) { _ = os.Remove(p) }, "disappeared"},
+		{"cleaned", func(p string, _ int) { _ = os.WriteFile(p, []byte("stripped"), 0o644) }, "changed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			fakeScanner(t, dir, tt.act)
+			path := filepath.Join(dir, "game.nes")
+			writeTestFile(t, path, "rom")
+
+			err := verifyWritten(path)
+			if got := avReason(err); got != tt.reason || (tt.reason == "" && err != nil) {
+				t.Fatalf("verifyWritten = %v; want reason %q", err, tt.reason)
+			}
+			if err != nil && !strings.Contains(err.Error(), "Consider adding an exclusion for "+dir) {
+				t.Errorf("message %q does not name the directory to exclude", err)
+			}
+		})
+	}
+
+	// A file already gone before the delay is reported the same way.
+	if got := avReason(verifyWritten(filepath.Join(t.TempDir(), "gone.nes"))); got != "disappeared" {
+		t.Errorf("missing file: reason %q", got)
+	}
+}
+
+func TestVerifyPresent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "round1.State")
+	writeTestFile(t, path, "state")
+
+	// BizHawk may still be writing the savestate; only deletion counts.
+	fakeScanner(t, dir, func(p string, _ int) { _ = os.WriteFile(p, []byte("more state"), 0o644) })
+	if err := verifyPresent(path); err != nil {
+		t.Errorf("changed savestate: %v", err)
+	}
+	fakeScanner(t, dir, func(p string, _ int) { _ = os.Remove(p) })
+	if got := avReason(verifyPresent(path)); got != "disappeared" {
+		t.Errorf("deleted savestate: reason %q", got)
+	}
+}
+
+func TestFetchVerified(t *testing.T) {
+	tests := []struct {
+		name string
+		// act is the scanner; it sees each file the download writes.
+		act     func(path string, pass int)
+		wantErr string
+	}{
+		{"no scanner", func(string, int) {}, ""},
+		{"transient", func(p string, pass int) {
+			if pass == 1 {
+				_ = os.Remove(p)
+			}
+		}, ""},
+		{"keyed on content", func(p string, _ int) { _ = os.Remove(p) }, "(confirmed on retry)"},
+		{"keyed on the file name", func(p string, _ int) {
+			if filepath.Base(p) == "game.nes" {
+				_ = os.Remove(p)
+			}
+		}, "(the scanner targets the file name)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			fakeScanner(t, dir, tt.act)
+			dest := filepath.Join(dir, "game.nes")
+			var fetched []string
+			fetch := func(p string) error {
+				fetched = append(fetched, filepath.Base(p))
+				return os.WriteFile(p, []byte("rom"), 0o644)
+			}
+
+			err := fetchVerified(fetch, dest)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if data, err := os.ReadFile(dest); err != nil || string(data) != "rom" {
+					t.Errorf("dest = %q, %v", data, err)
+				}
+			} else if avReason(err) != "disappeared" || !strings.HasSuffix(err.Error(), tt.wantErr) {
+				t.Errorf("fetchVerified = %v; want the quarantine %s", err, tt.wantErr)
+			}
+			if len(fetched) > 1 && !strings.HasPrefix(fetched[1], "game.nes.verify-") {
+				t.Errorf("retry fetched %q; want a temporary name", fetched[1])
+			}
+			leftovers, _ := filepath.Glob(filepath.Join(dir, "*.verify-*"))
+			if len(leftovers) > 0 {
+				t.Errorf("temporary downloads left behind: %v", leftovers)
+			}
+		})
+	}
+}
+
+func TestFetchVerifiedFetchError(t *testing.T) {
+	fakeScanner(t, t.TempDir(), func(string, int) { t.Error("verified a failed download") })
+	want := errors.New("connection reset")
+	if err := fetchVerified(func(string) error { return want }, filepath.Join(t.TempDir(), "game.nes")); err != want {
+		t.Errorf("fetchVerified = %v; want the fetch error", err)
+	}
+}
@@ -1,41 +1,63 @@
-package main
-
-import (
-	"fmt"
-	"log"
-	"os"
-	"os/exec"
-	"runtime"
-)
-
-// bizhawk.go
-func LaunchBizHawk(cfg *Config) (*exec.Cmd, error) {
-	exe := cfg.BizHawkPath
-
-	if runtime.GOOS != "windows" {
-		return nil, fmt.Errorf("BizHawk is only supported on Windows in this setup")
-	}
-
-	args := []string{}
-	if cfg.LuaScript != "" {
-		args = append(args, "--lua="+cfg.LuaScript)
-	}
-
-	cmd := exec.Command(exe, args...)
-	env := os.Environ()
-	env = append(env,
-		fmt.Sprintf("BIZHAWK_IPC_PORT=%d", cfg.BizhawkIPCPort),
-		fmt.Sprintf("BIZHAWK_ROM_DIR=%s", cfg.RomDir),
-		fmt.Sprintf("BIZHAWK_SAVE_DIR=%s", cfg.SaveDir),
-	)
-	cmd.Env = env
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	log.Printf("Launching BizHawk: %s %v", exe, args)
-	if err := cmd.Start(); err != nil {
-		return nil, err
-	}
-
-	return cmd, nil
-}
+package app
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// bizhawk.go
+func LaunchBizHawk(cfg *Config) (*exec.Cmd, error) {
+	exe := cfg.EmuHawkPath
+
+	if runtime.GOOS != "windows" {
+		return nil, fmt.Errorf("BizHawk is only supported on Windows in this setup")
+	}
+
+	args := []string{}
+	if cfg.LuaScript != "" {
+		args = append(args, "--lua="+cfg.LuaScript)
+	}
+
+	cmd := exec.Command(exe, args...)
+	env := os.Environ()
+	env = append(env,
+		fmt.Sprintf("BIZHAWK_IPC_PORT=%d", cfg.BizhawkIPCPort),
+		fmt.Sprintf("BIZHAWK_IPC_HOST=%s", bareHost(cfg.BizhawkIPCHost)),
+		fmt.Sprintf("BIZHAWK_ROM_DIR=%s", cfg.RomDir),
+		fmt.Sprintf("BIZHAWK_SAVE_DIR=%s", cfg.SaveDir),
+	)
+	cmd.Env = env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	log.Printf("Launching BizHawk: %s %v", exe, args)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return cmd, nil
+}
+
+// bizhawkBackend is the default EmulatorBackend: BizHawk from the install
+// Bootstrap selected.
+type bizhawkBackend struct{}
+
+func (bizhawkBackend) Start(cfg *Config) (Emulator, error) {
+	cmd, err := LaunchBizHawk(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return processEmulator{cmd}, nil
+}
+
+// processEmulator is an emulator running as a child process.
+type processEmulator struct {
+	cmd *exec.Cmd
+}
+
+func (p processEmulator) Wait() error { return p.cmd.Wait() }
+func (p processEmulator) Kill() error { return p.cmd.Process.Kill() }
+func (p processEmulator) PID() int    { return p.cmd.Process.Pid }
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// The server's BizhawkFiles.zip overlays its config and firmware on a
+// BizHawk install. BizhawkFiles.version, where the server has it, names
+// the overlay it currently serves.
+const (
+	bizhawkFilesPath        = "/api/BizhawkFiles.zip"
+	bizhawkFilesVersionPath = "/api/BizhawkFiles.version"
+)
+
+// bizhawkFilesVersion asks the server which overlay it serves, or returns
+// "" when it cannot say.
+func bizhawkFilesVersion(ctx context.Context, cfg *Config) string {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.ServerURL+bizhawkFilesVersionPath, nil)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("User-Agent", userAgent())
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		debugf("BizhawkFiles version check failed: %v", err)
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// applyBizhawkFiles extracts the overlay into dir unless the version last
+// applied there is current, and records the version it applied: the
+// server's, or the archive's SHA-256 when the server does not say. Only
+// the files in the archive are written, so the player's own settings
+// elsewhere in the install survive. It reports whether it extracted
+// anything.
+func applyBizhawkFiles(ctx context.Context, cfg *Config, cache *ArchiveCache, dir string) (bool, error) {
+	applied := cfg.BizhawkFilesApplied[dir]
+	version := bizhawkFilesVersion(ctx, cfg)
+	if version != "" && version == applied {
+		return false, nil
+	}
+	// The cache only downloads the archive again when its ETag changed.
+	zipPath, err := cache.Fetch(ctx, cfg.ServerURL+bizhawkFilesPath)
+	if err != nil {
+		return false, err
+	}
+	if version == "" {
+		if version, err = fileSHA256(zipPath); err != nil {
+			return false, err
+		}
+		if version == applied {
+			return false, nil
+		}
+	}
+	if err := extractZip(zipPath, dir); err != nil {
+		return false, err
+	}
+	recordBizhawkFiles(cfg, dir, version)
+	return true, nil
+}
+
+// recordBizhawkFiles remembers the overlay version applied to dir.
+func recordBizhawkFiles(cfg *Config, dir, version string) {
+	if cfg.BizhawkFilesApplied == nil {
+		cfg.BizhawkFilesApplied = make(map[string]string)
+	}
+	cfg.BizhawkFilesApplied[dir] = version
+}
+
+// refreshBizhawkFiles brings the overlay on the existing install in dir
+// up to date. Failures are only logged; the install still works with the
+// overlay it has.
+func refreshBizhawkFiles(ctx context.Context, cfg *Config, dir string) {
+	updated, err := applyBizhawkFiles(ctx, cfg, NewArchiveCache(cfg, httpClient), dir)
+	if err != nil {
+		log.Printf("BizhawkFiles update failed: %v", err)
+		return
+	}
+	if updated {
+		fmt.Printf("Updated BizhawkFiles in %s (%s)\n", dir, cfg.BizhawkFilesApplied[dir])
+	}
+}
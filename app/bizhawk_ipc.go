@@ -0,0 +1,937 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+type pendingCmd struct {
+	line     string
+	ch       chan string
+	retries  int
+	interval time.Duration
+	deadline time.Time
+	lastSent time.Time
+}
+
+type BizhawkIPC struct {
+	addr string
+	mu   sync.RWMutex
+	wmu  sync.Mutex
+	conn net.Conn
+	ln   net.Listener
+
+	// closed is closed once Listen has returned, after the listener and,
+	// unless Close is draining it, the current connection are closed. It
+	// does not imply that reader goroutines have exited or that pending
+	// commands were resolved; Close guarantees both.
+	closed chan struct{}
+
+	closing   atomic.Bool
+	closeOnce sync.Once
+	readers   sync.WaitGroup
+
+	cmdMu   sync.Mutex
+	nextID  int
+	pending map[int]*pendingCmd
+
+	state *ClientState
+
+	capMu sync.RWMutex
+	caps  map[string]bool // nil until a HELLO advertises capabilities
+
+	onCapsChanged func(caps []string)
+
+	// localName maps canonical game files to the paths, relative to the
+	// ROM directory, that the Lua script must load (see longpath.go and
+	// convert.go).
+	localName func(string) string
+
+	// schedule is published as SCHEDULE frames; resendSchedule forces the
+	// next frame out after Lua restarted and lost the previous one.
+	schedule       atomic.Pointer[Schedule]
+	resendSchedule atomic.Bool
+
+	eventMu   sync.Mutex
+	nextSub   int
+	eventSubs map[string]map[int]func(data string)
+
+	// EVENTs that arrive before anything subscribed to their name (Lua
+	// connects while the app is still wiring up) wait here for replay.
+	eventBuf    []bufferedEvent
+	subscribed  map[string]bool
+	replaying   map[string]bool
+	eventWarned map[string]bool
+
+	// Consecutive NACKs per command and the script reloads they caused
+	// (see ipc_health.go).
+	hellos      atomic.Int64
+	nackMu      sync.Mutex
+	nackStreaks map[string]*nackStreak
+	escalations atomic.Int64
+	scriptPath  string
+	onEscalate  func(cmd, reason string, retryErr error)
+}
+
+type bufferedEvent struct {
+	name string
+	data string
+	at   time.Time
+}
+
+const (
+	eventBufferTTL = 30 * time.Second
+	eventBufferMax = 64
+)
+
+// Lua-side capabilities advertised in HELLO.
+const (
+	CapOverlay     = "overlay"
+	CapScreenshots = "screenshots"
+	CapLoadSave    = "load_save"
+	CapDiscChange  = "disc_change"
+	CapReload      = "reload_script"
+	CapHotkeyLock  = "hotkey_lock"
+	CapQuery       = "query"
+)
+
+// commandCaps maps optional IPC commands to the capability they require.
+// Commands not listed here are part of the core protocol.
+var commandCaps = map[string]string{
+	"MSG":        CapOverlay,
+	"COUNTDOWN":  CapOverlay,
+	"STATS":      CapOverlay,
+	"SCREENSHOT": CapScreenshots,
+	"LOAD":       CapLoadSave,
+	"DISC":       CapDiscChange,
+	"RELOAD":     CapReload,
+	"SCHEDULE":   CapOverlay,
+	"QUERY":      CapQuery,
+}
+
+// ErrUnsupported is returned when the connected Lua script lacks a capability.
+var ErrUnsupported = errors.New("unsupported on this client")
+
+// ErrShuttingDown is returned for commands sent during or after Close, and
+// for pending commands Close had to abandon.
+var ErrShuttingDown = errors.New("ipc shutting down")
+
+// nackShutdown is the response Close delivers to abandoned commands.
+const nackShutdown = "NACK|shutdown"
+
+func NewBizhawkIPC(host string, port int, state *ClientState) *BizhawkIPC {
+	return &BizhawkIPC{
+		addr:    hostPort(host, port),
+		closed:  make(chan struct{}),
+		pending: make(map[int]*pendingCmd),
+		state:   state,
+
+		eventSubs: make(map[string]map[int]func(string)),
+
+		subscribed:  make(map[string]bool),
+		replaying:   make(map[string]bool),
+		eventWarned: make(map[string]bool),
+
+		nackStreaks: make(map[string]*nackStreak),
+	}
+}
+
+func (b *BizhawkIPC) Listen(ctx context.Context) error {
+	ln, err := net.Listen("tcp", b.addr)
+	if err != nil {
+		return fmt.Errorf("listen %s: %w", b.addr, err)
+	}
+	log.Printf("[IPC] Listening on %s", b.addr)
+	b.mu.Lock()
+	b.ln = ln
+	b.mu.Unlock()
+
+	defer func() {
+		_ = ln.Close()
+		b.mu.Lock()
+		// During Close the connection stays up so commands already sent
+		// can still collect their ACK; Close closes it after draining.
+		if b.conn != nil && !b.closing.Load() {
+			_ = b.conn.Close()
+			b.conn = nil
+		}
+		b.mu.Unlock()
+		close(b.closed)
+	}()
+
+	// Start resend loop
+	goSafe("ipc resender", func() { b.startResender(ctx) })
+
+	for {
+		ln.(*net.TCPListener).SetDeadline(time.Now().Add(1 * time.Second))
+		c, err := ln.Accept()
+		if err != nil {
+			if b.closing.Load() {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				default:
+				}
+				continue
+			}
+			log.Printf("[IPC] accept error: %v", err)
+			continue
+		}
+		log.Printf("[IPC] BizHawk connected from %s", c.RemoteAddr())
+		b.mu.Lock()
+		if b.conn != nil {
+			_ = b.conn.Close()
+		}
+		b.conn = c
+		b.mu.Unlock()
+		b.state.SetIPCConnected(true)
+
+		// Background reader
+		b.readers.Add(1)
+		conn := c
+		goSafe("ipc reader", func() {
+			defer b.readers.Done()
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				line := scanner.Text()
+				if logLevels.tracingIPC() {
+					log.Printf("[IPC TRACE] << %s", line)
+				}
+				b.handleResponse(line)
+			}
+			if err := scanner.Err(); err != nil && err != io.EOF {
+				log.Printf("[IPC] read error: %v", err)
+			}
+			b.mu.Lock()
+			if b.conn == conn {
+				_ = b.conn.Close()
+				b.conn = nil
+				b.state.SetIPCConnected(false)
+			}
+			b.mu.Unlock()
+		})
+	}
+}
+
+func (b *BizhawkIPC) SendLine(line string) error {
+	if b.closing.Load() {
+		return ErrShuttingDown
+	}
+	b.mu.RLock()
+	c := b.conn
+	b.mu.RUnlock()
+	if c == nil {
+		return fmt.Errorf("bizhawk not connected")
+	}
+	if logLevels.tracingIPC() {
+		log.Printf("[IPC TRACE] >> %s", line)
+	}
+	b.wmu.Lock()
+	defer b.wmu.Unlock()
+	_ = c.SetWriteDeadline(time.Now().Add(2 * time.Second))
+	_, err := io.WriteString(c, line+"\n")
+	if err != nil {
+		return fmt.Errorf("ipc write: %w", err)
+	}
+	return nil
+}
+
+// SendCommand sends a command with the timeout and retries configured for
+// it (see commandOpts) and waits for ACK/NACK.
+func (b *BizhawkIPC) SendCommand(parts ...string) error {
+	var cmd string
+	if len(parts) > 0 {
+		cmd = parts[0]
+	}
+	_, err := b.command(commandOpts(cmd), parts...)
+	return err
+}
+
+// SendCommandWithResponse is SendCommand for queries: it returns the data
+// the script sent back with its ACK.
+func (b *BizhawkIPC) SendCommandWithResponse(parts ...string) (string, error) {
+	var cmd string
+	if len(parts) > 0 {
+		cmd = parts[0]
+	}
+	return b.command(commandOpts(cmd), parts...)
+}
+
+// command sends a command and returns the ACK's data. When an escalated
+// command is NACKed nackEscalateAfter times in a row for the same reason,
+// the script is reloaded and resynced and the command retried once; the
+// retry's result is returned.
+func (b *BizhawkIPC) command(opts SendCommandOpts, parts ...string) (resp string, err error) {
+	defer func() {
+		if err != nil && len(parts) > 0 {
+			b.state.SetLastError("ipc "+parts[0], err)
+		}
+	}()
+	resp, err = b.sendCommand(opts, parts...)
+	if len(parts) == 0 || !nackEscalated[parts[0]] {
+		return resp, err
+	}
+	cmd := parts[0]
+	var nack *NackError
+	if !errors.As(err, &nack) {
+		if err == nil {
+			b.nackMu.Lock()
+			delete(b.nackStreaks, cmd)
+			b.nackMu.Unlock()
+		}
+		return resp, err
+	}
+	if !b.recordNack(cmd, nack.Reason) {
+		return "", err
+	}
+
+	log.Printf("[IPC] %s NACKed %d times in a row (%s); reloading the Lua script", cmd, nackEscalateAfter, nack.Reason)
+	b.escalations.Add(1)
+	if rerr := b.reloadScript(); rerr != nil {
+		log.Printf("[IPC] Script reload failed: %v", rerr)
+		b.escalated(cmd, nack.Reason, rerr)
+		return "", err
+	}
+	resp, retryErr := b.sendCommand(opts, parts...)
+	if retryErr == nil {
+		log.Printf("[IPC] %s succeeded after reloading the Lua script", cmd)
+	} else {
+		log.Printf("[IPC] %s still failing after reloading the Lua script: %v", cmd, retryErr)
+	}
+	b.escalated(cmd, nack.Reason, retryErr)
+	return resp, retryErr
+}
+
+// spectatorMuted are the gameplay commands a spectator's emulator no
+// longer receives; they are dropped as if acknowledged.
+var spectatorMuted = map[string]bool{"PAUSE": true, "RESUME": true, "START": true, "SWAP": true}
+
+// sendCommand sends a command, resending it as opts allow, and waits for
+// ACK/NACK until opts.Timeout. It returns the data the ACK carried, if
+// any. A NACK is returned as a *NackError.
+func (b *BizhawkIPC) sendCommand(opts SendCommandOpts, parts ...string) (string, error) {
+	if b.closing.Load() {
+		return "", ErrShuttingDown
+	}
+	if len(parts) > 0 && spectatorMuted[parts[0]] && b.state.Spectating() {
+		debugf("[IPC] %s not sent while spectating", parts[0])
+		return "", nil
+	}
+	if len(parts) > 0 && !b.Supports(parts[0]) {
+		return "", fmt.Errorf("%s: %w", parts[0], ErrUnsupported)
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = clientIPCTimings.Command
+	}
+	opts.Retries = max(opts.Retries, 0)
+	b.cmdMu.Lock()
+	id := b.nextID
+	b.nextID++
+	ch := make(chan string, 1)
+	line := fmt.Sprintf("CMD|%d|%s", id, strings.Join(parts, "|"))
+	now := time.Now()
+	cmd := &pendingCmd{
+		line:     line,
+		ch:       ch,
+		retries:  opts.Retries,
+		interval: opts.resendInterval(),
+		deadline: now.Add(opts.Timeout),
+		lastSent: now,
+	}
+	b.pending[id] = cmd
+	b.cmdMu.Unlock()
+
+	if err := b.SendLine(line); err != nil {
+		b.cmdMu.Lock()
+		delete(b.pending, id)
+		b.cmdMu.Unlock()
+		return "", err
+	}
+
+	select {
+	case resp := <-ch:
+		if data, ok := strings.CutPrefix(resp, "ACK"); ok {
+			return strings.TrimPrefix(data, "|"), nil
+		}
+		if resp == nackShutdown {
+			return "", fmt.Errorf("command %d: %w", id, ErrShuttingDown)
+		}
+		nack := &NackError{ID: id, Reason: strings.TrimPrefix(strings.TrimPrefix(resp, "NACK"), "|")}
+		if len(parts) > 0 {
+			nack.Command = parts[0]
+		}
+		return "", nack
+	case <-time.After(opts.Timeout):
+		usage.ipcTimeouts.Add(1)
+		b.cmdMu.Lock()
+		delete(b.pending, id)
+		b.cmdMu.Unlock()
+		return "", fmt.Errorf("command %d timeout", id)
+	}
+}
+
+// Close shuts the IPC link down deterministically: new commands fail with
+// ErrShuttingDown, the listener stops accepting, commands awaiting an ACK
+// get until ctx is done to complete before they are failed, in-flight
+// writes finish, and the connection is closed. It returns once Listen and
+// the reader goroutines have exited, or with ctx's error if they do not
+// in time. Listen must have been started; calling Close twice is safe.
+func (b *BizhawkIPC) Close(ctx context.Context) error {
+	var err error
+	b.closeOnce.Do(func() { err = b.close(ctx) })
+	return err
+}
+
+func (b *BizhawkIPC) close(ctx context.Context) error {
+	b.closing.Store(true)
+	b.mu.RLock()
+	if b.ln != nil {
+		_ = b.ln.Close()
+	}
+	b.mu.RUnlock()
+
+	// Let commands already sent collect their ACK, then fail the rest.
+	// Draining gets half the remaining time so teardown still fits.
+	drainCtx := ctx
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		drainCtx, cancel = context.WithDeadline(ctx, time.Now().Add(time.Until(deadline)/2))
+		defer cancel()
+	}
+	b.waitPending(drainCtx)
+	b.cmdMu.Lock()
+	for id, cmd := range b.pending {
+		delete(b.pending, id)
+		cmd.ch <- nackShutdown
+	}
+	b.cmdMu.Unlock()
+
+	// Taking the write lock waits out a frame that is mid-write.
+	flushed := make(chan struct{})
+	go func() {
+		b.wmu.Lock()
+		b.mu.Lock()
+		if b.conn != nil {
+			_ = b.conn.Close()
+			b.conn = nil
+		}
+		b.mu.Unlock()
+		b.wmu.Unlock()
+		close(flushed)
+	}()
+	readersDone := make(chan struct{})
+	go func() {
+		<-flushed
+		b.readers.Wait()
+		close(readersDone)
+	}()
+
+	for _, done := range []chan struct{}{flushed, readersDone, b.closed} {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return fmt.Errorf("ipc close: %w", ctx.Err())
+		}
+	}
+	return nil
+}
+
+// waitPending waits until no command awaits an ACK or ctx is done.
+func (b *BizhawkIPC) waitPending(ctx context.Context) {
+	tick := time.NewTicker(20 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		b.cmdMu.Lock()
+		n := len(b.pending)
+		b.cmdMu.Unlock()
+		if n == 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+func (b *BizhawkIPC) handleResponse(line string) {
+	parts := strings.SplitN(line, "|", 3)
+	if len(parts) < 1 {
+		return
+	}
+	switch parts[0] {
+	case "ACK", "NACK":
+		if len(parts) < 2 {
+			return
+		}
+		id, _ := strconv.Atoi(parts[1])
+		// ACK|<id>|<data> answers a query; NACK|<id>|<reason> says why
+		// the command failed.
+		resp := parts[0]
+		if len(parts) == 3 {
+			resp += "|" + parts[2]
+		}
+		b.cmdMu.Lock()
+		if cmd, ok := b.pending[id]; ok {
+			delete(b.pending, id)
+			cmd.ch <- resp
+		}
+		b.cmdMu.Unlock()
+	case "PING":
+		if len(parts) >= 2 {
+			_ = b.SendLine("PONG|" + parts[1])
+		}
+	case "EVENT":
+		// EVENT|<name>|<data>: unsolicited notifications from Lua
+		if len(parts) < 2 {
+			return
+		}
+		data := ""
+		if len(parts) == 3 {
+			data = parts[2]
+		}
+		b.dispatchEvent(parts[1], data)
+	case "HELLO":
+		// Lua restarted (possibly a different script), re-evaluate
+		// capabilities and send SYNC
+		b.state.MarkHelloSeen()
+		b.hellos.Add(1)
+		checkLuaProtocol(parseHelloProtocol(parts[1:]))
+		b.setCapabilities(parseHelloCaps(parts[1:]))
+		checkLuaTimings(parseHelloTimings(parts[1:]))
+		go func() {
+			if err := b.SendSync(); err != nil {
+				log.Printf("[IPC] Failed to send SYNC: %v", err)
+			} else {
+				log.Printf("[IPC] Sent SYNC to BizHawk")
+			}
+			if s := b.schedule.Load(); s != nil {
+				b.resendSchedule.Store(true)
+				s.Rearm()
+			}
+		}()
+	}
+}
+
+// OnEvent subscribes fn to Lua EVENT frames with the given name. Events of
+// that name buffered before the first subscription are delivered, in
+// order, before OnEvent returns. The returned function removes the
+// subscription.
+func (b *BizhawkIPC) OnEvent(name string, fn func(data string)) (unsubscribe func()) {
+	b.eventMu.Lock()
+	id := b.nextSub
+	b.nextSub++
+	if b.eventSubs[name] == nil {
+		b.eventSubs[name] = make(map[int]func(string))
+	}
+	b.eventSubs[name][id] = fn
+	b.subscribed[name] = true
+	b.eventMu.Unlock()
+
+	b.replayEvents(name)
+
+	return func() {
+		b.eventMu.Lock()
+		delete(b.eventSubs[name], id)
+		b.eventMu.Unlock()
+	}
+}
+
+func (b *BizhawkIPC) dispatchEvent(name, data string) {
+	b.eventMu.Lock()
+	// Queue behind a replay in progress so delivery stays in order.
+	if b.replaying[name] || !b.subscribed[name] {
+		b.bufferEventLocked(bufferedEvent{name: name, data: data, at: time.Now()})
+		b.eventMu.Unlock()
+		return
+	}
+	subs := b.subscribersLocked(name)
+	b.eventMu.Unlock()
+
+	if len(subs) == 0 {
+		log.Printf("[IPC] Unhandled EVENT %s", name)
+		return
+	}
+	for _, fn := range subs {
+		fn(data)
+	}
+}
+
+func (b *BizhawkIPC) subscribersLocked(name string) []func(string) {
+	subs := make([]func(string), 0, len(b.eventSubs[name]))
+	for _, fn := range b.eventSubs[name] {
+		subs = append(subs, fn)
+	}
+	return subs
+}
+
+func (b *BizhawkIPC) bufferEventLocked(ev bufferedEvent) {
+	b.pruneEventsLocked(ev.at)
+	if len(b.eventBuf) >= eventBufferMax {
+		b.warnDroppedLocked(b.eventBuf[0].name, "event buffer full")
+		b.eventBuf = b.eventBuf[1:]
+	}
+	b.eventBuf = append(b.eventBuf, ev)
+}
+
+// pruneEventsLocked drops buffered events older than eventBufferTTL.
+func (b *BizhawkIPC) pruneEventsLocked(now time.Time) {
+	kept := b.eventBuf[:0]
+	for _, ev := range b.eventBuf {
+		if now.Sub(ev.at) > eventBufferTTL {
+			b.warnDroppedLocked(ev.name, fmt.Sprintf("no handler within %s", eventBufferTTL))
+			continue
+		}
+		kept = append(kept, ev)
+	}
+	b.eventBuf = kept
+}
+
+// warnDroppedLocked logs a dropped buffered event once per name.
+func (b *BizhawkIPC) warnDroppedLocked(name, reason string) {
+	if b.eventWarned[name] {
+		return
+	}
+	b.eventWarned[name] = true
+	log.Printf("[IPC] Dropping EVENT %s: %s", name, reason)
+}
+
+// replayEvents delivers buffered events for name to its subscribers until
+// none remain. Events arriving meanwhile are buffered behind them.
+func (b *BizhawkIPC) replayEvents(name string) {
+	for {
+		b.eventMu.Lock()
+		b.pruneEventsLocked(time.Now())
+		var batch []bufferedEvent
+		kept := b.eventBuf[:0]
+		for _, ev := range b.eventBuf {
+			if ev.name == name {
+				batch = append(batch, ev)
+			} else {
+				kept = append(kept, ev)
+			}
+		}
+		b.eventBuf = kept
+		if len(batch) == 0 {
+			delete(b.replaying, name)
+			b.eventMu.Unlock()
+			return
+		}
+		b.replaying[name] = true
+		subs := b.subscribersLocked(name)
+		b.eventMu.Unlock()
+
+		debugf("[IPC] Replaying %d buffered EVENT %s", len(batch), name)
+		for _, ev := range batch {
+			for _, fn := range subs {
+				fn(ev.data)
+			}
+		}
+	}
+}
+
+// parseHelloCaps extracts "caps=a,b,c" from HELLO fields. A HELLO without a
+// caps field comes from a legacy script and yields nil (everything allowed).
+func parseHelloCaps(fields []string) map[string]bool {
+	for _, f := range fields {
+		for _, kv := range strings.Split(f, "|") {
+			list, ok := strings.CutPrefix(kv, "caps=")
+			if !ok {
+				continue
+			}
+			caps := make(map[string]bool)
+			for _, c := range strings.Split(list, ",") {
+				if c = strings.TrimSpace(c); c != "" {
+					caps[c] = true
+				}
+			}
+			return caps
+		}
+	}
+	return nil
+}
+
+func (b *BizhawkIPC) setCapabilities(caps map[string]bool) {
+	b.capMu.Lock()
+	changed := !maps.Equal(b.caps, caps) || (b.caps == nil) != (caps == nil)
+	b.caps = caps
+	onChange := b.onCapsChanged
+	b.capMu.Unlock()
+	if changed && onChange != nil {
+		go onChange(b.Capabilities())
+	}
+	if caps == nil {
+		log.Printf("[IPC] Lua did not advertise capabilities; assuming all")
+	} else {
+		log.Printf("[IPC] Lua capabilities: %v", caps)
+	}
+}
+
+// OnCapabilitiesChanged registers fn to run when a HELLO changes the
+// advertised capability set (e.g. after a script reload).
+func (b *BizhawkIPC) OnCapabilitiesChanged(fn func(caps []string)) {
+	b.capMu.Lock()
+	b.onCapsChanged = fn
+	b.capMu.Unlock()
+}
+
+// Capabilities returns the advertised Lua capabilities, or nil if unknown.
+func (b *BizhawkIPC) Capabilities() []string {
+	b.capMu.RLock()
+	defer b.capMu.RUnlock()
+	if b.caps == nil {
+		return nil
+	}
+	out := make([]string, 0, len(b.caps))
+	for c := range b.caps {
+		out = append(out, c)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Status reports the current connection state for snapshots.
+func (b *BizhawkIPC) Status() IPCStatus {
+	b.mu.RLock()
+	connected := b.conn != nil
+	b.mu.RUnlock()
+	b.cmdMu.Lock()
+	pending := len(b.pending)
+	b.cmdMu.Unlock()
+	return IPCStatus{
+		Connected:    connected,
+		Capabilities: b.Capabilities(),
+		Pending:      pending,
+		NackStreaks:  b.nackCounts(),
+		Escalations:  b.escalations.Load(),
+	}
+}
+
+// Supports reports whether the connected Lua script can handle cmd.
+func (b *BizhawkIPC) Supports(cmd string) bool {
+	need, ok := commandCaps[cmd]
+	if !ok {
+		return true
+	}
+	b.capMu.RLock()
+	defer b.capMu.RUnlock()
+	return b.caps == nil || b.caps[need]
+}
+
+func (b *BizhawkIPC) startResender(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			b.eventMu.Lock()
+			b.pruneEventsLocked(now)
+			b.eventMu.Unlock()
+			b.cmdMu.Lock()
+			// Commands out of resends wait for their deadline, where
+			// sendCommand gives up on them. Entries past it are dropped
+			// here too, so none can linger to stall Close or inflate
+			// Status.
+			for id, cmd := range b.pending {
+				if !now.Before(cmd.deadline) {
+					delete(b.pending, id)
+					continue
+				}
+				if cmd.retries > 0 && now.Sub(cmd.lastSent) >= cmd.interval {
+					log.Printf("[IPC] Resending command %d: %s", id, cmd.line)
+					_ = b.SendLine(cmd.line)
+					cmd.lastSent = now
+					cmd.retries--
+				}
+			}
+			b.cmdMu.Unlock()
+		}
+	}
+}
+
+// SetLocalNames installs the canonical-to-local game name mapping used
+// for SWAP and SYNC.
+func (b *BizhawkIPC) SetLocalNames(fn func(string) string) {
+	b.capMu.Lock()
+	b.localName = fn
+	b.capMu.Unlock()
+}
+
+func (b *BizhawkIPC) gameFile(game string) string {
+	b.capMu.RLock()
+	fn := b.localName
+	b.capMu.RUnlock()
+	if fn == nil || game == "" {
+		return game
+	}
+	return fn(game)
+}
+
+// SendSync sends the current state and our IPC timeouts to Lua after
+// HELLO. Scripts that can lock their hotkeys also get the hardcore flag.
+func (b *BizhawkIPC) SendSync() error {
+	game := b.gameFile(b.state.GetCurrentGame())
+	stateAt := b.state.localUnix(b.state.GetStateTime().Unix())
+	state := b.state.GetState()
+	args := []string{"SYNC", game, state, fmt.Sprintf("%d", stateAt), clientIPCTimings.Encode()}
+	if slices.Contains(b.Capabilities(), CapHotkeyLock) {
+		hardcore := "0"
+		if b.state.Hardcore() {
+			hardcore = "1"
+		}
+		args = append(args, "hardcore="+hardcore)
+	}
+	return b.SendCommand(args...)
+}
+
+// followHardcore tells the player and the Lua script whenever hardcore
+// mode is switched, so the script can lock or release its own hotkeys.
+func (b *BizhawkIPC) followHardcore(ctx context.Context) {
+	events := b.state.Subscribe(4)
+	defer b.state.Unsubscribe(events)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-events:
+			if ev.Type != EventHardcoreChanged {
+				continue
+			}
+			if on, _ := ev.New.(bool); on {
+				log.Println("Hardcore mode on: local pause and savestate controls are locked")
+				b.SendText(MsgHardcoreOn, nil)
+			} else {
+				log.Println("Hardcore mode off")
+				b.SendText(MsgHardcoreOff, nil)
+			}
+			if err := b.SendSync(); err != nil {
+				debugf("[IPC] SYNC after hardcore change failed: %v", err)
+			}
+		}
+	}
+}
+
+// Convenience helpers. Scheduled times are in server time and are
+// converted to the local clock for Lua.
+func (b *BizhawkIPC) SendSwap(at int64, game string) {
+	if err := b.Swap(at, game); err != nil {
+		log.Printf("[IPC] SWAP send failed: %v", err)
+	}
+}
+
+// Swap sends SWAP and returns once BizHawk has acknowledged it. The
+// timestamps a protocol 2 script returns are recorded as the swap's
+// timing.
+func (b *BizhawkIPC) Swap(at int64, game string) error {
+	sent := time.Now()
+	ack, err := b.SendCommandWithResponse("SWAP", fmt.Sprintf("%d", b.state.localUnix(at)), b.gameFile(game))
+	if err != nil {
+		return err
+	}
+	b.state.StartSwapGrace()
+	if recv, exec, ok := parseSwapAck(ack); ok {
+		t := newSwapTiming(game, time.Unix(at, 0), b.state.ClockOffset(), sent, recv, exec)
+		b.state.RecordSwapTiming(t)
+		t.logOutlier()
+	}
+	return nil
+}
+func (b *BizhawkIPC) SendStart(at int64, game string) {
+	if err := b.Start(at, game); err != nil {
+		log.Printf("[IPC] START send failed: %v", err)
+	}
+}
+
+// Start sends START and returns once BizHawk has acknowledged it.
+func (b *BizhawkIPC) Start(at int64, game string) error {
+	return b.SendCommand("START", fmt.Sprintf("%d", b.state.localUnix(at)), b.gameFile(game))
+}
+func (b *BizhawkIPC) SendSave(path string) {
+	if err := b.SendCommand("SAVE", path); err != nil {
+		log.Printf("[IPC] SAVE send failed: %v", err)
+	}
+}
+func (b *BizhawkIPC) SendPause(at *int64) {
+	if at != nil {
+		if err := b.SendCommand("PAUSE", fmt.Sprintf("%d", b.state.localUnix(*at))); err != nil {
+			log.Printf("[IPC] PAUSE send failed: %v", err)
+		}
+	} else {
+		if err := b.SendCommand("PAUSE"); err != nil {
+			log.Printf("[IPC] PAUSE send failed: %v", err)
+		}
+	}
+}
+func (b *BizhawkIPC) SendResume(at *int64) {
+	if at != nil {
+		if err := b.SendCommand("RESUME", fmt.Sprintf("%d", b.state.localUnix(*at))); err != nil {
+			log.Printf("[IPC] RESUME send failed: %v", err)
+		}
+	} else {
+		if err := b.SendCommand("RESUME"); err != nil {
+			log.Printf("[IPC] RESUME send failed: %v", err)
+		}
+	}
+}
+
+// QueryLoadedGame asks the Lua script which ROM the emulator has loaded.
+// It returns the file as the script names it, which is the local name
+// sent in SWAP or START (see gameFile), or "" when nothing is loaded.
+func (b *BizhawkIPC) QueryLoadedGame() (string, error) {
+	return b.SendCommandWithResponse("QUERY", "game")
+}
+
+// SendText renders a catalog message and shows it on the overlay unless
+// the host disabled it.
+func (b *BizhawkIPC) SendText(key string, vars MsgVars) {
+	if msg := messages.Render(key, vars); msg != "" {
+		b.SendMessage(msg)
+	}
+}
+
+// SendMessage shows msg on the overlay. Server text reaches it from
+// several places, so it is made frame-safe here (see ipcText).
+func (b *BizhawkIPC) SendMessage(msg string) {
+	if !b.Supports("MSG") {
+		return
+	}
+	if err := b.SendCommand("MSG", ipcText(msg)); err != nil {
+		log.Printf("[IPC] MSG send failed: %v", err)
+	}
+}
+
+// ipcText makes free text safe to send as one IPC field: frames end at a
+// newline and fields are split on '|', so control characters are dropped
+// and '|' becomes '/'.
+func ipcText(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '|':
+			return '/'
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, s)
+}
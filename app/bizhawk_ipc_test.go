@@ -0,0 +1,470 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-client/internal/luapeer"
+)
+
+// listenTestIPC runs Listen on a free loopback port and returns the
+// address it listens on.
+func listenTestIPC(t *testing.T) (*BizhawkIPC, string, <-chan error) {
+	t.Helper()
+	b := NewBizhawkIPC("127.0.0.1", 0, NewClientState())
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	listenErr := make(chan error, 1)
+	go func() { listenErr <- b.Listen(ctx) }()
+
+	var addr string
+	waitFor(t, "listener", func() bool {
+		b.mu.RLock()
+		defer b.mu.RUnlock()
+		if b.ln != nil {
+			addr = b.ln.Addr().String()
+		}
+		return addr != ""
+	})
+	return b, addr, listenErr
+}
+
+// startTestIPC runs Listen on a free loopback port and connects a peer
+// that answers each CMD with reply(id, command); an empty reply sends
+// nothing back.
+func startTestIPC(t *testing.T, reply func(id, cmd string) string) (*BizhawkIPC, <-chan error) {
+	t.Helper()
+	b, addr, listenErr := listenTestIPC(t)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	go func() {
+		var wmu sync.Mutex
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			parts := strings.SplitN(scanner.Text(), "|", 3)
+			if len(parts) < 3 || parts[0] != "CMD" {
+				continue
+			}
+			go func(id, cmd string) {
+				if resp := reply(id, cmd); resp != "" {
+					wmu.Lock()
+					_, _ = conn.Write([]byte(resp + "\n"))
+					wmu.Unlock()
+				}
+			}(parts[1], parts[2])
+		}
+	}()
+	waitFor(t, "connection", func() bool { return b.Status().Connected })
+	return b, listenErr
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestIPCCloseFailsUnansweredCommands(t *testing.T) {
+	b, listenErr := startTestIPC(t, func(id, cmd string) string { return "" })
+
+	cmdErr := make(chan error, 1)
+	go func() {
+		_, err := b.sendCommand(SendCommandOpts{Timeout: time.Minute}, "SYNC")
+		cmdErr <- err
+	}()
+	waitFor(t, "pending command", func() bool { return b.Status().Pending == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+	if err := b.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := <-cmdErr; !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("pending command error = %v; want ErrShuttingDown", err)
+	}
+	if err := <-listenErr; err != nil {
+		t.Errorf("Listen returned %v", err)
+	}
+	select {
+	case <-b.closed:
+	default:
+		t.Error("closed channel still open after Close")
+	}
+	if st := b.Status(); st.Connected || st.Pending != 0 {
+		t.Errorf("status after Close = %+v", st)
+	}
+	if _, err := b.sendCommand(SendCommandOpts{}, "SYNC"); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("command after Close = %v; want ErrShuttingDown", err)
+	}
+	// A second Close is a no-op.
+	if err := b.Close(context.Background()); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+func TestIPCCloseLetsSentCommandsFinish(t *testing.T) {
+	b, _ := startTestIPC(t, func(id, cmd string) string {
+		time.Sleep(50 * time.Millisecond)
+		return "ACK|" + id + "|done"
+	})
+
+	type result struct {
+		data string
+		err  error
+	}
+	res := make(chan result, 1)
+	go func() {
+		data, err := b.sendCommand(SendCommandOpts{Timeout: time.Minute}, "QUERY", "game")
+		res <- result{data, err}
+	}()
+	waitFor(t, "pending command", func() bool { return b.Status().Pending == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := b.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if r := <-res; r.err != nil || r.data != "done" {
+		t.Errorf("command = %q, %v; want its ACK", r.data, r.err)
+	}
+}
+
+// Run with -race: commands racing Close must neither panic nor hang, and
+// Close must still return in time.
+func TestIPCCloseRacesSendCommand(t *testing.T) {
+	b, _ := startTestIPC(t, func(id, cmd string) string { return "ACK|" + id })
+
+	var wg sync.WaitGroup
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				_, err := b.sendCommand(SendCommandOpts{Timeout: 500 * time.Millisecond}, "SYNC")
+				if errors.Is(err, ErrShuttingDown) {
+					return
+				}
+				b.SendMessage("racing")
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := b.Close(ctx); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("senders still running after Close")
+	}
+}
+
+func TestIPCDropsStalePendingCommands(t *testing.T) {
+	b := NewBizhawkIPC("127.0.0.1", 0, NewClientState())
+
+	// With no emulator connected the send fails at once and leaves
+	// nothing behind.
+	if _, err := b.sendCommand(SendCommandOpts{Timeout: time.Minute}, "SYNC"); err == nil {
+		t.Fatal("command sent with no connection")
+	}
+	if n := b.Status().Pending; n != 0 {
+		t.Errorf("%d commands pending after a failed send; want 0", n)
+	}
+
+	// An entry past its deadline is dropped by the resender.
+	b.cmdMu.Lock()
+	b.pending[99] = &pendingCmd{line: "CMD|99|SYNC", ch: make(chan string, 1), retries: 3, deadline: time.Now()}
+	b.cmdMu.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.startResender(ctx)
+	waitFor(t, "expired command dropped", func() bool { return b.Status().Pending == 0 })
+
+	// A command the emulator never answers is gone once it times out.
+	silent, _ := startTestIPC(t, func(id, cmd string) string { return "" })
+	if _, err := silent.sendCommand(SendCommandOpts{Timeout: 200 * time.Millisecond, Retries: 1}, "SYNC"); err == nil {
+		t.Fatal("unanswered command succeeded")
+	}
+	if n := silent.Status().Pending; n != 0 {
+		t.Errorf("%d commands pending after a timeout; want 0", n)
+	}
+
+	// Close's drain then has nothing to wait for.
+	start := time.Now()
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), time.Second)
+	defer drainCancel()
+	b.waitPending(drainCtx)
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("draining took %s with no live commands", d)
+	}
+}
+
+func TestIPCNackStreakResetsOnRecovery(t *testing.T) {
+	var mu sync.Mutex
+	var saves int
+	var reloads int
+	b, _ := startTestIPC(t, func(id, cmd string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case strings.HasPrefix(cmd, "RELOAD"):
+			reloads++
+			return "ACK|" + id
+		case strings.HasPrefix(cmd, "SAVE"):
+			saves++
+			// The script is briefly busy, recovers, then is busy again.
+			if saves == 3 {
+				return "ACK|" + id
+			}
+			return "NACK|" + id + "|busy"
+		}
+		return "ACK|" + id
+	})
+
+	for i, wantNack := range []bool{true, true, false, true, true} {
+		err := b.SendCommand("SAVE", "x.state")
+		var nack *NackError
+		if got := errors.As(err, &nack); got != wantNack {
+			t.Fatalf("SAVE %d = %v; want NACK %v", i+1, err, wantNack)
+		}
+	}
+	// The ACK ended the first streak, so neither run of NACKs reached
+	// nackEscalateAfter and the script was never reloaded.
+	st := b.Status()
+	mu.Lock()
+	defer mu.Unlock()
+	if st.Escalations != 0 || reloads != 0 {
+		t.Errorf("%d escalations, %d reloads; want none", st.Escalations, reloads)
+	}
+	if n := st.NackStreaks["SAVE"]; n != 2 {
+		t.Errorf("SAVE streak = %d; want 2 after recovering", n)
+	}
+}
+
+// startPeerIPC runs Listen on a free loopback port and connects a fake Lua
+// script playing the bundled scenario, returning once the client has
+// answered its HELLO with SYNC.
+func startPeerIPC(t *testing.T, scenario string) (*BizhawkIPC, *luapeer.Peer) {
+	t.Helper()
+	b, addr, _ := listenTestIPC(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	peer, err := luapeer.Dial(ctx, addr, luapeer.MustLoad(scenario), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = peer.Close() })
+	if err := peer.Expect(ctx, "SYNC"); err != nil {
+		t.Fatal(err)
+	}
+	return b, peer
+}
+
+func TestIPCLuaPeerScenarios(t *testing.T) {
+	tests := []struct {
+		scenario string
+		run      func(t *testing.T, b *BizhawkIPC, savePath string)
+	}{
+		{"happy-path", func(t *testing.T, b *BizhawkIPC, savePath string) {
+			if got := b.Capabilities(); !slices.Equal(got, []string{CapOverlay}) {
+				t.Errorf("capabilities = %v", got)
+			}
+			if err := b.SendCommand("SAVE", savePath); err != nil {
+				t.Fatalf("SAVE: %v", err)
+			}
+			if _, err := os.Stat(savePath); err != nil {
+				t.Errorf("savestate not written: %v", err)
+			}
+			if err := b.SendCommand("PAUSE"); err != nil {
+				t.Errorf("PAUSE: %v", err)
+			}
+		}},
+		{"flaky-acker", func(t *testing.T, b *BizhawkIPC, savePath string) {
+			lag := make(chan string, 1)
+			b.OnEvent("frame_lag", func(data string) { lag <- data })
+			// Every second command is dropped; the resend gets it through.
+			opts := SendCommandOpts{Timeout: 5 * time.Second, Retries: 2}
+			for i := 0; i < 2; i++ {
+				if _, err := b.command(opts, "PAUSE"); err != nil {
+					t.Fatalf("PAUSE %d: %v", i+1, err)
+				}
+			}
+			// A duplicated ACK is harmless.
+			if _, err := b.command(opts, "RESUME"); err != nil {
+				t.Fatalf("RESUME: %v", err)
+			}
+			select {
+			case data := <-lag:
+				if data != "120" {
+					t.Errorf("frame_lag data = %q", data)
+				}
+			case <-time.After(3 * time.Second):
+				t.Error("frame_lag event not delivered")
+			}
+		}},
+		{"slow-saver", func(t *testing.T, b *BizhawkIPC, savePath string) {
+			// The SAVE timeout leaves room for a slow emulator.
+			start := time.Now()
+			if err := b.SendCommand("SAVE", savePath); err != nil {
+				t.Fatalf("SAVE: %v", err)
+			}
+			if d := time.Since(start); d < 4*time.Second {
+				t.Errorf("slow SAVE answered after %s", d)
+			}
+		}},
+		{"stuck-saver", func(t *testing.T, b *BizhawkIPC, savePath string) {
+			escalated := make(chan error, 1)
+			b.OnEscalation(func(cmd, reason string, retryErr error) { escalated <- retryErr })
+			for i := 1; i < nackEscalateAfter; i++ {
+				var nack *NackError
+				if err := b.SendCommand("SAVE", savePath); !errors.As(err, &nack) || nack.Reason != "savestate slot busy" {
+					t.Fatalf("SAVE %d = %v; want the NACK", i, err)
+				}
+			}
+			// The next NACK reloads the script and the retry succeeds.
+			if err := b.SendCommand("SAVE", savePath); err != nil {
+				t.Fatalf("SAVE after reload: %v", err)
+			}
+			if err := <-escalated; err != nil {
+				t.Errorf("escalation reported retry error %v", err)
+			}
+			if st := b.Status(); st.Escalations != 1 || len(st.NackStreaks) != 0 {
+				t.Errorf("status = %+v; want one escalation and no streak", st)
+			}
+		}},
+		{"protocol-mismatch", func(t *testing.T, b *BizhawkIPC, savePath string) {
+			if got := b.Capabilities(); !slices.Equal(got, []string{CapOverlay, "teleport"}) {
+				t.Errorf("capabilities = %v", got)
+			}
+			var nack *NackError
+			if err := b.SendCommand("PAUSE"); !errors.As(err, &nack) || nack.Reason != "unknown command" {
+				t.Errorf("PAUSE = %v; want NACK unknown command", err)
+			}
+			// Commands the script did not advertise are not sent at all.
+			if _, err := b.QueryLoadedGame(); !errors.Is(err, ErrUnsupported) {
+				t.Errorf("QUERY = %v; want ErrUnsupported", err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			t.Parallel()
+			b, _ := startPeerIPC(t, tt.scenario)
+			tt.run(t, b, filepath.Join(t.TempDir(), "round.State"))
+			if n := b.Status().Pending; n != 0 {
+				t.Errorf("%d commands still pending", n)
+			}
+		})
+	}
+}
+
+func TestIPCEventsBufferedUntilSubscribed(t *testing.T) {
+	b := NewBizhawkIPC("127.0.0.1", 0, NewClientState())
+	for i := 1; i <= 3; i++ {
+		b.handleResponse(fmt.Sprintf("EVENT|frame_lag|%d", i))
+	}
+	b.handleResponse("EVENT|rom_loaded|zelda.sfc")
+
+	var got []string
+	unsubscribe := b.OnEvent("frame_lag", func(data string) { got = append(got, data) })
+	if want := []string{"1", "2", "3"}; !slices.Equal(got, want) {
+		t.Errorf("replayed %v; want %v before OnEvent returns", got, want)
+	}
+	// Later events go straight through; other names stay buffered.
+	b.handleResponse("EVENT|frame_lag|4")
+	var loaded []string
+	b.OnEvent("rom_loaded", func(data string) { loaded = append(loaded, data) })
+	if !slices.Equal(got, []string{"1", "2", "3", "4"}) || !slices.Equal(loaded, []string{"zelda.sfc"}) {
+		t.Errorf("frame_lag %v, rom_loaded %v", got, loaded)
+	}
+
+	unsubscribe()
+	b.handleResponse("EVENT|frame_lag|5")
+	if len(got) != 4 {
+		t.Errorf("event delivered after unsubscribe: %v", got)
+	}
+}
+
+func TestIPCEventsDuringReplayKeepOrder(t *testing.T) {
+	b := NewBizhawkIPC("127.0.0.1", 0, NewClientState())
+	for i := 1; i <= 3; i++ {
+		b.dispatchEvent("frame_lag", strconv.Itoa(i))
+	}
+
+	// The first replayed event blocks until more arrive from the reader.
+	var mu sync.Mutex
+	var got []string
+	release := make(chan struct{})
+	arrived := make(chan struct{})
+	go func() {
+		<-release
+		for i := 4; i <= 6; i++ {
+			b.dispatchEvent("frame_lag", strconv.Itoa(i))
+		}
+		close(arrived)
+	}()
+	b.OnEvent("frame_lag", func(data string) {
+		mu.Lock()
+		got = append(got, data)
+		mu.Unlock()
+		if data == "1" {
+			close(release)
+			<-arrived
+		}
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"1", "2", "3", "4", "5", "6"}; !slices.Equal(got, want) {
+		t.Errorf("delivered %v; want %v", got, want)
+	}
+}
+
+func TestIPCEventBufferLimits(t *testing.T) {
+	b := NewBizhawkIPC("127.0.0.1", 0, NewClientState())
+	for i := 0; i < eventBufferMax+2; i++ {
+		b.dispatchEvent("frame_lag", strconv.Itoa(i))
+	}
+	// One stale event of another name is pruned on the next arrival.
+	b.eventMu.Lock()
+	b.eventBuf = append(b.eventBuf, bufferedEvent{name: "rom_loaded", at: time.Now().Add(-eventBufferTTL - time.Second)})
+	b.eventMu.Unlock()
+
+	var got []string
+	b.OnEvent("frame_lag", func(data string) { got = append(got, data) })
+	if len(got) != eventBufferMax || got[0] != "2" || got[len(got)-1] != strconv.Itoa(eventBufferMax+1) {
+		t.Fatalf("replayed %d events %v; want the newest %d", len(got), got, eventBufferMax)
+	}
+	var loaded int
+	b.OnEvent("rom_loaded", func(string) { loaded++ })
+	if loaded != 0 {
+		t.Error("expired event replayed")
+	}
+}
@@ -0,0 +1,272 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// bizhawkInstallRoot holds side-by-side BizHawk installs, one
+	// directory per version, for sessions that need a specific release.
+	bizhawkInstallRoot  = "bizhawk"
+	bizhawkInstallsFile = "installs.json"
+
+	// bizhawkReleaseURL is used when a session names a version without a
+	// download URL.
+	bizhawkReleaseURL = "https://github.com/TASEmulators/BizHawk/releases/download/%[1]s/BizHawk-%[1]s-win-x64.zip"
+)
+
+// BizHawkRequirement is the BizHawk release a session's cores need.
+type BizHawkRequirement struct {
+	Version     string `json:"version"`
+	DownloadURL string `json:"download_url,omitempty"`
+	// SHA256 of the release archive; empty when the server does not send
+	// one.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// bizhawkInstall records one side-by-side install.
+type bizhawkInstall struct {
+	Dir         string    `json:"dir"`
+	URL         string    `json:"url"`
+	InstalledAt time.Time `json:"installed_at"`
+}
+
+// bizhawkInstalls is the bookkeeping for the installs under root, keyed
+// by version.
+type bizhawkInstalls struct {
+	root     string
+	Installs map[string]bizhawkInstall `json:"installs"`
+}
+
+func loadBizHawkInstalls(root string) *bizhawkInstalls {
+	b := &bizhawkInstalls{root: root, Installs: make(map[string]bizhawkInstall)}
+	p := filepath.Join(root, bizhawkInstallsFile)
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return b
+	}
+	if err := decodeJSON(p, data, b); err != nil {
+		log.Printf("Ignoring BizHawk install list: %v", err)
+	}
+	if b.Installs == nil {
+		b.Installs = make(map[string]bizhawkInstall)
+	}
+	return b
+}
+
+// find returns the EmuHawk.exe of the recorded install of version, if it
+// is still on disk.
+func (b *bizhawkInstalls) find(version string) (string, bool) {
+	inst, ok := b.Installs[version]
+	if !ok {
+		return "", false
+	}
+	exe := filepath.Join(inst.Dir, "EmuHawk.exe")
+	if _, err := os.Stat(exe); err != nil {
+		return "", false
+	}
+	return exe, true
+}
+
+func (b *bizhawkInstalls) record(version string, inst bizhawkInstall) error {
+	b.Installs[version] = inst
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(b.root, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(b.root, bizhawkInstallsFile), data, 0o644)
+}
+
+// validateBizHawkVersion rejects versions that cannot name an install
+// directory.
+func validateBizHawkVersion(v string) error {
+	if v == "" || v == "." || v == ".." || strings.ContainsAny(v, "/\\:\x00") {
+		return fmt.Errorf("invalid BizHawk version %q", v)
+	}
+	return nil
+}
+
+// bizhawkArchiveDir is the install directory used for a release archive
+// downloaded from url: its file name without the extension.
+func bizhawkArchiveDir(url string) string {
+	name := path.Base(url)
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// bizhawkArchiveVersion extracts the version from an official release
+// archive name such as BizHawk-2.10-win-x64.zip, or "" if it has none.
+func bizhawkArchiveVersion(url string) string {
+	parts := strings.Split(bizhawkArchiveDir(url), "-")
+	if len(parts) < 2 || !strings.EqualFold(parts[0], "BizHawk") {
+		return ""
+	}
+	return parts[1]
+}
+
+// bizhawkOverride returns the bizhawk_path the user set, or "" to pick an
+// install automatically. Older clients saved the path of the install they
+// managed there, so a value naming one of the configured release
+// directories is not treated as an override.
+func bizhawkOverride(cfg *Config) string {
+	p := cfg.BizHawkPath
+	if p == "" {
+		return ""
+	}
+	norm := func(s string) string {
+		return strings.ToLower(strings.ReplaceAll(s, `\`, "/"))
+	}
+	urls := []string{cfg.BizHawkDownloadURL}
+	for _, u := range cfg.BizHawkDownloadURLs {
+		urls = append(urls, u)
+	}
+	for _, u := range urls {
+		if u != "" && norm(p) == norm(bizhawkArchiveDir(u)+"/EmuHawk.exe") {
+			return ""
+		}
+	}
+	return p
+}
+
+// doctorBizHawk prints, for `doctor`, the EmuHawk.exe launched when the
+// session requires no particular version and each side-by-side install.
+func doctorBizHawk(cfg *Config) {
+	exe, source := bizhawkOverride(cfg), "bizhawk_path"
+	if exe == "" {
+		url, _ := selectBizHawkURL(cfg, cfg.HostArch)
+		exe, source = filepath.Join(bizhawkArchiveDir(url), "EmuHawk.exe"), "default"
+	}
+	fmt.Printf("BizHawk: %s %s (%s)\n", installStatus(exe), exe, source)
+
+	installs := loadBizHawkInstalls(bizhawkInstallRoot)
+	for _, v := range slices.Sorted(maps.Keys(installs.Installs)) {
+		exe := filepath.Join(installs.Installs[v].Dir, "EmuHawk.exe")
+		fmt.Printf("  %s: %s %s\n", v, installStatus(exe), exe)
+	}
+}
+
+func installStatus(exe string) string {
+	if _, err := os.Stat(exe); err != nil {
+		return "MISSING"
+	}
+	return "ok"
+}
+
+// selectBizHawk chooses the EmuHawk.exe to launch for the session: the
+// bizhawk_path override when set, otherwise an install of the version the
+// session requires, downloading it after confirmation if it is missing.
+// When no one can answer the prompt the download goes ahead.
+func selectBizHawk(ctx context.Context, cfg *Config, req *BizHawkRequirement) error {
+	if override := bizhawkOverride(cfg); override != "" {
+		if req != nil && req.Version != "" {
+			log.Printf("WARNING: session requires BizHawk %s; using bizhawk_path %s as configured", req.Version, override)
+		}
+		cfg.EmuHawkPath = override
+		return nil
+	}
+	if req == nil || req.Version == "" {
+		return ensureBizHawkInstalled(ctx, cfg)
+	}
+	if err := validateBizHawkVersion(req.Version); err != nil {
+		return err
+	}
+	defaultURL, _ := selectBizHawkURL(cfg, cfg.HostArch)
+	if bizhawkArchiveVersion(defaultURL) == req.Version {
+		return ensureBizHawkInstalled(ctx, cfg)
+	}
+
+	installs := loadBizHawkInstalls(bizhawkInstallRoot)
+	if exe, ok := installs.find(req.Version); ok {
+		log.Printf("Session requires BizHawk %s; using %s", req.Version, exe)
+		refreshBizhawkFiles(ctx, cfg, installs.Installs[req.Version].Dir)
+		cfg.EmuHawkPath = exe
+		return nil
+	}
+
+	answer, err := prompter.Ask(ctx, "bizhawk_install", fmt.Sprintf(
+		"This session requires BizHawk %s, which is not installed. Download it now? [Y/n]", req.Version))
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	} else if err != nil {
+		log.Printf("Installing BizHawk %s for the session without confirmation: %v", req.Version, err)
+	} else if a := strings.ToLower(answer); a == "n" || a == "no" {
+		return fmt.Errorf("session requires BizHawk %s, which is not installed", req.Version)
+	}
+	exe, err := installBizHawkVersion(ctx, cfg, req, installs)
+	if err != nil {
+		return fmt.Errorf("install BizHawk %s: %w", req.Version, err)
+	}
+	cfg.EmuHawkPath = exe
+	return nil
+}
+
+// installBizHawkVersion downloads req's release through the archive cache,
+// verifies it when the session gives a checksum, and installs it with the
+// server's BizhawkFiles.zip under the install root.
+func installBizHawkVersion(ctx context.Context, cfg *Config, req *BizHawkRequirement, installs *bizhawkInstalls) (string, error) {
+	url := req.DownloadURL
+	if url == "" {
+		url = fmt.Sprintf(bizhawkReleaseURL, req.Version)
+	}
+	cache := NewArchiveCache(cfg, httpClient)
+	fmt.Printf("Downloading BizHawk %s...\n", req.Version)
+	zipPath, err := cache.Fetch(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	if req.SHA256 != "" {
+		sum, err := fileSHA256(zipPath)
+		if err != nil {
+			return "", err
+		}
+		if !strings.EqualFold(sum, req.SHA256) {
+			return "", fmt.Errorf("%s: checksum %s does not match the session's %s", url, sum, req.SHA256)
+		}
+	}
+
+	dir := filepath.Join(installs.root, req.Version)
+	tmp := dir + partSuffix
+	_ = os.RemoveAll(tmp)
+	if err := extractZip(zipPath, tmp); err != nil {
+		_ = os.RemoveAll(tmp)
+		return "", err
+	}
+	delete(cfg.BizhawkFilesApplied, tmp)
+	if _, err := applyBizhawkFiles(ctx, cfg, cache, tmp); err != nil {
+		_ = os.RemoveAll(tmp)
+		return "", fmt.Errorf("failed to download and extract BizhawkFiles.zip: %w", err)
+	}
+	exe := filepath.Join(dir, "EmuHawk.exe")
+	if _, err := os.Stat(filepath.Join(tmp, "EmuHawk.exe")); err != nil {
+		_ = os.RemoveAll(tmp)
+		return "", errors.New("archive has no EmuHawk.exe at its top level")
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		return "", err
+	}
+	recordBizhawkFiles(cfg, dir, cfg.BizhawkFilesApplied[tmp])
+	delete(cfg.BizhawkFilesApplied, tmp)
+	fmt.Println("BizHawk", req.Version, "installed in", dir)
+	ensurePrereqs(cfg, dir)
+
+	if err := installs.record(req.Version, bizhawkInstall{Dir: dir, URL: url, InstalledAt: time.Now()}); err != nil {
+		log.Printf("BizHawk install list save failed: %v", err)
+	}
+	return exe, nil
+}
@@ -0,0 +1,345 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// zipOf builds an archive holding files, keyed by slash-separated name.
+func zipOf(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// releaseServer serves BizHawk release archives by path alongside the
+// BizhawkFiles.zip overlay, and returns the paths it was asked for.
+func releaseServer(t *testing.T, releases map[string][]byte) (*httptest.Server, func() []string) {
+	t.Helper()
+	overlay := zipOf(t, map[string]string{"config.ini": "overlay"})
+	var mu sync.Mutex
+	var hits []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits = append(hits, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case bizhawkFilesVersionPath:
+			_, _ = w.Write([]byte("v1"))
+		case bizhawkFilesPath:
+			_, _ = w.Write(overlay)
+		default:
+			body, ok := releases[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write(body)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(hits)
+	}
+}
+
+// fakeInstall lays out a BizHawk install in dir, with or without its
+// EmuHawk.exe.
+func fakeInstall(t *testing.T, dir string, withExe bool) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(dir, "dll"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if withExe {
+		writeTestFile(t, filepath.Join(dir, "EmuHawk.exe"), "MZ")
+	}
+}
+
+func TestBizHawkInstallBookkeeping(t *testing.T) {
+	root := filepath.Join(t.TempDir(), bizhawkInstallRoot)
+	fakeInstall(t, filepath.Join(root, "2.9.1"), true)
+	fakeInstall(t, filepath.Join(root, "2.10"), true)
+	fakeInstall(t, filepath.Join(root, "2.8"), false)
+
+	installs := loadBizHawkInstalls(root)
+	if len(installs.Installs) != 0 {
+		t.Fatalf("fresh root has installs %v", installs.Installs)
+	}
+	for _, v := range []string{"2.9.1", "2.10", "2.8"} {
+		if err := installs.record(v, bizhawkInstall{Dir: filepath.Join(root, v), URL: "https://example.test/" + v}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reloaded := loadBizHawkInstalls(root)
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"2.9.1", filepath.Join(root, "2.9.1", "EmuHawk.exe")},
+		{"2.10", filepath.Join(root, "2.10", "EmuHawk.exe")},
+		{"2.8", ""}, // recorded, but its EmuHawk.exe is gone
+		{"2.7", ""}, // never installed
+	}
+	for _, tt := range tests {
+		got, ok := reloaded.find(tt.version)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("find(%s) = %q, %v; want %q", tt.version, got, ok, tt.want)
+		}
+	}
+	if u := reloaded.Installs["2.10"].URL; u != "https://example.test/2.10" {
+		t.Errorf("2.10 recorded from %q", u)
+	}
+
+	if err := os.RemoveAll(filepath.Join(root, "2.10")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.find("2.10"); ok {
+		t.Error("found a deleted install")
+	}
+
+	writeTestFile(t, filepath.Join(root, bizhawkInstallsFile), `{"installs": {`)
+	corrupt := loadBizHawkInstalls(root)
+	if corrupt.Installs == nil || len(corrupt.Installs) != 0 {
+		t.Errorf("corrupt list loaded as %v; want empty", corrupt.Installs)
+	}
+	if err := corrupt.record("2.9.1", bizhawkInstall{Dir: filepath.Join(root, "2.9.1")}); err != nil {
+		t.Fatalf("record over a corrupt list: %v", err)
+	}
+	if _, ok := loadBizHawkInstalls(root).find("2.9.1"); !ok {
+		t.Error("install recorded over a corrupt list is lost")
+	}
+}
+
+func TestBizHawkArchiveNames(t *testing.T) {
+	tests := []struct {
+		url, dir, version string
+	}{
+		{"https://github.com/TASEmulators/BizHawk/releases/download/2.10/BizHawk-2.10-win-x64.zip", "BizHawk-2.10-win-x64", "2.10"},
+		{"https://example.test/bizhawk-2.9.1-win-x64.zip", "bizhawk-2.9.1-win-x64", "2.9.1"},
+		{"https://example.test/EmuHawk.zip", "EmuHawk", ""},
+		{"https://example.test/custom-build.zip", "custom-build", ""},
+	}
+	for _, tt := range tests {
+		if got := bizhawkArchiveDir(tt.url); got != tt.dir {
+			t.Errorf("bizhawkArchiveDir(%s) = %q; want %q", tt.url, got, tt.dir)
+		}
+		if got := bizhawkArchiveVersion(tt.url); got != tt.version {
+			t.Errorf("bizhawkArchiveVersion(%s) = %q; want %q", tt.url, got, tt.version)
+		}
+	}
+
+	for v, ok := range map[string]bool{
+		"2.10": true, "2.9.1": true, "2.10-rc1": true,
+		"": false, ".": false, "..": false, "../2.10": false, `2.10\x`: false, "C:2.10": false,
+	} {
+		if err := validateBizHawkVersion(v); (err == nil) != ok {
+			t.Errorf("validateBizHawkVersion(%q) = %v; want ok %v", v, err, ok)
+		}
+	}
+}
+
+func TestBizHawkOverride(t *testing.T) {
+	const release = "https://example.test/BizHawk-2.10-win-x64.zip"
+	tests := []struct {
+		name, path, want string
+		urls             map[string]string
+	}{
+		{name: "unset"},
+		{name: "own install", path: `D:\Emu\BizHawk\EmuHawk.exe`, want: `D:\Emu\BizHawk\EmuHawk.exe`},
+		{name: "managed install", path: "BizHawk-2.10-win-x64/EmuHawk.exe"},
+		{name: "managed install, backslashes", path: `bizhawk-2.10-WIN-x64\EmuHawk.exe`},
+		{
+			name: "managed arm64 install", path: "BizHawk-2.10-win-arm64/EmuHawk.exe",
+			urls: map[string]string{"arm64": "https://example.test/BizHawk-2.10-win-arm64.zip"},
+		},
+		{name: "inside a managed install", path: "BizHawk-2.10-win-x64/old/EmuHawk.exe", want: "BizHawk-2.10-win-x64/old/EmuHawk.exe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{BizHawkPath: tt.path, BizHawkDownloadURL: release, BizHawkDownloadURLs: tt.urls}
+			if got := bizhawkOverride(cfg); got != tt.want {
+				t.Errorf("bizhawkOverride(%q) = %q; want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectBizHawk(t *testing.T) {
+	release := zipOf(t, map[string]string{"EmuHawk.exe": "MZ", "dll/core.dll": "core"})
+	noExe := zipOf(t, map[string]string{"BizHawk/EmuHawk.exe": "MZ"})
+	side := filepath.Join(bizhawkInstallRoot, "2.9.1")
+
+	tests := []struct {
+		name     string
+		req      *BizHawkRequirement
+		override string
+		setup    func(t *testing.T)
+		prompt   *scriptedPrompter
+		wantExe  string
+		wantErr  string
+		asked    bool
+		download bool
+	}{
+		{
+			name: "override wins", req: &BizHawkRequirement{Version: "2.9.1"},
+			override: `D:\BizHawk\EmuHawk.exe`, wantExe: `D:\BizHawk\EmuHawk.exe`,
+		},
+		{
+			name: "no requirement", wantExe: filepath.Join("BizHawk-2.10-win-x64", "EmuHawk.exe"),
+			setup: func(t *testing.T) { fakeInstall(t, "BizHawk-2.10-win-x64", true) },
+		},
+		{
+			name: "default version", req: &BizHawkRequirement{Version: "2.10"},
+			wantExe: filepath.Join("BizHawk-2.10-win-x64", "EmuHawk.exe"),
+			setup:   func(t *testing.T) { fakeInstall(t, "BizHawk-2.10-win-x64", true) },
+		},
+		{
+			name: "side-by-side install", req: &BizHawkRequirement{Version: "2.9.1"},
+			wantExe: filepath.Join(side, "EmuHawk.exe"),
+			setup: func(t *testing.T) {
+				fakeInstall(t, side, true)
+				if err := loadBizHawkInstalls(bizhawkInstallRoot).record("2.9.1", bizhawkInstall{Dir: side}); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "install confirmed", req: &BizHawkRequirement{Version: "2.9.1", SHA256: sha256Hex(string(release))},
+			prompt: &scriptedPrompter{answer: "y"}, asked: true, download: true,
+			wantExe: filepath.Join(side, "EmuHawk.exe"),
+		},
+		{
+			name: "install declined", req: &BizHawkRequirement{Version: "2.9.1"},
+			prompt: &scriptedPrompter{answer: "n"}, asked: true,
+			wantErr: "requires BizHawk 2.9.1",
+		},
+		{
+			name: "install without anyone to ask", req: &BizHawkRequirement{Version: "2.9.1"},
+			prompt: &scriptedPrompter{err: errors.New("no terminal")}, asked: true, download: true,
+			wantExe: filepath.Join(side, "EmuHawk.exe"),
+		},
+		{
+			name: "recorded install deleted", req: &BizHawkRequirement{Version: "2.9.1"},
+			prompt: &scriptedPrompter{answer: ""}, asked: true, download: true,
+			wantExe: filepath.Join(side, "EmuHawk.exe"),
+			setup: func(t *testing.T) {
+				if err := loadBizHawkInstalls(bizhawkInstallRoot).record("2.9.1", bizhawkInstall{Dir: side}); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "checksum mismatch", req: &BizHawkRequirement{Version: "2.9.1", SHA256: sha256Hex("other")},
+			prompt: &scriptedPrompter{answer: "y"}, asked: true, download: true,
+			wantErr: "does not match",
+		},
+		{
+			name: "archive without EmuHawk.exe", req: &BizHawkRequirement{Version: "2.8"},
+			prompt: &scriptedPrompter{answer: "y"}, asked: true, download: true,
+			wantErr: "no EmuHawk.exe",
+		},
+		{
+			name: "unusable version", req: &BizHawkRequirement{Version: "../2.9.1"},
+			wantErr: "invalid BizHawk version",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			srv, hits := releaseServer(t, map[string][]byte{
+				"/BizHawk-2.9.1-win-x64.zip": release,
+				"/BizHawk-2.8-win-x64.zip":   noExe,
+			})
+			if tt.req != nil && tt.req.Version != "" {
+				tt.req.DownloadURL = srv.URL + "/BizHawk-" + tt.req.Version + "-win-x64.zip"
+			}
+			p := tt.prompt
+			if p == nil {
+				p = &scriptedPrompter{}
+			}
+			usePrompter(t, p)
+			if tt.setup != nil {
+				tt.setup(t)
+			}
+			cfg := &Config{
+				ServerURL:          srv.URL,
+				BizHawkPath:        tt.override,
+				BizHawkDownloadURL: srv.URL + "/BizHawk-2.10-win-x64.zip",
+				HostArch:           "amd64",
+				SkipPrereqInstall:  true,
+			}
+
+			var err error
+			captureStdout(t, func() { err = selectBizHawk(context.Background(), cfg, tt.req) })
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("selectBizHawk = %v; want an error containing %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if cfg.EmuHawkPath != tt.wantExe {
+				t.Errorf("EmuHawkPath = %q; want %q", cfg.EmuHawkPath, tt.wantExe)
+			}
+
+			if asked := len(p.asked) > 0; asked != tt.asked {
+				t.Errorf("asked = %v; want %v", asked, tt.asked)
+			}
+			downloaded := slices.ContainsFunc(hits(), func(h string) bool { return strings.HasPrefix(h, "/BizHawk-") })
+			if downloaded != tt.download {
+				t.Errorf("downloaded a release = %v; want %v (requests %v)", downloaded, tt.download, hits())
+			}
+
+			if !tt.download {
+				return
+			}
+			// A download either leaves a complete, recorded install or
+			// nothing at all.
+			dir := filepath.Join(bizhawkInstallRoot, tt.req.Version)
+			if _, err := os.Stat(dir + partSuffix); !os.IsNotExist(err) {
+				t.Errorf("partial install left behind: %v", err)
+			}
+			exe, recorded := loadBizHawkInstalls(bizhawkInstallRoot).find(tt.req.Version)
+			if tt.wantErr != "" {
+				if _, err := os.Stat(dir); !os.IsNotExist(err) || recorded {
+					t.Errorf("failed install left %s (recorded %v)", dir, recorded)
+				}
+				return
+			}
+			if !recorded || exe != tt.wantExe {
+				t.Errorf("recorded install = %q, %v; want %q", exe, recorded, tt.wantExe)
+			}
+			for _, f := range []string{"dll/core.dll", "config.ini"} {
+				if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(f))); err != nil {
+					t.Errorf("install is missing %s: %v", f, err)
+				}
+			}
+			if v := cfg.BizhawkFilesApplied[dir]; v != "v1" {
+				t.Errorf("overlay version on %s = %q; want v1", dir, v)
+			}
+		})
+	}
+}
@@ -0,0 +1,552 @@
+package app
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrStartupCancelled is returned by Run when a signal interrupts
+// Bootstrap.
+var ErrStartupCancelled = errors.New("startup cancelled")
+
+// removePartOnCancel deletes dest's partial download once ctx is
+// cancelled: an interrupted startup leaves nothing half-written behind.
+func removePartOnCancel(ctx context.Context, dest string) {
+	if ctx.Err() == nil {
+		return
+	}
+	if err := os.Remove(dest + partSuffix); err == nil {
+		log.Printf("Removed partial download %s", dest+partSuffix)
+	}
+}
+
+// Bootstrap handles the initial setup, including downloading assets,
+// registering the player, and joining a session. Non-critical failures are
+// returned in the report rather than aborting startup (see startup_report.go).
+// BizHawk is only installed with installBizHawk; an embedder's emulator
+// backend brings its own.
+func Bootstrap(ctx context.Context, cfg *Config, state *ClientState, api *API, installBizHawk bool) (*StartupReport, error) {
+	report := &StartupReport{}
+
+	if err := createDirectories(cfg); err != nil {
+		return report, fmt.Errorf("failed to create directories: %w", err)
+	}
+
+	// Check the URL before asking the player anything.
+	if err := waitForServer(ctx, api); err != nil {
+		return report, err
+	}
+
+	if err := ensurePlayerRegistered(ctx, cfg, api, true); err != nil {
+		return report, fmt.Errorf("player registration failed: %w", err)
+	}
+	if err := ensureSessionJoined(ctx, cfg, api); err != nil {
+		return report, fmt.Errorf("session join failed: %w", err)
+	}
+
+	manifest, err := resumeOrJoinSession(ctx, cfg, state, api)
+	if err != nil {
+		return report, fmt.Errorf("failed to get game list from session: %w", err)
+	}
+	state.SetSessionName(cfg.SessionName)
+	manifest.AssignLocalNames(cfg.RomDir, pathLimit(cfg))
+	if err := SaveManifest(manifest, manifestFile); err != nil {
+		return report, fmt.Errorf("failed to save session manifest: %w", err)
+	}
+
+	if installBizHawk {
+		if err := selectBizHawk(ctx, cfg, manifest.BizHawk); err != nil {
+			return report, fmt.Errorf("BizHawk installation check failed: %w", err)
+		}
+	}
+
+	for dest, err := range resumeInterruptedDownloads(ctx, state, api.Token()) {
+		if err := report.check(StepResumeDownload, dest, err); err != nil {
+			return report, fmt.Errorf("failed to resume downloads: %w", err)
+		}
+	}
+
+	for game, err := range downloadMissingGames(ctx, cfg, state, api, manifest) {
+		if err := report.check(StepROMDownload, game, err); err != nil {
+			return report, fmt.Errorf("failed to download games: %w", err)
+		}
+		state.FlagMissingGame(game)
+	}
+
+	if err := downloadLatestLuaScript(ctx, cfg); err != nil {
+		return report, fmt.Errorf("failed to download lua script: %w", err)
+	}
+
+	askTelemetryConsent(ctx, cfg)
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+
+	report.Print()
+	return report, SaveConfig(cfg, "config.json")
+}
+
+func createDirectories(cfg *Config) error {
+	dirs := []string{cfg.RomDir, cfg.SaveDir, "scripts"}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureBizHawkInstalled installs the configured default BizHawk release if
+// it is missing and selects it. An existing install gets the server's
+// current BizhawkFiles overlay.
+func ensureBizHawkInstalled(ctx context.Context, cfg *Config) error {
+	downloadURL, emulated := selectBizHawkURL(cfg, cfg.HostArch)
+	if emulated {
+		log.Printf(
+			"WARNING: running x64 BizHawk under emulation on %s; demanding cores may be slow",
+			cfg.HostArch,
+		)
+	}
+	installDir := bizhawkArchiveDir(downloadURL)
+	cfg.EmuHawkPath = filepath.Join(installDir, "EmuHawk.exe")
+
+	if _, err := os.Stat(cfg.EmuHawkPath); os.IsNotExist(err) {
+		cache := NewArchiveCache(cfg, httpClient)
+		fmt.Println("BizHawk not found. Downloading...")
+		if err := extractCachedArchive(
+			ctx,
+			cache,
+			downloadURL,
+			installDir,
+		); err != nil {
+			return err
+		}
+		fmt.Println("BizHawk installed in", installDir)
+
+		fmt.Println("Downloading BizhawkFiles.zip...")
+		delete(cfg.BizhawkFilesApplied, installDir) // a fresh install has none
+		if _, err := applyBizhawkFiles(ctx, cfg, cache, installDir); err != nil {
+			return fmt.Errorf(
+				"failed to download and extract BizhawkFiles.zip: %w",
+				err,
+			)
+		}
+		fmt.Println("BizhawkFiles.zip extracted into BizHawk directory.")
+		ensurePrereqs(cfg, installDir)
+	} else if err == nil {
+		refreshBizhawkFiles(ctx, cfg, installDir)
+	}
+	return nil
+}
+
+// tokenCheckRetryDelay is the minimum wait before re-checking a token after
+// a server-side failure.
+const tokenCheckRetryDelay = 5 * time.Second
+
+// ensurePlayerRegistered makes sure cfg holds a valid bearer token,
+// registering the player if needed. With interactive false the saved
+// PlayerName is reused and a failed registration is returned instead of
+// asking again.
+func ensurePlayerRegistered(ctx context.Context, cfg *Config, api *API, interactive bool) error {
+	for {
+		if cfg.BearerToken != "" {
+			ok, err := api.CheckTokenExists(ctx, cfg.BearerToken)
+			var apiErr *APIError
+			if errors.As(err, &apiErr) && apiErr.Temporary() {
+				// The server is struggling, not rejecting us; keep the token.
+				wait := max(apiErr.RetryAfter, tokenCheckRetryDelay)
+				log.Printf("Token check failed, retrying in %s: %v", wait, err)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(wait):
+				}
+				continue
+			}
+			if err != nil {
+				log.Printf("Token check failed, re-registering: %v", err)
+				cfg.BearerToken, cfg.AppKey = "", ""
+				continue // Retry
+			}
+			if ok {
+				return nil // Token is valid
+			}
+			log.Println("Bearer token is invalid, re-registering.")
+			cfg.BearerToken, cfg.AppKey = "", ""
+		}
+
+		if !interactive && cfg.PlayerName == "" {
+			return errors.New("no saved player name to re-register with")
+		}
+		if interactive {
+			playerName, err := prompter.Ask(ctx, "player_name", "Enter your desired player ID")
+			if err != nil {
+				return fmt.Errorf("read player ID: %w", err)
+			}
+			cfg.PlayerName = playerName
+		}
+
+		token, appKey, err := api.RegisterPlayer(ctx, cfg.PlayerName)
+		if err != nil && !interactive {
+			return fmt.Errorf("re-register %s: %w", cfg.PlayerName, err)
+		}
+		if err != nil {
+			log.Printf("RegisterPlayer failed: %v", err)
+			fmt.Println("Failed to register player. Please try again.")
+			continue
+		}
+		cfg.BearerToken = token
+		cfg.AppKey = appKey
+		api.SetToken(token)
+		return nil
+	}
+}
+
+func ensureSessionJoined(ctx context.Context, cfg *Config, api *API) error {
+	for {
+		if cfg.SessionName != "" {
+			canonical, exists, err := api.CheckSessionExists(ctx, cfg.SessionName)
+			if err != nil {
+				return err
+			}
+			if exists {
+				if canonical != cfg.SessionName {
+					log.Printf("Using server name '%s' for session '%s'", canonical, cfg.SessionName)
+					cfg.SessionName = canonical
+				}
+				return nil // Session exists
+			}
+			if sessionFlag != "" {
+				return fmt.Errorf("session '%s' not found", cfg.SessionName)
+			}
+			log.Printf("Session '%s' not found.", cfg.SessionName)
+			cfg.SessionName = ""
+		}
+
+		sessions, err := api.ListSessions(ctx)
+		if err != nil && !errors.Is(err, ErrEndpointUnsupported) {
+			log.Printf("Session list unavailable: %v", err)
+		}
+		sessionName, err := prompter.Ask(ctx, "session_name", sessionMenu(sessions))
+		if err != nil {
+			return fmt.Errorf("read session name: %w", err)
+		}
+		if n, err := strconv.Atoi(sessionName); err == nil && len(sessions) > 0 {
+			if n < 1 || n > len(sessions) {
+				fmt.Printf("Pick a session from 1 to %d, or type its name\n", len(sessions))
+				continue
+			}
+			sessionName = sessions[n-1].Name
+		}
+		if err := validateSessionName(sessionName); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		cfg.SessionName = sessionName
+	}
+}
+
+// sessionMenu is the session prompt: a numbered list of the open sessions,
+// or plain name entry when there are none.
+func sessionMenu(sessions []SessionInfo) string {
+	if len(sessions) == 0 {
+		return "Enter game session name"
+	}
+	var b strings.Builder
+	b.WriteString("Open sessions:\n")
+	for i, s := range sessions {
+		players := "players"
+		if s.Players == 1 {
+			players = "player"
+		}
+		fmt.Fprintf(&b, "  %d) %s (%d %s", i+1, s.Name, s.Players, players)
+		if s.Status != "" {
+			fmt.Fprintf(&b, ", %s", s.Status)
+		}
+		b.WriteString(")\n")
+	}
+	b.WriteString("Enter a number or a session name")
+	return b.String()
+}
+
+// resumeOrJoinSession avoids re-joining a session we are already part of,
+// since the server treats a join as "player rejoined" and resets the round
+// assignment. It only fetches the manifest in that case.
+func resumeOrJoinSession(
+	ctx context.Context,
+	cfg *Config,
+	state *ClientState,
+	api *API,
+) (*SessionManifest, error) {
+	if !forceRejoin && state.GetSessionName() == cfg.SessionName {
+		current, err := api.MySession(ctx)
+		switch {
+		case err != nil:
+			log.Printf("Membership check unavailable, joining: %v", err)
+		case current == cfg.SessionName:
+			manifest, err := api.SessionManifest(ctx, cfg.SessionName)
+			if err == nil {
+				log.Printf("Resuming session '%s' without rejoining", cfg.SessionName)
+				return manifest, nil
+			}
+			log.Printf("Manifest fetch failed, joining: %v", err)
+		default:
+			log.Printf("Server no longer lists us in '%s', joining", cfg.SessionName)
+		}
+	}
+	return api.JoinSession(ctx, cfg.SessionName)
+}
+
+// downloadMissingGames fetches games not yet on disk (under their local
+// names), or whose contents do not match the manifest's checksum, and
+// returns the failures keyed by canonical game file. Progress is printed
+// and published as EventDownloadProgress.
+func downloadMissingGames(
+	ctx context.Context,
+	cfg *Config,
+	state *ClientState,
+	api *API,
+	manifest *SessionManifest,
+) map[string]error {
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed = make(map[string]error)
+	)
+
+	files := manifest.Files()
+	exists := make(map[string]bool, len(files))
+	for _, g := range files {
+		localPath := filepath.Join(cfg.RomDir, manifest.LocalName(g))
+		if _, err := os.Stat(localPath); err == nil {
+			if err := checkROMHash(localPath, manifest.Checksum(g)); err != nil {
+				log.Printf("Game %s is corrupt, re-downloading: %v", g, err)
+			} else {
+				log.Println("Game already exists:", g)
+				exists[g] = true
+			}
+		}
+	}
+	progress := newBootstrapProgress(state, len(files)-len(exists))
+
+	for _, g := range files {
+		wg.Add(1)
+		go func(gameFile, dest string) {
+			defer wg.Done()
+			var err error
+			if !exists[gameFile] {
+				log.Println("Downloading:", gameFile)
+				fetch := func(d string) error {
+					defer removePartOnCancel(ctx, d)
+					ctx, cancel := context.WithTimeout(ctx, romDownloadTimeout)
+					defer cancel()
+					return api.DownloadROM(ctx, gameFile, d, progress.update(gameFile))
+				}
+				err = fetchVerified(fetch, dest)
+				if err == nil {
+					err = checkROMHash(dest, manifest.Checksum(gameFile))
+				}
+				if err != nil {
+					usage.downloadFailures.Add(1)
+					err = fmt.Errorf("failed to download %s: %w", gameFile, err)
+				}
+				progress.finished(gameFile, err)
+			}
+			if err == nil {
+				err = ensureConverted(ctx, cfg, manifest, gameFile)
+			}
+			if err != nil {
+				log.Print(err)
+				mu.Lock()
+				failed[gameFile] = err
+				mu.Unlock()
+			}
+		}(g, filepath.Join(cfg.RomDir, manifest.LocalName(g)))
+	}
+
+	wg.Wait()
+	saveRomHashes()
+	return failed
+}
+
+// bootstrapProgress prints per-file download percentages, at most once a
+// second per file, and a count of finished games.
+type bootstrapProgress struct {
+	state *ClientState
+	total int
+
+	mu   sync.Mutex
+	done int
+	last map[string]time.Time
+}
+
+func newBootstrapProgress(state *ClientState, total int) *bootstrapProgress {
+	return &bootstrapProgress{state: state, total: total, last: make(map[string]time.Time)}
+}
+
+// update returns the progress callback for one file's download.
+func (p *bootstrapProgress) update(file string) func(written, total int64) {
+	return func(written, total int64) {
+		p.mu.Lock()
+		now := time.Now()
+		due := now.Sub(p.last[file]) >= time.Second
+		if due {
+			p.last[file] = now
+		}
+		p.mu.Unlock()
+		if !due && written != total {
+			return
+		}
+		if total > 0 {
+			fmt.Printf("  %s: %d%% (%s of %s)\n", file, written*100/total,
+				formatBytes(uint64(written)), formatBytes(uint64(total)))
+		} else {
+			fmt.Printf("  %s: %s\n", file, formatBytes(uint64(written)))
+		}
+		p.state.ReportDownloadProgress(DownloadProgress{File: file, Written: written, Total: total})
+	}
+}
+
+// finished counts a completed download, successful or not.
+func (p *bootstrapProgress) finished(file string, err error) {
+	p.mu.Lock()
+	p.done++
+	done := p.done
+	delete(p.last, file)
+	p.mu.Unlock()
+	if err == nil {
+		fmt.Printf("%d/%d games downloaded\n", done, p.total)
+	} else {
+		fmt.Printf("%d/%d games: %s failed\n", done, p.total, file)
+	}
+}
+
+// checkROMHash compares path's SHA-256 with want; an empty want accepts
+// any contents. Unchanged files are checked against the hash cache.
+func checkROMHash(path, want string) error {
+	if want == "" {
+		return nil
+	}
+	sum, err := cachedSHA256(path)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(sum, want) {
+		return fmt.Errorf("hash mismatch (got %s, want %s)", sum, want)
+	}
+	return nil
+}
+
+func downloadLatestLuaScript(ctx context.Context, cfg *Config) error {
+	luaURL := cfg.ServerURL + "/api/scripts/latest"
+	luaDest := filepath.Join("scripts", "swap_latest.lua")
+	fetch := func(url, dest string, meta *conditionalMeta) error {
+		defer removePartOnCancel(ctx, dest)
+		ctx, cancel := context.WithTimeout(ctx, transientDownloadTimeout)
+		defer cancel()
+		_, err := downloadResumable(ctx, httpClient, url, dest, downloadOptions{Bearer: cfg.BearerToken, Conditional: meta})
+		return err
+	}
+	if updated, err := installLuaScript(fetch, luaURL, luaDest); err != nil {
+		var incompatible *ScriptIncompatibleError
+		if !errors.As(err, &incompatible) {
+			return err
+		}
+		// Keep playing with the old script rather than failing startup.
+		log.Printf("Lua script update skipped: %v", err)
+		fmt.Println("Lua script update skipped:", incompatible)
+	} else if !updated {
+		log.Println("Lua script is up to date")
+	}
+	cfg.LuaScript = luaDest
+	return nil
+}
+
+func DownloadAndExtract(
+	ctx context.Context,
+	client *http.Client,
+	url,
+	zipPath,
+	dest string,
+) error {
+	if _, err := downloadResumable(ctx, client, url, zipPath, downloadOptions{}); err != nil {
+		removePartOnCancel(ctx, zipPath)
+		return err
+	}
+	defer os.Remove(zipPath)
+	return extractZip(zipPath, dest)
+}
+
+// extractCachedArchive fetches a zip through the archive cache and
+// extracts it into dest.
+func extractCachedArchive(ctx context.Context, cache *ArchiveCache, url, dest string) error {
+	zipPath, err := cache.Fetch(ctx, url)
+	if err != nil {
+		return err
+	}
+	return extractZip(zipPath, dest)
+}
+
+// extractZip safely extracts zipPath into dest, rejecting entries that
+// would escape it.
+func extractZip(zipPath, dest string) error {
+	r, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		fpath := filepath.Join(dest, f.Name)
+		if !strings.HasPrefix(
+			fpath,
+			filepath.Clean(dest)+string(os.PathSeparator),
+		) {
+			return fmt.Errorf("illegal file path: %s", fpath)
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(fpath, f.Mode()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(fpath), 0o755); err != nil {
+			return err
+		}
+		outFile, err := os.OpenFile(
+			fpath,
+			os.O_WRONLY|os.O_CREATE|os.O_TRUNC,
+			f.Mode(),
+		)
+		if err != nil {
+			return err
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			outFile.Close()
+			return err
+		}
+
+		_, err = io.Copy(outFile, rc)
+		outFile.Close()
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// sessionServer answers the session endpoints: my-session with mySession
+// (status mySessionStatus when set), session-manifest with manifestStatus
+// when set, and join-session always. It records "METHOD path" per request.
+type sessionServer struct {
+	mySession       string
+	mySessionStatus int
+	manifestStatus  int
+
+	mu   sync.Mutex
+	hits []string
+}
+
+func (s *sessionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.hits = append(s.hits, r.Method+" "+r.URL.Path)
+	s.mu.Unlock()
+	switch r.URL.Path {
+	case "/api/my-session":
+		if s.mySessionStatus != 0 {
+			w.WriteHeader(s.mySessionStatus)
+			return
+		}
+		if s.mySession == "" {
+			_, _ = io.WriteString(w, `{"session_name":null}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"session_name":"`+s.mySession+`"}`)
+	case "/api/session-manifest/relay", "/api/join-session/relay":
+		if s.manifestStatus != 0 && r.Method == http.MethodGet {
+			w.WriteHeader(s.manifestStatus)
+			return
+		}
+		_, _ = io.WriteString(w, `{"games":[{"file":"mario.nes"}],"round_length_seconds":300}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *sessionServer) Hits() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.hits)
+}
+
+func TestResumeOrJoinSession(t *testing.T) {
+	const (
+		mine     = "GET /api/my-session"
+		manifest = "GET /api/session-manifest/relay"
+		join     = "POST /api/join-session/relay"
+	)
+	tests := []struct {
+		name   string
+		joined string // session name in the runtime state
+		force  bool
+		server *sessionServer
+		want   []string
+	}{
+		{"fresh join", "", false, &sessionServer{}, []string{join}},
+		{"other session", "speedrun", false, &sessionServer{mySession: "speedrun"}, []string{join}},
+		{"silent resume", "relay", false, &sessionServer{mySession: "relay"}, []string{mine, manifest}},
+		{"forced rejoin", "relay", true, &sessionServer{mySession: "relay"}, []string{join}},
+		{"dropped by server", "relay", false, &sessionServer{}, []string{mine, join}},
+		{"old server", "relay", false, &sessionServer{mySessionStatus: http.StatusNotFound}, []string{mine, join}},
+		{"manifest unavailable", "relay", false,
+			&sessionServer{mySession: "relay", manifestStatus: http.StatusInternalServerError},
+			[]string{mine, manifest, join}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := forceRejoin
+			forceRejoin = tt.force
+			t.Cleanup(func() { forceRejoin = old })
+
+			srv := httptest.NewServer(tt.server)
+			defer srv.Close()
+			cfg := &Config{ServerURL: srv.URL, BearerToken: "t", SessionName: "relay"}
+			state := NewClientState()
+			state.SetSessionName(tt.joined)
+
+			m, err := resumeOrJoinSession(context.Background(), cfg, state, NewAPI(cfg))
+			if err != nil {
+				t.Fatalf("resumeOrJoinSession: %v", err)
+			}
+			if m.SessionName != "relay" || len(m.Games) != 1 || m.Games[0].File != "mario.nes" {
+				t.Errorf("manifest = %+v", m)
+			}
+			if got := tt.server.Hits(); !slices.Equal(got, tt.want) {
+				t.Errorf("requests = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionRejoinHandlerAlwaysJoins(t *testing.T) {
+	f := newHandlerFixture(t)
+	f.dispatch("session_rejoin", `{}`)
+	if got := f.server.Calls(); !slices.Equal(got, []string{"JoinSession"}) {
+		t.Errorf("server calls = %v; want an explicit join", got)
+	}
+}
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCircuitThreshold = 5
+	defaultCircuitCooldown  = 15 * time.Second
+)
+
+// Circuit breaker states, as carried by EventCircuitChanged.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// ErrCircuitOpen is returned without contacting the server while the
+// circuit breaker is open.
+var ErrCircuitOpen = errors.New("server unreachable; request not sent")
+
+// circuitBreaker counts consecutive API failures across all endpoints.
+// After threshold of them it opens and requests fail fast for cooldown;
+// then one request is let through as a probe, and its outcome closes the
+// circuit or reopens it. A failure is a transport error or a 5xx: any
+// other response shows the server is reachable.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+	onChange func(from, to string)
+}
+
+func newCircuitBreaker(cfg *Config) *circuitBreaker {
+	b := &circuitBreaker{
+		threshold: defaultCircuitThreshold,
+		cooldown:  defaultCircuitCooldown,
+		state:     CircuitClosed,
+	}
+	if cfg.CircuitFailureThreshold > 0 {
+		b.threshold = cfg.CircuitFailureThreshold
+	}
+	if cfg.CircuitCooldownSeconds > 0 {
+		b.cooldown = time.Duration(cfg.CircuitCooldownSeconds) * time.Second
+	}
+	return b
+}
+
+// allow reports whether a request may be sent now. In the half-open state
+// only the probe is allowed.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.unlock(b.state)
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		b.probing = true
+		return true
+	case CircuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// record counts the outcome of a request allow let through.
+func (b *circuitBreaker) record(resp *http.Response, err error) {
+	if errors.Is(err, context.Canceled) {
+		// Our own cancellation says nothing about the server.
+		b.mu.Lock()
+		b.probing = false
+		b.mu.Unlock()
+		return
+	}
+	failed := err != nil || (resp != nil && resp.StatusCode >= 500)
+
+	b.mu.Lock()
+	defer b.unlock(b.state)
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		b.state = CircuitClosed
+		return
+	}
+	b.failures++
+	if b.state == CircuitHalfOpen || (b.state == CircuitClosed && b.failures >= b.threshold) {
+		if b.state == CircuitClosed {
+			log.Printf("%d API requests failed in a row; pausing requests for %s", b.failures, b.cooldown)
+		}
+		b.openedAt = time.Now()
+		b.state = CircuitOpen
+	}
+}
+
+// unlock releases the lock and reports a change from old to the current
+// state to onChange.
+func (b *circuitBreaker) unlock(old string) {
+	state, fn := b.state, b.onChange
+	b.mu.Unlock()
+	if state != old && fn != nil {
+		fn(old, state)
+	}
+}
+
+// Circuit returns the breaker's state.
+func (b *circuitBreaker) Circuit() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// OnCircuitChange installs fn to observe circuit breaker transitions.
+func (a *API) OnCircuitChange(fn func(from, to string)) {
+	a.breaker.mu.Lock()
+	a.breaker.onChange = fn
+	a.breaker.mu.Unlock()
+}
+
+// CircuitOpen reports whether requests are being held back because the
+// server looks unreachable.
+func (a *API) CircuitOpen() bool {
+	return a.breaker.Circuit() != CircuitClosed
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// capabilitiesVersion is bumped whenever the meaning of an entry changes.
+const capabilitiesVersion = 1
+
+// emulatorCommands are the IPC commands this client can send to BizHawk.
+var emulatorCommands = []string{"EJECT", "MSG", "PAUSE", "QUERY", "RESUME", "SAVE", "START", "SWAP", "SYNC"}
+
+// Capabilities tells the server what it can ask of this client.
+type Capabilities struct {
+	Version  int      `json:"version"`
+	Events   []string `json:"events"`
+	Lua      []string `json:"lua"`
+	Emulator []string `json:"emulator"`
+	Features []string `json:"features"`
+
+	// SaveTemplate is the save naming convention the client proposes.
+	SaveTemplate string `json:"save_template"`
+}
+
+// BuildCapabilities assembles the capability report from the registered
+// handlers, the Lua script's HELLO (nil if unknown), and enabled features.
+func BuildCapabilities(reg *Registry, luaCaps []string, cfg *Config) Capabilities {
+	features := []string{"archive_cache", "save_templates"}
+	if !cfg.SkipSaveUpload {
+		features = append(features, "save_upload")
+	}
+	if cfg.SavePassphrase != "" {
+		features = append(features, "save_encryption")
+	}
+	if cfg.CompressSaves {
+		features = append(features, "save_compression")
+	}
+	if cfg.DesktopNotifications {
+		features = append(features, "desktop_notifications")
+	}
+	sort.Strings(features)
+
+	var events []string
+	if reg != nil {
+		events = reg.Types()
+	}
+	lua := luaCaps
+	if lua == nil {
+		lua = []string{}
+	}
+	return Capabilities{
+		Version:  capabilitiesVersion,
+		Events:   events,
+		Lua:      lua,
+		Emulator: append([]string(nil), emulatorCommands...),
+		Features: features,
+
+		SaveTemplate: defaultSaveTemplate,
+	}
+}
+
+// UpdateCapabilities sends a changed capability list mid-session.
+func (a *API) UpdateCapabilities(ctx context.Context, caps Capabilities) error {
+	req, err := a.newRequest(ctx, http.MethodPatch, "/api/capabilities", caps)
+	if err != nil {
+		return err
+	}
+	resp, _, err := a.do(req)
+	if err != nil {
+		return fmt.Errorf("capabilities send error: %w", err)
+	}
+	if resp == nil {
+		return fmt.Errorf("nil capabilities response")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError("capabilities", resp)
+	}
+	return nil
+}
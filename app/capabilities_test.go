@@ -0,0 +1,216 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseHelloCaps(t *testing.T) {
+	tests := []struct {
+		fields []string
+		want   map[string]bool
+	}{
+		{[]string{"v=3"}, nil},
+		{[]string{"caps="}, map[string]bool{}},
+		{[]string{"v=3", "caps=overlay, query,"}, map[string]bool{CapOverlay: true, CapQuery: true}},
+		{[]string{"v=3|caps=screenshots"}, map[string]bool{CapScreenshots: true}},
+	}
+	for _, tt := range tests {
+		got := parseHelloCaps(tt.fields)
+		if (got == nil) != (tt.want == nil) || len(got) != len(tt.want) {
+			t.Errorf("parseHelloCaps(%q) = %v; want %v", tt.fields, got, tt.want)
+			continue
+		}
+		for c := range tt.want {
+			if !got[c] {
+				t.Errorf("parseHelloCaps(%q) = %v; missing %s", tt.fields, got, c)
+			}
+		}
+	}
+}
+
+func TestSupportsFollowsCapabilities(t *testing.T) {
+	for cmd, need := range commandCaps {
+		b := NewBizhawkIPC("127.0.0.1", 0, NewClientState())
+		if !b.Supports(cmd) {
+			t.Errorf("%s unsupported before any HELLO; legacy scripts get everything", cmd)
+		}
+
+		b.setCapabilities(map[string]bool{need: true})
+		if !b.Supports(cmd) {
+			t.Errorf("%s unsupported with %s advertised", cmd, need)
+		}
+		for other, otherNeed := range commandCaps {
+			if otherNeed != need && b.Supports(other) {
+				t.Errorf("%s supported with only %s advertised", other, need)
+			}
+		}
+
+		b.setCapabilities(map[string]bool{})
+		if b.Supports(cmd) {
+			t.Errorf("%s supported with no capabilities advertised", cmd)
+		}
+		// The core protocol needs no capability.
+		for _, core := range []string{"SYNC", "SAVE", "SWAP", "PAUSE"} {
+			if !b.Supports(core) {
+				t.Errorf("core command %s unsupported", core)
+			}
+		}
+	}
+}
+
+func TestUnsupportedCommandsAreNotSent(t *testing.T) {
+	b := NewBizhawkIPC("127.0.0.1", 0, NewClientState())
+	b.setCapabilities(map[string]bool{CapQuery: true})
+
+	// No emulator is connected, so anything that tried to send would fail
+	// with a connection error instead.
+	b.SendMessage("hello")
+	if last := b.state.GetLastError(); last != "" {
+		t.Errorf("MSG without an overlay recorded error %q; want it skipped", last)
+	}
+	if err := b.SendCommand("SCREENSHOT"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("SCREENSHOT = %v; want ErrUnsupported", err)
+	}
+	if err := b.reloadScript(); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("reloadScript = %v; want ErrUnsupported", err)
+	}
+}
+
+func TestCapabilitiesReevaluatedOnHello(t *testing.T) {
+	b := NewBizhawkIPC("127.0.0.1", 0, NewClientState())
+	changes := make(chan []string, 4)
+	b.OnCapabilitiesChanged(func(caps []string) { changes <- caps })
+	next := func() []string {
+		t.Helper()
+		select {
+		case caps := <-changes:
+			return caps
+		case <-time.After(time.Second):
+			t.Fatal("capability change not reported")
+			return nil
+		}
+	}
+
+	b.handleResponse("HELLO|caps=overlay,screenshots")
+	if got := next(); !slices.Equal(got, []string{CapOverlay, CapScreenshots}) {
+		t.Errorf("first HELLO caps = %v", got)
+	}
+	// A reloaded script without the overlay drops MSG.
+	b.handleResponse("HELLO|caps=screenshots")
+	if got := next(); !slices.Equal(got, []string{CapScreenshots}) {
+		t.Errorf("reloaded caps = %v", got)
+	}
+	if b.Supports("MSG") || !b.Supports("SCREENSHOT") {
+		t.Error("Supports not re-evaluated after the reload")
+	}
+	// The same set again is not a change.
+	b.handleResponse("HELLO|caps=screenshots")
+	select {
+	case caps := <-changes:
+		t.Errorf("unchanged HELLO reported %v", caps)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBuildCapabilities(t *testing.T) {
+	reg := NewRegistry()
+	for _, typ := range []string{"swap", "pause", "message"} {
+		reg.Register(typ, func(json.RawMessage) {})
+	}
+	tests := []struct {
+		name     string
+		reg      *Registry
+		lua      []string
+		cfg      Config
+		events   []string
+		wantLua  []string
+		features []string
+	}{
+		{
+			name:     "bare",
+			features: []string{"archive_cache", "save_templates", "save_upload"},
+			wantLua:  []string{},
+		},
+		{
+			name:     "handlers and lua",
+			reg:      reg,
+			lua:      []string{CapOverlay, CapQuery},
+			events:   []string{"message", "pause", "swap"},
+			wantLua:  []string{CapOverlay, CapQuery},
+			features: []string{"archive_cache", "save_templates", "save_upload"},
+		},
+		{
+			name:    "optional features",
+			cfg:     Config{SavePassphrase: "x", CompressSaves: true, DesktopNotifications: true},
+			wantLua: []string{},
+			features: []string{
+				"archive_cache", "desktop_notifications", "save_compression",
+				"save_encryption", "save_templates", "save_upload",
+			},
+		},
+		{
+			name:     "save upload off",
+			cfg:      Config{SkipSaveUpload: true},
+			wantLua:  []string{},
+			features: []string{"archive_cache", "save_templates"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := BuildCapabilities(tt.reg, tt.lua, &tt.cfg)
+			if got.Version != capabilitiesVersion || got.SaveTemplate != defaultSaveTemplate {
+				t.Errorf("version %d, template %q", got.Version, got.SaveTemplate)
+			}
+			if !slices.Equal(got.Events, tt.events) {
+				t.Errorf("events = %v; want %v", got.Events, tt.events)
+			}
+			// An unknown Lua capability set is sent as [] rather than null.
+			if got.Lua == nil || !slices.Equal(got.Lua, tt.wantLua) {
+				t.Errorf("lua = %#v; want %v", got.Lua, tt.wantLua)
+			}
+			if !slices.Equal(got.Features, tt.features) {
+				t.Errorf("features = %v; want %v", got.Features, tt.features)
+			}
+			if !slices.Equal(got.Emulator, emulatorCommands) {
+				t.Errorf("emulator = %v", got.Emulator)
+			}
+		})
+	}
+
+	// The emulator list is a copy the caller may change.
+	caps := BuildCapabilities(nil, nil, &Config{})
+	caps.Emulator[0] = "CHANGED"
+	if emulatorCommands[0] == "CHANGED" {
+		t.Error("BuildCapabilities shares emulatorCommands")
+	}
+}
+
+func TestUpdateCapabilitiesPatches(t *testing.T) {
+	var got Capabilities
+	var method string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		if r.URL.Path != "/api/capabilities" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	a := NewAPI(&Config{ServerURL: srv.URL, BearerToken: "t"})
+	caps := BuildCapabilities(nil, []string{CapOverlay}, &Config{})
+	if err := a.UpdateCapabilities(context.Background(), caps); err != nil {
+		t.Fatalf("UpdateCapabilities: %v", err)
+	}
+	if method != http.MethodPatch || !slices.Equal(got.Lua, []string{CapOverlay}) || got.Version != capabilitiesVersion {
+		t.Errorf("%s %+v", method, got)
+	}
+}
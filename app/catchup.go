@@ -0,0 +1,91 @@
+package app
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Scheduled action kinds subject to the catch-up policy.
+const (
+	ActionStart = "start"
+	ActionSwap  = "swap"
+	ActionPause = "pause"
+)
+
+// CatchUpPolicy bounds how late a scheduled action may still be executed.
+// An action whose due time passed more than the limit ago is skipped and
+// replaced with a resync; a zero limit means the action always applies.
+type CatchUpPolicy struct {
+	Start time.Duration
+	Swap  time.Duration
+	Pause time.Duration
+}
+
+// NewCatchUpPolicy builds the policy from config, using defaults for
+// unset values. Pauses always apply.
+func NewCatchUpPolicy(cfg *Config) CatchUpPolicy {
+	p := CatchUpPolicy{
+		Start: 10 * time.Minute,
+		Swap:  30 * time.Second,
+	}
+	if cfg.CatchUpStartSeconds > 0 {
+		p.Start = time.Duration(cfg.CatchUpStartSeconds) * time.Second
+	}
+	if cfg.CatchUpSwapSeconds > 0 {
+		p.Swap = time.Duration(cfg.CatchUpSwapSeconds) * time.Second
+	}
+	return p
+}
+
+// Allow reports whether an action of the given kind due at due should still
+// execute at now, along with how overdue it is.
+func (p CatchUpPolicy) Allow(kind string, due, now time.Time) (bool, time.Duration) {
+	age := now.Sub(due)
+	if age <= 0 {
+		return true, 0
+	}
+	var limit time.Duration
+	switch kind {
+	case ActionStart:
+		limit = p.Start
+	case ActionSwap:
+		limit = p.Swap
+	case ActionPause:
+		limit = p.Pause
+	}
+	return limit == 0 || age <= limit, age
+}
+
+// actionKindForState maps a change_game_state target to its action kind.
+func actionKindForState(state string) string {
+	switch state {
+	case "paused", "pause", "stopped":
+		return ActionPause
+	default:
+		return ActionStart
+	}
+}
+
+// catchUp applies the policy; when an action is too old it resyncs from the
+// server and reports the skip instead, returning false.
+func (h *Handlers) catchUp(kind string, due time.Time) bool {
+	ok, age := h.catchUpPolicy.Allow(kind, due, time.Now())
+	if ok {
+		return true
+	}
+	log.Printf("Skipping %s due %s ago; resyncing with server", kind, age.Round(time.Second))
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := h.api.SessionState(ctx, h.state); err != nil {
+			log.Printf("resync after skipped %s failed: %v", kind, err)
+		} else if err := h.ipc.SendSync(); err != nil {
+			log.Printf("[IPC] Failed to send SYNC: %v", err)
+		}
+		if err := h.reports.ReportSkippedAction(ctx, kind, due, age); err != nil {
+			log.Printf("skipped-action report error: %v", err)
+		}
+	}()
+	return false
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCatchUpPolicyBoundaries(t *testing.T) {
+	p := NewCatchUpPolicy(&Config{})
+	due := goldenTime
+	tests := []struct {
+		kind string
+		late time.Duration
+		want bool
+	}{
+		{ActionStart, -time.Minute, true},
+		{ActionStart, 0, true},
+		{ActionStart, 10 * time.Minute, true},
+		{ActionStart, 10*time.Minute + time.Second, false},
+		{ActionSwap, 30 * time.Second, true},
+		{ActionSwap, 30*time.Second + time.Millisecond, false},
+		{ActionSwap, 40 * time.Minute, false},
+		// Pauses always apply, however late.
+		{ActionPause, 24 * time.Hour, true},
+		// Kinds without a limit are not held back.
+		{"unknown", 24 * time.Hour, true},
+	}
+	for _, tt := range tests {
+		ok, age := p.Allow(tt.kind, due, due.Add(tt.late))
+		if ok != tt.want {
+			t.Errorf("Allow(%s, %s late) = %v; want %v", tt.kind, tt.late, ok, tt.want)
+		}
+		if want := max(tt.late, 0); age != want {
+			t.Errorf("Allow(%s, %s late) age = %s; want %s", tt.kind, tt.late, age, want)
+		}
+	}
+}
+
+func TestCatchUpPolicyConfig(t *testing.T) {
+	p := NewCatchUpPolicy(&Config{CatchUpStartSeconds: 60, CatchUpSwapSeconds: 5})
+	due := goldenTime
+	if ok, _ := p.Allow(ActionStart, due, due.Add(61*time.Second)); ok {
+		t.Error("start 61s late allowed with a 60s limit")
+	}
+	if ok, _ := p.Allow(ActionSwap, due, due.Add(5*time.Second)); !ok {
+		t.Error("swap 5s late refused with a 5s limit")
+	}
+	if ok, _ := p.Allow(ActionSwap, due, due.Add(6*time.Second)); ok {
+		t.Error("swap 6s late allowed with a 5s limit")
+	}
+}
+
+func TestActionKindForState(t *testing.T) {
+	for state, want := range map[string]string{
+		"paused": ActionPause, "pause": ActionPause, "stopped": ActionPause,
+		"running": ActionStart, "": ActionStart,
+	} {
+		if got := actionKindForState(state); got != want {
+			t.Errorf("actionKindForState(%q) = %s; want %s", state, got, want)
+		}
+	}
+}
+
+func TestOverdueActionsResync(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		typ     string
+		payload string
+		skipped bool
+	}{
+		{"late start", "change_game_state",
+			fmt.Sprintf(`{"state":"running","state_at":%d,"seq":1}`, now.Add(-11*time.Minute).Unix()), true},
+		{"recent start", "change_game_state",
+			fmt.Sprintf(`{"state":"running","state_at":%d,"seq":1}`, now.Add(-9*time.Minute).Unix()), false},
+		{"late pause", "change_game_state",
+			fmt.Sprintf(`{"state":"paused","state_at":%d,"seq":1}`, now.Add(-time.Hour).Unix()), false},
+		{"late swap", "swap",
+			fmt.Sprintf(`{"round_number":2,"new_game":"zelda.sfc","swap_at":%d}`, now.Add(-time.Minute).Unix()), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newHandlerFixture(t)
+			f.dispatch(tt.typ, tt.payload)
+			if !tt.skipped {
+				if slices.Contains(f.server.Calls(), "ReportSkippedAction") {
+					t.Errorf("action within its limit was skipped")
+				}
+				return
+			}
+			waitFor(t, "skip report", func() bool {
+				return slices.Contains(f.server.Calls(), "ReportSkippedAction")
+			})
+			if got := f.server.Calls(); !slices.Equal(got, []string{"SessionState", "ReportSkippedAction"}) {
+				t.Errorf("server calls = %v; want a resync then the report", got)
+			}
+			if slices.Contains(f.emu.Sent(), "SWAP") {
+				t.Error("overdue swap was executed")
+			}
+		})
+	}
+}
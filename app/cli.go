@@ -0,0 +1,207 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+var (
+	verbose     bool
+	forceRejoin bool
+	serverName  string
+	sessionFlag string
+	showVersion bool
+	versionJSON bool
+	hidden      bool
+	telemetry   string
+)
+
+// Main runs the command-line client with the process's arguments and
+// returns its exit code. The binary's main is a thin wrapper around it.
+func Main() int {
+	if handled, err := runSubcommand(os.Args[1:]); handled {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitError
+		}
+		return ExitOK
+	}
+
+	started := time.Now()
+	app, err := newCLIApp()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Initialization failed: %v\n", err)
+		status := newExitStatus(CauseConfigError, err.Error(), "", 0, started)
+		printExitStatus(status)
+		return status.Code
+	}
+
+	exit := func(where string, r any) {
+		status := app.ExitStatus(nil)
+		status.Cause, status.Code = CausePanic, ExitPanic
+		status.Detail = fmt.Sprintf("%s: %v", where, r)
+		printExitStatus(status)
+		os.Exit(status.Code)
+	}
+	panicExit.Store(&exit)
+	defer recoverPanic("main")
+
+	ctx, stop := signal.NotifyContext(
+		context.Background(),
+		os.Interrupt,
+		syscall.SIGTERM,
+	)
+	defer stop()
+
+	runErr := app.Run(ctx)
+	if runErr != nil {
+		log.Printf("Application run failed: %v", runErr)
+	}
+	status := app.ExitStatus(runErr)
+	printExitStatus(status)
+	return status.Code
+}
+
+// newCLIApp applies the command-line flags and config.json and creates the
+// client from them.
+func newCLIApp() (*App, error) {
+	flag.BoolVar(&verbose, "v", false, "Enable verbose logging to console")
+	flag.BoolVar(&forceRejoin, "force-rejoin", false, "Always re-join the session on startup")
+	flag.BoolVar(&strictBootstrap, "strict", false, "Abort startup on any download failure")
+	flag.StringVar(&serverName, "server", "", "Use the named server from config.json for this run (see server use)")
+	flag.StringVar(&sessionFlag, "session", "", "Join the named session without prompting")
+	flag.BoolVar(&showVersion, "version", false, "Print version information and exit")
+	flag.BoolVar(&versionJSON, "json", false, "With -version, print the full build and capability report as JSON")
+	flag.StringVar(&telemetry, "telemetry", "", "Set the usage report consent: on or off (remembered)")
+	flag.BoolVar(&hidden, "hidden", false, "Run without a console; setup and control happen in the local web UI")
+	flag.Parse()
+
+	if showVersion {
+		printVersion(versionJSON)
+		os.Exit(ExitOK)
+	}
+	if hidden {
+		// Nobody would see console output; everything goes to client.log.
+		verbose = false
+		if err := hideConsole(); err != nil {
+			log.Printf("Could not hide console: %v", err)
+		}
+	}
+
+	logFile, err := initLogging()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize logging: %w", err)
+	}
+
+	log.Println("=== Game Client Starting ===")
+
+	cfg, err := LoadOrCreateConfig("config.json")
+	if err != nil {
+		return nil, fmt.Errorf("config load/create failed: %w", err)
+	}
+	if serverName != "" {
+		if err := cfg.UseServer(serverName); err != nil {
+			return nil, err
+		}
+		log.Printf("Using server '%s' (%s)", serverName, cfg.ServerURL)
+	}
+	if sessionFlag != "" {
+		cfg.SessionName = sessionFlag
+	}
+
+	consent, err := parseTelemetryFlag(telemetry)
+	if err != nil {
+		return nil, err
+	}
+	if consent != "" {
+		setTelemetryConsent(cfg, consent)
+		if err := SaveConfig(cfg, "config.json"); err != nil {
+			log.Printf("Could not save telemetry setting: %v", err)
+		}
+	}
+
+	if hidden && cfg.StatusPort == 0 {
+		cfg.StatusPort = defaultStatusPort
+	}
+
+	app, err := New(cfg, Options{})
+	if err != nil {
+		return nil, err
+	}
+	app.logFile = logFile
+	return app, nil
+}
+
+func initLogging() (*os.File, error) {
+	logFile, err := os.OpenFile(
+		"client.log",
+		os.O_CREATE|os.O_WRONLY|os.O_APPEND,
+		0o666,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if verbose {
+		logLevels.setBase(LogDebug)
+		mw := io.MultiWriter(os.Stdout, logFile)
+		log.SetOutput(mw)
+	} else {
+		log.SetOutput(logFile)
+	}
+	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+	return logFile, nil
+}
+
+// runSubcommand handles maintenance subcommands that run without the full
+// client. It reports whether a subcommand was recognized.
+func runSubcommand(args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+	switch args[0] {
+	case "clean":
+		fs := flag.NewFlagSet("clean", flag.ExitOnError)
+		cache := fs.Bool("cache", false, "Remove cached BizHawk/overlay archives")
+		library := fs.Bool("library", false, "Remove prefetched ROMs the current session does not use")
+		_ = fs.Parse(args[1:])
+		if !*cache && !*library {
+			return true, fmt.Errorf("clean: nothing selected (use --cache and/or --library)")
+		}
+		if *cache {
+			if err := CleanArchiveCache(); err != nil {
+				return true, err
+			}
+			fmt.Println("Archive cache removed.")
+		}
+		if *library {
+			cfg, err := LoadConfig("config.json")
+			if err != nil {
+				return true, err
+			}
+			n, err := cleanPrefetched(cfg.RomDir)
+			if err != nil {
+				return true, err
+			}
+			fmt.Printf("Removed %d prefetched ROM(s).\n", n)
+		}
+		return true, nil
+	case "server":
+		return true, serverCommand(args[1:], "config.json")
+	case "doctor":
+		return true, runDoctor("config.json")
+	case "selftest":
+		return true, runSelftest()
+	case "prefetch":
+		return true, runPrefetch(args[1:], "config.json")
+	case "import":
+		return true, runImport(args[1:], "config.json")
+	}
+	return false, nil
+}
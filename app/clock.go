@@ -0,0 +1,156 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// clockSamples is the default number of round trips per offset
+	// measurement.
+	clockSamples = 5
+	// timeSyncSamples is used when the host explicitly asks for a sync,
+	// e.g. before the final round.
+	timeSyncSamples = 15
+	// clockSampleGap spaces samples so one network hiccup doesn't skew
+	// them all.
+	clockSampleGap = 100 * time.Millisecond
+	// clockSkewWarn is the offset beyond which the player is told their
+	// clock is off; scheduled actions are corrected either way.
+	clockSkewWarn = 2 * time.Second
+)
+
+// ClockSample is one measurement of the server clock relative to ours.
+// Offset is server time minus local time.
+type ClockSample struct {
+	Offset time.Duration
+	RTT    time.Duration
+}
+
+// ServerTime fetches the server's current time and the round-trip time
+// of the request.
+func (a *API) ServerTime(ctx context.Context) (time.Time, error) {
+	req, err := a.newRequest(ctx, http.MethodGet, "/api/time", nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp, _, err := a.do(req)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("time send error: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, newAPIError("time", resp)
+	}
+	var data struct {
+		ServerTimeMs int64 `json:"server_time_ms"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return time.Time{}, fmt.Errorf("decode time response: %w", err)
+	}
+	if data.ServerTimeMs == 0 {
+		return time.Time{}, errors.New("time response missing server_time_ms")
+	}
+	return time.UnixMilli(data.ServerTimeMs), nil
+}
+
+// TimeSync measures the server clock offset with the default number of
+// samples.
+func (a *API) TimeSync(ctx context.Context) (ClockSample, error) {
+	return measureClockOffset(ctx, a.ServerTime, time.Now, clockSamples)
+}
+
+// TimeSyncReport tells the server the result of a host-requested sync.
+func (a *API) TimeSyncReport(ctx context.Context, s ClockSample, samples int) error {
+	payload := map[string]any{
+		"offset_ms": s.Offset.Milliseconds(),
+		"rtt_ms":    s.RTT.Milliseconds(),
+		"samples":   samples,
+	}
+	req, err := a.newRequest(ctx, http.MethodPost, "/api/time-sync-report", payload)
+	if err != nil {
+		return err
+	}
+	resp, _, err := a.do(req)
+	if err != nil {
+		return fmt.Errorf("time-sync-report send error: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return newAPIError("time-sync-report", resp)
+	}
+	return nil
+}
+
+// measureClockOffset samples the server clock and returns the sample
+// with the lowest RTT, whose midpoint estimate is the most reliable.
+// now is the local clock.
+func measureClockOffset(
+	ctx context.Context,
+	serverTime func(context.Context) (time.Time, error),
+	now func() time.Time,
+	samples int,
+) (ClockSample, error) {
+	var best ClockSample
+	var lastErr error
+	got := 0
+	for i := 0; i < samples; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return best, ctx.Err()
+			case <-time.After(clockSampleGap):
+			}
+		}
+		sent := now()
+		server, err := serverTime(ctx)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		rtt := now().Sub(sent)
+		s := ClockSample{Offset: server.Sub(sent.Add(rtt / 2)), RTT: rtt}
+		if got == 0 || s.RTT < best.RTT {
+			best = s
+		}
+		got++
+	}
+	if got == 0 {
+		return best, fmt.Errorf("no clock samples: %w", lastErr)
+	}
+	return best, nil
+}
+
+// SetClockOffset records server time minus local time, warning when the
+// local clock is far enough off to notice.
+func (s *ClientState) SetClockOffset(d time.Duration) {
+	s.mu.Lock()
+	s.clockOffset = d
+	s.mu.Unlock()
+	if d > clockSkewWarn || d < -clockSkewWarn {
+		log.Printf("WARNING: this computer's clock is %s off the server's; scheduled swaps are corrected for it", d.Abs().Round(time.Millisecond))
+	}
+}
+
+// ClockOffset returns server time minus local time.
+func (s *ClientState) ClockOffset() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clockOffset
+}
+
+// ServerNow estimates the server's current time.
+func (s *ClientState) ServerNow() time.Time {
+	return s.now().Add(s.ClockOffset())
+}
+
+// localUnix converts a server-scheduled Unix time to the local clock the
+// Lua script fires on.
+func (s *ClientState) localUnix(at int64) int64 {
+	return time.Unix(at, 0).Add(-s.ClockOffset()).Unix()
+}
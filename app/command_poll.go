@@ -0,0 +1,121 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// commandPollInterval is how often pending commands are fetched while
+	// the websocket is down.
+	commandPollInterval = 5 * time.Second
+	// commandDedupSize bounds how many command ids are remembered.
+	commandDedupSize = 256
+)
+
+// commandDedup remembers recently executed command ids so a command seen
+// both by polling and over Pusher runs only once. The oldest ids are
+// forgotten first.
+type commandDedup struct {
+	mu    sync.Mutex
+	seen  map[string]bool
+	order []string
+	max   int
+}
+
+func newCommandDedup(max int) *commandDedup {
+	return &commandDedup{seen: make(map[string]bool), max: max}
+}
+
+// firstSight records id and reports whether it was new.
+func (d *commandDedup) firstSight(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.seen[id] {
+		return false
+	}
+	if len(d.order) >= d.max {
+		delete(d.seen, d.order[0])
+		d.order = d.order[1:]
+	}
+	d.seen[id] = true
+	d.order = append(d.order, id)
+	return true
+}
+
+// GetPendingCommands fetches the commands the server has for this player,
+// in the same shape as Pusher delivers them.
+func (a *API) GetPendingCommands(ctx context.Context) ([]WSMessage, error) {
+	req, err := a.newRequest(ctx, http.MethodGet, "/api/commands", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, _, err := a.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("commands send error: %w", err)
+	}
+	if resp == nil {
+		return nil, fmt.Errorf("nil commands response")
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrEndpointUnsupported
+	default:
+		return nil, newAPIError("commands", resp)
+	}
+	var cmds []WSMessage
+	if err := json.NewDecoder(resp.Body).Decode(&cmds); err != nil {
+		return nil, fmt.Errorf("decode commands response: %w", err)
+	}
+	return cmds, nil
+}
+
+// pollCommands keeps the client in the game while Pusher is unreachable
+// by fetching pending commands over plain HTTP and dispatching them.
+func (a *App) pollCommands(ctx context.Context) {
+	ticker := time.NewTicker(commandPollInterval)
+	defer ticker.Stop()
+	polling := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if a.state.Snapshot().Connected {
+			if polling {
+				log.Println("Websocket back; stopped polling for commands")
+				polling = false
+			}
+			continue
+		}
+		if !polling {
+			log.Println("Websocket down; polling the server for commands")
+			polling = true
+		}
+
+		pctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		cmds, err := a.api.GetPendingCommands(pctx)
+		cancel()
+		if errors.Is(err, ErrEndpointUnsupported) {
+			log.Println("Server has no command polling endpoint; waiting for the websocket")
+			return
+		}
+		if err != nil {
+			debugf("Command poll failed: %v", err)
+			continue
+		}
+		for _, msg := range cmds {
+			a.handlers.dispatch(msg)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+type Config struct {
+	// Named servers and the one in use. The flat server fields below are
+	// the resolved view of the active entry; they are only read from disk
+	// to migrate configs written before profiles existed.
+	Servers      map[string]*ServerProfile `json:"servers"`
+	ActiveServer string                    `json:"active_server"`
+
+	AppKey      string `json:"app_key,omitempty"`
+	BearerToken string `json:"bearer_token,omitempty"`
+
+	ServerScheme string `json:"server_scheme,omitempty"`
+	ServerHost   string `json:"server_host,omitempty"`
+	ServerPort   int    `json:"server_port,omitempty"`
+
+	PusherPort int `json:"pusher_port,omitempty"`
+
+	PlayerName  string `json:"player_name,omitempty"`
+	SessionName string `json:"session_name,omitempty"`
+
+	BizHawkDownloadURL string `json:"bizhawk_download_url"`
+	// Optional per-architecture overrides keyed by GOARCH (amd64, arm64, 386).
+	BizHawkDownloadURLs map[string]string `json:"bizhawk_download_urls,omitempty"`
+	// Optional EmuHawk.exe to launch instead of the install picked for
+	// the session's required BizHawk version.
+	BizHawkPath string `json:"bizhawk_path"`
+	// BizhawkFiles overlay version last applied, keyed by install
+	// directory, so a changed overlay is extracted again.
+	BizhawkFilesApplied map[string]string `json:"bizhawk_files_applied,omitempty"`
+	LuaScript           string            `json:"lua_script"`
+	RomDir              string            `json:"rom_dir"`
+	SaveDir             string            `json:"save_dir"`
+
+	BizhawkIPCPort int `json:"bizhawk_ipc_port"`
+	// Loopback address the IPC listener binds; "::1" on IPv6-only setups.
+	BizhawkIPCHost string `json:"bizhawk_ipc_host,omitempty"`
+	// IPC ACK timeouts in milliseconds for commands in general (default
+	// 5000), SAVE (default 15000) and SWAP (default 10000), and how often
+	// an unanswered command is resent (default 3; negative for never).
+	IPCCommandTimeoutMS int `json:"ipc_command_timeout_ms,omitempty"`
+	IPCSaveTimeoutMS    int `json:"ipc_save_timeout_ms,omitempty"`
+	IPCSwapTimeoutMS    int `json:"ipc_swap_timeout_ms,omitempty"`
+	IPCRetries          int `json:"ipc_retries,omitempty"`
+
+	// Optional savestate encryption; the passphrase is shared out-of-band.
+	// It lives in the credential store (see credentials.go): one entered
+	// here is moved there on the next load and never written back.
+	SavePassphrase string `json:"save_passphrase,omitempty"`
+	CompressSaves  bool   `json:"compress_saves"`
+	// Sessions that do not collect savestates turn off uploading them;
+	// saves are still captured locally.
+	SkipSaveUpload bool `json:"skip_save_upload,omitempty"`
+
+	DesktopNotifications bool `json:"desktop_notifications"`
+
+	// Overrides for client-originated overlay/notification text, keyed as
+	// in messages.go. An empty string disables that message.
+	Messages map[string]string `json:"messages,omitempty"`
+
+	// Maximum age of an overdue scheduled action that is still executed.
+	CatchUpStartSeconds int `json:"catch_up_start_seconds,omitempty"`
+	CatchUpSwapSeconds  int `json:"catch_up_swap_seconds,omitempty"`
+
+	// Size cap for the shared download cache of large archives.
+	ArchiveCacheMB int `json:"archive_cache_mb,omitempty"`
+	// Free space on the data directory's volume below which the client
+	// warns; defaults to 1024.
+	DiskFloorMB int `json:"disk_floor_mb,omitempty"`
+
+	// Report the heartbeat POST's round trip as ping, for servers without
+	// the lightweight /api/ping route.
+	PingViaHeartbeat bool `json:"ping_via_heartbeat,omitempty"`
+
+	// Managed environments install BizHawk prerequisites themselves.
+	SkipPrereqInstall bool `json:"skip_prereq_install,omitempty"`
+
+	// Optional bandwidth caps in KB/s per download class ("background",
+	// "urgent"); absent or 0 means unlimited. Adjustable at runtime from
+	// the status page.
+	DownloadLimitsKBps map[string]int `json:"download_limits_kbps,omitempty"`
+
+	// Path to chdman for sessions that ship discs as CHD; defaults to
+	// looking it up on PATH.
+	ChdmanPath string `json:"chdman_path,omitempty"`
+
+	// Grace windows during which missed heartbeats do not mark the client
+	// disconnected: after launch (until the first heartbeat and HELLO,
+	// capped at StartupGraceSeconds) and after each acknowledged swap.
+	StartupGraceSeconds int `json:"startup_grace_seconds,omitempty"`
+	SwapGraceSeconds    int `json:"swap_grace_seconds,omitempty"`
+
+	// Base heartbeat interval (default 10). The server may override it per
+	// response; the disconnect watchdog scales with the effective value.
+	HeartbeatSeconds int `json:"heartbeat_seconds,omitempty"`
+
+	// Consecutive API failures (transport errors or 5xx, on any endpoint)
+	// that mark the server unreachable (default 5), and how long requests
+	// are then held back before a probe is let through (default 15).
+	CircuitFailureThreshold int `json:"circuit_failure_threshold,omitempty"`
+	CircuitCooldownSeconds  int `json:"circuit_cooldown_seconds,omitempty"`
+
+	// Opt-in anonymous usage report (see telemetry.go). Telemetry is ""
+	// until the player is asked, then "granted" or "denied".
+	Telemetry    string `json:"telemetry,omitempty"`
+	TelemetryURL string `json:"telemetry_url,omitempty"`
+	TelemetryID  string `json:"telemetry_id,omitempty"`
+
+	// LongPaths disables ROM file name shortening for Windows installs with
+	// long path support enabled, where BizHawk can open paths past MAX_PATH.
+	LongPaths bool `json:"long_paths,omitempty"`
+
+	// Local status page (0 disables it). Control actions on the page
+	// require ControlToken, which is generated on first use.
+	StatusPort   int    `json:"status_port,omitempty"`
+	ControlToken string `json:"control_token,omitempty"`
+
+	// TLS for self-hosted servers: an extra PEM bundle to trust, or (last
+	// resort) no certificate verification at all.
+	TLSCAFile     string `json:"tls_ca_file,omitempty"`
+	TLSSkipVerify bool   `json:"tls_skip_verify,omitempty"`
+
+	// HTTP proxy for API calls and downloads, e.g. http://proxy:3128.
+	// Empty uses HTTP_PROXY/HTTPS_PROXY from the environment.
+	ProxyURL string `json:"proxy_url,omitempty"`
+
+	// Log every server API call with its status, latency and the start
+	// of the response, tokens redacted. Also enabled by -v.
+	LogHTTP bool `json:"log_http,omitempty"`
+
+	// Computed
+	ServerURL  string `json:"-"`
+	InstanceID string `json:"-"`
+	HostArch   string `json:"-"`
+	// EmuHawkPath is the EmuHawk.exe selected for the session.
+	EmuHawkPath string `json:"-"`
+
+	// savedServer is the active_server SaveConfig writes. The -server flag
+	// switches ActiveServer for one run only; "server use" changes both.
+	savedServer string
+}
+
+// ServerProfile is one named server with the identity registered on it, so
+// switching back does not require re-registering or re-entering a session.
+type ServerProfile struct {
+	Scheme     string `json:"scheme"`
+	Host       string `json:"host"`
+	Port       int    `json:"port"`
+	PusherPort int    `json:"pusher_port"`
+
+	AppKey      string `json:"app_key"`
+	BearerToken string `json:"bearer_token"`
+	PlayerName  string `json:"player_name"`
+	SessionName string `json:"session_name"`
+}
+
+// defaultIPCHost is the IPv4 loopback the Lua script has always used.
+const defaultIPCHost = "127.0.0.1"
+
+// defaultServerName is the profile a legacy flat config migrates into.
+const defaultServerName = "default"
+
+// UseServer makes the named profile active and resolves its fields into
+// the flat view used by the rest of the client.
+func (c *Config) UseServer(name string) error {
+	p, ok := c.Servers[name]
+	if !ok {
+		return fmt.Errorf("unknown server %q (configured: %s)", name, strings.Join(c.ServerNames(), ", "))
+	}
+	c.ActiveServer = name
+	c.ServerScheme, c.ServerHost, c.ServerPort = p.Scheme, p.Host, p.Port
+	c.PusherPort = p.PusherPort
+	c.AppKey, c.BearerToken = p.AppKey, p.BearerToken
+	c.PlayerName, c.SessionName = p.PlayerName, p.SessionName
+	c.ComputeURLs()
+	return nil
+}
+
+// ServerNames returns the configured server names in sorted order.
+func (c *Config) ServerNames() []string {
+	names := make([]string, 0, len(c.Servers))
+	for n := range c.Servers {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// activeProfile builds a profile from the flat view.
+func (c *Config) activeProfile() *ServerProfile {
+	return &ServerProfile{
+		Scheme:      c.ServerScheme,
+		Host:        c.ServerHost,
+		Port:        c.ServerPort,
+		PusherPort:  c.PusherPort,
+		AppKey:      c.AppKey,
+		BearerToken: c.BearerToken,
+		PlayerName:  c.PlayerName,
+		SessionName: c.SessionName,
+	}
+}
+
+// resolveServers migrates a flat config into a single "default" profile
+// and activates the selected server.
+func (c *Config) resolveServers() error {
+	if len(c.Servers) == 0 {
+		c.Servers = map[string]*ServerProfile{defaultServerName: c.activeProfile()}
+		c.ActiveServer = defaultServerName
+	}
+	if c.ActiveServer == "" {
+		if len(c.Servers) != 1 {
+			return fmt.Errorf("active_server must name one of: %s", strings.Join(c.ServerNames(), ", "))
+		}
+		c.ActiveServer = c.ServerNames()[0]
+	}
+	c.savedServer = c.ActiveServer
+	return c.UseServer(c.ActiveServer)
+}
+
+func (c *Config) ComputeURLs() {
+	c.ServerURL = fmt.Sprintf("%s://%s", c.ServerScheme, hostPort(c.ServerHost, c.ServerPort))
+}
+
+func DefaultConfig() *Config {
+	cfg := &Config{
+		AppKey:      "",
+		BearerToken: "",
+
+		ServerScheme: "http",
+		ServerHost:   "bizhawk-shuffler-server.test",
+		ServerPort:   8080,
+
+		PusherPort: 8000,
+
+		PlayerName:  "",
+		SessionName: "",
+
+		BizHawkDownloadURL: "https://github.com/TASEmulators/BizHawk/releases/download/2.10/BizHawk-2.10-win-x64.zip",
+		LuaScript:          "scripts\\swap_latest.lua",
+		RomDir:             "roms",
+		SaveDir:            "saves",
+
+		BizhawkIPCPort: 55355,
+		BizhawkIPCHost: defaultIPCHost,
+	}
+	_ = cfg.resolveServers()
+	return cfg
+}
+
+func LoadOrCreateConfig(path string) (*Config, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		cfg := DefaultConfig()
+		if err := SaveConfig(cfg, path); err != nil {
+			return nil, err
+		}
+		return cfg, nil
+	}
+	return LoadConfig(path)
+}
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := decodeJSON(path, data, &cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.BizhawkIPCPort == 0 {
+		cfg.BizhawkIPCPort = 55355
+	}
+	if cfg.BizhawkIPCHost == "" {
+		cfg.BizhawkIPCHost = defaultIPCHost
+	}
+
+	if err := cfg.resolveServers(); err != nil {
+		return nil, err
+	}
+	if err := loadSavePassphrase(&cfg, path); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// SaveConfig writes the flat view back into the active server's profile
+// and persists the config with only the profiles holding server fields.
+// A server picked with -server is not saved as the active one.
+func SaveConfig(cfg *Config, path string) error {
+	if cfg.ActiveServer != "" {
+		if cfg.Servers == nil {
+			cfg.Servers = make(map[string]*ServerProfile)
+		}
+		cfg.Servers[cfg.ActiveServer] = cfg.activeProfile()
+	}
+	out := *cfg
+	if cfg.savedServer != "" {
+		out.ActiveServer = cfg.savedServer
+	}
+	out.ServerScheme, out.ServerHost, out.ServerPort, out.PusherPort = "", "", 0, 0
+	out.AppKey, out.BearerToken, out.PlayerName, out.SessionName = "", "", "", ""
+	out.SavePassphrase = ""
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&out)
+}
+
+// serverCommand implements the "server list" and "server use <name>"
+// subcommands.
+func serverCommand(args []string, path string) error {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		for _, name := range cfg.ServerNames() {
+			marker := " "
+			if name == cfg.ActiveServer {
+				marker = "*"
+			}
+			p := cfg.Servers[name]
+			fmt.Printf("%s %s\t%s://%s\n", marker, name, p.Scheme, hostPort(p.Host, p.Port))
+		}
+		return nil
+	case len(args) == 2 && args[0] == "use":
+		if err := cfg.UseServer(args[1]); err != nil {
+			return err
+		}
+		cfg.savedServer = cfg.ActiveServer
+		if err := SaveConfig(cfg, path); err != nil {
+			return err
+		}
+		fmt.Printf("Active server: %s (%s)\n", cfg.ActiveServer, cfg.ServerURL)
+		return nil
+	}
+	return fmt.Errorf("usage: server list | server use <name>")
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const twoServerConfig = `{
+  "servers": {
+    "home": {"scheme": "https", "host": "home.example", "port": 443, "pusher_port": 6001,
+             "app_key": "home-key", "bearer_token": "home-token", "player_name": "ana", "session_name": "relay"},
+    "club": {"scheme": "http", "host": "club.example", "port": 8080, "pusher_port": 8000,
+             "app_key": "club-key", "bearer_token": "club-token", "player_name": "ana", "session_name": "marathon"}
+  },
+  "active_server": "home"
+}`
+
+func writeTestConfig(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigResolvesActiveServer(t *testing.T) {
+	cfg, err := LoadConfig(writeTestConfig(t, twoServerConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ServerURL != "https://home.example:443" || cfg.BearerToken != "home-token" || cfg.SessionName != "relay" {
+		t.Errorf("resolved view = %s, %s, %s", cfg.ServerURL, cfg.BearerToken, cfg.SessionName)
+	}
+	if err := cfg.UseServer("club"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ServerURL != "http://club.example:8080" || cfg.BearerToken != "club-token" || cfg.PusherPort != 8000 {
+		t.Errorf("after switch = %s, %s, %d", cfg.ServerURL, cfg.BearerToken, cfg.PusherPort)
+	}
+	if err := cfg.UseServer("nowhere"); err == nil || !strings.Contains(err.Error(), "club, home") {
+		t.Errorf("UseServer(nowhere) = %v; want the configured names", err)
+	}
+}
+
+func TestConfigAmbiguousActiveServer(t *testing.T) {
+	body := strings.Replace(twoServerConfig, `"active_server": "home"`, `"active_server": ""`, 1)
+	if _, err := LoadConfig(writeTestConfig(t, body)); err == nil {
+		t.Error("LoadConfig accepted two servers and no active_server")
+	}
+}
+
+func TestConfigMigratesFlatConfig(t *testing.T) {
+	path := writeTestConfig(t, `{
+  "server_scheme": "http", "server_host": "old.example", "server_port": 9000,
+  "app_key": "k", "bearer_token": "t", "player_name": "ana", "session_name": "s"
+}`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ActiveServer != defaultServerName || cfg.ServerURL != "http://old.example:9000" {
+		t.Fatalf("migrated to %q at %s", cfg.ActiveServer, cfg.ServerURL)
+	}
+	if err := SaveConfig(cfg, path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), `"server_host"`) {
+		t.Errorf("saved config still has flat server fields:\n%s", data)
+	}
+	cfg, err = LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := cfg.Servers[defaultServerName]; p == nil || p.Host != "old.example" || p.BearerToken != "t" {
+		t.Errorf("migrated profile = %+v", p)
+	}
+}
+
+func TestServerFlagIsNotPersisted(t *testing.T) {
+	path := writeTestConfig(t, twoServerConfig)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// -server club, then an unrelated save such as a token renewal.
+	if err := cfg.UseServer("club"); err != nil {
+		t.Fatal(err)
+	}
+	cfg.BearerToken = "club-token-2"
+	if err := SaveConfig(cfg, path); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err = LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ActiveServer != "home" {
+		t.Errorf("active server after save = %q; want home", cfg.ActiveServer)
+	}
+	// The renewed token still belongs to the server it was issued by.
+	if got := cfg.Servers["club"].BearerToken; got != "club-token-2" {
+		t.Errorf("club token = %q; want club-token-2", got)
+	}
+	if got := cfg.Servers["home"].BearerToken; got != "home-token" {
+		t.Errorf("home token = %q; want home-token", got)
+	}
+}
+
+func TestServerUsePersists(t *testing.T) {
+	path := writeTestConfig(t, twoServerConfig)
+	if err := serverCommand([]string{"use", "club"}, path); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ActiveServer != "club" || cfg.SessionName != "marathon" {
+		t.Errorf("after server use: %q, session %q", cfg.ActiveServer, cfg.SessionName)
+	}
+	if err := serverCommand([]string{"use"}, path); err == nil {
+		t.Error("server use without a name succeeded")
+	}
+}
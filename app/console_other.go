@@ -0,0 +1,9 @@
+//go:build !windows
+
+package app
+
+// hideConsole is a no-op outside Windows; detach from the terminal with
+// the shell instead.
+func hideConsole() error {
+	return nil
+}
@@ -0,0 +1,15 @@
+package app
+
+import "syscall"
+
+// hideConsole hides the console window the client was started with, for
+// launches from a Stream Deck or shortcut where it is only in the way.
+func hideConsole() error {
+	hwnd, _, _ := syscall.NewLazyDLL("kernel32.dll").NewProc("GetConsoleWindow").Call()
+	if hwnd == 0 {
+		return nil
+	}
+	const swHide = 0
+	_, _, _ = syscall.NewLazyDLL("user32.dll").NewProc("ShowWindow").Call(hwnd, swHide)
+	return nil
+}
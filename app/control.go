@@ -0,0 +1,100 @@
+package app
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrNotRunning is returned by a Control obtained before Run wired the
+	// client up.
+	ErrNotRunning = errors.New("client is not running")
+	// ErrHardcoreLocked refuses a local pause or resume while the session
+	// is in hardcore mode, where the host forbids players pausing on their
+	// own.
+	ErrHardcoreLocked = errors.New("hardcore mode is on for this ranked session; local pause and resume are disabled")
+	// ErrEmptyMessage rejects an overlay message with nothing to show.
+	ErrEmptyMessage = errors.New("empty message")
+)
+
+// Control performs the operations of the local control endpoints: the
+// status page's buttons call the same methods.
+type Control struct {
+	state *ClientState
+	ipc   EmulatorIPC
+	dl    *DownloadManager
+}
+
+func newControl(state *ClientState, ipc EmulatorIPC, dl *DownloadManager) *Control {
+	return &Control{state: state, ipc: ipc, dl: dl}
+}
+
+func (c *Control) running() error {
+	if c.ipc == nil {
+		return ErrNotRunning
+	}
+	return nil
+}
+
+// Pause pauses the emulator.
+func (c *Control) Pause() error {
+	if err := c.running(); err != nil {
+		return err
+	}
+	if c.state.Hardcore() {
+		return ErrHardcoreLocked
+	}
+	c.ipc.SendPause(nil)
+	return nil
+}
+
+// Resume resumes the emulator.
+func (c *Control) Resume() error {
+	if err := c.running(); err != nil {
+		return err
+	}
+	if c.state.Hardcore() {
+		return ErrHardcoreLocked
+	}
+	c.ipc.SendResume(nil)
+	return nil
+}
+
+// Message shows text on the emulator's overlay.
+func (c *Control) Message(text string) error {
+	if err := c.running(); err != nil {
+		return err
+	}
+	text = ipcText(text)
+	if strings.TrimSpace(text) == "" {
+		return ErrEmptyMessage
+	}
+	c.ipc.SendMessage(text)
+	return nil
+}
+
+// DownloadLimits returns the bandwidth limit of each download class in
+// KB/s, 0 meaning unlimited.
+func (c *Control) DownloadLimits() (map[DownloadClass]int, error) {
+	if err := c.running(); err != nil {
+		return nil, err
+	}
+	return c.dl.Limits(), nil
+}
+
+// SetDownloadLimit limits the named download class to kbps KB/s; 0 lifts
+// the limit.
+func (c *Control) SetDownloadLimit(class string, kbps int) error {
+	if err := c.running(); err != nil {
+		return err
+	}
+	dc, err := parseDownloadClass(class)
+	if err != nil {
+		return err
+	}
+	if kbps < 0 {
+		return errors.New("kbps must not be negative")
+	}
+	c.dl.SetLimit(dc, kbps)
+	return nil
+}
@@ -0,0 +1,85 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestControlNotRunning(t *testing.T) {
+	c := newControl(NewClientState(), nil, nil)
+	calls := map[string]func() error{
+		"Pause":   c.Pause,
+		"Resume":  c.Resume,
+		"Message": func() error { return c.Message("hi") },
+		"DownloadLimits": func() error {
+			_, err := c.DownloadLimits()
+			return err
+		},
+		"SetDownloadLimit": func() error { return c.SetDownloadLimit("background", 100) },
+	}
+	for name, call := range calls {
+		if err := call(); !errors.Is(err, ErrNotRunning) {
+			t.Errorf("%s = %v, want ErrNotRunning", name, err)
+		}
+	}
+}
+
+func TestControl(t *testing.T) {
+	state := NewClientState()
+	ipc := &recordingIPC{}
+	dl := NewDownloadManager(http.DefaultClient, state, &Config{})
+	c := newControl(state, ipc, dl)
+
+	if err := c.Pause(); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	if err := c.Resume(); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if ipc.pauses != 1 || ipc.resumes != 1 {
+		t.Errorf("pauses, resumes = %d, %d; want 1, 1", ipc.pauses, ipc.resumes)
+	}
+
+	if err := c.Message("  \n "); !errors.Is(err, ErrEmptyMessage) {
+		t.Errorf("blank Message = %v, want ErrEmptyMessage", err)
+	}
+	if err := c.Message("hello"); err != nil || len(ipc.messages) != 1 {
+		t.Errorf("Message = %v, sent %q", err, ipc.messages)
+	}
+
+	if err := c.SetDownloadLimit("background", -1); err == nil {
+		t.Error("negative limit accepted")
+	}
+	if err := c.SetDownloadLimit("nonsense", 1); err == nil {
+		t.Error("unknown class accepted")
+	}
+	if err := c.SetDownloadLimit("background", 250); err != nil {
+		t.Fatalf("SetDownloadLimit: %v", err)
+	}
+	limits, err := c.DownloadLimits()
+	if err != nil || limits[DownloadBackground] != 250 {
+		t.Errorf("DownloadLimits = %v, %v; want background 250", limits, err)
+	}
+
+	state.SetHardcore(true)
+	if err := c.Pause(); !errors.Is(err, ErrHardcoreLocked) {
+		t.Errorf("hardcore Pause = %v, want ErrHardcoreLocked", err)
+	}
+	if err := c.Resume(); !errors.Is(err, ErrHardcoreLocked) {
+		t.Errorf("hardcore Resume = %v, want ErrHardcoreLocked", err)
+	}
+}
+
+func TestShutdownBeforeRun(t *testing.T) {
+	t.Chdir(t.TempDir())
+	a, err := New(&Config{}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Shutdown()
+	a.Shutdown()
+	if _, err := a.Control().DownloadLimits(); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Control before Run: %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// convertedDir (under the ROM directory) holds conversion outputs; the
+	// downloaded originals stay where they are.
+	convertedDir = "converted"
+
+	chdmanTool = "chdman"
+
+	// conversionTimeout bounds one disc conversion.
+	conversionTimeout = 20 * time.Minute
+)
+
+// ConversionError explains a disc that could not be converted and what the
+// player needs to fix it.
+type ConversionError struct {
+	File string
+	Tool string
+	Err  error
+}
+
+func (e *ConversionError) Error() string {
+	if errors.Is(e.Err, exec.ErrNotFound) {
+		return fmt.Sprintf(
+			"%s must be converted but %s was not found: install it (part of MAME tools) and set chdman_path in config.json",
+			e.File, e.Tool,
+		)
+	}
+	return fmt.Sprintf("convert %s with %s: %v", e.File, e.Tool, e.Err)
+}
+
+func (e *ConversionError) Unwrap() error { return e.Err }
+
+// needsConversion reports the manifest entry if file is a compressed disc
+// that the session wants converted before BizHawk loads it.
+func (m *SessionManifest) needsConversion(file string) (*ManifestGame, bool) {
+	if m == nil || !strings.EqualFold(filepath.Ext(file), ".chd") {
+		return nil, false
+	}
+	for i := range m.Games {
+		g := &m.Games[i]
+		if g.ConvertTo == "" {
+			continue
+		}
+		if g.File == file || (g.ExtraFile != nil && *g.ExtraFile == file) {
+			return g, true
+		}
+	}
+	return nil, false
+}
+
+// convertedName is where the converted form of file lives, relative to the
+// ROM directory.
+func convertedName(file, format string) string {
+	stem := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	return filepath.Join(convertedDir, stem+"."+format)
+}
+
+// EmulatorFile is the ROM-relative path BizHawk should load for a canonical
+// game file: the converted disc when the session asks for conversion,
+// otherwise the local (possibly shortened) name.
+func (m *SessionManifest) EmulatorFile(file string) string {
+	if g, ok := m.needsConversion(file); ok {
+		return convertedName(m.LocalName(file), g.ConvertTo)
+	}
+	return m.LocalName(file)
+}
+
+// ensureConverted converts a downloaded disc if the session requires it
+// and no converted copy exists yet.
+func ensureConverted(ctx context.Context, cfg *Config, m *SessionManifest, file string) error {
+	g, ok := m.needsConversion(file)
+	if !ok {
+		return nil
+	}
+	out := filepath.Join(cfg.RomDir, m.EmulatorFile(file))
+	if _, err := os.Stat(out); err == nil {
+		return nil
+	}
+	src := filepath.Join(cfg.RomDir, m.LocalName(file))
+	return convertDisc(ctx, cfg.ChdmanPath, src, out, g.ConvertTo, g.ConvertedSHA256)
+}
+
+// convertDisc runs chdman to turn src into out (a .cue with its .bin next
+// to it) and verifies the .bin against wantSHA256 when one is given.
+// Partial outputs are removed on failure.
+func convertDisc(ctx context.Context, tool, src, out, format, wantSHA256 string) error {
+	file := filepath.Base(src)
+	if tool == "" {
+		tool = chdmanTool
+	}
+	if format != "cue" {
+		return &ConversionError{File: file, Tool: tool, Err: fmt.Errorf("unsupported target format %q", format)}
+	}
+	path, err := exec.LookPath(tool)
+	if err != nil {
+		return &ConversionError{File: file, Tool: tool, Err: err}
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		return err
+	}
+	bin := strings.TrimSuffix(out, filepath.Ext(out)) + ".bin"
+
+	ctx, cancel := context.WithTimeout(ctx, conversionTimeout)
+	defer cancel()
+	log.Printf("Converting %s to %s", file, filepath.Base(out))
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, path, "extractcd", "-i", src, "-o", out, "-ob", bin, "-f")
+	var tail bytes.Buffer
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return &ConversionError{File: file, Tool: tool, Err: err}
+	}
+	logConversionProgress(file, io.TeeReader(stderr, &tail))
+	if err := cmd.Wait(); err != nil {
+		removeConverted(out, bin)
+		msg := strings.TrimSpace(lastLine(tail.String()))
+		return &ConversionError{File: file, Tool: tool, Err: fmt.Errorf("%w: %s", err, msg)}
+	}
+
+	if wantSHA256 != "" {
+		got, err := fileSHA256(bin)
+		if err != nil {
+			removeConverted(out, bin)
+			return &ConversionError{File: file, Tool: tool, Err: err}
+		}
+		if !strings.EqualFold(got, wantSHA256) {
+			removeConverted(out, bin)
+			return &ConversionError{
+				File: file, Tool: tool,
+				Err: fmt.Errorf("converted image hash %s does not match expected %s", got, wantSHA256),
+			}
+		}
+	}
+	log.Printf("Converted %s in %s", file, time.Since(start).Round(time.Second))
+	return nil
+}
+
+// logConversionProgress relays chdman's "NN.N% complete" updates, which it
+// separates with carriage returns, at most once per 10%.
+func logConversionProgress(file string, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+	next := 10.0
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.Index(line, "%")
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(line[:i])
+		if len(fields) == 0 {
+			continue
+		}
+		var pct float64
+		if _, err := fmt.Sscanf(fields[len(fields)-1], "%g", &pct); err != nil {
+			continue
+		}
+		if pct >= next {
+			log.Printf("Converting %s: %.0f%%", file, pct)
+			next = pct - float64(int(pct)%10) + 10
+		}
+	}
+}
+
+func removeConverted(paths ...string) {
+	for _, p := range paths {
+		_ = os.Remove(p)
+	}
+}
+
+func lastLine(s string) string {
+	s = strings.TrimRight(s, "\r\n")
+	if i := strings.LastIndexAny(s, "\r\n"); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
@@ -0,0 +1,160 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stubChdmanEnv makes the test binary act as chdman (see TestMain). Its
+// value picks the behaviour: "ok" converts, "fail" exits with an error
+// after writing part of the output.
+const stubChdmanEnv = "GO_CLIENT_STUB_CHDMAN"
+
+const stubConvertedBin = "converted disc image"
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(stubChdmanEnv); mode != "" {
+		os.Exit(stubChdman(mode, os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// stubChdman imitates "chdman extractcd -i src -o out -ob bin -f".
+func stubChdman(mode string, args []string) int {
+	opts := map[string]string{}
+	for i := 0; i+1 < len(args); i++ {
+		if strings.HasPrefix(args[i], "-") {
+			opts[args[i]] = args[i+1]
+		}
+	}
+	if len(args) == 0 || args[0] != "extractcd" || opts["-i"] == "" || opts["-o"] == "" || opts["-ob"] == "" {
+		fmt.Fprintf(os.Stderr, "Error: bad arguments %q\n", args)
+		return 2
+	}
+	if _, err := os.Stat(opts["-i"]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening input file: %v\n", err)
+		return 1
+	}
+	for _, pct := range []string{"5.0", "12.5", "19.9", "47.0", "100.0"} {
+		fmt.Fprintf(os.Stderr, "Extracting, %s%% complete...\r", pct)
+	}
+	_ = os.WriteFile(opts["-ob"], []byte(stubConvertedBin), 0o644)
+	if mode == "fail" {
+		fmt.Fprintln(os.Stderr, "\nError: input file is not a CHD")
+		return 1
+	}
+	_ = os.WriteFile(opts["-o"], []byte(`FILE "disc.bin" BINARY`), 0o644)
+	fmt.Fprintln(os.Stderr, "\nExtraction complete")
+	return 0
+}
+
+// useStubChdman points cfg at the stub in the given mode.
+func useStubChdman(t *testing.T, mode string) string {
+	t.Helper()
+	t.Setenv(stubChdmanEnv, mode)
+	return os.Args[0]
+}
+
+func chdManifest(sum string) *SessionManifest {
+	return &SessionManifest{Games: []ManifestGame{
+		{ID: 1, File: "disc.chd", ConvertTo: "cue", ConvertedSHA256: sum},
+		{ID: 2, File: "plain.chd"},
+	}}
+}
+
+func writeDisc(t *testing.T, dir string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "disc.chd"), []byte("MComprHD"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEnsureConverted(t *testing.T) {
+	cfg := &Config{RomDir: t.TempDir(), ChdmanPath: useStubChdman(t, "ok")}
+	writeDisc(t, cfg.RomDir)
+	m := chdManifest(sha256Hex(stubConvertedBin))
+	logs := captureLog(t)
+
+	if err := ensureConverted(context.Background(), cfg, m, "disc.chd"); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.EmulatorFile("disc.chd"); got != filepath.Join(convertedDir, "disc.cue") {
+		t.Errorf("EmulatorFile = %s", got)
+	}
+	bin, err := os.ReadFile(filepath.Join(cfg.RomDir, convertedDir, "disc.bin"))
+	if err != nil || string(bin) != stubConvertedBin {
+		t.Errorf("converted bin = %q, %v", bin, err)
+	}
+	// Progress is logged once per 10% step reached.
+	var progress []string
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if _, pct, ok := strings.Cut(line, "Converting disc.chd: "); ok {
+			progress = append(progress, pct)
+		}
+	}
+	if got := strings.Join(progress, " "); got != "12% 47% 100%" {
+		t.Errorf("progress logged %q; want 12%% 47%% 100%%", got)
+	}
+
+	// An existing conversion is reused, and other discs are left alone.
+	t.Setenv(stubChdmanEnv, "fail")
+	if err := ensureConverted(context.Background(), cfg, m, "disc.chd"); err != nil {
+		t.Errorf("reconverted an existing output: %v", err)
+	}
+	if err := ensureConverted(context.Background(), cfg, m, "plain.chd"); err != nil {
+		t.Errorf("converted a disc the session did not ask for: %v", err)
+	}
+	if got := m.EmulatorFile("plain.chd"); got != "plain.chd" {
+		t.Errorf("EmulatorFile(plain.chd) = %s", got)
+	}
+}
+
+func TestConvertDiscFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   string
+		tool   string // "" uses the stub
+		format string
+		sum    string
+		want   string
+	}{
+		{"tool fails", "fail", "", "cue", "", "input file is not a CHD"},
+		{"hash mismatch", "ok", "", "cue", sha256Hex("something else"), "does not match expected"},
+		{"tool missing", "ok", "no-such-chdman", "cue", "", "was not found: install it"},
+		{"unsupported format", "ok", "", "iso", "", `unsupported target format "iso"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool := useStubChdman(t, tt.mode)
+			if tt.tool != "" {
+				tool = tt.tool
+			}
+			dir := t.TempDir()
+			writeDisc(t, dir)
+			out := filepath.Join(dir, convertedDir, "disc.cue")
+
+			err := convertDisc(context.Background(), tool, filepath.Join(dir, "disc.chd"), out, tt.format, tt.sum)
+			var conv *ConversionError
+			if !errors.As(err, &conv) || conv.File != "disc.chd" || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("convertDisc = %v; want a ConversionError containing %q", err, tt.want)
+			}
+			if tt.tool != "" && !errors.Is(err, exec.ErrNotFound) {
+				t.Errorf("missing tool error %v does not wrap exec.ErrNotFound", err)
+			}
+			for _, p := range []string{out, filepath.Join(dir, convertedDir, "disc.bin")} {
+				if _, err := os.Stat(p); !os.IsNotExist(err) {
+					t.Errorf("partial output %s kept: %v", filepath.Base(p), err)
+				}
+			}
+		})
+	}
+}
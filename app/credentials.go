@@ -0,0 +1,112 @@
+package app
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// credentialsFile holds secrets that are kept out of config.json, next to
+// it. Each value is protected with protectSecret: on Windows it is
+// encrypted with DPAPI for the current user, elsewhere the file is only
+// readable by its owner.
+const credentialsFile = "credentials.json"
+
+// savePassphraseCredential names the savestate encryption passphrase.
+const savePassphraseCredential = "save_passphrase"
+
+var credentialsMu sync.Mutex
+
+// loadCredential returns the secret stored under name in dir, or "" if
+// there is none.
+func loadCredential(dir, name string) (string, error) {
+	credentialsMu.Lock()
+	defer credentialsMu.Unlock()
+	creds, err := readCredentials(dir)
+	if err != nil {
+		return "", err
+	}
+	enc, ok := creds[name]
+	if !ok {
+		return "", nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return "", fmt.Errorf("credential %s: %w", name, err)
+	}
+	plain, err := unprotectSecret(sealed)
+	if err != nil {
+		return "", fmt.Errorf("credential %s: %w", name, err)
+	}
+	return string(plain), nil
+}
+
+// storeCredential stores secret under name in dir; an empty secret removes
+// the entry.
+func storeCredential(dir, name, secret string) error {
+	credentialsMu.Lock()
+	defer credentialsMu.Unlock()
+	creds, err := readCredentials(dir)
+	if err != nil {
+		return err
+	}
+	if secret == "" {
+		delete(creds, name)
+	} else {
+		sealed, err := protectSecret([]byte(secret))
+		if err != nil {
+			return fmt.Errorf("credential %s: %w", name, err)
+		}
+		creds[name] = base64.StdEncoding.EncodeToString(sealed)
+	}
+	b, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, credentialsFile), b, 0o600)
+}
+
+func readCredentials(dir string) (map[string]string, error) {
+	path := filepath.Join(dir, credentialsFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return make(map[string]string), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	creds := make(map[string]string)
+	if err := decodeJSON(path, data, &creds); err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+// loadSavePassphrase fills cfg.SavePassphrase from the credential store
+// beside the config at path. A passphrase still written in the config is
+// moved into the store and the config rewritten without it.
+func loadSavePassphrase(cfg *Config, path string) error {
+	dir := filepath.Dir(path)
+	if cfg.SavePassphrase != "" {
+		if err := storeCredential(dir, savePassphraseCredential, cfg.SavePassphrase); err != nil {
+			log.Printf("Could not move save_passphrase out of %s: %v", path, err)
+			return nil
+		}
+		if err := SaveConfig(cfg, path); err != nil {
+			log.Printf("Could not remove save_passphrase from %s: %v", path, err)
+			return nil
+		}
+		log.Printf("Moved save_passphrase from %s to %s", path, credentialsFile)
+		return nil
+	}
+	pass, err := loadCredential(dir, savePassphraseCredential)
+	if err != nil {
+		return fmt.Errorf("load save passphrase: %w", err)
+	}
+	cfg.SavePassphrase = pass
+	return nil
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCredentialStore(t *testing.T) {
+	dir := t.TempDir()
+	if got, err := loadCredential(dir, "missing"); err != nil || got != "" {
+		t.Errorf("loadCredential(missing) = %q, %v", got, err)
+	}
+	if err := storeCredential(dir, "a", "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := storeCredential(dir, "b", "second"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := loadCredential(dir, "a"); err != nil || got != "first" {
+		t.Errorf("loadCredential(a) = %q, %v", got, err)
+	}
+	if err := storeCredential(dir, "a", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := loadCredential(dir, "a"); got != "" {
+		t.Errorf("loadCredential(a) after delete = %q", got)
+	}
+	if got, _ := loadCredential(dir, "b"); got != "second" {
+		t.Errorf("loadCredential(b) = %q", got)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, credentialsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		t.Errorf("%s mode = %v; want owner-only", credentialsFile, info.Mode().Perm())
+	}
+}
+
+func TestSavePassphraseMovedOutOfConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	cfg := DefaultConfig()
+	if err := SaveConfig(cfg, path); err != nil {
+		t.Fatal(err)
+	}
+	// A hand-edited config carrying the passphrase in plaintext.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = []byte(strings.Replace(string(data), "{", `{"save_passphrase": "hunter2",`, 1))
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err = LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SavePassphrase != "hunter2" {
+		t.Errorf("SavePassphrase = %q; want hunter2", cfg.SavePassphrase)
+	}
+	assertNoPassphrase := func(when string) {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), "hunter2") {
+			t.Errorf("config.json %s still holds the passphrase:\n%s", when, data)
+		}
+	}
+	assertNoPassphrase("after load")
+
+	if err := SaveConfig(cfg, path); err != nil {
+		t.Fatal(err)
+	}
+	assertNoPassphrase("after save")
+
+	cfg, err = LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SavePassphrase != "hunter2" {
+		t.Errorf("SavePassphrase after reload = %q; want hunter2", cfg.SavePassphrase)
+	}
+}
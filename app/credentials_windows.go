@@ -0,0 +1,65 @@
+//go:build windows
+
+package app
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// dataBlob is DPAPI's DATA_BLOB.
+type dataBlob struct {
+	size uint32
+	data *byte
+}
+
+func newDataBlob(b []byte) *dataBlob {
+	if len(b) == 0 {
+		return &dataBlob{}
+	}
+	return &dataBlob{size: uint32(len(b)), data: &b[0]}
+}
+
+func (b *dataBlob) bytes() []byte {
+	out := make([]byte, b.size)
+	copy(out, unsafe.Slice(b.data, b.size))
+	return out
+}
+
+// cryptProtectUIForbidden fails instead of prompting the user.
+const cryptProtectUIForbidden = 0x1
+
+var (
+	crypt32                = syscall.NewLazyDLL("crypt32.dll")
+	procCryptProtectData   = crypt32.NewProc("CryptProtectData")
+	procCryptUnprotectData = crypt32.NewProc("CryptUnprotectData")
+	procLocalFree          = syscall.NewLazyDLL("kernel32.dll").NewProc("LocalFree")
+)
+
+// protectSecret encrypts plain with DPAPI, so only the current Windows
+// user can read it back.
+func protectSecret(plain []byte) ([]byte, error) {
+	return dpapi(procCryptProtectData, plain)
+}
+
+func unprotectSecret(sealed []byte) ([]byte, error) {
+	return dpapi(procCryptUnprotectData, sealed)
+}
+
+func dpapi(proc *syscall.LazyProc, in []byte) ([]byte, error) {
+	var out dataBlob
+	r, _, err := proc.Call(
+		uintptr(unsafe.Pointer(newDataBlob(in))),
+		0,
+		0,
+		0,
+		0,
+		cryptProtectUIForbidden,
+		uintptr(unsafe.Pointer(&out)),
+	)
+	if r == 0 {
+		return nil, err
+	}
+	defer procLocalFree.Call(uintptr(unsafe.Pointer(out.data)))
+	return out.bytes(), nil
+}
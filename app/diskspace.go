@@ -0,0 +1,151 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// defaultDiskFloorMB is the free space below which the client warns.
+	defaultDiskFloorMB = 1024
+	diskCheckInterval  = time.Minute
+)
+
+// diskFree reports the bytes available to this user on the volume holding
+// path. Tests replace it with a fake.
+var diskFree = volumeFree
+
+// DiskSpaceError is an operation refused because the volume lacks room.
+type DiskSpaceError struct {
+	Op   string
+	Path string
+	Need uint64
+	Have uint64
+}
+
+func (e *DiskSpaceError) Error() string {
+	return fmt.Sprintf("not enough disk space to %s: need %s, only %s free on the volume holding %s",
+		e.Op, formatBytes(e.Need), formatBytes(e.Have), e.Path)
+}
+
+// formatBytes renders n in MB, or GB from 1 GB up.
+func formatBytes(n uint64) string {
+	const mb, gb = 1 << 20, 1 << 30
+	if n >= gb {
+		return fmt.Sprintf("%.1f GB", float64(n)/gb)
+	}
+	return fmt.Sprintf("%.1f MB", float64(n)/mb)
+}
+
+// existingDir returns dir, or its nearest existing ancestor, so free space
+// can be probed before a download creates its directory.
+func existingDir(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// checkFreeSpace refuses op when the volume holding dir has less than need
+// bytes free. A volume that cannot be probed is not held against op.
+func checkFreeSpace(op, dir string, need uint64) error {
+	dir = existingDir(dir)
+	have, err := diskFree(dir)
+	if err != nil {
+		debugf("Free space probe for %s failed: %v", dir, err)
+		return nil
+	}
+	if have < need {
+		return &DiskSpaceError{Op: op, Path: dir, Need: need, Have: have}
+	}
+	return nil
+}
+
+// DiskStatus is the free space of the data directory's volume.
+type DiskStatus struct {
+	Path       string `json:"path"`
+	FreeBytes  uint64 `json:"free_bytes"`
+	FloorBytes uint64 `json:"floor_bytes"`
+	Low        bool   `json:"low"`
+}
+
+func diskFloorBytes(cfg *Config) uint64 {
+	mb := cfg.DiskFloorMB
+	if mb <= 0 {
+		mb = defaultDiskFloorMB
+	}
+	return uint64(mb) << 20
+}
+
+// probeDataDir measures the volume holding the client's working directory,
+// where ROMs, saves, BizHawk and the caches live by default.
+func probeDataDir(cfg *Config) (*DiskStatus, error) {
+	dir := existingDir(".")
+	free, err := diskFree(dir)
+	if err != nil {
+		return nil, err
+	}
+	floor := diskFloorBytes(cfg)
+	return &DiskStatus{Path: dir, FreeBytes: free, FloorBytes: floor, Low: free < floor}, nil
+}
+
+// watchDiskSpace re-probes the data directory periodically and warns on the
+// overlay and desktop when free space drops below the configured floor.
+func (a *App) watchDiskSpace(ctx context.Context) {
+	ticker := time.NewTicker(diskCheckInterval)
+	defer ticker.Stop()
+	wasLow := false
+	for {
+		st, err := probeDataDir(a.cfg)
+		if err != nil {
+			debugf("Free space probe failed: %v", err)
+		} else {
+			a.disk.Store(st)
+			if st.Low && !wasLow {
+				vars := MsgVars{
+					"free":  formatBytes(st.FreeBytes),
+					"floor": formatBytes(st.FloorBytes),
+				}
+				log.Printf("WARNING: only %s free on %s (floor %s)", vars["free"], st.Path, vars["floor"])
+				a.ipc.SendText(MsgDiskLow, vars)
+				if a.handlers != nil {
+					a.handlers.notify.Notify(NotifyDiskLow, messages.Render(MsgNotifyDiskLow, nil), messages.Render(MsgDiskLow, vars))
+				}
+			}
+			wasLow = st.Low
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// doctorDisk prints the data directory's free space for `doctor`.
+func doctorDisk(cfg *Config) {
+	st, err := probeDataDir(cfg)
+	if err != nil {
+		fmt.Printf("Disk: FAIL %v\n", err)
+		return
+	}
+	verdict := "ok"
+	if st.Low {
+		verdict = "LOW"
+	}
+	fmt.Printf("Disk: %s, %s free on %s (floor %s)\n",
+		verdict, formatBytes(st.FreeBytes), st.Path, formatBytes(st.FloorBytes))
+}
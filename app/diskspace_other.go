@@ -0,0 +1,14 @@
+//go:build !windows
+
+package app
+
+import "syscall"
+
+// volumeFree reports the blocks available to unprivileged users.
+func volumeFree(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
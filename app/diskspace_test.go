@@ -0,0 +1,162 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeDisk replaces the free space probe with one reporting free bytes (or
+// failing with err) and returns the paths it was asked about.
+func fakeDisk(t *testing.T, free uint64, err error) func() []string {
+	t.Helper()
+	old := diskFree
+	t.Cleanup(func() { diskFree = old })
+	var probed []string
+	diskFree = func(path string) (uint64, error) {
+		probed = append(probed, path)
+		return free, err
+	}
+	return func() []string { return probed }
+}
+
+func TestCheckFreeSpace(t *testing.T) {
+	dir := t.TempDir()
+	probed := fakeDisk(t, 100<<20, nil)
+
+	if err := checkFreeSpace("download a.iso", dir, 100<<20); err != nil {
+		t.Errorf("exactly enough room: %v", err)
+	}
+	err := checkFreeSpace("download a.iso", dir, 2<<30)
+	var ds *DiskSpaceError
+	if !errors.As(err, &ds) || ds.Need != 2<<30 || ds.Have != 100<<20 || ds.Path != dir {
+		t.Fatalf("checkFreeSpace = %v; want a DiskSpaceError", err)
+	}
+	want := "not enough disk space to download a.iso: need 2.0 GB, only 100.0 MB free on the volume holding " + dir
+	if err.Error() != want {
+		t.Errorf("message %q; want %q", err, want)
+	}
+
+	// A directory the download has yet to create is probed via its parent.
+	_ = checkFreeSpace("download b.nes", filepath.Join(dir, "roms", "new"), 1)
+	if got := probed(); got[len(got)-1] != dir {
+		t.Errorf("probed %q for a missing directory; want %q", got[len(got)-1], dir)
+	}
+
+	// A volume that cannot be probed does not block anything.
+	fakeDisk(t, 0, errors.New("statfs: not supported"))
+	if err := checkFreeSpace("download a.iso", dir, 2<<30); err != nil {
+		t.Errorf("failed probe: %v", err)
+	}
+}
+
+func TestDownloadRefusedWhenDiskFull(t *testing.T) {
+	fakeDisk(t, 1024, nil)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(rangeBody)))
+		_, _ = w.Write([]byte(rangeBody))
+	}))
+	defer srv.Close()
+	dest := filepath.Join(t.TempDir(), "roms", "game.nes")
+
+	err := DownloadFile(srv.Client(), srv.URL+"/game.nes", dest)
+	var ds *DiskSpaceError
+	if !errors.As(err, &ds) || ds.Op != "download game.nes" || ds.Need != uint64(len(rangeBody)) {
+		t.Fatalf("DownloadFile = %v; want a DiskSpaceError", err)
+	}
+	for _, p := range []string{dest, dest + partSuffix} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s written despite the full disk: %v", filepath.Base(p), err)
+		}
+	}
+}
+
+func TestProbeDataDir(t *testing.T) {
+	t.Chdir(t.TempDir())
+	wd, _ := os.Getwd()
+	tests := []struct {
+		free    uint64
+		floorMB int
+		low     bool
+	}{
+		{2 << 30, 0, false},
+		{512 << 20, 0, true},
+		{512 << 20, 256, false},
+		{255 << 20, 256, true},
+	}
+	for _, tt := range tests {
+		fakeDisk(t, tt.free, nil)
+		st, err := probeDataDir(&Config{DiskFloorMB: tt.floorMB})
+		if err != nil {
+			t.Fatal(err)
+		}
+		floor := uint64(defaultDiskFloorMB) << 20
+		if tt.floorMB > 0 {
+			floor = uint64(tt.floorMB) << 20
+		}
+		if st.Path != wd || st.FreeBytes != tt.free || st.FloorBytes != floor || st.Low != tt.low {
+			t.Errorf("free %s, floor %d MB: %+v; want low %v", formatBytes(tt.free), tt.floorMB, st, tt.low)
+		}
+	}
+	fakeDisk(t, 0, errors.New("statfs: not supported"))
+	if _, err := probeDataDir(&Config{}); err == nil {
+		t.Error("probeDataDir hid the probe failure")
+	}
+}
+
+func TestWatchDiskSpaceWarnsWhenLow(t *testing.T) {
+	for _, low := range []bool{false, true} {
+		f := newHandlerFixture(t)
+		sink := &fakeSink{}
+		f.h.notify = sink
+		free := uint64(2 << 30)
+		if low {
+			free = 10 << 20
+		}
+		fakeDisk(t, free, nil)
+		a := &App{cfg: f.cfg, ipc: NewBizhawkIPC("127.0.0.1", 0, f.state), handlers: f.h}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			a.watchDiskSpace(ctx)
+		}()
+		waitFor(t, "the first probe", func() bool { return a.disk.Load() != nil })
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("watchDiskSpace did not stop")
+		}
+
+		var want []NotifyKind
+		if low {
+			want = []NotifyKind{NotifyDiskLow}
+		}
+		if got := sink.Kinds(); !slices.Equal(got, want) || a.disk.Load().Low != low {
+			t.Errorf("free %s: notified %v, status %+v", formatBytes(free), got, a.disk.Load())
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[uint64]string{
+		0:               "0.0 MB",
+		512 << 10:       "0.5 MB",
+		1023 << 20:      "1023.0 MB",
+		1 << 30:         "1.0 GB",
+		5<<30 + 512<<20: "5.5 GB",
+	} {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %s; want %s", n, got, want)
+		}
+	}
+}
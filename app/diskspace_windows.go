@@ -0,0 +1,28 @@
+//go:build windows
+
+package app
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// volumeFree asks GetDiskFreeSpaceExW for the bytes available to the
+// caller, which honours per-user quotas.
+func volumeFree(path string) (uint64, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var avail uint64
+	r, _, err := syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW").Call(
+		uintptr(unsafe.Pointer(p)),
+		uintptr(unsafe.Pointer(&avail)),
+		0,
+		0,
+	)
+	if r == 0 {
+		return 0, err
+	}
+	return avail, nil
+}
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// runDoctor checks that the configured server is reachable and reports
+// which address families work, along with the BizHawk installs on disk.
+func runDoctor(path string) error {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	cfg.HostArch = HostArch()
+	printVersion(false)
+	doctorDisk(cfg)
+	doctorBizHawk(cfg)
+	fmt.Printf("Server: %s (%s)\n", cfg.ServerURL, cfg.ActiveServer)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	reachable := false
+	for _, p := range probeFamilies(ctx, cfg.ServerHost, cfg.ServerPort) {
+		family := "IPv4"
+		if p.Network == "tcp6" {
+			family = "IPv6"
+		}
+		if p.Err != nil {
+			fmt.Printf("  %s: FAIL %v\n", family, p.Err)
+			continue
+		}
+		reachable = true
+		fmt.Printf("  %s: ok via %s (%s)\n", family, p.Addrs[0], p.RTT.Round(time.Millisecond))
+	}
+	if !reachable {
+		return fmt.Errorf("server %s is not reachable over IPv4 or IPv6", cfg.ServerHost)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// doctorConfig writes a config whose active server is 127.0.0.1:port and
+// whose default BizHawk release is BizHawk-2.10-win-x64.
+func doctorConfig(t *testing.T, port int, bizhawkPath string) string {
+	t.Helper()
+	return writeTestConfig(t, fmt.Sprintf(`{
+  "servers": {
+    "local": {"scheme": "http", "host": "127.0.0.1", "port": %d, "bearer_token": "t", "player_name": "ana"}
+  },
+  "active_server": "local",
+  "bizhawk_path": %q,
+  "bizhawk_download_url": "https://example.test/BizHawk-2.10-win-x64.zip",
+  "bizhawk_download_urls": {"arm64": "https://example.test/BizHawk-2.10-win-arm64.zip"}
+}`, port, bizhawkPath))
+}
+
+func TestRunDoctor(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	closed, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	side := filepath.Join(bizhawkInstallRoot, "2.9.1")
+	gone := filepath.Join(bizhawkInstallRoot, "2.8")
+	tests := []struct {
+		name     string
+		port     int
+		override string
+		tree     func(t *testing.T)
+		want     []string
+		wantErr  string
+	}{
+		{
+			name: "empty tree",
+			port: port,
+			want: []string{
+				"Disk: ok",
+				"BizHawk: MISSING BizHawk-2.10-win-", // the release for the host's architecture
+				"IPv4: ok via 127.0.0.1",
+			},
+		},
+		{
+			name: "default and side-by-side installs",
+			port: port,
+			tree: func(t *testing.T) {
+				fakeInstall(t, "BizHawk-2.10-win-x64", true)
+				fakeInstall(t, "BizHawk-2.10-win-arm64", true)
+				fakeInstall(t, side, true)
+				fakeInstall(t, gone, false)
+				installs := loadBizHawkInstalls(bizhawkInstallRoot)
+				for v, dir := range map[string]string{"2.9.1": side, "2.8": gone} {
+					if err := installs.record(v, bizhawkInstall{Dir: dir}); err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+			want: []string{
+				"BizHawk: ok ",
+				"(default)",
+				"  2.8: MISSING " + filepath.Join(gone, "EmuHawk.exe"),
+				"  2.9.1: ok " + filepath.Join(side, "EmuHawk.exe"),
+			},
+		},
+		{
+			name:     "override",
+			port:     port,
+			override: "EmuHawk/EmuHawk.exe",
+			tree:     func(t *testing.T) { fakeInstall(t, "EmuHawk", true) },
+			want:     []string{"BizHawk: ok EmuHawk/EmuHawk.exe (bizhawk_path)"},
+		},
+		{
+			name:    "server down",
+			port:    closedPort,
+			want:    []string{"IPv4: FAIL"},
+			wantErr: "not reachable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := doctorConfig(t, tt.port, tt.override)
+			t.Chdir(t.TempDir())
+			fakeDisk(t, 1<<40, nil)
+			if tt.tree != nil {
+				tt.tree(t)
+			}
+
+			var err error
+			out := captureStdout(t, func() { err = runDoctor(path) })
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("runDoctor: %v\n%s", err, out)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("runDoctor = %v; want an error containing %q", err, tt.wantErr)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(out, w) {
+					t.Errorf("output lacks %q:\n%s", w, out)
+				}
+			}
+			// Side-by-side installs are listed in version order.
+			if i, j := strings.Index(out, "2.8:"), strings.Index(out, "2.9.1:"); i > j {
+				t.Errorf("installs out of order:\n%s", out)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+// Download acknowledgment outcomes.
+const (
+	AckSuccess        = "success"
+	AckFailed         = "failed"
+	AckAlreadyPresent = "already_present"
+)
+
+// Kinds of download acknowledged.
+const (
+	AckKindROM = "rom"
+	AckKindLua = "lua"
+)
+
+// DownloadAck tells the server how a download it pushed with download_rom
+// or download_lua ended on this client.
+type DownloadAck struct {
+	Kind       string `json:"kind"`
+	File       string `json:"file"`
+	Outcome    string `json:"outcome"`
+	Bytes      int64  `json:"bytes"`
+	DurationMS int64  `json:"duration_ms"`
+	SHA256     string `json:"sha256,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// newDownloadAck describes the outcome of a download into path that
+// started at started. Size and hash are taken from path unless it failed.
+func newDownloadAck(kind, file, path, outcome string, started time.Time, err error) DownloadAck {
+	ack := DownloadAck{
+		Kind:       kind,
+		File:       file,
+		Outcome:    outcome,
+		DurationMS: time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		ack.Outcome = AckFailed
+		ack.Error = err.Error()
+		return ack
+	}
+	if fi, statErr := os.Stat(path); statErr == nil {
+		ack.Bytes = fi.Size()
+	}
+	hash := fileSHA256
+	if kind == AckKindROM {
+		hash = cachedSHA256
+	}
+	if sum, hashErr := hash(path); hashErr == nil {
+		ack.SHA256 = sum
+	}
+	return ack
+}
+
+// DownloadAck reports the outcome of a pushed download. Delivery goes
+// through the outbox.
+func (a *API) DownloadAck(ctx context.Context, ack DownloadAck) error {
+	return a.outbox.Submit(ctx, ReportDownloadAck, "/api/download-ack", ack)
+}
+
+func (h *Handlers) ackDownload(ack DownloadAck) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.reports.DownloadAck(ctx, ack); err != nil {
+		log.Printf("download-ack error: %v", err)
+	}
+}
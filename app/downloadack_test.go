@@ -0,0 +1,210 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const romBytes = "NES\x1a rom body"
+
+// romServer serves files under /api/roms/ and the Lua script at
+// /api/scripts/latest, counting requests.
+func romServer(t *testing.T, files map[string]string, hits *atomic.Int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		body, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestDownloadROMAcks(t *testing.T) {
+	tests := []struct {
+		name    string
+		present bool
+		served  bool
+		outcome string
+		hits    int32
+	}{
+		{"downloaded", false, true, AckSuccess, 1},
+		{"already present", true, true, AckAlreadyPresent, 0},
+		{"failed", false, false, AckFailed, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newHandlerFixture(t)
+			files := map[string]string{}
+			if tt.served {
+				files["/api/roms/mario.nes"] = romBytes
+			}
+			var hits atomic.Int32
+			f.cfg.ServerURL = romServer(t, files, &hits).URL
+
+			m := testManifest()
+			m.Games[0].SHA256 = sha256Hex(romBytes)
+			f.h.setManifest(m)
+			if tt.present {
+				if err := os.MkdirAll(f.cfg.RomDir, 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(f.h.romPath("mario.nes"), []byte(romBytes), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			f.dispatch("download_rom", `{"file":"mario.nes"}`)
+			if len(f.server.acks) != 1 {
+				t.Fatalf("acks = %+v; want one", f.server.acks)
+			}
+			ack := f.server.acks[0]
+			if ack.Kind != AckKindROM || ack.File != "mario.nes" || ack.Outcome != tt.outcome {
+				t.Errorf("ack = %+v; want a %s rom ack", ack, tt.outcome)
+			}
+			if tt.outcome == AckFailed {
+				if ack.Error == "" || ack.SHA256 != "" {
+					t.Errorf("failed ack = %+v; want an error and no hash", ack)
+				}
+				if !slices.Contains(f.server.Calls(), "ReportError") {
+					t.Error("failed download was not reported as a client error")
+				}
+			} else if ack.Bytes != int64(len(romBytes)) || ack.SHA256 != sha256Hex(romBytes) {
+				t.Errorf("ack = %+v; want the file's size and hash", ack)
+			}
+			if hits.Load() != tt.hits {
+				t.Errorf("server saw %d requests; want %d", hits.Load(), tt.hits)
+			}
+		})
+	}
+}
+
+func TestDownloadLuaAcks(t *testing.T) {
+	const script = "-- relay script\nprint('hi')\n"
+	tests := []struct {
+		name      string
+		installed string
+		served    bool
+		outcome   string
+		reload    bool
+	}{
+		{"installed", "", true, AckSuccess, true},
+		{"unchanged", script, true, AckAlreadyPresent, false},
+		{"failed", "", false, AckFailed, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The script is installed under ./scripts.
+			t.Chdir(t.TempDir())
+			f := newHandlerFixture(t)
+			f.emu.caps = []string{CapReload}
+			files := map[string]string{}
+			if tt.served {
+				files["/api/scripts/latest"] = script
+			}
+			var hits atomic.Int32
+			f.cfg.ServerURL = romServer(t, files, &hits).URL
+			if tt.installed != "" {
+				if err := os.MkdirAll("scripts", 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join("scripts", "relay.lua"), []byte(tt.installed), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			f.dispatch("download_lua", `{"filename":"relay.lua"}`)
+			if len(f.server.acks) != 1 {
+				t.Fatalf("acks = %+v; want one", f.server.acks)
+			}
+			ack := f.server.acks[0]
+			if ack.Kind != AckKindLua || ack.File != "relay.lua" || ack.Outcome != tt.outcome {
+				t.Errorf("ack = %+v; want a %s lua ack", ack, tt.outcome)
+			}
+			if tt.outcome != AckFailed && ack.SHA256 != sha256Hex(script) {
+				t.Errorf("ack hash = %q; want the script's", ack.SHA256)
+			}
+			if got := slices.Contains(f.emu.Sent(), "RELOAD"); got != tt.reload {
+				t.Errorf("RELOAD sent = %v; want %v", got, tt.reload)
+			}
+		})
+	}
+}
+
+func TestDownloadROMReplaceFails(t *testing.T) {
+	tests := []struct {
+		name   string
+		locked bool
+	}{
+		{"locked", true},
+		{"other error", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renameErr := errors.New("rename refused")
+			oldRename, oldViolation := renameFile, sharingViolation
+			renameFile = func(src, dst string) error { return renameErr }
+			sharingViolation = func(err error) bool { return tt.locked && errors.Is(err, renameErr) }
+			t.Cleanup(func() { renameFile, sharingViolation = oldRename, oldViolation })
+
+			f := newHandlerFixture(t)
+			var hits atomic.Int32
+			f.cfg.ServerURL = romServer(t, map[string]string{"/api/roms/mario.nes": romBytes}, &hits).URL
+			f.h.setManifest(testManifest())
+			dest := f.h.romPath("mario.nes")
+			if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(dest, []byte("old rom"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			f.h.state.SetCurrentGame("mario.nes")
+
+			f.dispatch("download_rom", `{"file":"mario.nes","replace":true}`)
+
+			if len(f.server.acks) != 1 || f.server.acks[0].Outcome != AckFailed {
+				t.Fatalf("acks = %+v; want one failed ack", f.server.acks)
+			}
+			if b, _ := os.ReadFile(dest); string(b) != "old rom" {
+				t.Errorf("ROM now holds %q; want it untouched", b)
+			}
+			entries, _ := os.ReadDir(filepath.Dir(dest))
+			for _, e := range entries {
+				if e.Name() != "mario.nes" {
+					t.Errorf("left %s behind", e.Name())
+				}
+			}
+			if !slices.Contains(f.server.Calls(), "ReportError") {
+				t.Error("failed replace was not reported")
+			}
+			// The loaded ROM is ejected first and swapped back either way.
+			if sent := f.emu.Sent(); !slices.Contains(sent, "EJECT") || sent[len(sent)-1] != "SWAP" {
+				t.Errorf("emulator commands = %v; want EJECT then SWAP back", sent)
+			}
+			f.emu.mu.Lock()
+			msgs := strings.Join(f.emu.messages, "\n")
+			f.emu.mu.Unlock()
+			if got := strings.Contains(msgs, "ROM in use"); got != tt.locked {
+				t.Errorf("overlay messages %q; want the in-use notice %v", msgs, tt.locked)
+			}
+		})
+	}
+}
@@ -0,0 +1,409 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	partSuffix = ".part"
+
+	// romDownloadTimeout bounds one ROM download; large disc images can
+	// take minutes on slow links, which httpClient's 20s limit would kill.
+	romDownloadTimeout = 30 * time.Minute
+	// romDownloadAttempts bounds how often a dropped ROM download is
+	// resumed from its .part file before giving up.
+	romDownloadAttempts = 3
+	// transientDownloadTimeout bounds small downloads such as Lua scripts.
+	transientDownloadTimeout = 2 * time.Minute
+	// downloadShutdownGrace is how long Shutdown waits for cancelled
+	// downloads to flush their .part files.
+	downloadShutdownGrace = 2 * time.Second
+)
+
+// downloadClient has no overall timeout so large files can finish; a
+// stalled server is caught by the transport timeouts and the per-download
+// context instead. net.Dialer races IPv6 and IPv4 (happy eyeballs) by
+// default, so dual-stack hosts with one broken family still connect.
+var downloadClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   15 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   15 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+	},
+}
+
+// downloadOptions adjust a single download. The zero value is a plain
+// unauthenticated, unthrottled fetch.
+type downloadOptions struct {
+	// Validator from an earlier attempt allows resuming its .part file.
+	Validator string
+	// Limit paces the transfer; nil means unlimited.
+	Limit *rateLimiter
+	// Bearer is sent as the Authorization token when set.
+	Bearer string
+	// Conditional makes the request conditional on the recorded
+	// validators and is updated from a fresh response. An unchanged
+	// resource returns errNotModified and leaves dest alone.
+	Conditional *conditionalMeta
+	// Progress is called as data arrives with the bytes in the file so
+	// far and the full size, or -1 if the server did not send it.
+	Progress func(written, total int64)
+}
+
+// conditionalMeta holds the validators of a previously downloaded file.
+type conditionalMeta struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// errNotModified is returned by a conditional download the server
+// answered with 304.
+var errNotModified = errors.New("not modified")
+
+// DownloadFile streams the URL to a .part file and atomically moves it to
+// dest. It cannot be cancelled; handlers use DownloadManager instead.
+func DownloadFile(client *http.Client, url, dest string, opts ...downloadOptions) error {
+	var opt downloadOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	_, err := downloadResumable(context.Background(), client, url, dest, opt)
+	return err
+}
+
+// DownloadROM downloads the session game file to dest with the player's
+// token, resuming from dest's .part file if the connection drops. progress
+// may be nil.
+func (a *API) DownloadROM(ctx context.Context, file, dest string, progress func(written, total int64)) error {
+	url, err := romURL(a.baseURL, file)
+	if err != nil {
+		return err
+	}
+	_, err = downloadRetrying(ctx, downloadClient, url, dest, downloadOptions{
+		Bearer:   a.Token(),
+		Progress: progress,
+	})
+	return err
+}
+
+// progressReader reports the running total read through it.
+type progressReader struct {
+	r       io.Reader
+	written int64
+	total   int64
+	fn      func(written, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.written += int64(n)
+		p.fn(p.written, p.total)
+	}
+	return n, err
+}
+
+// InterruptedDownload is a download cut short by shutdown. Its .part file
+// is resumed on the next start when the server still serves the same
+// content (checked with If-Range against Validator).
+type InterruptedDownload struct {
+	URL       string `json:"url"`
+	Dest      string `json:"dest"`
+	Validator string `json:"validator,omitempty"`
+}
+
+// DownloadManager runs handler-initiated downloads under a context that
+// Shutdown cancels, so a large download cannot hold the process open past
+// shutdown. Interrupted downloads are recorded in the runtime state.
+// Downloads of one class share a bandwidth limit.
+type DownloadManager struct {
+	client *http.Client
+	state  *ClientState
+	// token returns the bearer token to send; the API's once the App
+	// wires it up, so refreshed tokens are used.
+	token  func() string
+	limits map[DownloadClass]*rateLimiter
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewDownloadManager(client *http.Client, state *ClientState, cfg *Config) *DownloadManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &DownloadManager{
+		client: client,
+		state:  state,
+		token:  func() string { return cfg.BearerToken },
+		limits: make(map[DownloadClass]*rateLimiter),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	for _, class := range downloadClasses {
+		m.limits[class] = newRateLimiter(int64(cfg.DownloadLimitsKBps[string(class)]) * 1024)
+	}
+	return m
+}
+
+// SetLimit changes the bandwidth limit of a download class at runtime,
+// including for downloads already running. Zero removes the limit.
+func (m *DownloadManager) SetLimit(class DownloadClass, kbps int) {
+	m.limits[class].SetRate(int64(kbps) * 1024)
+	if kbps > 0 {
+		log.Printf("Download limit for %s set to %d KB/s", class, kbps)
+	} else {
+		log.Printf("Download limit for %s removed", class)
+	}
+}
+
+// Limits returns the current per-class limits in KB/s (0 = unlimited).
+func (m *DownloadManager) Limits() map[DownloadClass]int {
+	out := make(map[DownloadClass]int, len(m.limits))
+	for class, l := range m.limits {
+		out[class] = int(l.Rate() / 1024)
+	}
+	return out
+}
+
+// UseToken makes downloads authenticate with the token fn returns.
+func (m *DownloadManager) UseToken(fn func() string) {
+	m.token = fn
+}
+
+// Fetch downloads url to dest under the class's bandwidth limit, resuming
+// a .part left by an interrupted run. If Shutdown interrupts it, the
+// download is recorded for Bootstrap to finish on the next start.
+func (m *DownloadManager) Fetch(class DownloadClass, url, dest string) error {
+	m.wg.Add(1)
+	defer m.wg.Done()
+	ctx, cancel := context.WithTimeout(m.ctx, romDownloadTimeout)
+	defer cancel()
+
+	validator := m.state.interruptedValidator(dest)
+	validator, err := downloadRetrying(ctx, m.client, url, dest, downloadOptions{
+		Validator: validator,
+		Limit:     m.limits[class],
+		Bearer:    m.token(),
+	})
+	if err != nil && m.ctx.Err() != nil {
+		m.state.RecordInterruptedDownload(InterruptedDownload{URL: url, Dest: dest, Validator: validator})
+		return fmt.Errorf("download of %s interrupted by shutdown: %w", filepath.Base(dest), err)
+	}
+	m.state.ClearInterruptedDownload(dest)
+	if err != nil {
+		usage.downloadFailures.Add(1)
+	}
+	return err
+}
+
+// FetchTransient downloads a small file that is not worth resuming; it is
+// still cancelled by Shutdown. A non-nil meta makes it conditional.
+func (m *DownloadManager) FetchTransient(url, dest string, meta *conditionalMeta) error {
+	m.wg.Add(1)
+	defer m.wg.Done()
+	ctx, cancel := context.WithTimeout(m.ctx, transientDownloadTimeout)
+	defer cancel()
+	_, err := downloadResumable(ctx, m.client, url, dest, downloadOptions{Bearer: m.token(), Conditional: meta})
+	return err
+}
+
+// Shutdown cancels in-flight downloads and waits up to grace for them to
+// record their progress.
+func (m *DownloadManager) Shutdown(grace time.Duration) {
+	m.cancel()
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(grace):
+		log.Printf("Downloads still running after %s; abandoning them", grace)
+	}
+}
+
+// resumeInterruptedDownloads finishes downloads recorded by a previous
+// run's shutdown and returns the failures keyed by destination.
+func resumeInterruptedDownloads(ctx context.Context, state *ClientState, bearer string) map[string]error {
+	failed := make(map[string]error)
+	for _, d := range state.GetInterruptedDownloads() {
+		log.Printf("Resuming interrupted download of %s", d.Dest)
+		ctx, cancel := context.WithTimeout(ctx, romDownloadTimeout)
+		_, err := downloadResumable(ctx, downloadClient, d.URL, d.Dest, downloadOptions{
+			Validator: d.Validator,
+			Bearer:    bearer,
+		})
+		cancel()
+		state.ClearInterruptedDownload(d.Dest)
+		if err != nil {
+			failed[d.Dest] = fmt.Errorf("resume %s: %w", d.Dest, err)
+			continue
+		}
+		fmt.Println("Finished interrupted download:", filepath.Base(d.Dest))
+	}
+	return failed
+}
+
+// resumeValidator picks the response header usable with If-Range. Weak
+// ETags cannot be used for range requests.
+func resumeValidator(h http.Header) string {
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return h.Get("Last-Modified")
+}
+
+// downloadRetrying is downloadResumable, continuing the .part with a Range
+// request when an attempt fails partway through. Downloads that cannot be
+// resumed are not retried.
+func downloadRetrying(
+	ctx context.Context,
+	client *http.Client,
+	url, dest string,
+	opts downloadOptions,
+) (string, error) {
+	for attempt := 1; ; attempt++ {
+		validator, err := downloadResumable(ctx, client, url, dest, opts)
+		if err == nil || ctx.Err() != nil || validator == "" || attempt == romDownloadAttempts {
+			return validator, err
+		}
+		fi, statErr := os.Stat(dest + partSuffix)
+		if statErr != nil {
+			return validator, err
+		}
+		log.Printf("Download of %s failed at %d bytes, resuming: %v", filepath.Base(dest), fi.Size(), err)
+		opts.Validator = validator
+	}
+}
+
+// downloadResumable streams url into dest+".part" and atomically moves it
+// to dest. With a validator from an earlier attempt, an existing .part is
+// continued with a Range request; a 200 reply means the content changed
+// and the download starts over. Redirects are followed by client. The
+// .part is kept on failure only when it can be resumed. It returns the
+// validator of the content being fetched.
+func downloadResumable(
+	ctx context.Context,
+	client *http.Client,
+	url, dest string,
+	opts downloadOptions,
+) (string, error) {
+	validator := opts.Validator
+	log.Printf("DownloadFile: %s -> %s", url, dest)
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return validator, err
+	}
+	part := dest + partSuffix
+
+	var offset int64
+	if validator != "" {
+		if fi, err := os.Stat(part); err == nil {
+			offset = fi.Size()
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return validator, err
+	}
+	req.Header.Set("User-Agent", userAgent())
+	if opts.Bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.Bearer)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", validator)
+	}
+	if c := opts.Conditional; c != nil {
+		if c.ETag != "" {
+			req.Header.Set("If-None-Match", c.ETag)
+		}
+		if c.LastModified != "" {
+			req.Header.Set("If-Modified-Since", c.LastModified)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return validator, err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	// size is the length the finished file must have, or -1 if the
+	// server did not say.
+	size := resp.ContentLength
+	switch {
+	case resp.StatusCode == http.StatusNotModified && opts.Conditional != nil:
+		return validator, errNotModified
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		log.Printf("Resuming %s at %d bytes", filepath.Base(dest), offset)
+		flags = os.O_WRONLY | os.O_APPEND
+		if size >= 0 {
+			size += offset
+		}
+	case resp.StatusCode == http.StatusOK:
+		if offset > 0 {
+			log.Printf("Server content changed; restarting %s", filepath.Base(dest))
+		}
+		validator = resumeValidator(resp.Header)
+		if c := opts.Conditional; c != nil {
+			c.ETag = resp.Header.Get("ETag")
+			c.LastModified = resp.Header.Get("Last-Modified")
+		}
+	default:
+		return validator, fmt.Errorf("download failed: %s (status: %s)", url, resp.Status)
+	}
+
+	if resp.ContentLength > 0 {
+		if err := checkFreeSpace("download "+filepath.Base(dest), filepath.Dir(dest), uint64(resp.ContentLength)); err != nil {
+			return validator, err
+		}
+	}
+	out, err := os.OpenFile(part, flags, 0o644)
+	if err != nil {
+		return validator, err
+	}
+	var body io.Reader = resp.Body
+	if opts.Progress != nil {
+		written := int64(0)
+		if flags&os.O_APPEND != 0 {
+			written = offset
+		}
+		body = &progressReader{r: body, written: written, total: size, fn: opts.Progress}
+	}
+	_, err = io.Copy(out, throttle(ctx, body, opts.Limit))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size >= 0 {
+		if fi, statErr := os.Stat(part); statErr != nil {
+			err = statErr
+		} else if fi.Size() != size {
+			err = fmt.Errorf("download of %s incomplete: %d of %d bytes", filepath.Base(dest), fi.Size(), size)
+		}
+	}
+	if err != nil {
+		if validator == "" {
+			_ = os.Remove(part)
+		}
+		return validator, err
+	}
+	return validator, replaceFile(part, dest)
+}
@@ -0,0 +1,287 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var rangeBody = strings.Repeat("rom data ", 4096)
+
+// rangeServer serves rangeBody with Range and If-Range support. The first
+// full request is cut off after cutAt bytes: dropped when hold is false,
+// otherwise held open until the client goes away. It records the Range
+// header of each request ("" for a full one).
+type rangeServer struct {
+	etag  string
+	cutAt int
+	hold  bool
+
+	mu     sync.Mutex
+	cut    bool
+	ranges []string
+}
+
+func (s *rangeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	cut := !s.cut && s.cutAt > 0 && r.Header.Get("Range") == ""
+	s.cut = s.cut || cut
+	s.mu.Unlock()
+
+	w.Header().Set("ETag", s.etag)
+	if cut {
+		w.Header().Set("Content-Length", strconv.Itoa(len(rangeBody)))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(rangeBody[:s.cutAt]))
+		w.(http.Flusher).Flush()
+		if s.hold {
+			<-r.Context().Done()
+		}
+		panic(http.ErrAbortHandler)
+	}
+	http.ServeContent(w, r, "", time.Time{}, strings.NewReader(rangeBody))
+}
+
+func (s *rangeServer) Ranges() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.ranges)
+}
+
+func checkDownloaded(t *testing.T, dest string) {
+	t.Helper()
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != rangeBody {
+		t.Errorf("%s holds %d bytes; want the %d-byte body", dest, len(data), len(rangeBody))
+	}
+	if _, err := os.Stat(dest + partSuffix); !os.IsNotExist(err) {
+		t.Errorf(".part left behind: %v", err)
+	}
+}
+
+func TestDownloadResumesAfterDrop(t *testing.T) {
+	s := &rangeServer{etag: `"v1"`, cutAt: 10000}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	dest := filepath.Join(t.TempDir(), "mario.nes")
+
+	validator, err := downloadRetrying(context.Background(), http.DefaultClient, srv.URL, dest, downloadOptions{})
+	if err != nil || validator != `"v1"` {
+		t.Fatalf("downloadRetrying = %q, %v", validator, err)
+	}
+	checkDownloaded(t, dest)
+	if got, want := s.Ranges(), []string{"", "bytes=10000-"}; !slices.Equal(got, want) {
+		t.Errorf("ranges = %q; want %q", got, want)
+	}
+}
+
+func TestDownloadWithoutValidatorRestarts(t *testing.T) {
+	// A weak ETag cannot be used with If-Range, so the .part is dropped
+	// and the failure returned for the caller to retry from scratch.
+	s := &rangeServer{etag: `W/"v1"`, cutAt: 10000}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	dest := filepath.Join(t.TempDir(), "mario.nes")
+
+	if _, err := downloadRetrying(context.Background(), http.DefaultClient, srv.URL, dest, downloadOptions{}); err == nil {
+		t.Fatal("dropped download succeeded")
+	}
+	if _, err := os.Stat(dest + partSuffix); !os.IsNotExist(err) {
+		t.Errorf("unresumable .part kept: %v", err)
+	}
+	if got := s.Ranges(); !slices.Equal(got, []string{""}) {
+		t.Errorf("ranges = %q; want a single attempt", got)
+	}
+}
+
+func TestDownloadResumeAfterContentChange(t *testing.T) {
+	s := &rangeServer{etag: `"v2"`}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	dest := filepath.Join(t.TempDir(), "mario.nes")
+	if err := os.WriteFile(dest+partSuffix, []byte("stale partial content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// If-Range no longer matches, so the server sends the whole file.
+	validator, err := downloadResumable(context.Background(), http.DefaultClient, srv.URL, dest, downloadOptions{Validator: `"v1"`})
+	if err != nil || validator != `"v2"` {
+		t.Fatalf("downloadResumable = %q, %v", validator, err)
+	}
+	checkDownloaded(t, dest)
+}
+
+func TestDownloadInterruptedByShutdownResumesNextStart(t *testing.T) {
+	s := &rangeServer{etag: `"v1"`, cutAt: 10000, hold: true}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	dest := filepath.Join(t.TempDir(), "mario.nes")
+	state := NewClientState()
+	m := NewDownloadManager(http.DefaultClient, state, &Config{})
+
+	done := make(chan error, 1)
+	go func() { done <- m.Fetch(DownloadUrgent, srv.URL, dest) }()
+	waitFor(t, "partial download", func() bool {
+		fi, err := os.Stat(dest + partSuffix)
+		return err == nil && fi.Size() == int64(s.cutAt)
+	})
+	m.Shutdown(downloadShutdownGrace)
+	if err := <-done; err == nil || !strings.Contains(err.Error(), "interrupted by shutdown") {
+		t.Fatalf("Fetch = %v; want an interruption", err)
+	}
+	want := []InterruptedDownload{{URL: srv.URL, Dest: dest, Validator: `"v1"`}}
+	if got := state.GetInterruptedDownloads(); !slices.Equal(got, want) {
+		t.Fatalf("interrupted downloads = %+v; want %+v", got, want)
+	}
+
+	// The next start picks up where the last one stopped.
+	if failed := resumeInterruptedDownloads(context.Background(), state, "tok"); len(failed) != 0 {
+		t.Fatalf("resume failed: %v", failed)
+	}
+	checkDownloaded(t, dest)
+	if got := s.Ranges(); !slices.Equal(got, []string{"", "bytes=10000-"}) {
+		t.Errorf("ranges = %q", got)
+	}
+	if got := state.GetInterruptedDownloads(); len(got) != 0 {
+		t.Errorf("resumed download still recorded: %+v", got)
+	}
+}
+
+// authRecorder serves rangeBody and records the Authorization header it
+// was sent.
+type authRecorder struct {
+	mu   sync.Mutex
+	auth []string
+}
+
+func (a *authRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	a.auth = append(a.auth, r.Header.Get("Authorization"))
+	a.mu.Unlock()
+	_, _ = w.Write([]byte(rangeBody))
+}
+
+func (a *authRecorder) Auth() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return slices.Clone(a.auth)
+}
+
+func TestDownloadFollowsRedirects(t *testing.T) {
+	mirror := &authRecorder{}
+	mirrorSrv := httptest.NewServer(mirror)
+	defer mirrorSrv.Close()
+	// The same server under another host name, as a CDN would be.
+	_, port, _ := net.SplitHostPort(mirrorSrv.Listener.Addr().String())
+	cdnURL := "http://localhost:" + port
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/roms/same-host.nes":
+			http.Redirect(w, r, "/files/same-host.nes", http.StatusFound)
+		case "/files/same-host.nes":
+			mirror.ServeHTTP(w, r)
+		case "/roms/cdn.nes":
+			http.Redirect(w, r, cdnURL+"/blob", http.StatusTemporaryRedirect)
+		case "/roms/chain.nes":
+			http.Redirect(w, r, "/roms/same-host.nes", http.StatusMovedPermanently)
+		case "/roms/loop.nes":
+			http.Redirect(w, r, "/roms/loop.nes", http.StatusFound)
+		}
+	}))
+	defer origin.Close()
+	dir := t.TempDir()
+
+	for _, name := range []string{"same-host.nes", "chain.nes"} {
+		dest := filepath.Join(dir, name)
+		if err := DownloadFile(origin.Client(), origin.URL+"/roms/"+name, dest, downloadOptions{Bearer: "tok"}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		checkDownloaded(t, dest)
+	}
+	dest := filepath.Join(dir, "cdn.nes")
+	if err := DownloadFile(origin.Client(), origin.URL+"/roms/cdn.nes", dest, downloadOptions{Bearer: "tok"}); err != nil {
+		t.Fatal(err)
+	}
+	checkDownloaded(t, dest)
+	// The token follows redirects on the same host only.
+	if got, want := mirror.Auth(), []string{"Bearer tok", "Bearer tok", ""}; !slices.Equal(got, want) {
+		t.Errorf("Authorization seen by the redirect targets = %q; want %q", got, want)
+	}
+
+	dest = filepath.Join(dir, "loop.nes")
+	err := DownloadFile(origin.Client(), origin.URL+"/roms/loop.nes", dest)
+	if err == nil || !strings.Contains(err.Error(), "stopped after 10 redirects") {
+		t.Errorf("redirect loop: %v", err)
+	}
+	for _, p := range []string{dest, dest + partSuffix} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s left by a redirect loop: %v", filepath.Base(p), err)
+		}
+	}
+}
+
+func TestDownloadNon200(t *testing.T) {
+	tests := []struct {
+		status    int
+		validator string // resuming from an earlier attempt when set
+		keepPart  bool
+	}{
+		{http.StatusNotFound, "", false},
+		{http.StatusForbidden, "", false},
+		{http.StatusInternalServerError, "", false},
+		{http.StatusServiceUnavailable, `"v1"`, true},
+		// Unasked-for partial content and a 304 to an unconditional
+		// request cannot be used either.
+		{http.StatusPartialContent, "", false},
+		{http.StatusNotModified, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.status), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte("error page"))
+			}))
+			defer srv.Close()
+			dest := filepath.Join(t.TempDir(), "game.nes")
+			part := dest + partSuffix
+			if tt.validator != "" {
+				if err := os.WriteFile(part, []byte(rangeBody[:100]), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := DownloadFile(srv.Client(), srv.URL+"/game.nes", dest, downloadOptions{Validator: tt.validator})
+			if err == nil || !strings.Contains(err.Error(), "status: "+strconv.Itoa(tt.status)) {
+				t.Fatalf("DownloadFile = %v; want the status reported", err)
+			}
+			if errors.Is(err, errNotModified) {
+				t.Error("unconditional request reported as not modified")
+			}
+			if _, err := os.Stat(dest); !os.IsNotExist(err) {
+				t.Errorf("dest written from a %d: %v", tt.status, err)
+			}
+			data, err := os.ReadFile(part)
+			if tt.keepPart && string(data) != rangeBody[:100] {
+				t.Errorf("resumable .part = %d bytes, %v; want it kept", len(data), err)
+			}
+			if !tt.keepPart && !os.IsNotExist(err) {
+				t.Errorf(".part left behind: %v", err)
+			}
+		})
+	}
+}
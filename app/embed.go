@@ -0,0 +1,102 @@
+// Package app is the BizHawk session client. The go-client binary runs it
+// through Main; other Go programs, such as GUI wrappers, can embed it with
+// New.
+//
+// The embedding surface is New, Options, EmulatorBackend, Emulator and the
+// App methods Run, Shutdown, Ready, State and Control, together with the
+// Config, SnapshotExtended, StateEvent and Control types they use. Within
+// a major version of the module these keep their signatures and meaning:
+// fields and methods may be added, but none is removed or changed
+// incompatibly. Everything else exported here serves the command-line
+// client and may change in any release.
+package app
+
+import (
+	"log"
+)
+
+// Options configures an embedded client. The zero value runs it the way
+// the command-line client does: logging through the standard logger,
+// keeping its files in the working directory and launching BizHawk.
+type Options struct {
+	// Logger receives the client's log output. The client logs through the
+	// standard library's default logger, which New points at this one's
+	// writer, flags and prefix.
+	Logger *log.Logger
+
+	// StateDir holds config.json, runtime_state.json, the ROMs, saves and
+	// caches. The client resolves those paths against the working
+	// directory, so New changes into StateDir; only one client can run in
+	// a process.
+	StateDir string
+
+	// EmulatorBackend starts the emulator whose Lua side talks to the
+	// client. Nil installs and launches BizHawk.
+	EmulatorBackend EmulatorBackend
+}
+
+// EmulatorBackend starts the emulator once the client is ready for it. The
+// emulator's Lua side connects to cfg.BizhawkIPCHost:cfg.BizhawkIPCPort.
+type EmulatorBackend interface {
+	Start(cfg *Config) (Emulator, error)
+}
+
+// Emulator is a running emulator. The client stops when it exits.
+type Emulator interface {
+	// Wait blocks until the emulator exits; an error means it crashed.
+	Wait() error
+	// Kill stops the emulator, making Wait return.
+	Kill() error
+	// PID is the emulator's process ID, or 0 if it has none.
+	PID() int
+}
+
+// Shutdown stops the client and waits until Run has left the session,
+// stopped the emulator and saved the client's state. It may be called
+// from any goroutine, more than once, and before Run, which then returns
+// straight away.
+func (a *App) Shutdown() {
+	a.quitOnce.Do(func() { close(a.quit) })
+	if a.running.Load() {
+		<-a.done
+	}
+}
+
+// Ready is closed once Run has launched the emulator and told the server
+// the player is ready.
+func (a *App) Ready() <-chan struct{} {
+	return a.ready
+}
+
+// StateView is a read-only view of a client's state.
+type StateView struct {
+	a *App
+}
+
+// State returns a read-only view of the client's state.
+func (a *App) State() StateView {
+	return StateView{a}
+}
+
+// Snapshot returns the client's current state, as reported in heartbeats
+// and on the status page.
+func (v StateView) Snapshot() SnapshotExtended {
+	return v.a.Snapshot()
+}
+
+// Subscribe delivers state changes on events until cancel is called,
+// which closes it. Changes are dropped while its buffer of buf is full.
+func (v StateView) Subscribe(buf int) (events <-chan StateEvent, cancel func()) {
+	ch := v.a.state.Subscribe(buf)
+	return ch, func() { v.a.state.Unsubscribe(ch) }
+}
+
+// Control returns the client's local controls. Until Run has wired the
+// client up they fail with ErrNotRunning; one obtained after Ready works
+// for the rest of the run.
+func (a *App) Control() *Control {
+	if c := a.control.Load(); c != nil {
+		return c
+	}
+	return newControl(a.state, nil, nil)
+}
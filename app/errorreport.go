@@ -0,0 +1,130 @@
+package app
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// errorReportWindow is the minimum spacing between client-error
+	// posts; errors raised in between are batched into the next one.
+	errorReportWindow = 30 * time.Second
+	// errorBatchMax caps the distinct errors carried by one post. Repeats
+	// of a batched error only bump its count; others are dropped.
+	errorBatchMax = 20
+)
+
+// Error report categories.
+const (
+	ErrorSwap     = "swap"
+	ErrorDownload = "download"
+	ErrorBizHawk  = "bizhawk"
+	ErrorIPC      = "ipc"
+)
+
+// ClientError is one failure reported to the server, with how many times
+// it recurred within the batch.
+type ClientError struct {
+	Category string    `json:"category"`
+	Message  string    `json:"message"`
+	Count    int       `json:"count"`
+	First    time.Time `json:"first_at"`
+	Last     time.Time `json:"last_at"`
+}
+
+// errorBatcher collects client errors so a tight failure loop costs the
+// server one request per window rather than one per failure.
+type errorBatcher struct {
+	send func(ctx context.Context, batch []ClientError, dropped int) error
+	now  func() time.Time
+
+	mu       sync.Mutex
+	pending  []ClientError
+	dropped  int
+	lastSent time.Time
+	timer    *time.Timer
+}
+
+// add records an error and sends the batch with ctx if the window since
+// the last post has passed; otherwise it arms a timer to send it then.
+func (b *errorBatcher) add(ctx context.Context, category, message string) error {
+	b.mu.Lock()
+	now := b.now()
+	b.recordLocked(category, message, now)
+	if wait := errorReportWindow - now.Sub(b.lastSent); wait > 0 {
+		if b.timer == nil {
+			b.timer = time.AfterFunc(wait, func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				if err := b.flush(ctx); err != nil {
+					log.Printf("client-error report error: %v", err)
+				}
+			})
+		}
+		b.mu.Unlock()
+		return nil
+	}
+	b.mu.Unlock()
+	return b.flush(ctx)
+}
+
+func (b *errorBatcher) recordLocked(category, message string, now time.Time) {
+	for i := range b.pending {
+		if e := &b.pending[i]; e.Category == category && e.Message == message {
+			e.Count++
+			e.Last = now
+			return
+		}
+	}
+	if len(b.pending) >= errorBatchMax {
+		b.dropped++
+		return
+	}
+	b.pending = append(b.pending, ClientError{
+		Category: category,
+		Message:  message,
+		Count:    1,
+		First:    now,
+		Last:     now,
+	})
+}
+
+// flush sends whatever is pending.
+func (b *errorBatcher) flush(ctx context.Context) error {
+	b.mu.Lock()
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	batch, dropped := b.pending, b.dropped
+	b.pending, b.dropped = nil, 0
+	if len(batch) == 0 {
+		b.mu.Unlock()
+		return nil
+	}
+	b.lastSent = b.now()
+	b.mu.Unlock()
+	return b.send(ctx, batch, dropped)
+}
+
+// ReportError tells the server about a client-side failure it would not
+// otherwise see, such as a failed swap or download. Reports are batched and
+// rate-limited; delivery goes through the outbox.
+func (a *API) ReportError(ctx context.Context, category, message string) error {
+	return a.errors.add(ctx, category, message)
+}
+
+// FlushErrors sends any batched error reports now, e.g. at shutdown.
+func (a *API) FlushErrors(ctx context.Context) error {
+	return a.errors.flush(ctx)
+}
+
+func (a *API) sendClientErrors(ctx context.Context, batch []ClientError, dropped int) error {
+	payload := map[string]any{
+		"errors":  batch,
+		"dropped": dropped,
+	}
+	return a.outbox.Submit(ctx, ReportClientError, "/api/client-error", payload)
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type sentBatch struct {
+	errors  []ClientError
+	dropped int
+}
+
+func newTestBatcher(now *time.Time) (*errorBatcher, *[]sentBatch) {
+	var mu sync.Mutex
+	var sent []sentBatch
+	b := &errorBatcher{
+		send: func(ctx context.Context, batch []ClientError, dropped int) error {
+			mu.Lock()
+			defer mu.Unlock()
+			sent = append(sent, sentBatch{batch, dropped})
+			return nil
+		},
+		now: func() time.Time { return *now },
+	}
+	return b, &sent
+}
+
+func TestErrorBatcherRateLimits(t *testing.T) {
+	now := goldenTime
+	b, sent := newTestBatcher(&now)
+	ctx := context.Background()
+
+	// The first error goes out at once.
+	if err := b.add(ctx, ErrorSwap, "NACK"); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != 1 {
+		t.Fatalf("sent %d batches after the first error; want 1", len(*sent))
+	}
+
+	// A failure loop inside the window is held and folded together.
+	for i := 0; i < 5; i++ {
+		now = now.Add(time.Second)
+		_ = b.add(ctx, ErrorSwap, "NACK")
+	}
+	_ = b.add(ctx, ErrorDownload, "404")
+	if len(*sent) != 1 {
+		t.Fatalf("sent %d batches inside the window; want 1", len(*sent))
+	}
+	if err := b.flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got := (*sent)[1].errors
+	if len(got) != 2 || got[0].Count != 5 || got[1].Category != ErrorDownload {
+		t.Errorf("second batch = %+v", got)
+	}
+	if got[0].First.Equal(got[0].Last) {
+		t.Errorf("repeated error has First == Last: %+v", got[0])
+	}
+
+	// Once the window has passed the next error is sent directly again.
+	now = now.Add(errorReportWindow)
+	_ = b.add(ctx, ErrorBizHawk, "exited")
+	if len(*sent) != 3 {
+		t.Errorf("sent %d batches after the window; want 3", len(*sent))
+	}
+}
+
+func TestErrorBatcherCapsBatch(t *testing.T) {
+	now := goldenTime
+	b, sent := newTestBatcher(&now)
+	b.lastSent = now // inside the window: everything is batched
+	for i := 0; i < errorBatchMax+3; i++ {
+		_ = b.add(context.Background(), ErrorIPC, fmt.Sprintf("failure %d", i))
+	}
+	if err := b.flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != 1 {
+		t.Fatalf("sent %d batches; want 1", len(*sent))
+	}
+	if got := (*sent)[0]; len(got.errors) != errorBatchMax || got.dropped != 3 {
+		t.Errorf("batch of %d with %d dropped; want %d and 3", len(got.errors), got.dropped, errorBatchMax)
+	}
+	// An empty flush sends nothing.
+	_ = b.flush(context.Background())
+	if len(*sent) != 1 {
+		t.Errorf("empty flush sent a batch")
+	}
+}
+
+func TestReportErrorPostsClientError(t *testing.T) {
+	var path string
+	var body struct {
+		Errors  []ClientError `json:"errors"`
+		Dropped int           `json:"dropped"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("client-error body %s: %v", data, err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	a := NewAPI(&Config{ServerURL: srv.URL, BearerToken: "t"})
+	if err := a.ReportError(context.Background(), ErrorSwap, "swap to zelda.sfc: NACK"); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/api/client-error" {
+		t.Errorf("posted to %q", path)
+	}
+	if len(body.Errors) != 1 || body.Errors[0].Category != ErrorSwap || body.Errors[0].Count != 1 {
+		t.Errorf("posted %+v", body)
+	}
+}
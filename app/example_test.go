@@ -0,0 +1,125 @@
+package app_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"time"
+
+	"go-client/app"
+	"go-client/internal/luapeer"
+)
+
+// fakeBizHawk stands in for BizHawk: starting it connects a scripted Lua
+// peer to the client's IPC port.
+type fakeBizHawk struct {
+	peers chan *luapeer.Peer
+}
+
+func (b fakeBizHawk) Start(cfg *app.Config) (app.Emulator, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	addr := net.JoinHostPort(cfg.BizhawkIPCHost, strconv.Itoa(cfg.BizhawkIPCPort))
+	peer, err := luapeer.Dial(ctx, addr, luapeer.MustLoad("happy-path"), nil)
+	if err != nil {
+		return nil, err
+	}
+	b.peers <- peer
+	return fakeEmulator{peer}, nil
+}
+
+type fakeEmulator struct {
+	peer *luapeer.Peer
+}
+
+func (e fakeEmulator) Wait() error {
+	<-e.peer.Closed()
+	return nil
+}
+
+func (e fakeEmulator) Kill() error { return e.peer.Close() }
+
+func (e fakeEmulator) PID() int { return 0 }
+
+// Example embeds the client against a mock server, with a fake emulator in
+// place of BizHawk, shows a message on its overlay and shuts it down.
+func Example() {
+	dir, err := os.MkdirTemp("", "go-client-example-")
+	if err != nil {
+		log.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	defer func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}()
+
+	server := httptest.NewServer(app.NewMockServer())
+	defer server.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	cfg := &app.Config{
+		ServerURL:      server.URL,
+		PlayerName:     "embedder",
+		SessionName:    "selftest",
+		BearerToken:    "selftest-token",
+		RomDir:         "roms",
+		SaveDir:        "saves",
+		BizhawkIPCHost: "127.0.0.1",
+		BizhawkIPCPort: port,
+	}
+	bizhawk := fakeBizHawk{peers: make(chan *luapeer.Peer, 1)}
+	client, err := app.New(cfg, app.Options{
+		Logger:          log.New(io.Discard, "", 0),
+		StateDir:        dir,
+		EmulatorBackend: bizhawk,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	events, unsubscribe := client.State().Subscribe(64)
+	defer unsubscribe()
+
+	done := make(chan error, 1)
+	go func() { done <- client.Run(context.Background()) }()
+	<-client.Ready()
+	peer := <-bizhawk.peers
+
+	for ev := range events {
+		if ev.Type == app.EventReadyChanged {
+			fmt.Println("event:", ev.Type, ev.New)
+			break
+		}
+	}
+	snap := client.State().Snapshot()
+	fmt.Println("ready:", snap.Ready, "session:", snap.SessionName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Control().Message("Hello from the embedder"); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("overlay:", peer.Expect(ctx, "MSG"))
+
+	client.Shutdown()
+	fmt.Println("run:", <-done)
+	// Output:
+	//   selftest.nes: 100% (0.0 MB of 0.0 MB)
+	// 1/1 games downloaded
+	// event: ready_changed true
+	// ready: true session: selftest
+	// overlay: <nil>
+	// run: <nil>
+}
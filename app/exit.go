@@ -0,0 +1,160 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// Process exit codes. These are a stable contract for wrapper scripts;
+// never renumber an existing code.
+const (
+	ExitOK             = 0   // clean shutdown (session ended or BizHawk closed)
+	ExitError          = 1   // unclassified runtime error
+	ExitConfigError    = 2   // config/logging could not be initialized
+	ExitBootstrapError = 3   // install, registration, or session join failed
+	ExitServerError    = 4   // server rejected Ready or was unreachable
+	ExitKicked         = 5   // kicked by the host
+	ExitBizHawkCrashed = 6   // BizHawk failed to launch or exited with an error
+	ExitInterrupted    = 130 // Ctrl+C / SIGTERM
+	ExitPanic          = 70  // unrecovered panic in the client
+)
+
+// ExitCause names why the client is terminating.
+type ExitCause string
+
+const (
+	CauseNone           ExitCause = ""
+	CauseSessionEnded   ExitCause = "session_ended"
+	CauseBizHawkExited  ExitCause = "bizhawk_exited"
+	CauseBizHawkCrashed ExitCause = "bizhawk_crashed"
+	CauseKicked         ExitCause = "kicked"
+	CauseInterrupted    ExitCause = "interrupted"
+	CauseConfigError    ExitCause = "config_error"
+	CauseBootstrapError ExitCause = "bootstrap_error"
+	CauseServerError    ExitCause = "server_error"
+	CauseError          ExitCause = "error"
+	CausePanic          ExitCause = "panic"
+)
+
+// ExitCode maps a termination cause to its process exit code.
+func ExitCode(c ExitCause) int {
+	switch c {
+	case CauseNone, CauseSessionEnded, CauseBizHawkExited:
+		return ExitOK
+	case CauseConfigError:
+		return ExitConfigError
+	case CauseBootstrapError:
+		return ExitBootstrapError
+	case CauseServerError:
+		return ExitServerError
+	case CauseKicked:
+		return ExitKicked
+	case CauseBizHawkCrashed:
+		return ExitBizHawkCrashed
+	case CauseInterrupted:
+		return ExitInterrupted
+	case CausePanic:
+		return ExitPanic
+	default:
+		return ExitError
+	}
+}
+
+// exitError tags an error returned from Run with its termination cause.
+type exitError struct {
+	cause ExitCause
+	err   error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+func withCause(cause ExitCause, err error) error {
+	return &exitError{cause: cause, err: err}
+}
+
+// causeOf extracts the termination cause from an error returned by Run.
+func causeOf(err error) ExitCause {
+	if err == nil {
+		return CauseNone
+	}
+	var ee *exitError
+	if errors.As(err, &ee) {
+		return ee.cause
+	}
+	return CauseError
+}
+
+// ExitStatus is the single JSON line printed to stdout on exit.
+type ExitStatus struct {
+	Status       string    `json:"status"`
+	Cause        ExitCause `json:"cause"`
+	Code         int       `json:"code"`
+	Detail       string    `json:"detail,omitempty"`
+	Session      string    `json:"session,omitempty"`
+	RoundsPlayed int       `json:"rounds_played"`
+	DurationSec  int64     `json:"duration_sec"`
+
+	PlaytimeSeconds map[string]int64 `json:"playtime_seconds,omitempty"`
+}
+
+// printExitStatus writes the final machine-readable status line.
+func printExitStatus(s ExitStatus) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(os.Stdout, string(b))
+}
+
+func newExitStatus(
+	cause ExitCause,
+	detail, session string,
+	rounds int,
+	started time.Time,
+) ExitStatus {
+	return ExitStatus{
+		Status:       "exit",
+		Cause:        cause,
+		Code:         ExitCode(cause),
+		Detail:       detail,
+		Session:      session,
+		RoundsPlayed: rounds,
+		DurationSec:  int64(time.Since(started).Seconds()),
+	}
+}
+
+// panicExit ends the process after a panic with the final status line.
+// main installs it; until then a panic crashes as usual.
+var panicExit atomic.Pointer[func(where string, r any)]
+
+// goSafe runs fn in a new goroutine. A panic in fn ends the client with
+// ExitPanic and the status line, as one on the main goroutine does,
+// instead of a bare crash.
+func goSafe(where string, fn func()) {
+	go func() {
+		defer recoverPanic(where)
+		fn()
+	}()
+}
+
+// recoverPanic must be deferred directly. It hands a panic to panicExit,
+// or re-panics when none is installed.
+func recoverPanic(where string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	log.Printf("PANIC in %s: %v\n%s", where, r, debug.Stack())
+	if fn := panicExit.Load(); fn != nil {
+		(*fn)(where, r)
+		return
+	}
+	panic(r)
+}
@@ -0,0 +1,121 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestExitCode(t *testing.T) {
+	// Wrapper scripts depend on these numbers; never change one.
+	tests := []struct {
+		cause ExitCause
+		code  int
+	}{
+		{CauseNone, 0},
+		{CauseSessionEnded, 0},
+		{CauseBizHawkExited, 0},
+		{CauseError, 1},
+		{CauseConfigError, 2},
+		{CauseBootstrapError, 3},
+		{CauseServerError, 4},
+		{CauseKicked, 5},
+		{CauseBizHawkCrashed, 6},
+		{CausePanic, 70},
+		{CauseInterrupted, 130},
+		{ExitCause("from_the_future"), 1},
+	}
+	for _, tt := range tests {
+		if got := ExitCode(tt.cause); got != tt.code {
+			t.Errorf("ExitCode(%q) = %d; want %d", tt.cause, got, tt.code)
+		}
+	}
+}
+
+func TestCauseOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ExitCause
+	}{
+		{nil, CauseNone},
+		{errors.New("boom"), CauseError},
+		{withCause(CauseBootstrapError, errors.New("join failed")), CauseBootstrapError},
+		{fmt.Errorf("run: %w", withCause(CauseServerError, errors.New("ready"))), CauseServerError},
+	}
+	for _, tt := range tests {
+		if got := causeOf(tt.err); got != tt.want {
+			t.Errorf("causeOf(%v) = %q; want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestAppExitStatus(t *testing.T) {
+	newApp := func() *App {
+		return &App{cfg: &Config{SessionName: "relay"}, state: NewClientState(), started: time.Now()}
+	}
+
+	// The first recorded cause wins over the interrupt our own stop causes.
+	a := newApp()
+	a.terminate(CauseKicked, "host kicked ana", false)
+	a.terminate(CauseInterrupted, "", false)
+	s := a.ExitStatus(nil)
+	if s.Cause != CauseKicked || s.Code != ExitKicked || s.Detail != "host kicked ana" || s.Session != "relay" {
+		t.Errorf("status = %+v; want the kick", s)
+	}
+
+	// An error from Run overrides a recorded cause.
+	a = newApp()
+	a.terminate(CauseSessionEnded, "", false)
+	s = a.ExitStatus(withCause(CauseServerError, errors.New("ready error")))
+	if s.Cause != CauseServerError || s.Code != ExitServerError {
+		t.Errorf("status = %+v; want the server error", s)
+	}
+
+	// A clean run exits 0.
+	if s := newApp().ExitStatus(nil); s.Code != ExitOK || s.Status != "exit" {
+		t.Errorf("status = %+v; want a clean exit", s)
+	}
+}
+
+func TestExitStatusLine(t *testing.T) {
+	s := newExitStatus(CauseKicked, "bye", "relay", 3, time.Now())
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]any{
+		"status": "exit", "cause": "kicked", "code": float64(5),
+		"detail": "bye", "session": "relay", "rounds_played": float64(3),
+	} {
+		if got[key] != want {
+			t.Errorf("%s = %v; want %v", key, got[key], want)
+		}
+	}
+}
+
+func TestGoSafeReportsPanic(t *testing.T) {
+	type report struct {
+		where string
+		r     any
+	}
+	got := make(chan report, 1)
+	exit := func(where string, r any) { got <- report{where, r} }
+	prev := panicExit.Swap(&exit)
+	defer panicExit.Store(prev)
+
+	goSafe("heartbeat", func() { panic("nil snapshot") })
+	select {
+	case rep := <-got:
+		if rep.where != "heartbeat" || rep.r != "nil snapshot" {
+			t.Errorf("panic reported as %q: %v", rep.where, rep.r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("panic in a goroutine was not reported")
+	}
+}
@@ -0,0 +1,5 @@
+package app
+
+// NewMockServer exposes the self-test's fake server to the package's
+// examples.
+var NewMockServer = newSelftestServer
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrFileLocked is returned when a file cannot be replaced because another
+// process (typically EmuHawk) holds it open.
+var ErrFileLocked = errors.New("file is locked by another process")
+
+// renameFile and sharingViolation are swapped out in tests to simulate
+// sharing violations, which only Windows reports.
+var (
+	renameFile       = os.Rename
+	sharingViolation = isSharingViolation
+)
+
+const replaceAttempts = 5
+
+// replaceFile atomically moves src over dst, retrying briefly on sharing
+// violations. On failure src is removed so no partial file is left behind.
+func replaceFile(src, dst string) error {
+	for attempt := 1; ; attempt++ {
+		err := renameFile(src, dst)
+		if err == nil {
+			return nil
+		}
+		if !sharingViolation(err) {
+			_ = os.Remove(src)
+			return err
+		}
+		if attempt >= replaceAttempts {
+			_ = os.Remove(src)
+			return fmt.Errorf("replace %s: %w: %v", dst, ErrFileLocked, err)
+		}
+		time.Sleep(time.Duration(attempt) * 250 * time.Millisecond)
+	}
+}
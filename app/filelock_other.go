@@ -0,0 +1,9 @@
+//go:build !windows
+
+package app
+
+// isSharingViolation is always false outside Windows, where open files
+// can be replaced freely.
+func isSharingViolation(err error) bool {
+	return false
+}
@@ -0,0 +1,29 @@
+//go:build windows
+
+package app
+
+import (
+	"errors"
+	"syscall"
+)
+
+const (
+	errorAccessDenied     syscall.Errno = 5
+	errorSharingViolation syscall.Errno = 32
+	errorLockViolation    syscall.Errno = 33
+)
+
+// isSharingViolation reports whether err is a Windows sharing/lock violation.
+// MoveFileEx reports ERROR_ACCESS_DENIED when the target is mapped by a
+// running process, so that is treated the same way.
+func isSharingViolation(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	switch errno {
+	case errorAccessDenied, errorSharingViolation, errorLockViolation:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	gameMetaFile = "game_meta.json"
+	// gameMetaTTL is how long fetched metadata is trusted before it is
+	// fetched again. Stale entries are still shown until then.
+	gameMetaTTL = 7 * 24 * time.Hour
+)
+
+// GameMeta is the server's descriptive information about one game, shown
+// by overlays and the status page.
+type GameMeta struct {
+	File        string    `json:"file"`
+	Title       string    `json:"title,omitempty"`
+	Console     string    `json:"console,omitempty"`
+	CoverURL    string    `json:"cover_url,omitempty"`
+	ReleaseYear int       `json:"release_year,omitempty"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+// GameMetadata fetches metadata for one game file.
+func (a *API) GameMetadata(ctx context.Context, file string) (*GameMeta, error) {
+	if err := validateROMName(file); err != nil {
+		return nil, err
+	}
+	req, err := a.newRequest(ctx, http.MethodGet, "/api/games/"+url.PathEscape(file), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, _, err := a.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("game metadata send error: %w", err)
+	}
+	if resp == nil {
+		return nil, fmt.Errorf("nil game metadata response")
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrEndpointUnsupported
+	default:
+		return nil, newAPIError("game metadata", resp)
+	}
+	var meta GameMeta
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		return nil, fmt.Errorf("decode game metadata response: %w", err)
+	}
+	meta.File = file
+	return &meta, nil
+}
+
+// GameMetaCache holds game metadata fetched lazily, the first time each
+// game is swapped to, and persists it between runs. Lookups never block on
+// the network; a game without metadata is shown by its file name.
+type GameMetaCache struct {
+	path  string
+	fetch func(ctx context.Context, file string) (*GameMeta, error)
+	now   func() time.Time
+
+	mu       sync.Mutex
+	entries  map[string]*GameMeta
+	inflight map[string]bool
+}
+
+func NewGameMetaCache(path string, fetch func(ctx context.Context, file string) (*GameMeta, error)) *GameMetaCache {
+	c := &GameMetaCache{
+		path:     path,
+		fetch:    fetch,
+		now:      time.Now,
+		entries:  make(map[string]*GameMeta),
+		inflight: make(map[string]bool),
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := decodeJSON(path, data, &c.entries); err != nil {
+			log.Printf("Ignoring game metadata cache: %v", err)
+			c.entries = make(map[string]*GameMeta)
+		}
+	}
+	return c
+}
+
+// Lookup returns the cached metadata for file, or nil.
+func (c *GameMetaCache) Lookup(file string) *GameMeta {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if m := c.entries[file]; m != nil {
+		cp := *m
+		return &cp
+	}
+	return nil
+}
+
+// Refresh fetches metadata for file unless a fresh entry is cached or a
+// fetch is already running. A 404 (an older server, or a game it has no
+// details for) is cached as a file-name-only entry so it is not asked for
+// again until the TTL passes; other failures keep whatever was cached.
+func (c *GameMetaCache) Refresh(ctx context.Context, file string) {
+	if file == "" {
+		return
+	}
+	c.mu.Lock()
+	m := c.entries[file]
+	if c.inflight[file] || (m != nil && c.now().Sub(m.FetchedAt) < gameMetaTTL) {
+		c.mu.Unlock()
+		return
+	}
+	c.inflight[file] = true
+	c.mu.Unlock()
+
+	meta, err := c.fetch(ctx, file)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.inflight, file)
+	switch {
+	case errors.Is(err, ErrEndpointUnsupported):
+		debugf("Server has no game metadata for %s; showing its file name", file)
+		meta = &GameMeta{File: file}
+	case err != nil:
+		debugf("Game metadata for %s unavailable: %v", file, err)
+		return
+	}
+	meta.FetchedAt = c.now()
+	c.entries[file] = meta
+	if err := c.saveLocked(); err != nil {
+		log.Printf("Game metadata cache save failed: %v", err)
+	}
+}
+
+func (c *GameMetaCache) saveLocked() error {
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, data, 0o644)
+}
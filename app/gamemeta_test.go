@@ -0,0 +1,184 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGameMetadataFetch(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.EscapedPath() {
+		case "/api/games/Zelda%20%233.sfc":
+			_, _ = w.Write([]byte(`{"file":"ignored","title":"Zelda 3","console":"SNES","release_year":1991}`))
+		case "/api/games/broken.nes":
+			http.Error(w, "boom", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	a := NewAPI(&Config{ServerURL: srv.URL, BearerToken: "t"})
+	ctx := context.Background()
+
+	meta, err := a.GameMetadata(ctx, "Zelda #3.sfc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The entry is keyed by the file asked for, whatever the server says.
+	if meta.File != "Zelda #3.sfc" || meta.Title != "Zelda 3" || meta.Console != "SNES" || meta.ReleaseYear != 1991 {
+		t.Errorf("GameMetadata = %+v", meta)
+	}
+	if _, err := a.GameMetadata(ctx, "unknown.nes"); !errors.Is(err, ErrEndpointUnsupported) {
+		t.Errorf("unknown game: %v", err)
+	}
+	var apiErr *APIError
+	if _, err := a.GameMetadata(ctx, "broken.nes"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("server error: %v", err)
+	}
+	before := requests.Load()
+	if _, err := a.GameMetadata(ctx, "../config.json"); err == nil || requests.Load() != before {
+		t.Errorf("unsafe name: %v after %d requests", err, requests.Load()-before)
+	}
+}
+
+// countingFetch answers from results, or ErrEndpointUnsupported, and
+// counts calls per file.
+type countingFetch struct {
+	mu      sync.Mutex
+	results map[string]*GameMeta
+	err     error
+	calls   map[string]int
+}
+
+func (f *countingFetch) fetch(ctx context.Context, file string) (*GameMeta, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[file]++
+	if f.err != nil {
+		return nil, f.err
+	}
+	if m, ok := f.results[file]; ok {
+		cp := *m
+		return &cp, nil
+	}
+	return nil, ErrEndpointUnsupported
+}
+
+func (f *countingFetch) Calls(file string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[file]
+}
+
+func TestGameMetaCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", gameMetaFile)
+	f := &countingFetch{results: map[string]*GameMeta{"mario.nes": {File: "mario.nes", Title: "Super Mario Bros."}}}
+	c := NewGameMetaCache(path, f.fetch)
+	now := goldenTime
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if c.Lookup("mario.nes") != nil {
+		t.Fatal("metadata before any fetch")
+	}
+	c.Refresh(ctx, "mario.nes")
+	m := c.Lookup("mario.nes")
+	if m == nil || m.Title != "Super Mario Bros." || !m.FetchedAt.Equal(goldenTime) {
+		t.Fatalf("Lookup = %+v", m)
+	}
+	m.Title = "changed by a caller"
+	if c.Lookup("mario.nes").Title != "Super Mario Bros." {
+		t.Error("Lookup returned the cached entry itself")
+	}
+
+	// Fresh entries are not fetched again until the TTL passes.
+	now = now.Add(gameMetaTTL - time.Minute)
+	c.Refresh(ctx, "mario.nes")
+	if n := f.Calls("mario.nes"); n != 1 {
+		t.Errorf("fetched %d times within the TTL; want 1", n)
+	}
+	// A failed refresh of a stale entry keeps showing it.
+	now = now.Add(time.Minute)
+	f.err = errors.New("offline")
+	c.Refresh(ctx, "mario.nes")
+	if n, m := f.Calls("mario.nes"), c.Lookup("mario.nes"); n != 2 || m == nil || !m.FetchedAt.Equal(goldenTime) {
+		t.Errorf("after a failed refresh: %d fetches, entry %+v", n, m)
+	}
+	f.err = nil
+	c.Refresh(ctx, "mario.nes")
+	if m := c.Lookup("mario.nes"); !m.FetchedAt.Equal(now) {
+		t.Errorf("refreshed entry fetched at %s; want %s", m.FetchedAt, now)
+	}
+
+	// A game the server has no details for is remembered by name.
+	c.Refresh(ctx, "homebrew.nes")
+	c.Refresh(ctx, "homebrew.nes")
+	if m := c.Lookup("homebrew.nes"); m == nil || m.File != "homebrew.nes" || m.Title != "" || f.Calls("homebrew.nes") != 1 {
+		t.Errorf("unknown game: entry %+v after %d fetches", m, f.Calls("homebrew.nes"))
+	}
+	c.Refresh(ctx, "")
+	if f.Calls("") != 0 {
+		t.Error("fetched metadata for no game")
+	}
+
+	// The next run starts from the saved cache.
+	again := NewGameMetaCache(path, f.fetch)
+	again.now = c.now
+	again.Refresh(ctx, "mario.nes")
+	if m := again.Lookup("mario.nes"); m == nil || m.Title != "Super Mario Bros." || f.Calls("mario.nes") != 3 {
+		t.Errorf("reloaded cache: entry %+v after %d fetches", m, f.Calls("mario.nes"))
+	}
+}
+
+func TestGameMetaCacheCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), gameMetaFile)
+	if err := os.WriteFile(path, []byte(`{"mario.nes": {`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f := &countingFetch{}
+	c := NewGameMetaCache(path, f.fetch)
+	if c.Lookup("mario.nes") != nil {
+		t.Error("entry read from a corrupt cache")
+	}
+	c.Refresh(context.Background(), "mario.nes")
+	if f.Calls("mario.nes") != 1 || c.Lookup("mario.nes") == nil {
+		t.Error("corrupt cache not replaced by a fresh fetch")
+	}
+}
+
+func TestGameMetaCacheSingleFlight(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	c := NewGameMetaCache(filepath.Join(t.TempDir(), gameMetaFile), func(ctx context.Context, file string) (*GameMeta, error) {
+		calls.Add(1)
+		<-release
+		return &GameMeta{File: file, Title: "Zelda"}, nil
+	})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.Refresh(context.Background(), "zelda.sfc")
+	}()
+	waitFor(t, "the first fetch", func() bool { return calls.Load() == 1 })
+	// A second swap to the same game while the fetch runs does not fetch.
+	c.Refresh(context.Background(), "zelda.sfc")
+	close(release)
+	wg.Wait()
+	if calls.Load() != 1 || c.Lookup("zelda.sfc") == nil {
+		t.Errorf("%d fetches; want 1 with its result cached", calls.Load())
+	}
+}
@@ -0,0 +1,128 @@
+package app
+
+import "time"
+
+const (
+	// defaultStartupGrace caps how long disconnect handling stays off
+	// while waiting for the first heartbeat and HELLO; a client that never
+	// gets either is genuinely broken and should say so.
+	defaultStartupGrace = 2 * time.Minute
+	// defaultSwapGrace covers the core re-init stall after a SWAP ACK.
+	defaultSwapGrace = 15 * time.Second
+)
+
+// Grace window names as shown in snapshots and logs.
+const (
+	GraceStartup = "startup"
+	GraceSwap    = "swap"
+
+	GraceServerRestart = "server_restart"
+)
+
+// GraceStatus describes the grace window suppressing disconnect handling,
+// if any, so a quiet watchdog is explainable from the status page.
+type GraceStatus struct {
+	Window string    `json:"window"`
+	Until  time.Time `json:"until"`
+}
+
+// graceWindows tracks when disconnect handling is suppressed. It lives in
+// ClientState and uses its clock.
+type graceWindows struct {
+	startupUntil  time.Time
+	heartbeatSeen bool
+	helloSeen     bool
+
+	swapGrace time.Duration
+	swapUntil time.Time
+
+	restartUntil time.Time
+}
+
+// startupGrace returns the configured startup grace cap.
+func startupGrace(cfg *Config) time.Duration {
+	if cfg.StartupGraceSeconds > 0 {
+		return time.Duration(cfg.StartupGraceSeconds) * time.Second
+	}
+	return defaultStartupGrace
+}
+
+// swapGrace returns the configured per-swap grace.
+func swapGrace(cfg *Config) time.Duration {
+	if cfg.SwapGraceSeconds > 0 {
+		return time.Duration(cfg.SwapGraceSeconds) * time.Second
+	}
+	return defaultSwapGrace
+}
+
+// StartGraceWindows opens the startup window, which lasts until the first
+// successful heartbeat and Lua HELLO (at most startup), and sets the
+// length of the window opened by each acknowledged swap.
+func (s *ClientState) StartGraceWindows(startup, swap time.Duration) {
+	s.mu.Lock()
+	s.grace = graceWindows{startupUntil: s.now().Add(startup), swapGrace: swap}
+	s.mu.Unlock()
+}
+
+// MarkHelloSeen records that the Lua script has said HELLO this run.
+func (s *ClientState) MarkHelloSeen() {
+	s.mu.Lock()
+	s.grace.helloSeen = true
+	s.mu.Unlock()
+}
+
+// StartSwapGrace opens the per-swap window after a SWAP is acknowledged.
+func (s *ClientState) StartSwapGrace() {
+	s.mu.Lock()
+	if s.grace.swapGrace > 0 {
+		s.grace.swapUntil = s.now().Add(s.grace.swapGrace)
+	}
+	s.mu.Unlock()
+}
+
+// StartServerRestartGrace opens the window announced by a server restart
+// and returns when it ends. It survives StartGraceWindows' other windows
+// and is closed early by EndServerRestartGrace.
+func (s *ClientState) StartServerRestartGrace(d time.Duration) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.grace.restartUntil = s.now().Add(d)
+	return s.grace.restartUntil
+}
+
+// EndServerRestartGrace closes the server restart window and reports
+// whether one was still open.
+func (s *ClientState) EndServerRestartGrace() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	open := s.now().Before(s.grace.restartUntil)
+	s.grace.restartUntil = time.Time{}
+	return open
+}
+
+// ServerRestartUntil returns the end of the current server restart window,
+// or the zero time once it has been closed.
+func (s *ClientState) ServerRestartUntil() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.grace.restartUntil
+}
+
+// Grace returns the active grace window, or nil when disconnect handling
+// is live.
+func (s *ClientState) Grace() *GraceStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := s.now()
+	g := s.grace
+	if now.Before(g.restartUntil) {
+		return &GraceStatus{Window: GraceServerRestart, Until: g.restartUntil}
+	}
+	if !(g.heartbeatSeen && g.helloSeen) && now.Before(g.startupUntil) {
+		return &GraceStatus{Window: GraceStartup, Until: g.startupUntil}
+	}
+	if now.Before(g.swapUntil) {
+		return &GraceStatus{Window: GraceSwap, Until: g.swapUntil}
+	}
+	return nil
+}
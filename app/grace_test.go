@@ -0,0 +1,121 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+// graceWindow returns the name of the active window, or "" when
+// disconnect handling is live.
+func graceWindow(s *ClientState) string {
+	if g := s.Grace(); g != nil {
+		return g.Window
+	}
+	return ""
+}
+
+func TestStartupGrace(t *testing.T) {
+	s, advance := manualClockState()
+	if w := graceWindow(s); w != "" {
+		t.Fatalf("grace %q before StartGraceWindows", w)
+	}
+	s.StartGraceWindows(time.Minute, 10*time.Second)
+	if g := s.Grace(); g == nil || g.Window != GraceStartup || !g.Until.Equal(goldenTime.Add(time.Minute)) {
+		t.Fatalf("Grace = %+v; want startup until +1m", g)
+	}
+
+	// Only the heartbeat and HELLO together close it early.
+	s.MarkHeartbeat()
+	advance(time.Second)
+	if w := graceWindow(s); w != GraceStartup {
+		t.Errorf("grace after heartbeat only = %q; want startup", w)
+	}
+	s.MarkHelloSeen()
+	if w := graceWindow(s); w != "" {
+		t.Errorf("grace after heartbeat and HELLO = %q; want none", w)
+	}
+
+	// Without them it runs out at the cap.
+	s.StartGraceWindows(time.Minute, 10*time.Second)
+	advance(time.Minute - time.Nanosecond)
+	if w := graceWindow(s); w != GraceStartup {
+		t.Errorf("grace just before the cap = %q; want startup", w)
+	}
+	advance(time.Nanosecond)
+	if w := graceWindow(s); w != "" {
+		t.Errorf("grace at the cap = %q; want none", w)
+	}
+}
+
+func TestSwapGrace(t *testing.T) {
+	s, advance := manualClockState()
+	s.StartSwapGrace()
+	if w := graceWindow(s); w != "" {
+		t.Fatalf("swap grace %q opened before its length was set", w)
+	}
+
+	s.StartGraceWindows(0, 10*time.Second)
+	s.StartSwapGrace()
+	advance(9 * time.Second)
+	if w := graceWindow(s); w != GraceSwap {
+		t.Errorf("grace 9s after a swap = %q; want swap", w)
+	}
+	// A second swap restarts the window rather than extending the first.
+	s.StartSwapGrace()
+	advance(9 * time.Second)
+	if g := s.Grace(); g == nil || g.Window != GraceSwap || !g.Until.Equal(goldenTime.Add(19*time.Second)) {
+		t.Errorf("Grace after a second swap = %+v; want swap until +19s", g)
+	}
+	advance(time.Second)
+	if w := graceWindow(s); w != "" {
+		t.Errorf("grace after the swap window = %q; want none", w)
+	}
+
+	s.StartGraceWindows(0, 0)
+	s.StartSwapGrace()
+	if w := graceWindow(s); w != "" {
+		t.Errorf("grace with swap grace off = %q; want none", w)
+	}
+}
+
+func TestServerRestartGrace(t *testing.T) {
+	s, advance := manualClockState()
+	s.StartGraceWindows(2*time.Minute, 10*time.Second)
+	s.StartSwapGrace()
+	until := s.StartServerRestartGrace(time.Minute)
+	if !until.Equal(goldenTime.Add(time.Minute)) || !s.ServerRestartUntil().Equal(until) {
+		t.Fatalf("restart window ends %s (reported %s); want +1m", until, s.ServerRestartUntil())
+	}
+
+	// It outranks the other windows, which carry on underneath it.
+	if w := graceWindow(s); w != GraceServerRestart {
+		t.Errorf("grace with every window open = %q; want server_restart", w)
+	}
+	advance(time.Minute)
+	if w := graceWindow(s); w != GraceStartup {
+		t.Errorf("grace after the restart window = %q; want startup", w)
+	}
+	if s.EndServerRestartGrace() {
+		t.Error("EndServerRestartGrace reported an expired window as open")
+	}
+
+	s.StartServerRestartGrace(time.Minute)
+	advance(time.Second)
+	if !s.EndServerRestartGrace() {
+		t.Error("EndServerRestartGrace reported an open window as closed")
+	}
+	if !s.ServerRestartUntil().IsZero() {
+		t.Errorf("ServerRestartUntil = %s after closing; want zero", s.ServerRestartUntil())
+	}
+}
+
+func TestGraceDurations(t *testing.T) {
+	cfg := &Config{}
+	if startupGrace(cfg) != defaultStartupGrace || swapGrace(cfg) != defaultSwapGrace {
+		t.Errorf("defaults = %s, %s", startupGrace(cfg), swapGrace(cfg))
+	}
+	cfg.StartupGraceSeconds, cfg.SwapGraceSeconds = 30, 5
+	if startupGrace(cfg) != 30*time.Second || swapGrace(cfg) != 5*time.Second {
+		t.Errorf("configured = %s, %s", startupGrace(cfg), swapGrace(cfg))
+	}
+}
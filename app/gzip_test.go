@@ -0,0 +1,97 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// gzipServer answers every request with body, gzip-compressed, and
+// decodes any gzip request body into got.
+func gzipServer(t *testing.T, body string, got *[]byte) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			t.Errorf("%s sent without Accept-Encoding: gzip", r.URL.Path)
+		}
+		var in io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("%s: %v", r.URL.Path, err)
+				return
+			}
+			in = zr
+		}
+		*got, _ = io.ReadAll(in)
+
+		zb, err := gzipBytes([]byte(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(zb)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestJoinSessionDecodesGzip(t *testing.T) {
+	var got []byte
+	srv := gzipServer(t, `{"games":[{"id":11,"file":"mario.nes"}],"round_length_seconds":90}`, &got)
+	a := NewAPI(&Config{ServerURL: srv.URL, BearerToken: "t"})
+	m, err := a.JoinSession(context.Background(), "relay")
+	if err != nil {
+		t.Fatalf("JoinSession: %v", err)
+	}
+	if len(m.Games) != 1 || m.Games[0].File != "mario.nes" || m.RoundLengthSeconds != 90 {
+		t.Errorf("manifest = %+v", m)
+	}
+}
+
+func TestReadyDecodesGzip(t *testing.T) {
+	var got []byte
+	srv := gzipServer(t, `{"game_file":"zelda.sfc","state":"running"}`, &got)
+	a := NewAPI(&Config{ServerURL: srv.URL, BearerToken: "t"})
+	state := NewClientState()
+	if err := a.Ready(context.Background(), state, Capabilities{}); err != nil {
+		t.Fatalf("Ready: %v", err)
+	}
+	if state.GetCurrentGame() != "zelda.sfc" || !state.Snapshot().Ready {
+		t.Errorf("game %q, ready %v after a gzip ready response", state.GetCurrentGame(), state.Snapshot().Ready)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(got, &body); err != nil || body["instance_id"] == nil {
+		t.Errorf("ready body = %q", got)
+	}
+}
+
+func TestLargeRequestBodiesAreCompressed(t *testing.T) {
+	var got []byte
+	srv := gzipServer(t, `{}`, &got)
+	a := NewAPI(&Config{ServerURL: srv.URL, BearerToken: "t"})
+	payload := map[string]string{"log": strings.Repeat("x", gzipRequestThreshold)}
+	req, err := a.newRequest(context.Background(), http.MethodPost, "/api/anything", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q; want gzip", req.Header.Get("Content-Encoding"))
+	}
+	resp, _, err := a.do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	want, _ := json.Marshal(payload)
+	if !bytes.Equal(got, want) {
+		t.Errorf("server decoded %d bytes; want the %d-byte payload", len(got), len(want))
+	}
+}
@@ -0,0 +1,1257 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HandlerAPI is the server API the built-in handlers call. *API
+// implements it; tests substitute a fake.
+type HandlerAPI interface {
+	ServerAPI
+	UploadSave(ctx context.Context, localPath string, roundNumber int) error
+	JoinSession(ctx context.Context, sessionName string) (*SessionManifest, error)
+	SessionManifest(ctx context.Context, sessionName string) (*SessionManifest, error)
+	ReportError(ctx context.Context, category, message string) error
+}
+
+// HandlerReports are the notices handlers send about events they answered,
+// skipped or refused. *API delivers them through its outbox.
+type HandlerReports interface {
+	ReadyCheckResponse(ctx context.Context, checkID string, confirmed bool, latency time.Duration) error
+	ReportSkippedAction(ctx context.Context, action string, dueAt time.Time, age time.Duration) error
+	ReportRejectedGame(ctx context.Context, game string, round int) error
+	ReportStaleState(ctx context.Context, state string, stateAt time.Time, seq int64, current StateOrder) error
+	ReportRoleRejected(ctx context.Context, event, role, reason string) error
+	SwapFailed(ctx context.Context, round int, reason string) error
+	DownloadAck(ctx context.Context, ack DownloadAck) error
+}
+
+// ServerClock samples the server clock for host-requested time syncs.
+type ServerClock interface {
+	ServerTime(ctx context.Context) (time.Time, error)
+	TimeSyncReport(ctx context.Context, s ClockSample, samples int) error
+}
+
+// HandlerIPC is the emulator connection the built-in handlers use.
+// *BizhawkIPC implements it; tests substitute a fake.
+type HandlerIPC interface {
+	EmulatorIPC
+	Swap(at int64, game string) error
+	QueryLoadedGame() (string, error)
+	Capabilities() []string
+	OnEvent(name string, fn func(data string)) (unsubscribe func())
+}
+
+// HandlerDeps are what NewHandlers wires the built-in handlers to.
+type HandlerDeps struct {
+	API     HandlerAPI
+	Reports HandlerReports
+	Clock   ServerClock
+	IPC     HandlerIPC
+	Config  *Config
+	State   *ClientState
+
+	// ManifestPath is where the session manifest is loaded from and
+	// saved to.
+	ManifestPath string
+	// HTTPClient runs ROM and Lua script downloads.
+	HTTPClient *http.Client
+	// GameMetadata fetches the details shown for a game.
+	GameMetadata func(ctx context.Context, file string) (*GameMeta, error)
+}
+
+// Handlers contains methods for processing events received from the server.
+type Handlers struct {
+	api     HandlerAPI
+	reports HandlerReports
+	clock   ServerClock
+	cfg     *Config
+	state   *ClientState
+	ipc     HandlerIPC
+
+	manifestPath string
+	manifestMu   sync.RWMutex
+	manifest     *SessionManifest
+
+	saves         *SaveCipher
+	notify        Notifier
+	catchUpPolicy CatchUpPolicy
+	registry      *Registry
+	prepares      *prepareTracker
+	downloads     *DownloadManager
+	commands      *commandDedup
+	schedule      *Schedule
+	gameMeta      *GameMetaCache
+
+	// exit records a termination cause and optionally stops the app.
+	exit func(cause ExitCause, detail string, stop bool)
+	// recover queues a session recovery (resync plus Pusher reconnect).
+	recover func(trigger RecoveryTrigger, gap time.Duration)
+	// closeEmulator and launchEmulator stop and restart BizHawk without
+	// ending the client, for spectators (see role.go).
+	closeEmulator  func() error
+	launchEmulator func() error
+
+	rounds    atomic.Int64
+	lastRound atomic.Int64
+
+	// rearmMu serializes clock re-syncs so re-armed actions go out once.
+	rearmMu sync.Mutex
+}
+
+// RoundsPlayed returns how many swaps this client has executed.
+func (h *Handlers) RoundsPlayed() int {
+	return int(h.rounds.Load())
+}
+
+// NewHandlers loads the session manifest and sets up the built-in
+// handlers. The caller hands the save cipher, if any, to the API and the
+// game name mapping to the IPC link.
+func NewHandlers(deps HandlerDeps) *Handlers {
+	cfg := deps.Config
+	manifest, err := LoadManifest(deps.ManifestPath)
+	if err != nil {
+		log.Printf("No session manifest loaded: %v", err)
+	}
+	var saves *SaveCipher
+	if cfg.SavePassphrase != "" {
+		saves, err = NewSaveCipher(cfg.SavePassphrase, cfg.SessionName, cfg.CompressSaves)
+		if err != nil {
+			log.Printf("Save encryption disabled: %v", err)
+		}
+	}
+	h := &Handlers{
+		api:     deps.API,
+		reports: deps.Reports,
+		clock:   deps.Clock,
+		cfg:     cfg,
+		state:   deps.State,
+		ipc:     deps.IPC,
+		saves:   saves,
+		notify:  NewNotifier(cfg),
+
+		manifestPath: deps.ManifestPath,
+		manifest:     manifest,
+
+		catchUpPolicy: NewCatchUpPolicy(cfg),
+		registry:      NewRegistry(),
+		prepares:      newPrepareTracker(),
+		downloads:     NewDownloadManager(deps.HTTPClient, deps.State, cfg),
+		commands:      newCommandDedup(commandDedupSize),
+		schedule:      NewSchedule(),
+		gameMeta:      NewGameMetaCache(filepath.Join(archiveCacheDir, gameMetaFile), deps.GameMetadata),
+	}
+	h.registerBuiltins()
+	RegisterCustomHandlers(h.registry, Deps{
+		API:    deps.API,
+		IPC:    deps.IPC,
+		State:  deps.State,
+		Config: cfg,
+	})
+	return h
+}
+
+func (h *Handlers) registerBuiltins() {
+	h.registry.Register("swap", h.Swap)
+	h.registry.Register("download_rom", h.DownloadROM)
+	h.registry.Register("download_lua", h.DownloadLua)
+	h.registry.Register("message", h.ServerMessage)
+	h.registry.Register("kick", h.Kick)
+	h.registry.Register("change_game_state", h.ChnageGameState)
+	h.registry.Register("session_ended", h.SessionEnded)
+	h.registry.Register("prepare_swap", h.PrepareSwap)
+	h.registry.Register("clear_saves", h.ClearSaves)
+	h.registry.Register("session_rejoin", h.SessionRejoin)
+	h.registry.Register("set_log_level", h.SetLogLevel)
+	h.registry.Register("ready_check", h.ReadyCheck)
+	h.registry.Register("time_sync", h.TimeSync)
+	h.registry.Register("server_restarting", h.ServerRestarting)
+	h.registry.Register("change_role", h.ChangeRole)
+}
+
+// Downloads returns the manager running handler-initiated downloads.
+func (h *Handlers) Downloads() *DownloadManager {
+	return h.downloads
+}
+
+// Schedule returns the actions armed in the emulator.
+func (h *Handlers) Schedule() *Schedule {
+	return h.schedule
+}
+
+// GameMeta returns the cache of server-provided game metadata.
+func (h *Handlers) GameMeta() *GameMetaCache {
+	return h.gameMeta
+}
+
+// Shutdown cancels handler-initiated downloads so they cannot keep the
+// process alive; interrupted ROM downloads resume on the next start.
+func (h *Handlers) Shutdown() {
+	h.downloads.Shutdown(downloadShutdownGrace)
+}
+
+// decryptSave decrypts the savestate at path, if it is encrypted, so
+// BizHawk can load it. A file sealed with another passphrase, or whose
+// plaintext does not match the hash recorded at upload, is left as-is.
+func (h *Handlers) decryptSave(path string) {
+	if h.saves == nil {
+		return
+	}
+	_, err := h.saves.OpenFile(path, savedHash(path))
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	log.Printf("Savestate decrypt failed: %v", err)
+	switch {
+	case errors.Is(err, ErrSaveKeyMismatch):
+		h.sendText(MsgSaveKeyMismatch, MsgVars{"file": filepath.Base(path)})
+	case errors.Is(err, ErrSaveHashMismatch):
+		h.reportError(ErrorSwap, err)
+	}
+}
+
+// localName maps a canonical game file to its on-disk name.
+func (h *Handlers) localName(file string) string {
+	h.manifestMu.RLock()
+	defer h.manifestMu.RUnlock()
+	return h.manifest.LocalName(file)
+}
+
+// emulatorFile maps a canonical game file to what BizHawk loads: its
+// converted form or its on-disk name.
+func (h *Handlers) emulatorFile(file string) string {
+	h.manifestMu.RLock()
+	defer h.manifestMu.RUnlock()
+	return h.manifest.EmulatorFile(file)
+}
+
+// convert runs the session's disc conversion for file, if any.
+func (h *Handlers) convert(file string) error {
+	h.manifestMu.RLock()
+	m := h.manifest
+	h.manifestMu.RUnlock()
+	return ensureConverted(context.Background(), h.cfg, m, file)
+}
+
+// checksum returns the manifest's expected SHA-256 for file, or "".
+func (h *Handlers) checksum(file string) string {
+	h.manifestMu.RLock()
+	defer h.manifestMu.RUnlock()
+	return h.manifest.Checksum(file)
+}
+
+// romPath is where a canonical game file is stored locally.
+func (h *Handlers) romPath(file string) string {
+	return filepath.Join(h.cfg.RomDir, h.localName(file))
+}
+
+// resolveGame maps a payload game reference to its canonical filename.
+func (h *Handlers) resolveGame(ref GameRef) (string, error) {
+	h.manifestMu.RLock()
+	defer h.manifestMu.RUnlock()
+	return h.manifest.Resolve(ref)
+}
+
+// checkInSession refuses a swap target outside the session manifest,
+// refreshing the manifest once in case it is stale. allowUnlisted is the
+// host's explicit opt-out for bonus games.
+func (h *Handlers) checkInSession(game string, allowUnlisted bool) error {
+	h.manifestMu.RLock()
+	m := h.manifest
+	h.manifestMu.RUnlock()
+	if allowUnlisted || m == nil || m.Contains(game) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	fresh, err := h.api.SessionManifest(ctx, h.cfg.SessionName)
+	if err != nil {
+		log.Printf("Manifest refresh for %s failed: %v", game, err)
+	} else {
+		h.setManifest(fresh)
+		if fresh.Contains(game) {
+			log.Printf("Manifest was stale; %s is part of the session", game)
+			return nil
+		}
+	}
+	return &UnlistedGameError{Game: game, Session: h.cfg.SessionName}
+}
+
+// setManifest stores and persists a newly fetched manifest.
+func (h *Handlers) setManifest(m *SessionManifest) {
+	m.AssignLocalNames(h.cfg.RomDir, pathLimit(h.cfg))
+	if err := SaveManifest(m, h.manifestPath); err != nil {
+		log.Printf("Save session manifest: %v", err)
+	}
+	h.manifestMu.Lock()
+	h.manifest = m
+	h.manifestMu.Unlock()
+}
+
+// rejectUnlisted reports a refused swap target to the server and player.
+func (h *Handlers) rejectUnlisted(err error, round int) {
+	var unlisted *UnlistedGameError
+	if !errors.As(err, &unlisted) {
+		return
+	}
+	log.Printf("Refusing swap: %v", err)
+	h.notify.Notify(NotifySwapFailed, messages.Render(MsgNotifySwapBlocked, nil), err.Error())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.reports.ReportRejectedGame(ctx, unlisted.Game, round); err != nil {
+		log.Printf("rejected-game report error: %v", err)
+	}
+}
+
+func (h *Handlers) Swap(payload json.RawMessage) {
+	if h.rejectSpectator("swap") {
+		return
+	}
+	var data struct {
+		GameRef
+		RoundNumber   int   `json:"round_number"`
+		SwapTime      int64 `json:"swap_at"`
+		AllowUnlisted bool  `json:"allow_unlisted"`
+	}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		log.Printf("handleSwap: bad payload: %v", err)
+		return
+	}
+	if data.GameRef.IsZero() || data.SwapTime == 0 {
+		log.Printf("handleSwap: missing fields: %+v", data)
+		return
+	}
+	gameName, err := h.resolveGame(data.GameRef)
+	if err != nil {
+		log.Printf("handleSwap: %v", err)
+		h.notify.Notify(NotifySwapFailed, messages.Render(MsgNotifySwapFailed, nil), err.Error())
+		h.reportError(ErrorSwap, err)
+		return
+	}
+	if err := h.checkInSession(gameName, data.AllowUnlisted); err != nil {
+		h.rejectUnlisted(err, data.RoundNumber)
+		return
+	}
+	if !h.catchUp(ActionSwap, time.Unix(data.SwapTime, 0)) {
+		return
+	}
+
+	// Execute asynchronously so a reordered prepare_swap on the same
+	// channel can still be dispatched while we wait for it.
+	goSafe("swap", func() { h.executeSwap(data.RoundNumber, data.SwapTime, gameName) })
+}
+
+// savePath renders the local savestate path for meta using the agreed
+// save template.
+func (h *Handlers) savePath(meta SaveMeta) (string, error) {
+	rel, err := RenderSavePath(h.state.GetSaveTemplate(), meta)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(h.cfg.SaveDir, filepath.FromSlash(rel)), nil
+}
+
+func (h *Handlers) executeSwap(round int, swapAt int64, gameName string) {
+	prepared := h.prepares.wait(round)
+
+	if h.state.IsGameMissing(gameName) {
+		log.Printf("Game %s failed to download at startup; retrying before swap", gameName)
+		if err := h.fetchROM(DownloadUrgent, gameName); err != nil {
+			log.Printf("handleSwap: %v", err)
+			h.sendText(MsgSwapMissingGame, MsgVars{"game": gameName})
+			h.notify.Notify(NotifySwapFailed, messages.Render(MsgNotifySwapFailed, nil), err.Error())
+			h.reportError(ErrorSwap, err)
+			h.swapFailed(round, SwapFailedROMMissing)
+			return
+		}
+	}
+
+	want := SaveMeta{Session: h.state.GetSessionName(), Round: round, Game: gameName}
+	if path, err := h.savePath(want); err == nil {
+		h.decryptSave(path)
+		if err := ValidateSave(path, want); err != nil {
+			log.Printf("handleSwap: %v", err)
+			h.sendText(MsgSwapSaveMismatch, MsgVars{"game": gameName})
+			h.notify.Notify(NotifySwapFailed, messages.Render(MsgNotifySwapBlocked, nil), err.Error())
+			h.reportError(ErrorSwap, err)
+			h.swapFailed(round, SwapFailedSaveMismatch)
+			return
+		}
+	}
+	if err := h.ipc.Swap(swapAt, gameName); err != nil {
+		// The emulator keeps the old game, so the round is not counted
+		// and is reported failed instead of complete.
+		log.Printf("[IPC] SWAP send failed: %v", err)
+		h.schedule.Cancel(slotSwap)
+		h.notify.Notify(NotifySwapFailed, messages.Render(MsgNotifySwapFailed, nil), err.Error())
+		h.reportError(ErrorSwap, fmt.Errorf("swap to %s: %w", gameName, err))
+		h.swapFailed(round, SwapFailedEmulator)
+		return
+	}
+	h.schedule.Arm(slotSwap, ScheduledAction{Type: ActionSwap, At: time.Unix(swapAt, 0), Game: gameName})
+	h.gameStarted(gameName, &round)
+	h.state.SetCurrentGame(gameName)
+	h.rounds.Add(1)
+	h.lastRound.Store(int64(round))
+	log.Printf("Swap scheduled for game %s at %d", gameName, swapAt)
+
+	if err := h.verifyLoadedGame(swapAt, gameName); err != nil {
+		log.Printf("handleSwap: %v", err)
+		h.notify.Notify(NotifySwapFailed, messages.Render(MsgNotifySwapFailed, nil), err.Error())
+		h.reportError(ErrorSwap, err)
+		h.swapFailed(round, SwapFailedWrongGame)
+		return
+	}
+
+	if !prepared {
+		// The outgoing save may not be on the server yet.
+		err := fmt.Errorf("round %d: save upload still running", round)
+		log.Printf("Not reporting swap-complete: %v", err)
+		h.state.SetLastError("swap_complete", err)
+		h.swapFailed(round, SwapFailedSavePending)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.api.SwapComplete(ctx, round); err != nil {
+		log.Printf("swap-complete error: %v", err)
+		h.state.SetLastError("swap_complete", err)
+	}
+}
+
+// Reasons sent with a swap-failed report.
+const (
+	SwapFailedROMMissing   = "rom_missing"
+	SwapFailedSaveMismatch = "save_mismatch"
+	SwapFailedEmulator     = "emulator_refused"
+	SwapFailedWrongGame    = "wrong_game_loaded"
+	SwapFailedSavePending  = "save_upload_pending"
+)
+
+// swapFailed reports a round whose swap-complete will not be sent, so the
+// server is not left waiting for it.
+func (h *Handlers) swapFailed(round int, reason string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.reports.SwapFailed(ctx, round, reason); err != nil {
+		log.Printf("swap-failed report error: %v", err)
+	}
+}
+
+const (
+	// swapVerifyPoll is how often the loaded ROM is queried after a swap
+	// until it is the one swapped to or the SWAP timeout has passed.
+	swapVerifyPoll = 500 * time.Millisecond
+	// swapVerifyMaxWait caps how long swap-complete is held back waiting
+	// for the swap time before the loaded ROM can be checked.
+	swapVerifyMaxWait = 30 * time.Second
+)
+
+// verifyLoadedGame waits for the swap at swapAt to happen and checks that
+// the emulator then has game loaded. Scripts that cannot answer the query
+// are trusted on their SWAP ACK, as are swaps scheduled further out than
+// swapVerifyMaxWait.
+func (h *Handlers) verifyLoadedGame(swapAt int64, game string) error {
+	if d := time.Unix(swapAt, 0).Sub(h.state.ServerNow()); d > swapVerifyMaxWait {
+		debugf("handleSwap: swap to %s is %s away; trusting the SWAP ACK", game, d.Round(time.Second))
+		return nil
+	} else if d > 0 {
+		time.Sleep(d)
+	}
+	want := h.emulatorFile(game)
+	deadline := time.Now().Add(clientIPCTimings.Swap)
+	for {
+		loaded, err := h.ipc.QueryLoadedGame()
+		if err != nil {
+			debugf("handleSwap: cannot confirm the loaded game: %v", err)
+			return nil
+		}
+		if sameGameFile(loaded, want) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("swap to %s: emulator has %q loaded", game, loaded)
+		}
+		time.Sleep(swapVerifyPoll)
+	}
+}
+
+// sameGameFile reports whether the ROM the Lua script reports loaded is
+// want, a path relative to the ROM directory. The script may report it
+// with the ROM directory in front and with either slash.
+func sameGameFile(loaded, want string) bool {
+	norm := func(s string) string {
+		return strings.ToLower(strings.ReplaceAll(s, `\`, "/"))
+	}
+	loaded, want = norm(loaded), norm(want)
+	return want != "" && (loaded == want || strings.HasSuffix(loaded, "/"+want))
+}
+
+func (h *Handlers) DownloadROM(payload json.RawMessage) {
+	var data struct {
+		File    string `json:"file"`
+		Replace bool   `json:"replace"`
+	}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		log.Printf("handleDownloadROM: bad payload: %v", err)
+		return
+	}
+	started := time.Now()
+	url, err := romURL(h.cfg.ServerURL, data.File)
+	if err != nil {
+		log.Printf("handleDownloadROM: %v", err)
+		h.reportError(ErrorDownload, err)
+		h.ackDownload(newDownloadAck(AckKindROM, data.File, "", AckFailed, started, err))
+		return
+	}
+
+	// A verified copy needs no download unless the server is replacing it.
+	dest := h.romPath(data.File)
+	if want := h.checksum(data.File); !data.Replace && want != "" && checkROMHash(dest, want) == nil {
+		log.Printf("ROM %s already present and verified; not downloading", data.File)
+		h.state.ClearMissingGame(data.File)
+		h.ackDownload(newDownloadAck(AckKindROM, data.File, dest, AckAlreadyPresent, started, nil))
+		return
+	}
+
+	// EmuHawk keeps the loaded ROM open, so replacing it requires ejecting
+	// first and swapping back afterwards.
+	loaded := data.Replace && data.File == h.state.GetCurrentGame()
+	if loaded {
+		if err := h.ipc.SendCommand("EJECT"); err != nil {
+			log.Printf("handleDownloadROM: eject before replace failed: %v", err)
+		}
+	}
+
+	err = h.downloads.Fetch(DownloadBackground, url, dest)
+	switch {
+	case errors.Is(err, ErrFileLocked):
+		// Windows does not say which process holds the file; EmuHawk is
+		// only the likeliest one.
+		log.Printf(
+			"handleDownloadROM: %s is held open by another process (probably %s) and could not be replaced: %v",
+			dest, filepath.Base(h.cfg.EmuHawkPath), err,
+		)
+		h.sendText(MsgROMLocked, MsgVars{"game": data.File})
+		h.reportError(ErrorDownload, fmt.Errorf("replace %s: %w", data.File, err))
+	case err != nil:
+		log.Printf("handleDownloadROM: download failed: %v", err)
+		h.reportError(ErrorDownload, fmt.Errorf("download %s: %w", data.File, err))
+	default:
+		log.Printf("Downloaded ROM: %s", data.File)
+		if err = h.convert(data.File); err != nil {
+			log.Printf("handleDownloadROM: %v", err)
+			h.reportError(ErrorDownload, err)
+			break
+		}
+		h.state.ClearMissingGame(data.File)
+	}
+	h.ackDownload(newDownloadAck(AckKindROM, data.File, dest, AckSuccess, started, err))
+
+	if loaded {
+		if err := h.ipc.Swap(h.state.ServerNow().Unix(), data.File); err != nil {
+			log.Printf("[IPC] SWAP send failed: %v", err)
+		} else {
+			h.gameStarted(data.File, nil)
+		}
+	}
+}
+
+// gameStarted reports a game BizHawk has acknowledged loading and fetches
+// its metadata if it has none cached yet.
+func (h *Handlers) gameStarted(game string, round *int) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		h.gameMeta.Refresh(ctx, game)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.api.GameStarted(ctx, game, round); err != nil {
+		log.Printf("game-started error: %v", err)
+	}
+}
+
+func (h *Handlers) DownloadLua(payload json.RawMessage) {
+	var data struct {
+		Filename string `json:"filename"`
+	}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		log.Printf("handleDownloadLua: bad payload: %v", err)
+		return
+	}
+	dest := filepath.Join("scripts", data.Filename)
+	url := h.cfg.ServerURL + "/api/scripts/latest"
+	var incompatible *ScriptIncompatibleError
+	started := time.Now()
+	updated, err := installLuaScript(h.downloads.FetchTransient, url, dest)
+	outcome := AckSuccess
+	if !updated {
+		outcome = AckAlreadyPresent
+	}
+	defer h.ackDownload(newDownloadAck(AckKindLua, data.Filename, dest, outcome, started, err))
+	if errors.As(err, &incompatible) {
+		log.Printf("handleDownloadLua: %v", err)
+		h.sendText(MsgScriptIncompatible, MsgVars{
+			"required":  strconv.Itoa(incompatible.Required),
+			"supported": strconv.Itoa(incompatible.Supported),
+		})
+	} else if err != nil {
+		log.Printf("handleDownloadLua: download failed: %v", err)
+	} else if !updated {
+		log.Printf("Lua script %s unchanged; not reloading", data.Filename)
+	} else {
+		log.Printf("Downloaded Lua script: %s", data.Filename)
+		// Only scripts that advertise reloading understand RELOAD.
+		if slices.Contains(h.ipc.Capabilities(), CapReload) {
+			if err := h.ipc.SendCommand("RELOAD", dest); err != nil {
+				log.Printf("handleDownloadLua: reload failed: %v", err)
+			}
+		}
+	}
+}
+
+func (h *Handlers) ServerMessage(payload json.RawMessage) {
+	var data struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		log.Printf("handleServerMessage: bad payload: %v", err)
+		return
+	}
+	log.Printf("[SERVER MESSAGE] %s", data.Text)
+	h.ipc.SendMessage(data.Text)
+}
+
+func (h *Handlers) Kick(payload json.RawMessage) {
+	var data struct {
+		Reason string `json:"reason"`
+	}
+	_ = json.Unmarshal(payload, &data)
+	log.Printf("[KICKED] Reason: %s", data.Reason)
+	h.notify.Notify(NotifyKicked, messages.Render(MsgNotifyKicked, nil), data.Reason)
+
+	h.sendText(MsgKicked, MsgVars{"reason": data.Reason})
+	h.ipc.SendPause(nil)
+	if h.exit != nil {
+		h.exit(CauseKicked, data.Reason, true)
+	} else {
+		os.Exit(ExitKicked)
+	}
+}
+
+func (h *Handlers) ChnageGameState(payload json.RawMessage) {
+	var data struct {
+		State   string `json:"state"`
+		StateAt int64  `json:"state_at"`
+		Seq     int64  `json:"seq"`
+		Force   bool   `json:"force"`
+	}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		log.Printf("handleChnageGameState: bad payload: %v", err)
+		return
+	}
+	if data.StateAt == 0 {
+		log.Printf("handleChnageGameState: missing or zero start_time")
+		return
+	}
+
+	// state_at (then seq) is the logical clock: an event older than the
+	// applied state was overtaken by a newer one and must not undo it.
+	stateTime := time.Unix(data.StateAt, 0)
+	order := StateOrder{At: stateTime, Seq: data.Seq}
+	if current := h.state.CurrentStateOrder(); !data.Force && order.Before(current) {
+		h.staleState(data.State, order, current)
+		return
+	}
+	if !h.catchUp(actionKindForState(data.State), stateTime) {
+		return
+	}
+	if ok, current := h.state.ApplyStateOrdered(stateTime, data.State, data.Seq, data.Force); !ok {
+		h.staleState(data.State, order, current)
+		return
+	}
+	log.Printf(
+		"Scheduled %s at %s (%d)",
+		data.State,
+		stateTime.Format(time.RFC3339),
+		data.StateAt,
+	)
+	h.ipc.SendSync()
+
+	if time.Until(stateTime) > 5*time.Second {
+		h.notify.Notify(
+			NotifySessionStart,
+			messages.Render(MsgNotifyGameState, MsgVars{"state": data.State}),
+			messages.Render(MsgNotifyScheduledAt, MsgVars{"time": stateTime.Format("15:04:05")}),
+		)
+	}
+}
+
+// reportError passes a failure on to the server, which batches them.
+func (h *Handlers) reportError(category string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.api.ReportError(ctx, category, err.Error()); err != nil {
+		log.Printf("client-error report error: %v", err)
+	}
+}
+
+// sendText renders a catalog message and shows it on the overlay unless
+// the host disabled it.
+func (h *Handlers) sendText(key string, vars MsgVars) {
+	if msg := messages.Render(key, vars); msg != "" {
+		h.ipc.SendMessage(msg)
+	}
+}
+
+// staleState logs and reports a change_game_state event that arrived
+// after a newer one.
+func (h *Handlers) staleState(state string, order, current StateOrder) {
+	log.Printf(
+		"Ignoring %s at %s (seq %d): state from %s (seq %d) is newer",
+		state, order.At.Format(time.RFC3339), order.Seq,
+		current.At.Format(time.RFC3339), current.Seq,
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.reports.ReportStaleState(ctx, state, order.At, order.Seq, current); err != nil {
+		log.Printf("stale-state report error: %v", err)
+	}
+}
+
+// SessionEnded tears the session down in an order that keeps the last
+// segment's progress: final save, upload, pause, then game-stopped. A
+// failing step is logged and never skips the later ones.
+func (h *Handlers) SessionEnded(payload json.RawMessage) {
+	log.Printf("Session ended (payload: %s)", string(payload))
+	h.state.MarkSessionEnded()
+	if h.exit != nil {
+		h.exit(CauseSessionEnded, "", false)
+	}
+	h.state.SetConnected(false)
+	h.sendText(MsgSessionEnded, nil)
+	h.schedule.Cancel(slotSwap)
+	h.schedule.Cancel(slotState)
+	h.state.SetHardcore(false)
+	h.uploadFinalSave("session end")
+	h.ipc.SendPause(nil)
+
+	// GameStopped goes through the outbox, so a failure here is queued
+	// and retried (and persisted across a restart) rather than lost.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := h.api.GameStopped(ctx); err != nil {
+		log.Printf("game-stopped error: %v", err)
+	}
+}
+
+// uploadFinalSave captures the current game's final save and uploads it
+// unless save upload is turned off; reason prefixes the log lines.
+func (h *Handlers) uploadFinalSave(reason string) {
+	path, round, err := h.finalSave()
+	if err != nil {
+		log.Printf("%s: final save skipped: %v", reason, err)
+		return
+	}
+	if h.cfg.SkipSaveUpload {
+		debugf("%s: save upload is off; keeping %s locally", reason, path)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	if err := h.api.UploadSave(ctx, path, round); err != nil {
+		log.Printf("%s: final save upload failed: %v", reason, err)
+	}
+}
+
+// finalSave asks the emulator to save the current game before it is
+// paused at session end. The wait is bounded by SendCommand's ACK timeout.
+func (h *Handlers) finalSave() (string, int, error) {
+	game := h.state.GetCurrentGame()
+	if game == "" {
+		return "", 0, errors.New("no game loaded")
+	}
+	meta := SaveMeta{Session: h.state.GetSessionName(), Round: int(h.lastRound.Load()), Game: game}
+	path, err := h.savePath(meta)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := WriteSaveMeta(path, meta); err != nil {
+		return "", 0, fmt.Errorf("write save metadata: %w", err)
+	}
+	if err := h.ipc.SendCommand("SAVE", path); err != nil {
+		return "", 0, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", 0, fmt.Errorf("emulator acknowledged SAVE but wrote nothing: %w", err)
+	}
+	log.Printf("Final save captured: %s", path)
+	return path, meta.Round, nil
+}
+
+func (h *Handlers) PrepareSwap(payload json.RawMessage) {
+	if h.rejectSpectator("prepare_swap") {
+		return
+	}
+	var data struct {
+		GameRef
+		SavePath    string `json:"save_path"`
+		RoundNumber *int   `json:"round_number"`
+
+		// Authoritative makes the server's save_path override the template.
+		Authoritative bool `json:"save_path_authoritative"`
+		AllowUnlisted bool `json:"allow_unlisted"`
+	}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		log.Printf("handlePrepareSwap: bad payload: %v", err)
+		return
+	}
+	op := h.prepares.begin(data.RoundNumber)
+
+	savePath := data.SavePath
+	current := h.state.GetCurrentGame()
+	if !data.Authoritative && data.RoundNumber != nil && current != "" {
+		meta := SaveMeta{Session: h.state.GetSessionName(), Round: *data.RoundNumber, Game: current}
+		path, err := h.savePath(meta)
+		if err != nil {
+			log.Printf("handlePrepareSwap: %v; using server path", err)
+		} else if err := WriteSaveMeta(path, meta); err != nil {
+			log.Printf("handlePrepareSwap: write save metadata: %v; using server path", err)
+		} else {
+			savePath = path
+		}
+	}
+	if savePath == "" {
+		log.Printf("handlePrepareSwap: no save path for payload %s", string(payload))
+		h.prepares.finish(op)
+		return
+	}
+
+	// Saving and uploading can take minutes. They run off the dispatch
+	// goroutine so later events on the channel are not held up behind
+	// them; the swap waits on op instead.
+	goSafe("prepare_swap", func() {
+		defer h.prepares.finish(op)
+		h.saveForSwap(savePath, data.RoundNumber)
+	})
+
+	if data.GameRef.IsZero() {
+		return
+	}
+	gameName, err := h.resolveGame(data.GameRef)
+	if err != nil {
+		log.Printf("handlePrepareSwap: %v", err)
+		return
+	}
+	if err := h.checkInSession(gameName, data.AllowUnlisted); err != nil {
+		// The swap itself reports the rejection; just don't download.
+		log.Printf("handlePrepareSwap: not prefetching: %v", err)
+		return
+	}
+	goSafe("prefetch", func() { h.prefetchROM(gameName) })
+}
+
+// saveForSwap saves the outgoing game to path and, when the swap has a
+// round and save upload is on, uploads it. It returns once the upload succeeded or gave up, so
+// executeSwap, which waits for it (see prepareWaitTimeout), only reports
+// swap-complete after that.
+func (h *Handlers) saveForSwap(path string, round *int) {
+	log.Printf("Prepare swap: saving state to %s", path)
+	if err := h.ipc.SendCommand("SAVE", path); err != nil {
+		log.Printf("handlePrepareSwap: SAVE failed: %v", err)
+		return
+	}
+	if round != nil && !h.cfg.SkipSaveUpload {
+		h.uploadPreparedSave(path, *round)
+	}
+}
+
+const (
+	// saveUploadRetries is how many times a failed swap save upload is
+	// retried.
+	saveUploadRetries = 2
+	// saveWriteTimeout is how long a prepared save may take to reach disk
+	// after the emulator ACKed SAVE.
+	saveWriteTimeout = 10 * time.Second
+	// saveUploadTimeout bounds one save upload attempt.
+	saveUploadTimeout = 60 * time.Second
+)
+
+// saveUploadBackoff is the pause before upload attempt n.
+func saveUploadBackoff(attempt int) time.Duration {
+	return time.Duration(attempt) * time.Second
+}
+
+// uploadPreparedSave waits for the emulator to finish writing path and
+// uploads it, retrying a failed upload. The final failure is recorded as
+// the state's last error.
+func (h *Handlers) uploadPreparedSave(path string, round int) {
+	ctx, cancel := context.WithTimeout(context.Background(), saveWriteTimeout)
+	err := waitForFile(ctx, path)
+	cancel()
+	if err == nil {
+		err = verifyPresent(path)
+	}
+	if err != nil {
+		log.Printf("handlePrepareSwap: %v", err)
+		h.state.SetLastError("prepare_swap", err)
+		return
+	}
+
+	for attempt := 0; attempt <= saveUploadRetries; attempt++ {
+		if attempt > 0 {
+			log.Printf("Retrying save upload for round %d (%d/%d): %v", round, attempt, saveUploadRetries, err)
+			time.Sleep(saveUploadBackoff(attempt))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), saveUploadTimeout)
+		err = h.api.UploadSave(ctx, path, round)
+		cancel()
+		var tooLarge *SaveTooLargeError
+		if err == nil || errors.As(err, &tooLarge) {
+			break
+		}
+	}
+	if err != nil {
+		log.Printf("handlePrepareSwap: save upload failed: %v", err)
+		h.state.SetLastError("save_upload", fmt.Errorf("round %d: %w", round, err))
+		return
+	}
+	log.Printf("Uploaded save for round %d", round)
+}
+
+// waitForFile polls until path exists and is non-empty. The Lua script
+// ACKs SAVE once the write is queued, which can be before it hits disk.
+func waitForFile(ctx context.Context, path string) error {
+	tick := time.NewTicker(50 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		if fi, err := os.Stat(path); err == nil && fi.Size() > 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("savestate %s not written: %w", path, ctx.Err())
+		case <-tick.C:
+		}
+	}
+}
+
+// prefetchROM downloads the upcoming game if it is not already on disk.
+func (h *Handlers) prefetchROM(file string) {
+	dest := h.romPath(file)
+	if _, err := os.Stat(dest); err == nil {
+		if err := h.convert(file); err != nil {
+			log.Printf("Prefetch of %s: %v", file, err)
+		}
+		return
+	}
+	if err := h.fetchROM(DownloadBackground, file); err != nil {
+		log.Printf("Prefetch of %s failed: %v", file, err)
+	} else {
+		log.Printf("Prefetched ROM: %s", file)
+	}
+}
+
+// fetchROM downloads a game and clears any startup failure flag for it.
+func (h *Handlers) fetchROM(class DownloadClass, file string) error {
+	url, err := romURL(h.cfg.ServerURL, file)
+	if err != nil {
+		return err
+	}
+	dest := h.romPath(file)
+	fetch := func(d string) error { return h.downloads.Fetch(class, url, d) }
+	if err := fetchVerified(fetch, dest); err != nil {
+		var av *AVInterferenceError
+		if errors.As(err, &av) {
+			h.state.SetLastError("download", err)
+		}
+		return fmt.Errorf("download %s: %w", file, err)
+	}
+	if err := h.convert(file); err != nil {
+		return err
+	}
+	h.state.ClearMissingGame(file)
+	return nil
+}
+
+func (h *Handlers) ClearSaves(_payload json.RawMessage) {
+	saveDir := h.cfg.SaveDir
+	entries, err := os.ReadDir(saveDir)
+	if err != nil {
+		log.Printf("Error reading save directory '%s': %v", saveDir, err)
+		return
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(saveDir, entry.Name())
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("Error deleting %s: %v", path, err)
+		}
+	}
+	log.Println("All saves cleared.")
+}
+
+// SessionRejoin explicitly re-joins the session and refreshes the manifest.
+func (h *Handlers) SessionRejoin(_payload json.RawMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	manifest, err := h.api.JoinSession(ctx, h.cfg.SessionName)
+	if err != nil {
+		log.Printf("handleSessionRejoin: %v", err)
+		return
+	}
+	h.setManifest(manifest)
+	h.state.SetSessionName(h.cfg.SessionName)
+	log.Printf("Re-joined session '%s' (%d games)", h.cfg.SessionName, len(manifest.Games))
+}
+
+// SetLogLevel temporarily raises (or lowers) log verbosity.
+func (h *Handlers) SetLogLevel(payload json.RawMessage) {
+	var d LogDirective
+	if err := json.Unmarshal(payload, &d); err != nil {
+		log.Printf("handleSetLogLevel: bad payload: %v", err)
+		return
+	}
+	d.apply()
+}
+
+// TimeSync re-measures the server clock offset with extra samples, reports
+// the result, and re-arms the pending scheduled action on the new clock.
+func (h *Handlers) TimeSync(payload json.RawMessage) {
+	var data struct {
+		Samples int `json:"samples"`
+	}
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &data); err != nil {
+			log.Printf("handleTimeSync: bad payload: %v", err)
+			return
+		}
+	}
+	samples := data.Samples
+	if samples <= 0 {
+		samples = timeSyncSamples
+	}
+
+	h.rearmMu.Lock()
+	defer h.rearmMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	sample, err := measureClockOffset(ctx, h.clock.ServerTime, time.Now, samples)
+	if err != nil {
+		log.Printf("handleTimeSync: %v", err)
+		return
+	}
+	old := h.state.ClockOffset()
+	h.state.SetClockOffset(sample.Offset)
+	log.Printf(
+		"Clock re-synced: offset %s (was %s), rtt %s over %d samples",
+		sample.Offset, old, sample.RTT, samples,
+	)
+	if err := h.clock.TimeSyncReport(ctx, sample, samples); err != nil {
+		log.Printf("time-sync-report error: %v", err)
+	}
+
+	// SYNC replaces the script's scheduled state rather than adding to
+	// it, so re-sending it moves the armed action without a second fire.
+	if h.state.GetStateTime().After(h.state.ServerNow()) {
+		if err := h.ipc.SendSync(); err != nil {
+			log.Printf("handleTimeSync: re-arm failed: %v", err)
+		}
+	}
+	// The overlay timeline shows local fire times, which just moved.
+	h.schedule.Rearm()
+}
+
+// ReadyCheck prompts the player on the overlay and reports whether they
+// confirmed (via the Lua ready_confirm hotkey event) before the timeout.
+func (h *Handlers) ReadyCheck(payload json.RawMessage) {
+	var data struct {
+		ID             string `json:"id"`
+		TimeoutSeconds int    `json:"timeout_seconds"`
+	}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		log.Printf("handleReadyCheck: bad payload: %v", err)
+		return
+	}
+	timeout := time.Duration(data.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	confirmed := make(chan struct{}, 1)
+	unsubscribe := h.ipc.OnEvent("ready_confirm", func(string) {
+		select {
+		case confirmed <- struct{}{}:
+		default:
+		}
+	})
+	started := time.Now()
+	h.sendText(MsgReadyCheck, MsgVars{"seconds": strconv.Itoa(int(timeout.Seconds()))})
+	log.Printf("Ready check %s started (timeout %s)", data.ID, timeout)
+
+	go func() {
+		defer unsubscribe()
+		ok := false
+		select {
+		case <-confirmed:
+			ok = true
+		case <-time.After(timeout):
+			h.sendText(MsgReadyCheckTimeout, nil)
+		}
+		latency := time.Since(started)
+		log.Printf("Ready check %s: confirmed=%v after %s", data.ID, ok, latency.Round(time.Millisecond))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := h.reports.ReadyCheckResponse(ctx, data.ID, ok, latency); err != nil {
+			log.Printf("ready-check-response error: %v", err)
+		}
+	}()
+}
+
+const (
+	defaultServerRestartWindow = 2 * time.Minute
+	serverRestartCountdownStep = 15 * time.Second
+)
+
+// ServerRestarting pauses the emulator for an announced server restart,
+// suppresses disconnect handling for the window, counts down on the
+// overlay, and then reconnects and resyncs without waiting for backoff.
+// If heartbeats come back early the watchdog closes the window instead.
+func (h *Handlers) ServerRestarting(payload json.RawMessage) {
+	var data struct {
+		DownSeconds int `json:"down_seconds"`
+	}
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &data); err != nil {
+			log.Printf("handleServerRestarting: bad payload: %v", err)
+			return
+		}
+	}
+	window := time.Duration(data.DownSeconds) * time.Second
+	if window <= 0 {
+		window = defaultServerRestartWindow
+	}
+
+	h.ipc.SendPause(nil)
+	until := h.state.StartServerRestartGrace(window)
+	log.Printf("Server restarting; holding off disconnect handling until %s", until.Format(time.TimeOnly))
+
+	go func() {
+		tick := time.NewTicker(serverRestartCountdownStep)
+		defer tick.Stop()
+		for {
+			left := time.Until(until)
+			if left <= 0 {
+				break
+			}
+			h.sendText(MsgServerRestarting, MsgVars{"seconds": strconv.Itoa(int(left.Round(time.Second).Seconds()))})
+			select {
+			case <-tick.C:
+			case <-time.After(left):
+			}
+			// A newer announcement or an early return replaced this window.
+			if !h.state.ServerRestartUntil().Equal(until) {
+				return
+			}
+		}
+		h.state.EndServerRestartGrace()
+		log.Println("Server restart window elapsed; reconnecting")
+		if h.recover != nil {
+			h.recover(TriggerServerRestart, window)
+		}
+	}()
+}
+
+type WSMessage struct {
+	// ID identifies a command so one delivered both over Pusher and by
+	// polling runs once. Older servers omit it.
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// eventTarget is the addressing some servers add to commands broadcast on
+// the session channel instead of the player channel.
+type eventTarget struct {
+	TargetPlayer *string  `json:"target_player"`
+	Targets      []string `json:"targets"`
+}
+
+// targetsMe reports whether an event payload is meant for this player.
+// Payloads without target_player or targets are for everyone.
+func (h *Handlers) targetsMe(payload json.RawMessage) bool {
+	var t eventTarget
+	if len(payload) == 0 || json.Unmarshal(payload, &t) != nil {
+		return true
+	}
+	if t.TargetPlayer == nil && t.Targets == nil {
+		return true
+	}
+	me := canonicalName(h.cfg.PlayerName)
+	if t.TargetPlayer != nil && canonicalName(*t.TargetPlayer) == me {
+		return true
+	}
+	for _, name := range t.Targets {
+		if canonicalName(name) == me {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handlers) handleRawEvent(raw json.RawMessage) {
+	// The pusher library wraps the event data in a JSON string,
+	// so we need to unmarshal it twice. First to get the string,
+	// then to get the actual message object.
+	var eventData string
+	if err := json.Unmarshal(raw, &eventData); err != nil {
+		log.Printf("[ERROR] Unmarshal outer Pusher event: %v", err)
+		return
+	}
+
+	var msg WSMessage
+	if err := json.Unmarshal([]byte(eventData), &msg); err != nil {
+		log.Printf("[ERROR] Unmarshal inner WSMessage: %v", err)
+		return
+	}
+	h.dispatch(msg)
+}
+
+// dispatch runs the handler for one command, skipping commands already
+// seen by id and those addressed to another player.
+func (h *Handlers) dispatch(msg WSMessage) {
+	if msg.ID != "" && !h.commands.firstSight(msg.ID) {
+		debugf("Skipping duplicate %s command %s", msg.Type, msg.ID)
+		return
+	}
+
+	if !h.targetsMe(msg.Payload) {
+		debugf("Dropping %s event addressed to another player", msg.Type)
+		return
+	}
+
+	handler, ok := h.registry.Lookup(msg.Type)
+	if !ok {
+		log.Printf("[WARN] Unknown event type: %s", msg.Type)
+		return
+	}
+	handler(msg.Payload)
+}
@@ -0,0 +1,38 @@
+//go:build custom_handlers
+
+package app
+
+// This file is the template for fork-specific events. Keep custom logic
+// here rather than patching handlers.go; only the Deps surface is stable.
+
+import (
+	"encoding/json"
+	"log"
+)
+
+const customHandlersBuild = true
+
+// RegisterCustomHandlers is called from NewHandlers after the built-in
+// handlers are registered.
+func RegisterCustomHandlers(reg *Registry, deps Deps) {
+	reg.Register("bingo_update", func(payload json.RawMessage) {
+		var data struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(payload, &data); err != nil {
+			log.Printf("handleBingoUpdate: bad payload: %v", err)
+			return
+		}
+		deps.IPC.SendMessage("Bingo: " + data.Text)
+	})
+	reg.Register("trivia_question", func(payload json.RawMessage) {
+		var data struct {
+			Question string `json:"question"`
+		}
+		if err := json.Unmarshal(payload, &data); err != nil {
+			log.Printf("handleTriviaQuestion: bad payload: %v", err)
+			return
+		}
+		deps.IPC.SendMessage("Trivia: " + data.Question)
+	})
+}
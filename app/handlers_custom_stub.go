@@ -0,0 +1,9 @@
+//go:build !custom_handlers
+
+package app
+
+const customHandlersBuild = false
+
+// RegisterCustomHandlers is the extension point for forks. Build with
+// -tags custom_handlers and provide a handlers_custom.go to add events.
+func RegisterCustomHandlers(reg *Registry, deps Deps) {}
@@ -0,0 +1,32 @@
+//go:build custom_handlers
+
+package app
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCustomHandlersRegistered(t *testing.T) {
+	f := newHandlerFixture(t)
+	types := f.h.registry.Types()
+	for _, typ := range []string{"bingo_update", "trivia_question"} {
+		if !slices.Contains(types, typ) {
+			t.Errorf("%s not registered; have %v", typ, types)
+		}
+	}
+	// Built-ins are still there alongside them.
+	if !slices.Contains(types, "swap") {
+		t.Error("built-in swap handler missing from a custom_handlers build")
+	}
+
+	f.dispatch("bingo_update", `{"text":"B-12"}`)
+	f.dispatch("trivia_question", `{"question":"Who?"}`)
+	f.dispatch("bingo_update", `{"broken`)
+	f.emu.mu.Lock()
+	defer f.emu.mu.Unlock()
+	want := []string{"Bingo: B-12", "Trivia: Who?"}
+	if !slices.Equal(f.emu.messages, want) {
+		t.Errorf("overlay messages = %q; want %q", f.emu.messages, want)
+	}
+}
@@ -0,0 +1,866 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer stands in for *API: it records which methods the handlers
+// called and answers queries from its fields.
+type fakeServer struct {
+	mu       sync.Mutex
+	calls    []string
+	manifest *SessionManifest
+	uploaded []string
+	acks     []DownloadAck
+	// uploadGate, when set, holds UploadSave until it is closed.
+	uploadGate chan struct{}
+	// clockAhead is how far the server clock runs ahead of ours.
+	clockAhead time.Duration
+}
+
+func (f *fakeServer) record(call string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+}
+
+func (f *fakeServer) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.calls)
+}
+
+func (f *fakeServer) SwapComplete(ctx context.Context, round int) error {
+	f.record("SwapComplete")
+	return nil
+}
+
+func (f *fakeServer) GameStarted(ctx context.Context, game string, round *int) error {
+	f.record("GameStarted")
+	return nil
+}
+
+func (f *fakeServer) GameStopped(ctx context.Context) error {
+	f.record("GameStopped")
+	return nil
+}
+
+func (f *fakeServer) SessionState(ctx context.Context, state *ClientState) error {
+	f.record("SessionState")
+	return nil
+}
+
+func (f *fakeServer) UploadSave(ctx context.Context, path string, round int) error {
+	if f.uploadGate != nil {
+		<-f.uploadGate
+	}
+	f.record("UploadSave")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.uploaded = append(f.uploaded, path)
+	return nil
+}
+
+func (f *fakeServer) JoinSession(ctx context.Context, name string) (*SessionManifest, error) {
+	f.record("JoinSession")
+	return f.manifest, nil
+}
+
+func (f *fakeServer) SessionManifest(ctx context.Context, name string) (*SessionManifest, error) {
+	f.record("SessionManifest")
+	return f.manifest, nil
+}
+
+func (f *fakeServer) ReportError(ctx context.Context, category, message string) error {
+	f.record("ReportError")
+	return nil
+}
+
+func (f *fakeServer) ReadyCheckResponse(ctx context.Context, id string, confirmed bool, latency time.Duration) error {
+	f.record(fmt.Sprintf("ReadyCheckResponse %v", confirmed))
+	return nil
+}
+
+func (f *fakeServer) ReportSkippedAction(ctx context.Context, action string, due time.Time, age time.Duration) error {
+	f.record("ReportSkippedAction")
+	return nil
+}
+
+func (f *fakeServer) ReportRejectedGame(ctx context.Context, game string, round int) error {
+	f.record("ReportRejectedGame")
+	return nil
+}
+
+func (f *fakeServer) ReportStaleState(ctx context.Context, state string, at time.Time, seq int64, current StateOrder) error {
+	f.record("ReportStaleState")
+	return nil
+}
+
+func (f *fakeServer) ReportRoleRejected(ctx context.Context, event, role, reason string) error {
+	f.record("ReportRoleRejected")
+	return nil
+}
+
+func (f *fakeServer) SwapFailed(ctx context.Context, round int, reason string) error {
+	f.record("SwapFailed " + reason)
+	return nil
+}
+
+func (f *fakeServer) DownloadAck(ctx context.Context, ack DownloadAck) error {
+	f.record("DownloadAck")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.acks = append(f.acks, ack)
+	return nil
+}
+
+func (f *fakeServer) ServerTime(ctx context.Context) (time.Time, error) {
+	return time.Now().Add(f.clockAhead), nil
+}
+
+func (f *fakeServer) TimeSyncReport(ctx context.Context, s ClockSample, samples int) error {
+	f.record(fmt.Sprintf("TimeSyncReport %d", samples))
+	return nil
+}
+
+// GameMetadata fails like an unreachable server so nothing is cached.
+func (f *fakeServer) GameMetadata(ctx context.Context, file string) (*GameMeta, error) {
+	return nil, errors.New("offline")
+}
+
+// fakeEmulator stands in for *BizhawkIPC. It records the command name of
+// everything sent and writes a file for each SAVE, as BizHawk would.
+type fakeEmulator struct {
+	mu       sync.Mutex
+	sent     []string
+	messages []string
+	caps     []string
+	subs     map[string]func(string)
+	// swapErr fails SWAP; loaded, when set, is the ROM QueryLoadedGame
+	// reports.
+	swapErr error
+	loaded  string
+}
+
+func (f *fakeEmulator) record(cmd string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, cmd)
+}
+
+func (f *fakeEmulator) Sent() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.sent)
+}
+
+func (f *fakeEmulator) SendCommand(parts ...string) error {
+	f.record(parts[0])
+	if parts[0] == "SAVE" {
+		if err := os.MkdirAll(filepath.Dir(parts[1]), 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(parts[1], []byte("state"), 0o644)
+	}
+	return nil
+}
+
+func (f *fakeEmulator) Supports(cmd string) bool { return true }
+func (f *fakeEmulator) SendSync() error          { f.record("SYNC"); return nil }
+func (f *fakeEmulator) SendSwap(at int64, game string) {
+	f.record("SWAP")
+}
+func (f *fakeEmulator) SendSave(path string)   { _ = f.SendCommand("SAVE", path) }
+func (f *fakeEmulator) SendPause(at *int64)    { f.record("PAUSE") }
+func (f *fakeEmulator) SendResume(at *int64)   { f.record("RESUME") }
+func (f *fakeEmulator) Capabilities() []string { return f.caps }
+
+func (f *fakeEmulator) SendMessage(msg string) {
+	f.record("MSG")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages = append(f.messages, msg)
+}
+
+func (f *fakeEmulator) Swap(at int64, game string) error {
+	f.record("SWAP")
+	return f.swapErr
+}
+
+// QueryLoadedGame fails like a script without the query capability unless
+// loaded is set, so swaps are trusted on their ACK by default.
+func (f *fakeEmulator) QueryLoadedGame() (string, error) {
+	if f.loaded == "" {
+		return "", ErrUnsupported
+	}
+	return f.loaded, nil
+}
+
+func (f *fakeEmulator) OnEvent(name string, fn func(string)) func() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.subs == nil {
+		f.subs = make(map[string]func(string))
+	}
+	f.subs[name] = fn
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.subs, name)
+	}
+}
+
+func (f *fakeEmulator) fire(name, data string) bool {
+	f.mu.Lock()
+	fn := f.subs[name]
+	f.mu.Unlock()
+	if fn != nil {
+		fn(data)
+	}
+	return fn != nil
+}
+
+type handlerFixture struct {
+	h            *Handlers
+	server       *fakeServer
+	emu          *fakeEmulator
+	state        *ClientState
+	cfg          *Config
+	manifestPath string
+	exits        []ExitCause
+}
+
+// newHandlerFixture builds Handlers on fakes, with the testManifest
+// session saved where NewHandlers loads it from.
+func newHandlerFixture(t *testing.T) *handlerFixture {
+	t.Helper()
+	dir := t.TempDir()
+	manifestPath := filepath.Join(dir, manifestFile)
+	if err := SaveManifest(testManifest(), manifestPath); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{
+		ServerURL:   "http://127.0.0.1:1",
+		PlayerName:  "ana",
+		SessionName: "relay",
+		SaveDir:     filepath.Join(dir, "saves"),
+		RomDir:      filepath.Join(dir, "roms"),
+	}
+	state := NewClientState()
+	state.SetSessionName("relay")
+	f := &handlerFixture{
+		server:       &fakeServer{manifest: testManifest()},
+		emu:          &fakeEmulator{},
+		state:        state,
+		cfg:          cfg,
+		manifestPath: manifestPath,
+	}
+	f.h = NewHandlers(HandlerDeps{
+		API:          f.server,
+		Reports:      f.server,
+		Clock:        f.server,
+		IPC:          f.emu,
+		Config:       cfg,
+		State:        state,
+		ManifestPath: manifestPath,
+		HTTPClient:   &http.Client{},
+		GameMetadata: f.server.GameMetadata,
+	})
+	f.h.exit = func(cause ExitCause, detail string, stop bool) {
+		f.exits = append(f.exits, cause)
+	}
+	t.Cleanup(f.h.Shutdown)
+	return f
+}
+
+func (f *handlerFixture) dispatch(typ, payload string) {
+	f.h.dispatch(WSMessage{Type: typ, Payload: json.RawMessage(payload)})
+}
+
+func TestHandlersMalformedPayloads(t *testing.T) {
+	// Handlers that read their payload must ignore a malformed one without
+	// touching the server or the emulator.
+	for _, typ := range []string{
+		"swap", "download_rom", "download_lua", "message", "change_game_state",
+		"prepare_swap", "set_log_level", "ready_check", "time_sync",
+		"server_restarting", "change_role",
+	} {
+		for _, payload := range []string{`{"broken`, `[1,2]`, `"text"`} {
+			f := newHandlerFixture(t)
+			f.dispatch(typ, payload)
+			if calls := f.server.Calls(); len(calls) > 0 {
+				t.Errorf("%s %s: server calls %v", typ, payload, calls)
+			}
+			if sent := f.emu.Sent(); len(sent) > 0 {
+				t.Errorf("%s %s: emulator got %v", typ, payload, sent)
+			}
+		}
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	future := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		name    string
+		typ     string
+		payload string
+		setup   func(f *handlerFixture)
+		server  []string
+		emu     []string
+		exits   []ExitCause
+	}{
+		{
+			name: "message", typ: "message", payload: `{"text":"gg"}`,
+			emu: []string{"MSG"},
+		},
+		{
+			name: "kick", typ: "kick", payload: `{"reason":"afk"}`,
+			emu: []string{"MSG", "PAUSE"}, exits: []ExitCause{CauseKicked},
+		},
+		{
+			name: "kick without reason", typ: "kick", payload: `{"broken`,
+			emu: []string{"MSG", "PAUSE"}, exits: []ExitCause{CauseKicked},
+		},
+		{
+			name: "state change", typ: "change_game_state",
+			payload: fmt.Sprintf(`{"state":"running","state_at":%d,"seq":2}`, future),
+			emu:     []string{"SYNC"},
+		},
+		{
+			name: "state change without time", typ: "change_game_state",
+			payload: `{"state":"running"}`,
+		},
+		{
+			name: "stale state change", typ: "change_game_state",
+			payload: fmt.Sprintf(`{"state":"paused","state_at":%d,"seq":1}`, future),
+			setup: func(f *handlerFixture) {
+				f.state.ApplyStateOrdered(time.Unix(future, 0), "running", 2, false)
+			},
+			server: []string{"ReportStaleState"},
+		},
+		{
+			name: "swap without game", typ: "swap", payload: fmt.Sprintf(`{"swap_at":%d}`, future),
+		},
+		{
+			name: "swap while spectating", typ: "swap",
+			payload: fmt.Sprintf(`{"new_game":"zelda.sfc","swap_at":%d}`, future),
+			setup:   func(f *handlerFixture) { f.state.SetRole(RoleSpectator) },
+			server:  []string{"ReportRoleRejected"},
+		},
+		{
+			name: "prepare while spectating", typ: "prepare_swap", payload: `{"save_path":"x.state"}`,
+			setup:  func(f *handlerFixture) { f.state.SetRole(RoleSpectator) },
+			server: []string{"ReportRoleRejected"},
+		},
+		{
+			name: "session ended", typ: "session_ended", payload: `{}`,
+			server: []string{"GameStopped"}, emu: []string{"MSG", "PAUSE"},
+			exits: []ExitCause{CauseSessionEnded},
+		},
+		{
+			name: "session ended saves the game", typ: "session_ended", payload: `{}`,
+			setup:  func(f *handlerFixture) { f.state.SetCurrentGame("mario.nes") },
+			server: []string{"UploadSave", "GameStopped"}, emu: []string{"MSG", "SAVE", "PAUSE"},
+			exits: []ExitCause{CauseSessionEnded},
+		},
+		{
+			name: "session ended without save upload", typ: "session_ended", payload: `{}`,
+			setup: func(f *handlerFixture) {
+				f.state.SetCurrentGame("mario.nes")
+				f.cfg.SkipSaveUpload = true
+			},
+			server: []string{"GameStopped"}, emu: []string{"MSG", "SAVE", "PAUSE"},
+			exits: []ExitCause{CauseSessionEnded},
+		},
+		{
+			name: "become spectator", typ: "change_role", payload: `{"role":"spectator"}`,
+			server: []string{"GameStopped"}, emu: []string{"PAUSE", "MSG"},
+		},
+		{
+			name: "same role", typ: "change_role", payload: `{"role":"player"}`,
+		},
+		{
+			name: "unknown role", typ: "change_role", payload: `{"role":"referee"}`,
+		},
+		{
+			name: "unknown event", typ: "no_such_event", payload: `{}`,
+		},
+		{
+			name: "addressed to another player", typ: "message", payload: `{"text":"hi","target_player":"bo"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newHandlerFixture(t)
+			if tt.setup != nil {
+				tt.setup(f)
+			}
+			f.dispatch(tt.typ, tt.payload)
+			if got := f.server.Calls(); !slices.Equal(got, tt.server) {
+				t.Errorf("server calls = %v; want %v", got, tt.server)
+			}
+			if got := f.emu.Sent(); !slices.Equal(got, tt.emu) {
+				t.Errorf("emulator got %v; want %v", got, tt.emu)
+			}
+			if !slices.Equal(f.exits, tt.exits) {
+				t.Errorf("exits = %v; want %v", f.exits, tt.exits)
+			}
+		})
+	}
+}
+
+func TestSwapHandlerAfterPrepare(t *testing.T) {
+	f := newHandlerFixture(t)
+	f.state.SetCurrentGame("mario.nes")
+	swapAt := time.Now().Unix()
+
+	f.dispatch("prepare_swap", `{"round_number":2,"new_game":"zelda.sfc"}`)
+	f.dispatch("swap", fmt.Sprintf(`{"round_number":2,"new_game":"zelda.sfc","swap_at":%d}`, swapAt))
+	waitFor(t, "swap-complete", func() bool {
+		return slices.Contains(f.server.Calls(), "SwapComplete")
+	})
+
+	want := []string{"UploadSave", "GameStarted", "SwapComplete"}
+	if got := f.server.Calls(); !slices.Equal(got, want) {
+		t.Errorf("server calls = %v; want %v", got, want)
+	}
+	if got := f.emu.Sent(); !slices.Equal(got, []string{"SAVE", "SWAP"}) {
+		t.Errorf("emulator got %v; want SAVE then SWAP", got)
+	}
+	if got := f.state.GetCurrentGame(); got != "zelda.sfc" {
+		t.Errorf("current game = %q", got)
+	}
+	if f.h.RoundsPlayed() != 1 {
+		t.Errorf("RoundsPlayed = %d", f.h.RoundsPlayed())
+	}
+	// The outgoing save is the previous game's, for the swap's round.
+	meta, err := readSaveMeta(f.server.uploaded[0])
+	if err != nil || meta.Game != "mario.nes" || meta.Round != 2 {
+		t.Errorf("uploaded save meta = %+v, %v", meta, err)
+	}
+}
+
+func TestPrepareSwapDoesNotBlockDispatch(t *testing.T) {
+	f := newHandlerFixture(t)
+	f.state.SetCurrentGame("mario.nes")
+	f.server.uploadGate = make(chan struct{})
+	defer close(f.server.uploadGate)
+
+	// A slow upload must not hold up the next event on the channel.
+	done := make(chan struct{})
+	go func() {
+		f.dispatch("prepare_swap", `{"round_number":2,"new_game":"zelda.sfc"}`)
+		f.dispatch("message", `{"text":"next up: zelda"}`)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("dispatch blocked behind the save upload")
+	}
+	waitFor(t, "message shown", func() bool { return slices.Contains(f.emu.Sent(), "MSG") })
+}
+
+func TestSwapWaitsForPrepareUpload(t *testing.T) {
+	f := newHandlerFixture(t)
+	f.state.SetCurrentGame("mario.nes")
+	f.server.uploadGate = make(chan struct{})
+
+	f.dispatch("prepare_swap", `{"round_number":2,"new_game":"zelda.sfc"}`)
+	f.dispatch("swap", fmt.Sprintf(`{"round_number":2,"new_game":"zelda.sfc","swap_at":%d}`, time.Now().Unix()))
+	waitFor(t, "save", func() bool { return slices.Contains(f.emu.Sent(), "SAVE") })
+	time.Sleep(100 * time.Millisecond)
+	if got := f.emu.Sent(); slices.Contains(got, "SWAP") {
+		t.Fatalf("emulator got %v; SWAP sent before the save was uploaded", got)
+	}
+
+	close(f.server.uploadGate)
+	waitFor(t, "swap-complete", func() bool {
+		return slices.Contains(f.server.Calls(), "SwapComplete")
+	})
+	want := []string{"UploadSave", "GameStarted", "SwapComplete"}
+	if got := f.server.Calls(); !slices.Equal(got, want) {
+		t.Errorf("server calls = %v; want %v", got, want)
+	}
+}
+
+func TestSwapReportsUnfinishedPrepare(t *testing.T) {
+	f := newHandlerFixture(t)
+	f.state.SetCurrentGame("mario.nes")
+	f.h.prepares.timeout = 100 * time.Millisecond
+	f.server.uploadGate = make(chan struct{})
+	defer close(f.server.uploadGate)
+
+	f.dispatch("prepare_swap", `{"round_number":2,"new_game":"zelda.sfc"}`)
+	f.dispatch("swap", fmt.Sprintf(`{"round_number":2,"new_game":"zelda.sfc","swap_at":%d}`, time.Now().Unix()))
+	waitFor(t, "swap-failed report", func() bool {
+		return slices.Contains(f.server.Calls(), "SwapFailed "+SwapFailedSavePending)
+	})
+
+	// The swap goes ahead, but swap-complete is withheld while the save
+	// may not be on the server.
+	if got := f.emu.Sent(); !slices.Equal(got, []string{"SAVE", "SWAP"}) {
+		t.Errorf("emulator got %v; want SAVE then SWAP", got)
+	}
+	if slices.Contains(f.server.Calls(), "SwapComplete") {
+		t.Error("swap-complete sent before the save upload finished")
+	}
+}
+
+func TestSwapHandlerFailedSwap(t *testing.T) {
+	f := newHandlerFixture(t)
+	f.state.SetCurrentGame("mario.nes")
+	f.emu.swapErr = &NackError{Command: "SWAP", Reason: "rom not found"}
+
+	f.dispatch("prepare_swap", `{"round_number":2,"new_game":"zelda.sfc"}`)
+	f.dispatch("swap", fmt.Sprintf(`{"round_number":2,"new_game":"zelda.sfc","swap_at":%d}`, time.Now().Unix()))
+	waitFor(t, "swap-failed report", func() bool {
+		return slices.Contains(f.server.Calls(), "SwapFailed "+SwapFailedEmulator)
+	})
+
+	// The failure is reported in place of swap-complete.
+	want := []string{"UploadSave", "ReportError", "SwapFailed " + SwapFailedEmulator}
+	if got := f.server.Calls(); !slices.Equal(got, want) {
+		t.Errorf("server calls = %v; want %v", got, want)
+	}
+	if got := f.state.GetCurrentGame(); got != "mario.nes" {
+		t.Errorf("current game = %q; want the game still loaded", got)
+	}
+	if f.h.RoundsPlayed() != 0 {
+		t.Errorf("RoundsPlayed = %d; want the failed round uncounted", f.h.RoundsPlayed())
+	}
+}
+
+func TestSwapDecryptsOnlyIncomingSave(t *testing.T) {
+	f := newHandlerFixture(t)
+	c := newTestCipher(t, "hunter2", "relay")
+	f.h.saves = c
+	seal := func(meta SaveMeta) string {
+		t.Helper()
+		path, err := f.h.savePath(meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sealed, err := c.Seal([]byte(meta.Game + " state"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, sealed, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	session := f.state.GetSessionName()
+	incoming := seal(SaveMeta{Session: session, Round: 2, Game: "zelda.sfc"})
+	other := seal(SaveMeta{Session: session, Round: 1, Game: "metroid.nes"})
+
+	f.dispatch("swap", fmt.Sprintf(`{"round_number":2,"new_game":"zelda.sfc","swap_at":%d}`, time.Now().Unix()))
+	waitFor(t, "swap", func() bool { return f.h.RoundsPlayed() == 1 })
+
+	if b, _ := os.ReadFile(incoming); string(b) != "zelda.sfc state" {
+		t.Errorf("incoming save holds %q; want it decrypted", b)
+	}
+	if b, _ := os.ReadFile(other); !IsEncryptedSave(b) {
+		t.Error("a save the swap does not load was decrypted")
+	}
+}
+
+func TestSwapHandlerBoundsVerifyWait(t *testing.T) {
+	f := newHandlerFixture(t)
+	f.state.SetCurrentGame("mario.nes")
+	// The emulator would fail the check, but a swap this far out is
+	// trusted on its ACK rather than holding swap-complete until then.
+	f.emu.loaded = "mario.nes"
+	swapAt := time.Now().Add(time.Hour).Unix()
+
+	f.dispatch("prepare_swap", `{"round_number":2,"new_game":"zelda.sfc"}`)
+	f.dispatch("swap", fmt.Sprintf(`{"round_number":2,"new_game":"zelda.sfc","swap_at":%d}`, swapAt))
+	waitFor(t, "swap-complete", func() bool {
+		return slices.Contains(f.server.Calls(), "SwapComplete")
+	})
+	if f.h.RoundsPlayed() != 1 {
+		t.Errorf("RoundsPlayed = %d", f.h.RoundsPlayed())
+	}
+}
+
+func TestSwapHandlerRejectsUnlistedGame(t *testing.T) {
+	f := newHandlerFixture(t)
+	f.dispatch("swap", fmt.Sprintf(`{"round_number":1,"new_game":"tetris.gb","swap_at":%d}`, time.Now().Unix()))
+
+	// The manifest is refreshed once before the game is refused.
+	want := []string{"SessionManifest", "ReportRejectedGame"}
+	if got := f.server.Calls(); !slices.Equal(got, want) {
+		t.Errorf("server calls = %v; want %v", got, want)
+	}
+	if sent := f.emu.Sent(); len(sent) > 0 {
+		t.Errorf("emulator got %v", sent)
+	}
+}
+
+func TestSessionRejoinSavesManifest(t *testing.T) {
+	f := newHandlerFixture(t)
+	fresh := testManifest()
+	fresh.Games = append(fresh.Games, ManifestGame{ID: 9, File: "tetris.gb"})
+	f.server.manifest = fresh
+
+	f.dispatch("session_rejoin", `{}`)
+	m, err := LoadManifest(f.manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Contains("tetris.gb") {
+		t.Errorf("manifest at %s lacks the rejoined session's games", f.manifestPath)
+	}
+	if got, err := f.h.resolveGame(GameRef{ID: ptr(9)}); err != nil || got != "tetris.gb" {
+		t.Errorf("resolve id 9 = %q, %v", got, err)
+	}
+}
+
+func TestReadyCheckHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		confirm bool
+		want    string
+	}{
+		{"confirmed", true, "ReadyCheckResponse true"},
+		{"timed out", false, "ReadyCheckResponse false"},
+	}
+	for _, tt := range tests {
+		f := newHandlerFixture(t)
+		f.dispatch("ready_check", `{"id":"rc-1","timeout_seconds":1}`)
+		if tt.confirm && !f.emu.fire("ready_confirm", "") {
+			t.Fatalf("%s: ready check did not subscribe to ready_confirm", tt.name)
+		}
+		waitFor(t, "ready-check response", func() bool { return len(f.server.Calls()) > 0 })
+		if got := f.server.Calls(); !slices.Equal(got, []string{tt.want}) {
+			t.Errorf("%s: server calls = %v; want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClearSavesHandler(t *testing.T) {
+	f := newHandlerFixture(t)
+	save := filepath.Join(f.cfg.SaveDir, "relay", "mario.state")
+	if err := os.MkdirAll(filepath.Dir(save), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(save, []byte("state"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f.dispatch("clear_saves", `{}`)
+	entries, err := os.ReadDir(f.cfg.SaveDir)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("save dir after clear_saves = %v, %v", entries, err)
+	}
+}
+
+func TestDuplicateCommandRunsOnce(t *testing.T) {
+	f := newHandlerFixture(t)
+	msg := WSMessage{ID: "cmd-1", Type: "message", Payload: json.RawMessage(`{"text":"once"}`)}
+	f.h.dispatch(msg)
+	f.h.dispatch(msg)
+	if got := f.emu.Sent(); len(got) != 1 || !strings.Contains(f.emu.messages[0], "once") {
+		t.Errorf("emulator got %v, %v; want one message", got, f.emu.messages)
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestTimeSyncRearms(t *testing.T) {
+	tests := []struct {
+		name    string
+		stateAt time.Duration // from now; the state change the script has armed
+		rearm   bool
+	}{
+		{"pending action", time.Minute, true},
+		{"action already fired", -time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newHandlerFixture(t)
+			f.server.clockAhead = 3 * time.Second
+			f.state.SetState(time.Now().Add(tt.stateAt), "running")
+			changes := f.h.schedule.Subscribe()
+
+			f.dispatch("time_sync", `{"samples":2}`)
+
+			if off := f.state.ClockOffset(); (off - 3*time.Second).Abs() > time.Second {
+				t.Errorf("clock offset = %s; want about 3s", off)
+			}
+			if got := f.server.Calls(); !slices.Equal(got, []string{"TimeSyncReport 2"}) {
+				t.Errorf("server calls = %v; want the sync reported with its sample count", got)
+			}
+			if got := slices.Contains(f.emu.Sent(), "SYNC"); got != tt.rearm {
+				t.Errorf("SYNC sent = %v; want %v (sent %v)", got, tt.rearm, f.emu.Sent())
+			}
+			select {
+			case <-changes:
+			default:
+				t.Error("schedule subscribers not told to re-evaluate fire times")
+			}
+		})
+	}
+}
+
+func TestTimeSyncDefaultsSamples(t *testing.T) {
+	f := newHandlerFixture(t)
+	f.server.clockAhead = -2 * time.Second
+	f.dispatch("time_sync", ``)
+	if got := f.server.Calls(); !slices.Equal(got, []string{fmt.Sprintf("TimeSyncReport %d", timeSyncSamples)}) {
+		t.Errorf("server calls = %v", got)
+	}
+	if off := f.state.ClockOffset(); (off + 2*time.Second).Abs() > time.Second {
+		t.Errorf("clock offset = %s; want about -2s", off)
+	}
+}
+
+// TestReadyInterleavedWithSwap holds a Ready response that still carries
+// the old game and schedule while events change them locally, and checks
+// the late response does not undo the newer changes.
+func TestReadyInterleavedWithSwap(t *testing.T) {
+	stale := time.Now().Add(-time.Hour).Unix()
+	future := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		name      string
+		during    func(f *handlerFixture)
+		wantGame  string
+		wantState string
+	}{
+		{"nothing happens", func(f *handlerFixture) {}, "mario.nes", "paused"},
+		{"swap", func(f *handlerFixture) {
+			f.dispatch("prepare_swap", `{"round_number":2,"new_game":"zelda.sfc"}`)
+			f.dispatch("swap", fmt.Sprintf(`{"round_number":2,"new_game":"zelda.sfc","swap_at":%d}`, time.Now().Unix()))
+			waitFor(t, "swap-complete", func() bool { return slices.Contains(f.server.Calls(), "SwapComplete") })
+		}, "zelda.sfc", "paused"},
+		{"state change", func(f *handlerFixture) {
+			f.dispatch("change_game_state", fmt.Sprintf(`{"state":"running","state_at":%d,"seq":2}`, future))
+		}, "mario.nes", "running"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newHandlerFixture(t)
+			arrived, release := make(chan struct{}), make(chan struct{})
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(arrived)
+				<-release
+				fmt.Fprintf(w, `{"game_file":"mario.nes","state":"paused","state_at":%d}`, stale)
+			}))
+			defer srv.Close()
+			a := NewAPI(&Config{ServerURL: srv.URL, BearerToken: "t"})
+
+			done := make(chan error, 1)
+			go func() { done <- a.Ready(context.Background(), f.state, Capabilities{}) }()
+			<-arrived
+			tt.during(f)
+			close(release)
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+
+			if got := f.state.GetCurrentGame(); got != tt.wantGame {
+				t.Errorf("current game = %q; want %q", got, tt.wantGame)
+			}
+			if got := f.state.GetState(); got != tt.wantState {
+				t.Errorf("state = %q; want %q", got, tt.wantState)
+			}
+			f.state.mu.RLock()
+			ready := f.state.ready
+			f.state.mu.RUnlock()
+			if !ready {
+				t.Error("client not marked ready after a partly ignored response")
+			}
+		})
+	}
+}
+
+func TestChangeGameStateOrdering(t *testing.T) {
+	at := time.Now().Add(time.Hour).Unix()
+	event := func(state string, stateAt, seq int64, force bool) string {
+		return fmt.Sprintf(`{"state":%q,"state_at":%d,"seq":%d,"force":%t}`, state, stateAt, seq, force)
+	}
+	tests := []struct {
+		name          string
+		first, second string
+		wantState     string
+		wantAt        int64
+		server, emu   []string
+	}{
+		{
+			name:      "in order",
+			first:     event("running", at, 1, false),
+			second:    event("paused", at+10, 2, false),
+			wantState: "paused", wantAt: at + 10,
+			emu: []string{"SYNC", "SYNC"},
+		},
+		{
+			name:      "reversed",
+			first:     event("paused", at+10, 2, false),
+			second:    event("running", at, 1, false),
+			wantState: "paused", wantAt: at + 10,
+			server: []string{"ReportStaleState"}, emu: []string{"SYNC"},
+		},
+		{
+			name:      "equal time, older seq",
+			first:     event("paused", at, 2, false),
+			second:    event("running", at, 1, false),
+			wantState: "paused", wantAt: at,
+			server: []string{"ReportStaleState"}, emu: []string{"SYNC"},
+		},
+		{
+			name:      "equal time and seq",
+			first:     event("paused", at, 2, false),
+			second:    event("running", at, 2, false),
+			wantState: "paused", wantAt: at,
+			server: []string{"ReportStaleState"}, emu: []string{"SYNC"},
+		},
+		{
+			name:      "equal time without seq",
+			first:     event("paused", at, 0, false),
+			second:    event("running", at, 0, false),
+			wantState: "running", wantAt: at,
+			emu: []string{"SYNC", "SYNC"},
+		},
+		{
+			name:      "forced older",
+			first:     event("paused", at+10, 2, false),
+			second:    event("running", at, 1, true),
+			wantState: "running", wantAt: at,
+			emu: []string{"SYNC", "SYNC"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newHandlerFixture(t)
+			f.dispatch("change_game_state", tt.first)
+			f.dispatch("change_game_state", tt.second)
+
+			if got := f.state.GetState(); got != tt.wantState {
+				t.Errorf("state = %q; want %q", got, tt.wantState)
+			}
+			if got := f.state.GetStateTime().Unix(); got != tt.wantAt {
+				t.Errorf("state_at = %d; want %d", got, tt.wantAt)
+			}
+			if got := f.server.Calls(); !slices.Equal(got, tt.server) {
+				t.Errorf("server calls = %v; want %v", got, tt.server)
+			}
+			if got := f.emu.Sent(); !slices.Equal(got, tt.emu) {
+				t.Errorf("emulator got %v; want %v", got, tt.emu)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// romHashFile caches ROM hashes so startup does not re-read every game to
+// verify it. An entry is trusted only while the file's size and
+// modification time are unchanged.
+const romHashFile = "rom_hashes.json"
+
+type romHashEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	SHA256  string    `json:"sha256"`
+}
+
+var romHashes struct {
+	once    sync.Once
+	mu      sync.Mutex
+	entries map[string]romHashEntry
+	dirty   bool
+}
+
+func loadRomHashes() {
+	romHashes.once.Do(func() {
+		romHashes.entries = make(map[string]romHashEntry)
+		if data, err := os.ReadFile(romHashFile); err == nil {
+			if err := json.Unmarshal(data, &romHashes.entries); err != nil {
+				log.Printf("Ignoring ROM hash cache: %v", err)
+				romHashes.entries = make(map[string]romHashEntry)
+			}
+		}
+	})
+}
+
+// cachedSHA256 returns path's SHA-256, from the cache when the file is
+// unchanged since it was last hashed.
+func cachedSHA256(path string) (string, error) {
+	loadRomHashes()
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	key := filepath.Clean(path)
+	romHashes.mu.Lock()
+	e, ok := romHashes.entries[key]
+	romHashes.mu.Unlock()
+	if ok && e.Size == fi.Size() && e.ModTime.Equal(fi.ModTime()) {
+		return e.SHA256, nil
+	}
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return "", err
+	}
+	recordSHA256(path, sum)
+	return sum, nil
+}
+
+// recordSHA256 stores a hash already known for path, e.g. computed while
+// importing it.
+func recordSHA256(path, sum string) {
+	loadRomHashes()
+	fi, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	romHashes.mu.Lock()
+	romHashes.entries[filepath.Clean(path)] = romHashEntry{Size: fi.Size(), ModTime: fi.ModTime(), SHA256: sum}
+	romHashes.dirty = true
+	romHashes.mu.Unlock()
+}
+
+// saveRomHashes writes the cache if it changed.
+func saveRomHashes() {
+	loadRomHashes()
+	romHashes.mu.Lock()
+	defer romHashes.mu.Unlock()
+	if !romHashes.dirty {
+		return
+	}
+	data, err := json.MarshalIndent(romHashes.entries, "", "  ")
+	if err == nil {
+		err = os.WriteFile(romHashFile, data, 0o644)
+	}
+	if err != nil {
+		log.Printf("ROM hash cache save failed: %v", err)
+		return
+	}
+	romHashes.dirty = false
+}
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// withRomHashes runs a test in an empty directory with the ROM hash cache
+// unloaded, so it reads romHashFile afresh.
+func withRomHashes(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	reset := func() {
+		romHashes.mu.Lock()
+		romHashes.entries, romHashes.dirty = nil, false
+		romHashes.mu.Unlock()
+		romHashes.once = sync.Once{}
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestCachedSHA256(t *testing.T) {
+	withRomHashes(t)
+	if err := os.WriteFile("mario.nes", []byte("mario"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := fileSHA256("mario.nes")
+	if got, err := cachedSHA256("mario.nes"); err != nil || got != want {
+		t.Fatalf("cachedSHA256 = %s, %v; want %s", got, err, want)
+	}
+
+	// A hit is served without reading the file: a planted hash shows it.
+	fi, _ := os.Stat("mario.nes")
+	romHashes.entries["mario.nes"] = romHashEntry{Size: fi.Size(), ModTime: fi.ModTime(), SHA256: "planted"}
+	if got, _ := cachedSHA256("./mario.nes"); got != "planted" {
+		t.Errorf("unchanged file hashed again: %s", got)
+	}
+
+	// A changed modification time or size is a miss.
+	later := fi.ModTime().Add(time.Minute)
+	if err := os.Chtimes("mario.nes", later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := cachedSHA256("mario.nes"); got != want {
+		t.Errorf("touched file = %s; want a rehash", got)
+	}
+	if err := os.WriteFile("mario.nes", []byte("mario 2"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Chtimes("mario.nes", later, later)
+	if got, _ := cachedSHA256("mario.nes"); got == want {
+		t.Error("resized file served its old hash")
+	}
+
+	if _, err := cachedSHA256("missing.nes"); err == nil {
+		t.Error("missing file hashed")
+	}
+}
+
+func TestRomHashesPersist(t *testing.T) {
+	withRomHashes(t)
+	if err := os.WriteFile("zelda.sfc", []byte("zelda"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	recordSHA256("zelda.sfc", "imported")
+	saveRomHashes()
+
+	// Reloading from disk keeps the entry.
+	romHashes.entries, romHashes.once = nil, sync.Once{}
+	if got, _ := cachedSHA256("zelda.sfc"); got != "imported" {
+		t.Errorf("reloaded hash = %s; want the recorded one", got)
+	}
+	if romHashes.dirty {
+		t.Error("cache dirty after a hit")
+	}
+}
+
+func TestRomHashesCorruptFile(t *testing.T) {
+	withRomHashes(t)
+	if err := os.WriteFile(romHashFile, []byte(`{"zelda.sfc": [`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("zelda.sfc", []byte("zelda"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := fileSHA256("zelda.sfc")
+	if got, err := cachedSHA256("zelda.sfc"); err != nil || got != want {
+		t.Fatalf("cachedSHA256 = %s, %v; want %s", got, err, want)
+	}
+	// The unreadable file is overwritten with a valid one.
+	saveRomHashes()
+	romHashes.entries, romHashes.once = nil, sync.Once{}
+	loadRomHashes()
+	if e := romHashes.entries["zelda.sfc"]; e.SHA256 != want {
+		t.Errorf("rewritten cache entry = %+v", e)
+	}
+}
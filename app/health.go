@@ -0,0 +1,77 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// serverWaitLimit bounds how long startup waits for the server before
+	// giving up on the configured URL.
+	serverWaitLimit    = 2 * time.Minute
+	serverWaitMaxDelay = 15 * time.Second
+)
+
+// Health checks that the server is up, with GET /api/health or, on servers
+// without it, GET /api/ping. A server with neither route still answered,
+// so that counts as healthy.
+func (a *API) Health(ctx context.Context) error {
+	req, err := a.newRequest(ctx, http.MethodGet, "/api/health", nil)
+	if err != nil {
+		return err
+	}
+	resp, _, err := a.do(req)
+	if err != nil {
+		return fmt.Errorf("health send error: %w", err)
+	}
+	if resp == nil {
+		return fmt.Errorf("nil health response")
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound:
+		if _, err := a.pingOnce(ctx); err != nil && !errors.Is(err, ErrEndpointUnsupported) {
+			return err
+		}
+		return nil
+	default:
+		return newAPIError("health", resp)
+	}
+}
+
+// waitForServer blocks until Health succeeds, retrying with backoff for up
+// to serverWaitLimit so a server that is still starting is waited for but
+// a wrong URL fails clearly.
+func waitForServer(ctx context.Context, api *API) error {
+	deadline := time.Now().Add(serverWaitLimit)
+	delay := time.Second
+	for {
+		err := api.Health(ctx)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("server at %s not reachable after %s (check the server settings in config.json): %w",
+				api.baseURL, serverWaitLimit, err)
+		}
+		if delay == time.Second {
+			fmt.Printf("Waiting for server at %s...\n", api.baseURL)
+		}
+		log.Printf("Server health check failed, retrying in %s: %v", delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, serverWaitMaxDelay)
+	}
+}
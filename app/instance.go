@@ -0,0 +1,95 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInstanceConflict is returned when the server reports that another
+// machine is heartbeating with the same bearer token.
+var ErrInstanceConflict = errors.New("another client instance is active with this token")
+
+// instanceIDPath lives in the per-user config directory rather than next to
+// config.json so copying the client folder to another PC does not copy it.
+func instanceIDPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "go-game-client", "instance_id"), nil
+}
+
+// LoadOrCreateInstanceID returns this install's random ID, generating and
+// persisting one on first run.
+func LoadOrCreateInstanceID() (string, error) {
+	path, err := instanceIDPath()
+	if err != nil {
+		return "", err
+	}
+	if b, err := os.ReadFile(path); err == nil {
+		if id := strings.TrimSpace(string(b)); id != "" {
+			return id, nil
+		}
+	}
+
+	id, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(id+"\n"), 0o644); err != nil {
+		return "", err
+	}
+	log.Printf("Generated new instance ID %s", id)
+	return id, nil
+}
+
+// newUUID returns a random (version 4) UUID string.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// parseInstanceConflict inspects a 409 response body for the server's
+// "another instance active" error.
+func parseInstanceConflict(r io.Reader) error {
+	var body struct {
+		Error      string `json:"error"`
+		InstanceID string `json:"active_instance_id"`
+	}
+	if err := json.NewDecoder(r).Decode(&body); err != nil {
+		return nil
+	}
+	if body.Error != "instance_conflict" {
+		return nil
+	}
+	return fmt.Errorf("%w (active instance %s)", ErrInstanceConflict, body.InstanceID)
+}
+
+// warnInstanceConflict prints a prominent warning to the console and log.
+func warnInstanceConflict(err error) {
+	msg := strings.Join([]string{
+		"",
+		"!!! WARNING: " + err.Error(),
+		"!!! This player's token is being used on another computer.",
+		"!!! Swaps will go to whichever machine connected last.",
+		"!!! Delete bearer_token from config.json on one machine to re-register it.",
+		"",
+	}, "\n")
+	fmt.Fprintln(os.Stderr, msg)
+	log.Print(msg)
+}
@@ -0,0 +1,143 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// withConfigDir points os.UserConfigDir at a temporary directory.
+func withConfigDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("APPDATA", dir)
+	t.Setenv("HOME", dir)
+	return dir
+}
+
+var uuidV4 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNewUUID(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id, err := newUUID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !uuidV4.MatchString(id) {
+			t.Fatalf("newUUID() = %q; not a version 4 UUID", id)
+		}
+		if seen[id] {
+			t.Fatalf("newUUID() repeated %q", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestInstanceIDPersists(t *testing.T) {
+	withConfigDir(t)
+
+	first, err := LoadOrCreateInstanceID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !uuidV4.MatchString(first) {
+		t.Errorf("instance ID %q is not a UUID", first)
+	}
+	again, err := LoadOrCreateInstanceID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != first {
+		t.Errorf("second run got %q; want the stored %q", again, first)
+	}
+
+	// A blank file is replaced with a fresh ID.
+	path, err := instanceIDPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := LoadOrCreateInstanceID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh == first || fresh == "" {
+		t.Errorf("blank file gave %q", fresh)
+	}
+	b, _ := os.ReadFile(path)
+	if strings.TrimSpace(string(b)) != fresh {
+		t.Errorf("stored %q; want %q", b, fresh)
+	}
+}
+
+func TestParseInstanceConflict(t *testing.T) {
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{`{"error":"instance_conflict","active_instance_id":"abc"}`, true},
+		{`{"error":"session_full"}`, false},
+		{`not json`, false},
+		{``, false},
+	}
+	for _, tt := range tests {
+		err := parseInstanceConflict(strings.NewReader(tt.body))
+		if got := errors.Is(err, ErrInstanceConflict); got != tt.want {
+			t.Errorf("parseInstanceConflict(%q) = %v; want conflict %v", tt.body, err, tt.want)
+		}
+		if tt.want && !strings.Contains(err.Error(), "abc") {
+			t.Errorf("conflict error %q does not name the active instance", err)
+		}
+	}
+}
+
+func TestReadyInstanceConflict(t *testing.T) {
+	withConfigDir(t)
+	var sentID string
+	conflict := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			InstanceID string `json:"instance_id"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		sentID = body.InstanceID
+		w.WriteHeader(http.StatusConflict)
+		if conflict {
+			_, _ = w.Write([]byte(`{"error":"instance_conflict","active_instance_id":"other-pc"}`))
+		} else {
+			_, _ = w.Write([]byte(`{"error":"round_closed"}`))
+		}
+	}))
+	defer srv.Close()
+
+	id, err := LoadOrCreateInstanceID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAPI(&Config{ServerURL: srv.URL, BearerToken: "t", InstanceID: id})
+	err = a.Ready(context.Background(), NewClientState(), Capabilities{})
+	if !errors.Is(err, ErrInstanceConflict) {
+		t.Fatalf("Ready = %v; want ErrInstanceConflict", err)
+	}
+	if sentID != id {
+		t.Errorf("Ready sent instance_id %q; want %q", sentID, id)
+	}
+
+	// Any other 409 is an ordinary API error.
+	conflict = false
+	err = a.Ready(context.Background(), NewClientState(), Capabilities{})
+	var apiErr *APIError
+	if errors.Is(err, ErrInstanceConflict) || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("Ready = %v; want a 409 APIError", err)
+	}
+}
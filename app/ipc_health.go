@@ -0,0 +1,111 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// nackEscalateAfter is how many consecutive NACKs with the same reason an
+// escalated command takes before the Lua script is reloaded.
+const nackEscalateAfter = 3
+
+// nackEscalated are the commands whose repeated failure means the script
+// is stuck rather than that one request was bad.
+var nackEscalated = map[string]bool{"LOAD": true, "SAVE": true, "SWAP": true}
+
+// NackError is a command the Lua script answered with NACK.
+type NackError struct {
+	ID      int
+	Command string
+	Reason  string
+}
+
+func (e *NackError) Error() string {
+	return fmt.Sprintf("command %d (%s) failed: NACK %s", e.ID, e.Command, e.Reason)
+}
+
+// nackStreak is the run of consecutive NACKs of one command.
+type nackStreak struct {
+	reason string
+	count  int
+}
+
+// recordNack extends cmd's streak and reports whether it is long enough
+// to escalate, in which case the streak starts over.
+func (b *BizhawkIPC) recordNack(cmd, reason string) bool {
+	b.nackMu.Lock()
+	defer b.nackMu.Unlock()
+	s := b.nackStreaks[cmd]
+	if s == nil || s.reason != reason {
+		s = &nackStreak{reason: reason}
+		b.nackStreaks[cmd] = s
+	}
+	s.count++
+	if s.count < nackEscalateAfter {
+		return false
+	}
+	delete(b.nackStreaks, cmd)
+	return true
+}
+
+// reloadScript asks the Lua script to reload itself and waits for its
+// HELLO, then resyncs state.
+func (b *BizhawkIPC) reloadScript() error {
+	b.nackMu.Lock()
+	path := b.scriptPath
+	b.nackMu.Unlock()
+	if !b.Supports("RELOAD") {
+		return fmt.Errorf("RELOAD: %w", ErrUnsupported)
+	}
+	hellos := b.hellos.Load()
+	if _, err := b.sendCommand(commandOpts("RELOAD"), "RELOAD", path); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(clientIPCTimings.Command)
+	for b.hellos.Load() == hellos && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if b.hellos.Load() == hellos {
+		log.Printf("[IPC] No HELLO after RELOAD; resyncing anyway")
+	}
+	return b.SendSync()
+}
+
+func (b *BizhawkIPC) escalated(cmd, reason string, retryErr error) {
+	b.nackMu.Lock()
+	fn := b.onEscalate
+	b.nackMu.Unlock()
+	if fn != nil {
+		go fn(cmd, reason, retryErr)
+	}
+}
+
+// SetScriptPath sets the script RELOAD names when escalating.
+func (b *BizhawkIPC) SetScriptPath(path string) {
+	b.nackMu.Lock()
+	b.scriptPath = path
+	b.nackMu.Unlock()
+}
+
+// OnEscalation registers fn to be told about each script reload caused by
+// repeated NACKs; retryErr is the retried command's result.
+func (b *BizhawkIPC) OnEscalation(fn func(cmd, reason string, retryErr error)) {
+	b.nackMu.Lock()
+	b.onEscalate = fn
+	b.nackMu.Unlock()
+}
+
+// nackCounts returns the current NACK streak length per command.
+func (b *BizhawkIPC) nackCounts() map[string]int {
+	b.nackMu.Lock()
+	defer b.nackMu.Unlock()
+	if len(b.nackStreaks) == 0 {
+		return nil
+	}
+	out := make(map[string]int, len(b.nackStreaks))
+	for cmd, s := range b.nackStreaks {
+		out[cmd] = s.count
+	}
+	return out
+}
@@ -0,0 +1,181 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ipcCommandTimeout is how long SendCommand waits for an ACK by
+	// default. SAVE, which writes the whole state, and SWAP, which loads a
+	// ROM, get longer.
+	ipcCommandTimeout = 5 * time.Second
+	ipcSaveTimeout    = 15 * time.Second
+	ipcSwapTimeout    = 10 * time.Second
+	// ipcCommandRetries is how many times an unacknowledged command is
+	// sent again before its timeout.
+	ipcCommandRetries = 3
+	// ipcResendInterval is the shortest wait before an unacknowledged
+	// command is sent again; resends are otherwise spread over its
+	// timeout.
+	ipcResendInterval = 1 * time.Second
+	// ipcCloseGrace bounds BizhawkIPC.Close during app shutdown.
+	ipcCloseGrace = 2 * time.Second
+)
+
+// IPCTimings are the timeouts one side of the IPC link works with. The
+// client sends its own in SYNC; the Lua script may report its own in
+// HELLO so mismatches show up in the log instead of as contradictory
+// give-ups on each side.
+type IPCTimings struct {
+	Command time.Duration
+	Save    time.Duration
+	Swap    time.Duration
+}
+
+// clientIPCTimings are the effective timeouts of this client, and
+// clientIPCRetries its resends per command.
+var (
+	clientIPCTimings = IPCTimings{
+		Command: ipcCommandTimeout,
+		Save:    ipcSaveTimeout,
+		Swap:    ipcSwapTimeout,
+	}
+	clientIPCRetries = ipcCommandRetries
+)
+
+// configureIPCTimings applies the IPC timeout and retry settings.
+func configureIPCTimings(cfg *Config) {
+	ms := func(v int, def time.Duration) time.Duration {
+		if v > 0 {
+			return time.Duration(v) * time.Millisecond
+		}
+		return def
+	}
+	clientIPCTimings = IPCTimings{
+		Command: ms(cfg.IPCCommandTimeoutMS, ipcCommandTimeout),
+		Save:    ms(cfg.IPCSaveTimeoutMS, ipcSaveTimeout),
+		Swap:    ms(cfg.IPCSwapTimeoutMS, ipcSwapTimeout),
+	}
+	switch {
+	case cfg.IPCRetries > 0:
+		clientIPCRetries = cfg.IPCRetries
+	case cfg.IPCRetries < 0:
+		clientIPCRetries = 0
+	default:
+		clientIPCRetries = ipcCommandRetries
+	}
+}
+
+// SendCommandOpts bound how long one IPC command may take.
+type SendCommandOpts struct {
+	// Timeout is how long to wait for the ACK; zero means the default
+	// command timeout.
+	Timeout time.Duration
+	// Retries is how many times the command is resent while unanswered;
+	// zero sends it once.
+	Retries int
+}
+
+// commandOpts are the options SendCommand uses for cmd: longer timeouts
+// for SAVE and SWAP, and a single attempt for MSG, whose overlay text is
+// stale by the time a resend would show it.
+func commandOpts(cmd string) SendCommandOpts {
+	opts := SendCommandOpts{Timeout: clientIPCTimings.Command, Retries: clientIPCRetries}
+	switch cmd {
+	case "SAVE":
+		opts.Timeout = clientIPCTimings.Save
+	case "SWAP":
+		opts.Timeout = clientIPCTimings.Swap
+	case "MSG":
+		opts.Retries = 0
+	}
+	return opts
+}
+
+// resendInterval spreads a command's resends over its timeout, so a slow
+// SAVE is not sent again every second while the emulator is still
+// writing it.
+func (o SendCommandOpts) resendInterval() time.Duration {
+	return max(ipcResendInterval, o.Timeout/time.Duration(o.Retries+1))
+}
+
+// Encode renders the timings as a "timings=cmd:5000,save:5000,swap:5000"
+// frame field (milliseconds).
+func (t IPCTimings) Encode() string {
+	return fmt.Sprintf(
+		"timings=cmd:%d,save:%d,swap:%d",
+		t.Command.Milliseconds(), t.Save.Milliseconds(), t.Swap.Milliseconds(),
+	)
+}
+
+// parseHelloTimings extracts the timings field from HELLO, or nil when the
+// script does not report any. Unknown or malformed entries are ignored.
+func parseHelloTimings(fields []string) *IPCTimings {
+	for _, f := range fields {
+		for _, kv := range strings.Split(f, "|") {
+			list, ok := strings.CutPrefix(kv, "timings=")
+			if !ok {
+				continue
+			}
+			var t IPCTimings
+			for _, entry := range strings.Split(list, ",") {
+				name, value, ok := strings.Cut(strings.TrimSpace(entry), ":")
+				if !ok {
+					continue
+				}
+				ms, err := strconv.Atoi(value)
+				if err != nil || ms < 0 {
+					continue
+				}
+				d := time.Duration(ms) * time.Millisecond
+				switch name {
+				case "cmd":
+					t.Command = d
+				case "save":
+					t.Save = d
+				case "swap":
+					t.Swap = d
+				}
+			}
+			return &t
+		}
+	}
+	return nil
+}
+
+// timingMismatches lists the timeouts where the Lua side differs grossly
+// (by more than half) from ours. Timeouts Lua did not report are skipped.
+func timingMismatches(ours, lua IPCTimings) []string {
+	var out []string
+	check := func(name string, a, b time.Duration) {
+		if b == 0 {
+			return
+		}
+		diff := a - b
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff*2 > max(a, b) {
+			out = append(out, fmt.Sprintf("%s: client %s, lua %s", name, a, b))
+		}
+	}
+	check("command", ours.Command, lua.Command)
+	check("save", ours.Save, lua.Save)
+	check("swap", ours.Swap, lua.Swap)
+	return out
+}
+
+// checkLuaTimings logs the timeouts the Lua script reported in HELLO that
+// disagree with ours.
+func checkLuaTimings(lua *IPCTimings) {
+	if lua == nil {
+		return
+	}
+	for _, m := range timingMismatches(clientIPCTimings, *lua) {
+		log.Printf("[IPC] Timeout mismatch with Lua script (%s); the sides will give up at different times", m)
+	}
+}
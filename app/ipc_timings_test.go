@@ -0,0 +1,125 @@
+package app
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIPCTimingsRoundTrip(t *testing.T) {
+	want := IPCTimings{Command: 5 * time.Second, Save: 15 * time.Second, Swap: 1500 * time.Millisecond}
+	if got := want.Encode(); got != "timings=cmd:5000,save:15000,swap:1500" {
+		t.Errorf("Encode = %s", got)
+	}
+	// Timings may share a field with other HELLO entries or stand alone.
+	for _, fields := range [][]string{
+		{want.Encode()},
+		{"protocol=2|caps=overlay|" + want.Encode()},
+		{"caps=overlay", want.Encode()},
+	} {
+		if got := parseHelloTimings(fields); got == nil || *got != want {
+			t.Errorf("parseHelloTimings(%q) = %+v; want %+v", fields, got, want)
+		}
+	}
+}
+
+func TestParseHelloTimingsPartial(t *testing.T) {
+	tests := []struct {
+		field string
+		want  *IPCTimings
+	}{
+		{"caps=overlay", nil},
+		{"timings=", &IPCTimings{}},
+		{"timings=save:8000", &IPCTimings{Save: 8 * time.Second}},
+		// Unknown names, bad numbers and negative values are skipped.
+		{"timings=cmd:x,save:-1,swap:2000,load:9000,junk", &IPCTimings{Swap: 2 * time.Second}},
+		{"timings= cmd:100 , swap:200", &IPCTimings{Command: 100 * time.Millisecond, Swap: 200 * time.Millisecond}},
+	}
+	for _, tt := range tests {
+		got := parseHelloTimings([]string{tt.field})
+		if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("parseHelloTimings(%q) = %+v; want %+v", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestTimingMismatches(t *testing.T) {
+	ours := IPCTimings{Command: 5 * time.Second, Save: 15 * time.Second, Swap: 10 * time.Second}
+	tests := []struct {
+		lua  IPCTimings
+		want []string
+	}{
+		{ours, nil},
+		// Within half of the larger value is close enough.
+		{IPCTimings{Command: 3 * time.Second, Save: 25 * time.Second, Swap: 19 * time.Second}, nil},
+		{IPCTimings{Command: 2 * time.Second}, []string{"command: client 5s, lua 2s"}},
+		{IPCTimings{Save: 5 * time.Second, Swap: 30 * time.Second}, []string{"save: client 15s, lua 5s", "swap: client 10s, lua 30s"}},
+		// Unreported timeouts are not compared.
+		{IPCTimings{}, nil},
+	}
+	for _, tt := range tests {
+		if got := timingMismatches(ours, tt.lua); !slices.Equal(got, tt.want) {
+			t.Errorf("timingMismatches(%+v) = %q; want %q", tt.lua, got, tt.want)
+		}
+	}
+}
+
+func TestConfigureIPCTimings(t *testing.T) {
+	oldTimings, oldRetries := clientIPCTimings, clientIPCRetries
+	t.Cleanup(func() { clientIPCTimings, clientIPCRetries = oldTimings, oldRetries })
+
+	configureIPCTimings(&Config{IPCSaveTimeoutMS: 30000, IPCRetries: 1})
+	if want := (IPCTimings{Command: ipcCommandTimeout, Save: 30 * time.Second, Swap: ipcSwapTimeout}); clientIPCTimings != want {
+		t.Errorf("timings = %+v; want %+v", clientIPCTimings, want)
+	}
+	if opts := commandOpts("SAVE"); opts != (SendCommandOpts{Timeout: 30 * time.Second, Retries: 1}) {
+		t.Errorf("SAVE opts = %+v", opts)
+	}
+	if opts := commandOpts("MSG"); opts.Retries != 0 || opts.Timeout != ipcCommandTimeout {
+		t.Errorf("MSG opts = %+v; want a single attempt", opts)
+	}
+	// Resends are spread over the timeout, but never closer than a second.
+	if got := commandOpts("SAVE").resendInterval(); got != 15*time.Second {
+		t.Errorf("SAVE resend interval = %s", got)
+	}
+	if got := (SendCommandOpts{Timeout: 2 * time.Second, Retries: 3}).resendInterval(); got != ipcResendInterval {
+		t.Errorf("short resend interval = %s", got)
+	}
+
+	configureIPCTimings(&Config{IPCRetries: -1})
+	if clientIPCRetries != 0 || clientIPCTimings != oldTimings {
+		t.Errorf("retries %d, timings %+v; want no resends and the defaults", clientIPCRetries, clientIPCTimings)
+	}
+}
+
+func TestIPCTimingsOnTheWire(t *testing.T) {
+	syncs := make(chan string, 2)
+	b, _ := startTestIPC(t, func(id, cmd string) string {
+		if strings.HasPrefix(cmd, "SYNC|") {
+			syncs <- cmd
+		}
+		return "ACK|" + id
+	})
+	logs := captureLog(t)
+
+	// A HELLO with far shorter timeouts is answered with ours and logged.
+	b.handleResponse("HELLO|protocol=2|caps=overlay|timings=cmd:1000,save:1000,swap:10000")
+	select {
+	case sync := <-syncs:
+		if !strings.HasSuffix(sync, "|"+clientIPCTimings.Encode()) {
+			t.Errorf("SYNC = %q; want our timings last", sync)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no SYNC after HELLO")
+	}
+	out := logs.String()
+	for _, want := range []string{"command: client 5s, lua 1s", "save: client 15s, lua 1s"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "swap: client") {
+		t.Errorf("matching swap timeout reported:\n%s", out)
+	}
+}
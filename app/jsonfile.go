@@ -0,0 +1,210 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// checksumPrefix starts the footer line appended to machine-written files.
+const checksumPrefix = "#sha256:"
+
+// JSONFileError is a parse failure in a local JSON file, located by line
+// and column with a hint for the usual hand-editing mistakes.
+type JSONFileError struct {
+	Path string
+	Line int
+	Col  int
+	Hint string
+	Err  error
+}
+
+func (e *JSONFileError) Error() string {
+	msg := fmt.Sprintf("%s: line %d, column %d: ", e.Path, e.Line, e.Col)
+	if e.Hint != "" {
+		return msg + e.Hint
+	}
+	return msg + e.Err.Error()
+}
+
+func (e *JSONFileError) Unwrap() error { return e.Err }
+
+// decodeJSON parses data from path into v. A UTF-8 BOM (added by some
+// Windows editors) is ignored, and syntax errors are reported with their
+// position and, where recognisable, what to fix.
+func decodeJSON(path string, data []byte, v any) error {
+	data = bytes.TrimPrefix(data, utf8BOM)
+	err := json.Unmarshal(data, v)
+	if err == nil {
+		return nil
+	}
+	var offset int64 = -1
+	var syntax *json.SyntaxError
+	var typ *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntax):
+		offset = syntax.Offset
+	case errors.As(err, &typ):
+		offset = typ.Offset
+	default:
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	// Offsets point just past the offending byte, except at the end of
+	// the input, where there is no such byte.
+	pos := max(int(offset)-1, 0)
+	if syntax != nil && syntax.Error() == "unexpected end of JSON input" {
+		pos = len(data)
+	}
+	line, col := lineCol(data, pos)
+	return &JSONFileError{Path: path, Line: line, Col: col, Hint: jsonHint(data, pos, typ), Err: err}
+}
+
+// lineCol converts a byte offset to a 1-based line and column.
+func lineCol(data []byte, pos int) (int, int) {
+	pos = min(pos, len(data))
+	line := 1 + bytes.Count(data[:pos], []byte("\n"))
+	col := pos - bytes.LastIndexByte(data[:pos], '\n')
+	return line, col
+}
+
+// jsonHint recognises the mistakes behind most broken hand-edited files.
+func jsonHint(data []byte, pos int, typ *json.UnmarshalTypeError) string {
+	if typ != nil {
+		return fmt.Sprintf("%q should be a %s, not a JSON %s", typ.Field, typ.Type, typ.Value)
+	}
+	if pos >= len(data) {
+		return "the file ends early; a closing } or ] or a quote is probably missing"
+	}
+	rest := data[pos:]
+	if bytes.HasPrefix(rest, []byte("//")) || bytes.HasPrefix(rest, []byte("/*")) {
+		return "comments are not allowed in JSON; remove the // or /* */ text"
+	}
+	if rest[0] == '}' || rest[0] == ']' {
+		prev := bytes.TrimRight(data[:pos], " \t\r\n")
+		if len(prev) > 0 && prev[len(prev)-1] == ',' {
+			return fmt.Sprintf("trailing comma before %q; remove the last comma", rest[0])
+		}
+	}
+	if rest[0] == '\'' {
+		return "strings must use double quotes, not single quotes"
+	}
+	if rest[0] == '"' {
+		prev := bytes.TrimRight(data[:pos], " \t\r\n")
+		if len(prev) > 0 && (prev[len(prev)-1] == '"' || prev[len(prev)-1] == '}' || prev[len(prev)-1] == ']') {
+			return "a comma is missing before this entry"
+		}
+	}
+	return ""
+}
+
+// writeChecksummed writes body followed by a checksum footer, atomically,
+// keeping the previous version as path+".bak" for recovery.
+func writeChecksummed(path string, body []byte) error {
+	body = bytes.TrimRight(body, "\n")
+	sum := sha256.Sum256(body)
+	out := make([]byte, 0, len(body)+80)
+	out = append(out, body...)
+	out = append(out, '\n')
+	out = append(out, checksumPrefix...)
+	out = append(out, hex.EncodeToString(sum[:])...)
+	out = append(out, '\n')
+
+	// Only a verified copy is worth keeping as the backup.
+	if prev, err := os.ReadFile(path); err == nil {
+		if _, ok, intact := splitChecksum(prev); ok && intact {
+			if err := copyFile(path, path+".bak"); err != nil {
+				log.Printf("Could not back up %s: %v", path, err)
+			}
+		}
+	}
+	return writeFileAtomic(path, out, 0o644)
+}
+
+// writeFileAtomic replaces path with data through a uniquely named temp
+// file, so concurrent writers never interleave in a shared one.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), perm)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return replaceFile(tmp.Name(), path)
+}
+
+// splitChecksum separates a machine-written file from its footer. ok is
+// false when there is no footer (an old or hand-written file); intact
+// reports whether the body still matches the footer.
+func splitChecksum(data []byte) (body []byte, ok, intact bool) {
+	trimmed := bytes.TrimRight(data, "\r\n")
+	i := bytes.LastIndexByte(trimmed, '\n')
+	if i < 0 || !bytes.HasPrefix(trimmed[i+1:], []byte(checksumPrefix)) {
+		return data, false, false
+	}
+	body = bytes.TrimRight(trimmed[:i], "\r")
+	want := string(bytes.TrimSpace(trimmed[i+1+len(checksumPrefix):]))
+	sum := sha256.Sum256(body)
+	return body, true, hex.EncodeToString(sum[:]) == want
+}
+
+// readChecksummed loads a file written by writeChecksummed into v. A body
+// that no longer matches its checksum but still parses is taken as a hand
+// edit; one that does not parse is corruption, and the .bak copy is
+// restored instead.
+func readChecksummed(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	body, hasSum, intact := splitChecksum(data)
+	err = decodeJSON(path, body, v)
+	switch {
+	case err == nil:
+		if hasSum && !intact {
+			log.Printf("%s was edited by hand (checksum mismatch); using it as is", path)
+		}
+		return nil
+	case hasSum && !intact:
+		log.Printf("%s is corrupt (%v); restoring from backup", path, err)
+		bak := path + ".bak"
+		bdata, berr := os.ReadFile(bak)
+		if berr != nil {
+			return fmt.Errorf("%w (no usable backup: %v)", err, berr)
+		}
+		bbody, _, _ := splitChecksum(bdata)
+		if berr := decodeJSON(bak, bbody, v); berr != nil {
+			return fmt.Errorf("%w (backup unusable: %v)", err, berr)
+		}
+		if cerr := copyFile(bak, path); cerr != nil {
+			log.Printf("Could not restore %s from backup: %v", path, cerr)
+		}
+		return nil
+	default:
+		return err
+	}
+}
+
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(dst, data, 0o644)
+}
@@ -0,0 +1,158 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWriteChecksummedConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "runtime_state.json")
+	type doc struct {
+		Writer int    `json:"writer"`
+		Pad    string `json:"pad"`
+	}
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Large enough that interleaved writes would corrupt it.
+			body, _ := json.Marshal(doc{Writer: i, Pad: strings.Repeat(fmt.Sprint(i), 64<<10)})
+			for range 5 {
+				if err := writeChecksummed(path, body); err != nil {
+					t.Errorf("writer %d: %v", i, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, intact := splitChecksum(data); !ok || !intact {
+		t.Fatalf("file after concurrent writes: footer %v, intact %v", ok, intact)
+	}
+	var got doc
+	if err := readChecksummed(path, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Pad != strings.Repeat(fmt.Sprint(got.Writer), 64<<10) {
+		t.Errorf("body mixes writers")
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	if len(leftovers) > 0 {
+		t.Errorf("temp files left behind: %v", leftovers)
+	}
+}
+
+func TestReadChecksummedRestoresBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := writeChecksummed(path, []byte(`{"round":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	// The second write keeps the first as the backup.
+	if err := writeChecksummed(path, []byte(`{"round":2}`)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data[:5], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A truncated file has no footer, so it is reported rather than
+	// silently replaced.
+	var v struct{ Round int }
+	if err := readChecksummed(path, &v); err == nil {
+		t.Fatal("readChecksummed accepted a truncated file")
+	}
+
+	// A corrupt body under an intact footer is restored from the backup.
+	corrupt := strings.Replace(string(data), `{"round":2}`, `{"round":`, 1)
+	if err := os.WriteFile(path, []byte(corrupt), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := readChecksummed(path, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Round != 1 {
+		t.Errorf("restored round = %d; want 1", v.Round)
+	}
+}
+
+func TestReadChecksummedAcceptsHandEdits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := writeChecksummed(path, []byte(`{"round":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	edited := strings.Replace(string(data), `{"round":1}`, `{"round":5}`, 1)
+	if err := os.WriteFile(path, []byte(edited), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var v struct{ Round int }
+	if err := readChecksummed(path, &v); err != nil || v.Round != 5 {
+		t.Errorf("hand-edited file = %d, %v; want 5", v.Round, err)
+	}
+}
+
+// TestDecodeJSONFixtures runs decodeJSON over the hand-editing mistakes in
+// testdata/json, with both line endings since Windows editors save CRLF.
+func TestDecodeJSONFixtures(t *testing.T) {
+	tests := []struct {
+		file      string
+		line, col int
+		hint      string
+	}{
+		{"bom.json", 0, 0, ""},
+		{"trailing_comma.json", 4, 1, `trailing comma before '}'; remove the last comma`},
+		{"trailing_comma_array.json", 5, 3, `trailing comma before ']'; remove the last comma`},
+		{"line_comment.json", 3, 3, "comments are not allowed in JSON; remove the // or /* */ text"},
+		{"block_comment.json", 2, 22, "comments are not allowed in JSON; remove the // or /* */ text"},
+		{"single_quotes.json", 2, 14, "strings must use double quotes, not single quotes"},
+		{"missing_comma.json", 3, 3, "a comma is missing before this entry"},
+		{"truncated.json", 4, 1, "the file ends early; a closing } or ] or a quote is probably missing"},
+		{"wrong_type.json", 3, 29, `"bizhawk_ipc_port" should be a int, not a JSON string`},
+	}
+	for _, tt := range tests {
+		raw, err := os.ReadFile(filepath.Join("testdata", "json", tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lf := strings.ReplaceAll(string(raw), "\r\n", "\n")
+		for eol, data := range map[string]string{"LF": lf, "CRLF": strings.ReplaceAll(lf, "\n", "\r\n")} {
+			t.Run(tt.file+"/"+eol, func(t *testing.T) {
+				var cfg Config
+				err := decodeJSON(tt.file, []byte(data), &cfg)
+				if tt.line == 0 {
+					if err != nil || cfg.RomDir != "roms" || cfg.SaveDir != "saves" {
+						t.Fatalf("decodeJSON = %+v, %v", cfg, err)
+					}
+					return
+				}
+				var jerr *JSONFileError
+				if !errors.As(err, &jerr) {
+					t.Fatalf("decodeJSON = %v; want a JSONFileError", err)
+				}
+				if jerr.Line != tt.line || jerr.Col != tt.col || jerr.Hint != tt.hint {
+					t.Errorf("error at %d:%d hint %q; want %d:%d %q", jerr.Line, jerr.Col, jerr.Hint, tt.line, tt.col, tt.hint)
+				}
+				if want := fmt.Sprintf("%s: line %d, column %d: %s", tt.file, tt.line, tt.col, tt.hint); err.Error() != want {
+					t.Errorf("message %q; want %q", err, want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// prefetchIndexFile lists the ROMs fetched by `prefetch`, so `clean
+// --library` can tell them apart from session downloads.
+const prefetchIndexFile = "prefetched.json"
+
+// LibraryGame is one entry of the server's ROM library.
+type LibraryGame struct {
+	File   string `json:"file"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// ListLibrary fetches every page of the server's ROM library.
+func (a *API) ListLibrary(ctx context.Context) ([]LibraryGame, error) {
+	var games []LibraryGame
+	for page := 1; ; page++ {
+		req, err := a.newRequest(ctx, http.MethodGet, "/api/library?page="+strconv.Itoa(page), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, _, err := a.do(req)
+		if err != nil {
+			return nil, fmt.Errorf("library send error: %w", err)
+		}
+		if resp == nil {
+			return nil, fmt.Errorf("nil library response")
+		}
+		var data struct {
+			Data        []LibraryGame `json:"data"`
+			CurrentPage int           `json:"current_page"`
+			LastPage    int           `json:"last_page"`
+		}
+		switch resp.StatusCode {
+		case http.StatusOK:
+			err = json.NewDecoder(resp.Body).Decode(&data)
+		case http.StatusNotFound:
+			err = ErrEndpointUnsupported
+		default:
+			err = newAPIError("library", resp)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("library page %d: %w", page, err)
+		}
+		games = append(games, data.Data...)
+		if len(data.Data) == 0 || data.LastPage <= page {
+			return games, nil
+		}
+	}
+}
+
+// parseSelection turns "1,3,5-7" (1-based, as listed) into sorted,
+// de-duplicated indexes below n. "all" selects everything.
+func parseSelection(s string, n int) ([]int, error) {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, "all") {
+		all := make([]int, n)
+		for i := range all {
+			all[i] = i
+		}
+		return all, nil
+	}
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil {
+			return nil, fmt.Errorf("bad selection %q", part)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil {
+				return nil, fmt.Errorf("bad selection %q", part)
+			}
+		}
+		if first < 1 || last > n || first > last {
+			return nil, fmt.Errorf("selection %q out of range 1-%d", part, n)
+		}
+		for i := first; i <= last; i++ {
+			seen[i-1] = true
+		}
+	}
+	out := make([]int, 0, len(seen))
+	for i := range seen {
+		out = append(out, i)
+	}
+	sort.Ints(out)
+	return out, nil
+}
+
+// matchLibrary selects the games whose file name matches any of the
+// comma-separated glob patterns, case-insensitively.
+func matchLibrary(games []LibraryGame, patterns string) ([]int, error) {
+	var out []int
+	for i, g := range games {
+		for _, p := range strings.Split(patterns, ",") {
+			ok, err := path.Match(strings.ToLower(strings.TrimSpace(p)), strings.ToLower(g.File))
+			if err != nil {
+				return nil, fmt.Errorf("bad pattern %q: %w", p, err)
+			}
+			if ok {
+				out = append(out, i)
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+// runPrefetch downloads games from the server library into the ROM
+// directory ahead of a session, so Bootstrap finds them already present.
+func runPrefetch(args []string, configPath string) error {
+	fs := flag.NewFlagSet("prefetch", flag.ExitOnError)
+	all := fs.Bool("all", false, "Download every game in the library")
+	pattern := fs.String("pattern", "", "Download games matching these comma-separated globs (e.g. '*.sfc,mario*')")
+	_ = fs.Parse(args)
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	if err := configureTLS(cfg); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	games, err := NewAPI(cfg).ListLibrary(ctx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	if len(games) == 0 {
+		fmt.Println("The server library is empty.")
+		return nil
+	}
+
+	var picked []int
+	switch {
+	case *all:
+		picked, _ = parseSelection("all", len(games))
+	case *pattern != "":
+		if picked, err = matchLibrary(games, *pattern); err != nil {
+			return err
+		}
+	default:
+		for i, g := range games {
+			fmt.Printf("%3d  %-50s %8.1f MB\n", i+1, g.File, float64(g.Size)/(1<<20))
+		}
+		fmt.Print("Select games (e.g. 1,3,5-7 or all): ")
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if picked, err = parseSelection(line, len(games)); err != nil {
+			return err
+		}
+	}
+	if len(picked) == 0 {
+		fmt.Println("Nothing selected.")
+		return nil
+	}
+
+	if err := os.MkdirAll(cfg.RomDir, 0o755); err != nil {
+		return err
+	}
+	index := loadPrefetchIndex()
+	dl := NewDownloadManager(downloadClient, NewClientState(), cfg)
+	failed := 0
+	for _, i := range picked {
+		g := games[i]
+		if err := prefetchGame(dl, cfg, g); err != nil {
+			fmt.Printf("FAIL  %s: %v\n", g.File, err)
+			failed++
+			continue
+		}
+		if !slices.Contains(index, g.File) {
+			index = append(index, g.File)
+		}
+		fmt.Printf("OK    %s\n", g.File)
+	}
+	if err := savePrefetchIndex(index); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("prefetch: %d of %d downloads failed", failed, len(picked))
+	}
+	return nil
+}
+
+// prefetchGame downloads one library game unless an intact copy exists.
+func prefetchGame(dl *DownloadManager, cfg *Config, g LibraryGame) error {
+	url, err := romURL(cfg.ServerURL, g.File)
+	if err != nil {
+		return err
+	}
+	dest := filepath.Join(cfg.RomDir, g.File)
+	if g.SHA256 != "" {
+		if sum, err := fileSHA256(dest); err == nil && strings.EqualFold(sum, g.SHA256) {
+			return nil
+		}
+	} else if _, err := os.Stat(dest); err == nil {
+		return nil
+	}
+	if err := dl.Fetch(DownloadBackground, url, dest); err != nil {
+		return err
+	}
+	if err := checkROMHash(dest, g.SHA256); err != nil {
+		_ = os.Remove(dest)
+		return err
+	}
+	return nil
+}
+
+func loadPrefetchIndex() []string {
+	var files []string
+	data, err := os.ReadFile(prefetchIndexFile)
+	if err == nil {
+		_ = json.Unmarshal(data, &files)
+	}
+	return files
+}
+
+func savePrefetchIndex(files []string) error {
+	sort.Strings(files)
+	data, err := json.MarshalIndent(files, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(prefetchIndexFile, data, 0o644)
+}
+
+// cleanPrefetched removes prefetched ROMs the current session manifest
+// does not reference and returns how many were removed.
+func cleanPrefetched(romDir string) (int, error) {
+	manifest, err := LoadManifest(manifestFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+	var keep []string
+	if manifest != nil {
+		keep = manifest.Files()
+	}
+	var remaining []string
+	removed := 0
+	for _, f := range loadPrefetchIndex() {
+		if slices.Contains(keep, f) {
+			remaining = append(remaining, f)
+			continue
+		}
+		if err := os.Remove(filepath.Join(romDir, filepath.Base(f))); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, savePrefetchIndex(remaining)
+}
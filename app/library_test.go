@@ -0,0 +1,154 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// libraryServer serves pages of files, claiming lastPage pages in total,
+// and records the pages requested. failPage, when set, answers 500.
+func libraryServer(t *testing.T, pages [][]string, lastPage, failPage int) (*httptest.Server, func() []int) {
+	t.Helper()
+	var mu sync.Mutex
+	var requested []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		mu.Lock()
+		requested = append(requested, page)
+		mu.Unlock()
+		if page == failPage {
+			http.Error(w, "db down", http.StatusInternalServerError)
+			return
+		}
+		var games []string
+		if page >= 1 && page <= len(pages) {
+			for _, f := range pages[page-1] {
+				games = append(games, fmt.Sprintf(`{"file":%q,"size":1024}`, f))
+			}
+		}
+		fmt.Fprintf(w, `{"data":[%s],"current_page":%d,"last_page":%d}`, strings.Join(games, ","), page, lastPage)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(requested)
+	}
+}
+
+func libraryFiles(games []LibraryGame) []string {
+	var out []string
+	for _, g := range games {
+		out = append(out, g.File)
+	}
+	return out
+}
+
+func TestListLibraryPages(t *testing.T) {
+	pages := [][]string{{"a.nes", "b.nes"}, {"c.sfc"}, {"d.md"}}
+	tests := []struct {
+		name     string
+		lastPage int
+		want     []string
+		pages    []int
+	}{
+		{"all pages", 3, []string{"a.nes", "b.nes", "c.sfc", "d.md"}, []int{1, 2, 3}},
+		{"last page reached", 2, []string{"a.nes", "b.nes", "c.sfc"}, []int{1, 2}},
+		// A server that overstates last_page ends at the first empty page.
+		{"empty page", 9, []string{"a.nes", "b.nes", "c.sfc", "d.md"}, []int{1, 2, 3, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requested := libraryServer(t, pages, tt.lastPage, 0)
+			games, err := NewAPI(&Config{ServerURL: srv.URL, BearerToken: "t"}).ListLibrary(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := libraryFiles(games); !slices.Equal(got, tt.want) {
+				t.Errorf("games = %v; want %v", got, tt.want)
+			}
+			if got := requested(); !slices.Equal(got, tt.pages) {
+				t.Errorf("pages requested = %v; want %v", got, tt.pages)
+			}
+		})
+	}
+}
+
+func TestListLibraryErrors(t *testing.T) {
+	srv, _ := libraryServer(t, [][]string{{"a.nes"}, {"b.nes"}}, 2, 2)
+	_, err := NewAPI(&Config{ServerURL: srv.URL, BearerToken: "t"}).ListLibrary(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError || !strings.HasPrefix(err.Error(), "library page 2: ") {
+		t.Errorf("failing second page: %v", err)
+	}
+
+	old := httptest.NewServer(http.NotFoundHandler())
+	defer old.Close()
+	if _, err := NewAPI(&Config{ServerURL: old.URL, BearerToken: "t"}).ListLibrary(context.Background()); !errors.Is(err, ErrEndpointUnsupported) {
+		t.Errorf("server without a library: %v", err)
+	}
+}
+
+func TestParseSelection(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []int
+		err  bool
+	}{
+		{"1", []int{0}, false},
+		{" 1, 3 ,5-7\n", []int{0, 2, 4, 5, 6}, false},
+		{"7-5", nil, true},
+		{"3,1-3,2", []int{0, 1, 2}, false},
+		{"ALL", []int{0, 1, 2, 3, 4, 5, 6, 7}, false},
+		{"", []int{}, false},
+		{",,", []int{}, false},
+		{"4 - 4", []int{3}, false},
+		{"0", nil, true},
+		{"9", nil, true},
+		{"2-9", nil, true},
+		{"two", nil, true},
+		{"1-", nil, true},
+		{"-3", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSelection(tt.in, 8)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseSelection(%q) = %v; want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("parseSelection(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestMatchLibrary(t *testing.T) {
+	games := []LibraryGame{{File: "Mario.nes"}, {File: "zelda.sfc"}, {File: "Metroid.SFC"}, {File: "sonic.md"}}
+	tests := []struct {
+		patterns string
+		want     []int
+	}{
+		{"*.sfc", []int{1, 2}},
+		{"mario*, sonic.md", []int{0, 3}},
+		{"*.sfc,m*", []int{0, 1, 2}},
+		{"*.gb", nil},
+	}
+	for _, tt := range tests {
+		if got, err := matchLibrary(games, tt.patterns); err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("matchLibrary(%q) = %v, %v; want %v", tt.patterns, got, err, tt.want)
+		}
+	}
+	if _, err := matchLibrary(games, "[z"); err == nil {
+		t.Error("matchLibrary accepted a malformed pattern")
+	}
+}
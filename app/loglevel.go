@@ -0,0 +1,124 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// LogLevel controls how chatty client.log is.
+type LogLevel string
+
+const (
+	LogInfo  LogLevel = "info"
+	LogDebug LogLevel = "debug"
+
+	maxLogOverride = time.Hour
+)
+
+// logLevels holds the base level (from -v) and any temporary override
+// requested by the server, which always reverts on its own.
+var logLevels = &logLevelController{base: LogInfo}
+
+type logLevelController struct {
+	mu       sync.Mutex
+	base     LogLevel
+	override LogLevel
+	ipcTrace bool
+	until    time.Time
+	timer    *time.Timer
+}
+
+// LogLevelStatus describes the effective log level for status reporting.
+type LogLevelStatus struct {
+	Level    LogLevel  `json:"level"`
+	IPCTrace bool      `json:"ipc_trace"`
+	Until    time.Time `json:"until,omitempty"`
+}
+
+func (c *logLevelController) setBase(l LogLevel) {
+	c.mu.Lock()
+	c.base = l
+	c.mu.Unlock()
+}
+
+// Set applies a temporary level for d (capped at maxLogOverride). A newer
+// request replaces an older one, including its expiry.
+func (c *logLevelController) Set(l LogLevel, ipcTrace bool, d time.Duration) error {
+	if l != LogInfo && l != LogDebug {
+		return fmt.Errorf("unknown log level %q", l)
+	}
+	if d <= 0 || d > maxLogOverride {
+		d = maxLogOverride
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.override = l
+	c.ipcTrace = ipcTrace
+	c.until = time.Now().Add(d)
+	c.timer = time.AfterFunc(d, c.revert)
+	log.Printf("Log level set to %s (ipc trace %v) until %s", l, ipcTrace, c.until.Format(time.RFC3339))
+	return nil
+}
+
+func (c *logLevelController) revert() {
+	c.mu.Lock()
+	if c.override == "" || time.Now().Before(c.until) {
+		c.mu.Unlock()
+		return
+	}
+	c.override = ""
+	c.ipcTrace = false
+	c.until = time.Time{}
+	c.timer = nil
+	base := c.base
+	c.mu.Unlock()
+	log.Printf("Log level reverted to %s", base)
+}
+
+func (c *logLevelController) Status() LogLevelStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.override != "" {
+		return LogLevelStatus{Level: c.override, IPCTrace: c.ipcTrace, Until: c.until}
+	}
+	return LogLevelStatus{Level: c.base}
+}
+
+func (c *logLevelController) debug() bool {
+	return c.Status().Level == LogDebug
+}
+
+func (c *logLevelController) tracingIPC() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.override != "" && c.ipcTrace
+}
+
+// debugf logs only when the effective level is debug.
+func debugf(format string, args ...any) {
+	if logLevels.debug() {
+		log.Output(2, "[DEBUG] "+fmt.Sprintf(format, args...))
+	}
+}
+
+// LogDirective is the server's request to change verbosity, delivered in
+// the heartbeat response or a set_log_level event.
+type LogDirective struct {
+	Level    LogLevel `json:"log_level"`
+	Seconds  int      `json:"log_level_seconds"`
+	IPCTrace bool     `json:"ipc_trace"`
+}
+
+func (d LogDirective) apply() {
+	if d.Level == "" {
+		return
+	}
+	if err := logLevels.Set(d.Level, d.IPCTrace, time.Duration(d.Seconds)*time.Second); err != nil {
+		log.Printf("Ignoring log directive: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLogLevelOverrideReverts(t *testing.T) {
+	c := &logLevelController{base: LogInfo}
+	if err := c.Set(LogDebug, true, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	st := c.Status()
+	if st.Level != LogDebug || !st.IPCTrace || st.Until.IsZero() || !c.debug() || !c.tracingIPC() {
+		t.Errorf("status after Set = %+v", st)
+	}
+	waitFor(t, "revert", func() bool { return !c.debug() })
+	if st := c.Status(); st != (LogLevelStatus{Level: LogInfo}) || c.tracingIPC() {
+		t.Errorf("status after revert = %+v; want the base level", st)
+	}
+}
+
+func TestLogLevelNewerOverrideWins(t *testing.T) {
+	c := &logLevelController{base: LogInfo}
+	if err := c.Set(LogDebug, false, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	// A newer request replaces the first, expiry included.
+	if err := c.Set(LogDebug, true, 400*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if st := c.Status(); st.Level != LogDebug || !st.IPCTrace {
+		t.Errorf("status after the first override's expiry = %+v; want the second still active", st)
+	}
+	waitFor(t, "revert", func() bool { return !c.debug() })
+
+	// A stale timer that fires after a newer Set leaves it alone.
+	if err := c.Set(LogDebug, false, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	c.revert()
+	if !c.debug() {
+		t.Error("early revert cleared an override that has not expired")
+	}
+	c.timer.Stop()
+}
+
+func TestLogLevelSetValidates(t *testing.T) {
+	c := &logLevelController{base: LogDebug}
+	if err := c.Set("verbose", false, time.Minute); err == nil {
+		t.Error("unknown level accepted")
+	}
+	if st := c.Status(); st.Level != LogDebug || !st.Until.IsZero() {
+		t.Errorf("rejected Set changed status to %+v", st)
+	}
+
+	// Missing and excessive durations are capped.
+	for _, d := range []time.Duration{0, -time.Second, 3 * maxLogOverride} {
+		if err := c.Set(LogInfo, false, d); err != nil {
+			t.Fatal(err)
+		}
+		left := time.Until(c.Status().Until)
+		if left <= maxLogOverride-time.Minute || left > maxLogOverride {
+			t.Errorf("Set for %s expires in %s; want about %s", d, left, maxLogOverride)
+		}
+	}
+	c.timer.Stop()
+	// An override can lower verbosity below the base level too.
+	if c.debug() {
+		t.Error("info override on a debug base still logs debug")
+	}
+}
+
+func TestLogDirectiveApply(t *testing.T) {
+	// The directive acts on the global controller; clear what it leaves.
+	t.Cleanup(func() {
+		c := logLevels
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+		c.override, c.ipcTrace, c.until, c.timer = "", false, time.Time{}, nil
+	})
+
+	// No level means no change.
+	LogDirective{Seconds: 60}.apply()
+	if logLevels.debug() {
+		t.Error("directive without a level changed the level")
+	}
+	LogDirective{Level: "loud", Seconds: 60}.apply()
+	if st := logLevels.Status(); st.Level != LogInfo || !st.Until.IsZero() {
+		t.Errorf("invalid directive applied: %+v", st)
+	}
+
+	f := newHandlerFixture(t)
+	f.dispatch("set_log_level", `{"log_level":"debug","log_level_seconds":60,"ipc_trace":true}`)
+	st := logLevels.Status()
+	if st.Level != LogDebug || !st.IPCTrace {
+		t.Errorf("status after set_log_level = %+v", st)
+	}
+	if left := time.Until(st.Until); left <= 50*time.Second || left > time.Minute {
+		t.Errorf("override expires in %s; want about a minute", left)
+	}
+}
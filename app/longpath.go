@@ -0,0 +1,89 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"path/filepath"
+	"runtime"
+	"unicode/utf8"
+)
+
+// windowsMaxPath is MAX_PATH minus the terminating NUL. Go itself copes
+// with longer paths, but BizHawk fails to open ROMs beyond it.
+const windowsMaxPath = 259
+
+// shortNameHashLen is the number of hex digits of the name hash kept in a
+// shortened file name.
+const shortNameHashLen = 8
+
+// pathLimit returns the longest ROM path we let the emulator see, or 0
+// when no limit applies.
+func pathLimit(cfg *Config) int {
+	if runtime.GOOS != "windows" || cfg.LongPaths {
+		return 0
+	}
+	return windowsMaxPath
+}
+
+// shortenFileName deterministically shortens name so it is at most max
+// bytes, keeping the extension and as much of the stem as fits, followed
+// by "~" and a hash of the full name so distinct names stay distinct.
+func shortenFileName(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	suffix := "~" + hex.EncodeToString(sum[:])[:shortNameHashLen] + filepath.Ext(name)
+	stem := name[:len(name)-len(filepath.Ext(name))]
+	keep := max - len(suffix)
+	if keep < 1 {
+		keep = 1
+	}
+	if keep < len(stem) {
+		stem = stem[:keep]
+		// Don't cut a multi-byte character in half.
+		for len(stem) > 0 && !utf8.ValidString(stem) {
+			stem = stem[:len(stem)-1]
+		}
+	}
+	return stem + suffix
+}
+
+// AssignLocalNames records a shortened local name for every session file
+// whose path under romDir would exceed limit (0 disables shortening).
+// Names are derived deterministically, so recomputing them after a
+// restart yields the same mapping.
+func (m *SessionManifest) AssignLocalNames(romDir string, limit int) {
+	m.LocalNames = nil
+	if limit <= 0 {
+		return
+	}
+	dir, err := filepath.Abs(romDir)
+	if err != nil {
+		dir = romDir
+	}
+	room := limit - len(dir) - 1
+	for _, file := range m.Files() {
+		if len(dir)+1+len(file) <= limit {
+			continue
+		}
+		local := shortenFileName(file, room)
+		if m.LocalNames == nil {
+			m.LocalNames = make(map[string]string)
+		}
+		m.LocalNames[file] = local
+		log.Printf("Game file name too long for Windows paths; storing %q as %q", file, local)
+	}
+}
+
+// LocalName returns the on-disk name of a session file. Server-facing
+// code keeps using the canonical name.
+func (m *SessionManifest) LocalName(file string) string {
+	if m != nil {
+		if local, ok := m.LocalNames[file]; ok {
+			return local
+		}
+	}
+	return file
+}
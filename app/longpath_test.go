@@ -0,0 +1,116 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestShortenFileName(t *testing.T) {
+	long := strings.Repeat("Legend of Zelda ", 10) + "(USA).sfc"
+	tests := []struct {
+		name string
+		max  int
+	}{
+		{long, 60},
+		{long, 20},
+		{strings.Repeat("ゼルダの伝説", 10) + ".sfc", 40},
+		// Too little room for a stem still keeps one byte of it.
+		{long, 5},
+	}
+	for _, tt := range tests {
+		got := shortenFileName(tt.name, tt.max)
+		if again := shortenFileName(tt.name, tt.max); again != got {
+			t.Errorf("shortenFileName is not deterministic: %q then %q", got, again)
+		}
+		if !strings.HasSuffix(got, ".sfc") || !strings.Contains(got, "~") {
+			t.Errorf("shortenFileName(%q, %d) = %q; want the hash and extension kept", tt.name, tt.max, got)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("shortenFileName(%q, %d) = %q cuts a character", tt.name, tt.max, got)
+		}
+		if tt.max >= 20 && len(got) > tt.max {
+			t.Errorf("shortenFileName(%q, %d) = %q is %d bytes", tt.name, tt.max, got, len(got))
+		}
+	}
+	sum := sha256.Sum256([]byte(long))
+	if got, want := shortenFileName(long, 60), long[:47]+"~"+hex.EncodeToString(sum[:4])+".sfc"; got != want {
+		t.Errorf("shortenFileName(long, 60) = %q; want %q", got, want)
+	}
+
+	// Short names pass through; names differing only past the cut differ.
+	if got := shortenFileName("mario.nes", 60); got != "mario.nes" {
+		t.Errorf("short name changed to %q", got)
+	}
+	a := shortenFileName(long+"-disc1.cue", 40)
+	b := shortenFileName(long+"-disc2.cue", 40)
+	if a == b {
+		t.Errorf("distinct names shortened alike: %q", a)
+	}
+}
+
+func TestAssignLocalNames(t *testing.T) {
+	romDir := t.TempDir()
+	abs, _ := filepath.Abs(romDir)
+	long := strings.Repeat("x", 80) + ".nes"
+	limit := len(abs) + 1 + 40
+
+	m := testManifest()
+	m.Games = append(m.Games, ManifestGame{ID: 99, File: long})
+	m.AssignLocalNames(romDir, limit)
+	local := m.LocalName(long)
+	if len(m.LocalNames) != 1 || local == long || len(abs)+1+len(local) > limit {
+		t.Fatalf("local names = %v; want only %q shortened to fit %d", m.LocalNames, long, limit)
+	}
+	if got := m.LocalName("mario.nes"); got != "mario.nes" {
+		t.Errorf("LocalName(mario.nes) = %q", got)
+	}
+	if got := (*SessionManifest)(nil).LocalName("mario.nes"); got != "mario.nes" {
+		t.Errorf("nil manifest LocalName = %q", got)
+	}
+
+	// A restart reloads the manifest and recomputes the same names.
+	path := filepath.Join(t.TempDir(), manifestFile)
+	if err := SaveManifest(m, path); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := LoadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded.AssignLocalNames(romDir, limit)
+	if got := reloaded.LocalName(long); got != local {
+		t.Errorf("after restart %q maps to %q; want %q", long, got, local)
+	}
+
+	// Long paths enabled: no shortening at all.
+	m.AssignLocalNames(romDir, 0)
+	if m.LocalNames != nil {
+		t.Errorf("local names with no limit: %v", m.LocalNames)
+	}
+}
+
+func TestShortenedNamesReachDiskAndEmulator(t *testing.T) {
+	f := newHandlerFixture(t)
+	long := strings.Repeat("x", 80) + ".nes"
+	m := testManifest()
+	m.Games = append(m.Games, ManifestGame{ID: 99, File: long})
+	// Installed directly: setManifest only shortens on Windows.
+	m.LocalNames = map[string]string{long: "xxxx~12345678.nes"}
+	f.h.manifestMu.Lock()
+	f.h.manifest = m
+	f.h.manifestMu.Unlock()
+
+	if got, want := f.h.romPath(long), filepath.Join(f.cfg.RomDir, "xxxx~12345678.nes"); got != want {
+		t.Errorf("romPath = %s; want %s", got, want)
+	}
+	if got := f.h.emulatorFile(long); got != "xxxx~12345678.nes" {
+		t.Errorf("emulatorFile = %s; want the local name", got)
+	}
+	if got := f.h.emulatorFile("mario.nes"); got != "mario.nes" {
+		t.Errorf("emulatorFile(mario.nes) = %s", got)
+	}
+}
@@ -0,0 +1,167 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ipcProtocolVersion is the IPC protocol this client speaks. Protocol 2
+// adds receive and execution timestamps to the SWAP ACK (see
+// swap_timing.go).
+const ipcProtocolVersion = 2
+
+// ScriptIncompatibleError is returned when a downloaded Lua script needs a
+// newer IPC protocol than this client supports.
+type ScriptIncompatibleError struct {
+	Required  int
+	Supported int
+}
+
+func (e *ScriptIncompatibleError) Error() string {
+	return fmt.Sprintf(
+		"lua script requires IPC protocol %d but this client supports %d; update the client",
+		e.Required, e.Supported,
+	)
+}
+
+var scriptProtocolRe = regexp.MustCompile(`^\s*--\s*(?:ipc[-_ ])?protocol\s*[:=]\s*(\d+)`)
+
+// parseScriptProtocol reads the protocol requirement declared in the first
+// few comment lines of a script ("-- protocol: 2"). ok is false when the
+// script declares none, which is treated as protocol 1.
+func parseScriptProtocol(r io.Reader) (version int, ok bool) {
+	sc := bufio.NewScanner(r)
+	for i := 0; i < 5 && sc.Scan(); i++ {
+		if m := scriptProtocolRe.FindStringSubmatch(sc.Text()); m != nil {
+			v, err := strconv.Atoi(m[1])
+			if err == nil {
+				return v, true
+			}
+		}
+	}
+	return 1, false
+}
+
+// parseHelloProtocol extracts "protocol=N" from HELLO fields. Scripts that
+// predate the field speak protocol 1.
+func parseHelloProtocol(fields []string) int {
+	for _, f := range fields {
+		for _, kv := range strings.Split(f, "|") {
+			if v, ok := strings.CutPrefix(kv, "protocol="); ok {
+				if n, err := strconv.Atoi(v); err == nil {
+					return n
+				}
+			}
+		}
+	}
+	return 1
+}
+
+// checkLuaProtocol warns when the running script speaks a newer protocol
+// than this client, which usually means the client needs updating.
+func checkLuaProtocol(version int) {
+	if version > ipcProtocolVersion {
+		log.Printf("[IPC] WARNING: %v", &ScriptIncompatibleError{Required: version, Supported: ipcProtocolVersion})
+	}
+}
+
+func checkScriptCompatible(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	required, _ := parseScriptProtocol(f)
+	if required > ipcProtocolVersion {
+		return &ScriptIncompatibleError{Required: required, Supported: ipcProtocolVersion}
+	}
+	return nil
+}
+
+// scriptMetaPath is the sidecar holding the validators of an installed
+// script.
+func scriptMetaPath(dest string) string {
+	return dest + ".meta.json"
+}
+
+// loadScriptMeta returns the recorded validators for dest. They are only
+// trusted while dest itself exists.
+func loadScriptMeta(dest string) *conditionalMeta {
+	meta := &conditionalMeta{}
+	if _, err := os.Stat(dest); err != nil {
+		return meta
+	}
+	data, err := os.ReadFile(scriptMetaPath(dest))
+	if err == nil {
+		_ = json.Unmarshal(data, meta)
+	}
+	return meta
+}
+
+func saveScriptMeta(dest string, meta *conditionalMeta) {
+	data, err := json.Marshal(meta)
+	if err == nil {
+		err = os.WriteFile(scriptMetaPath(dest), data, 0o644)
+	}
+	if err != nil {
+		log.Printf("Could not record validators for %s: %v", dest, err)
+	}
+}
+
+// installLuaScript downloads a script, conditionally on the validators of
+// the installed one, and only replaces dest when the new script differs
+// and is compatible. An incompatible script is still installed when no
+// script exists yet, since there is nothing working to keep. updated
+// reports whether dest changed.
+func installLuaScript(
+	fetch func(url, dest string, meta *conditionalMeta) error,
+	url, dest string,
+) (updated bool, err error) {
+	meta := loadScriptMeta(dest)
+	tmp := dest + ".new"
+	if err := fetch(url, tmp, meta); errors.Is(err, errNotModified) {
+		debugf("Lua script %s not modified", dest)
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if same, _ := sameContents(tmp, dest); same {
+		_ = os.Remove(tmp)
+		saveScriptMeta(dest, meta)
+		return false, nil
+	}
+	if err := checkScriptCompatible(tmp); err != nil {
+		if _, statErr := os.Stat(dest); statErr == nil {
+			_ = os.Remove(tmp)
+			return false, fmt.Errorf("kept existing %s: %w", dest, err)
+		}
+		log.Printf("WARNING: installing %s with no fallback: %v", dest, err)
+	}
+	if err := replaceFile(tmp, dest); err != nil {
+		return false, err
+	}
+	saveScriptMeta(dest, meta)
+	return true, nil
+}
+
+// sameContents reports whether two files have identical contents.
+func sameContents(a, b string) (bool, error) {
+	x, err := os.ReadFile(a)
+	if err != nil {
+		return false, err
+	}
+	y, err := os.ReadFile(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(x, y), nil
+}
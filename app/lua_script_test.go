@@ -0,0 +1,134 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseScriptProtocolFixtures(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		want     int
+		declared bool
+	}{
+		{"undeclared.lua", 1, false},
+		{"protocol2.lua", 2, true},
+		{"protocol3.lua", 3, true},
+		{"crlf_spaced.lua", 2, true},
+		// Only the first five lines are read.
+		{"late_declaration.lua", 1, false},
+	}
+	for _, tt := range tests {
+		f, err := os.Open(filepath.Join("testdata", "lua", tt.fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, declared := parseScriptProtocol(f)
+		f.Close()
+		if got != tt.want || declared != tt.declared {
+			t.Errorf("%s: protocol %d, declared %v; want %d, %v", tt.fixture, got, declared, tt.want, tt.declared)
+		}
+	}
+}
+
+func TestParseHelloProtocol(t *testing.T) {
+	tests := []struct {
+		fields []string
+		want   int
+	}{
+		{nil, 1},
+		{[]string{"caps=save,swap"}, 1},
+		{[]string{"protocol=2|caps=save"}, 2},
+		{[]string{"caps=save", "protocol=3"}, 3},
+		{[]string{"protocol=two"}, 1},
+	}
+	for _, tt := range tests {
+		if got := parseHelloProtocol(tt.fields); got != tt.want {
+			t.Errorf("parseHelloProtocol(%q) = %d; want %d", tt.fields, got, tt.want)
+		}
+	}
+}
+
+// fixtureFetch serves a testdata/lua fixture as the download, recording
+// the validators it was asked with and returning them updated.
+func fixtureFetch(t *testing.T, fixture string, sent **conditionalMeta) func(url, dest string, meta *conditionalMeta) error {
+	return func(url, dest string, meta *conditionalMeta) error {
+		sentMeta := *meta
+		*sent = &sentMeta
+		if fixture == "" {
+			return errNotModified
+		}
+		data, err := os.ReadFile(filepath.Join("testdata", "lua", fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		meta.ETag = `"` + fixture + `"`
+		return os.WriteFile(dest, data, 0o644)
+	}
+}
+
+func TestInstallLuaScript(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "relay.lua")
+	var sent *conditionalMeta
+	install := func(fixture string) (bool, error) {
+		return installLuaScript(fixtureFetch(t, fixture, &sent), "https://example.com/relay.lua", dest)
+	}
+	installed := func() string {
+		data, _ := os.ReadFile(dest)
+		return string(data)
+	}
+	fixture := func(name string) string {
+		data, _ := os.ReadFile(filepath.Join("testdata", "lua", name))
+		return string(data)
+	}
+
+	// With nothing installed, even a too-new script goes in.
+	if updated, err := install("protocol3.lua"); !updated || err != nil {
+		t.Fatalf("first install = %v, %v", updated, err)
+	}
+	if installed() != fixture("protocol3.lua") {
+		t.Error("incompatible first script not installed")
+	}
+
+	if updated, err := install("protocol2.lua"); !updated || err != nil {
+		t.Fatalf("compatible update = %v, %v", updated, err)
+	}
+	if sent.ETag != `"protocol3.lua"` {
+		t.Errorf("update sent validators %+v; want the installed script's", sent)
+	}
+
+	// A too-new script does not replace a working one.
+	updated, err := install("protocol3.lua")
+	var incompatible *ScriptIncompatibleError
+	if updated || !errors.As(err, &incompatible) || incompatible.Required != 3 || incompatible.Supported != ipcProtocolVersion {
+		t.Errorf("incompatible update = %v, %v; want a ScriptIncompatibleError", updated, err)
+	}
+	if installed() != fixture("protocol2.lua") {
+		t.Error("incompatible update replaced the working script")
+	}
+	if _, err := os.Stat(dest + ".new"); !os.IsNotExist(err) {
+		t.Errorf("download left behind: %v", err)
+	}
+
+	// Identical and unmodified downloads change nothing.
+	if updated, err := install("protocol2.lua"); updated || err != nil {
+		t.Errorf("identical download = %v, %v", updated, err)
+	}
+	if updated, err := install(""); updated || err != nil {
+		t.Errorf("304 = %v, %v", updated, err)
+	}
+	if sent.ETag != `"protocol2.lua"` {
+		t.Errorf("conditional request sent %+v", sent)
+	}
+
+	// Validators are ignored once the script itself is gone.
+	_ = os.Remove(dest)
+	if updated, err := install("undeclared.lua"); !updated || err != nil {
+		t.Errorf("reinstall = %v, %v", updated, err)
+	}
+	if sent.ETag != "" {
+		t.Errorf("reinstall sent stale validators %+v", sent)
+	}
+}
@@ -0,0 +1,191 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const manifestFile = "session_manifest.json"
+
+// ManifestGame is a single game entry from the session's join response.
+type ManifestGame struct {
+	ID        int     `json:"id"`
+	File      string  `json:"file"`
+	ExtraFile *string `json:"extra_file,omitempty"`
+
+	// Expected hashes of File and ExtraFile; empty when the server does
+	// not send them, in which case files are only checked for presence.
+	SHA256      string `json:"sha256,omitempty"`
+	ExtraSHA256 string `json:"extra_sha256,omitempty"`
+
+	DisplayName string `json:"display_name,omitempty"`
+	Platform    string `json:"platform,omitempty"`
+
+	// ConvertTo asks for the entry's .chd disc to be converted (only
+	// "cue" is supported) before BizHawk loads it; ConvertedSHA256 is the
+	// expected hash of the resulting .bin.
+	ConvertTo       string `json:"convert_to,omitempty"`
+	ConvertedSHA256 string `json:"converted_sha256,omitempty"`
+}
+
+// SessionManifest is the locally cached list of games in the joined session.
+type SessionManifest struct {
+	SessionName string         `json:"session_name"`
+	Games       []ManifestGame `json:"games"`
+
+	// RoundLengthSeconds is the session's nominal time between swaps, or
+	// 0 if the server does not say.
+	RoundLengthSeconds int `json:"round_length_seconds,omitempty"`
+
+	// BizHawk is the release the session's cores need, or nil for the
+	// configured default.
+	BizHawk *BizHawkRequirement `json:"bizhawk,omitempty"`
+
+	// LocalNames maps canonical file names to shortened on-disk names
+	// for files whose path would exceed the Windows path limit.
+	LocalNames map[string]string `json:"local_names,omitempty"`
+}
+
+// GameRef identifies a game in an event payload. Producers may send the
+// filename, the server game id, or an index into the session manifest.
+type GameRef struct {
+	File  string `json:"new_game"`
+	ID    *int   `json:"game_id"`
+	Index *int   `json:"game_index"`
+}
+
+// IsZero reports whether no form of game reference was provided.
+func (r GameRef) IsZero() bool {
+	return r.File == "" && r.ID == nil && r.Index == nil
+}
+
+func (r GameRef) String() string {
+	switch {
+	case r.File != "":
+		return fmt.Sprintf("file %q", r.File)
+	case r.ID != nil:
+		return fmt.Sprintf("id %d", *r.ID)
+	case r.Index != nil:
+		return fmt.Sprintf("index %d", *r.Index)
+	default:
+		return "empty reference"
+	}
+}
+
+// Files returns every file (including extra files) the session needs.
+func (m *SessionManifest) Files() []string {
+	var files []string
+	for _, g := range m.Games {
+		files = append(files, g.File)
+		if g.ExtraFile != nil {
+			files = append(files, *g.ExtraFile)
+		}
+	}
+	return files
+}
+
+// Checksum returns the expected SHA-256 of a file from Files, or "" if
+// the server did not provide one.
+func (m *SessionManifest) Checksum(file string) string {
+	if m == nil {
+		return ""
+	}
+	for _, g := range m.Games {
+		switch {
+		case g.File == file:
+			return g.SHA256
+		case g.ExtraFile != nil && *g.ExtraFile == file:
+			return g.ExtraSHA256
+		}
+	}
+	return ""
+}
+
+// UnlistedGameError is returned for a swap target that is not part of the
+// joined session.
+type UnlistedGameError struct {
+	Game    string
+	Session string
+}
+
+func (e *UnlistedGameError) Error() string {
+	return fmt.Sprintf("game %q is not part of session %q", e.Game, e.Session)
+}
+
+// Contains reports whether file is one of the session's games, comparing
+// names case-insensitively. A missing manifest contains nothing.
+func (m *SessionManifest) Contains(file string) bool {
+	if m == nil {
+		return false
+	}
+	for _, g := range m.Games {
+		if strings.EqualFold(g.File, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve maps a game reference to its canonical filename.
+// A filename is accepted as-is when there is no manifest to check against.
+func (m *SessionManifest) Resolve(ref GameRef) (string, error) {
+	if ref.File != "" {
+		return ref.File, nil
+	}
+	if m == nil {
+		return "", fmt.Errorf("cannot resolve game %s: no session manifest", ref)
+	}
+	switch {
+	case ref.ID != nil:
+		for _, g := range m.Games {
+			if g.ID == *ref.ID {
+				return g.File, nil
+			}
+		}
+		return "", fmt.Errorf(
+			"cannot resolve game %s: not in manifest for session %q",
+			ref, m.SessionName,
+		)
+	case ref.Index != nil:
+		i := *ref.Index
+		if i < 0 || i >= len(m.Games) {
+			return "", fmt.Errorf(
+				"cannot resolve game %s: manifest has %d games",
+				ref, len(m.Games),
+			)
+		}
+		return m.Games[i].File, nil
+	default:
+		return "", fmt.Errorf("cannot resolve game: %s", ref)
+	}
+}
+
+// SaveManifest writes the manifest to disk.
+func SaveManifest(m *SessionManifest, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// LoadManifest reads a previously saved manifest.
+func LoadManifest(path string) (*SessionManifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var m SessionManifest
+	if err := json.NewDecoder(f).Decode(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
@@ -0,0 +1,101 @@
+package app
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testManifest() *SessionManifest {
+	return &SessionManifest{
+		SessionName: "relay",
+		Games: []ManifestGame{
+			{ID: 11, File: "mario.nes", SHA256: "aa"},
+			{ID: 42, File: "zelda.sfc"},
+			{ID: 7, File: "sonic.md"},
+		},
+	}
+}
+
+func TestGameRefPayloads(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    string
+	}{
+		{`{"new_game":"zelda.sfc"}`, "zelda.sfc"},
+		{`{"game_id":42}`, "zelda.sfc"},
+		{`{"game_index":2}`, "sonic.md"},
+		{`{"game_index":0}`, "mario.nes"},
+		// The filename wins over the other forms.
+		{`{"new_game":"mario.nes","game_id":42}`, "mario.nes"},
+	}
+	m := testManifest()
+	for _, tt := range tests {
+		var ref GameRef
+		if err := json.Unmarshal([]byte(tt.payload), &ref); err != nil {
+			t.Fatalf("unmarshal %s: %v", tt.payload, err)
+		}
+		if ref.IsZero() {
+			t.Errorf("%s: IsZero() = true", tt.payload)
+		}
+		got, err := m.Resolve(ref)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: Resolve = %q, %v; want %q", tt.payload, got, err, tt.want)
+		}
+	}
+}
+
+func TestResolveUnknown(t *testing.T) {
+	id, index, negative := 99, 3, -1
+	tests := []struct {
+		name     string
+		manifest *SessionManifest
+		ref      GameRef
+		wantErr  string
+	}{
+		{"unknown id", testManifest(), GameRef{ID: &id}, `not in manifest for session "relay"`},
+		{"index past end", testManifest(), GameRef{Index: &index}, "manifest has 3 games"},
+		{"negative index", testManifest(), GameRef{Index: &negative}, "manifest has 3 games"},
+		{"empty reference", testManifest(), GameRef{}, "empty reference"},
+		{"no manifest", nil, GameRef{ID: &id}, "no session manifest"},
+	}
+	for _, tt := range tests {
+		got, err := tt.manifest.Resolve(tt.ref)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: Resolve = %q, %v; want error containing %q", tt.name, got, err, tt.wantErr)
+		}
+	}
+}
+
+func TestResolveFileWithoutManifest(t *testing.T) {
+	var m *SessionManifest
+	got, err := m.Resolve(GameRef{File: "any.gb"})
+	if err != nil || got != "any.gb" {
+		t.Errorf("Resolve = %q, %v; want %q", got, err, "any.gb")
+	}
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), manifestFile)
+	if err := SaveManifest(testManifest(), path); err != nil {
+		t.Fatal(err)
+	}
+	m, err := LoadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Ids and order must survive persistence for game_id and game_index
+	// to resolve after a restart.
+	id := 42
+	if got, err := m.Resolve(GameRef{ID: &id}); err != nil || got != "zelda.sfc" {
+		t.Errorf("Resolve(id 42) after reload = %q, %v", got, err)
+	}
+	index := 2
+	if got, err := m.Resolve(GameRef{Index: &index}); err != nil || got != "sonic.md" {
+		t.Errorf("Resolve(index 2) after reload = %q, %v", got, err)
+	}
+	if m.SessionName != "relay" || m.Checksum("mario.nes") != "aa" {
+		t.Errorf("reloaded manifest = %+v", m)
+	}
+}
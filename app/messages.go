@@ -0,0 +1,130 @@
+package app
+
+import (
+	"log"
+	"sort"
+	"strings"
+)
+
+// Keys of client-originated overlay and notification text. Hosts override
+// them with the "messages" map in config.json; an empty string disables
+// a message entirely.
+const (
+	MsgWelcome            = "welcome"
+	MsgKicked             = "kicked"
+	MsgSessionEnded       = "session_ended"
+	MsgSwapMissingGame    = "swap_missing_game"
+	MsgSwapSaveMismatch   = "swap_save_mismatch"
+	MsgROMLocked          = "rom_locked"
+	MsgScriptIncompatible = "script_incompatible"
+	MsgSaveKeyMismatch    = "save_key_mismatch"
+	MsgTokenInUse         = "token_in_use"
+	MsgReadyCheck         = "ready_check"
+	MsgReadyCheckTimeout  = "ready_check_timeout"
+	MsgServerRestarting   = "server_restarting"
+	MsgDiskLow            = "disk_low"
+	MsgHardcoreOn         = "hardcore_on"
+	MsgHardcoreOff        = "hardcore_off"
+	MsgSpectating         = "spectating"
+	MsgPlayingAgain       = "playing_again"
+
+	MsgRecoveredFromSleep = "recovered_from_sleep"
+	MsgReconnected        = "reconnected"
+	MsgRecoveryMissedSwap = "recovery_missed_swap"
+	MsgRecoveryNewState   = "recovery_new_state"
+	MsgRecoveryNoChange   = "recovery_no_change"
+
+	MsgNotifySwapFailed    = "notify_swap_failed"
+	MsgNotifySwapBlocked   = "notify_swap_blocked"
+	MsgNotifyKicked        = "notify_kicked"
+	MsgNotifyGameState     = "notify_game_state"
+	MsgNotifyScheduledAt   = "notify_scheduled_at"
+	MsgNotifyTokenInUse    = "notify_token_in_use"
+	MsgNotifyDisconnected  = "notify_disconnected"
+	MsgNotifyDisconnectMsg = "notify_disconnected_body"
+	MsgNotifyDiskLow       = "notify_disk_low"
+)
+
+var defaultMessages = map[string]string{
+	MsgWelcome:            "Welcome",
+	MsgKicked:             "Kicked: {reason}",
+	MsgSessionEnded:       "Session ended",
+	MsgSwapMissingGame:    "Swap failed: missing {game}",
+	MsgSwapSaveMismatch:   "Swap blocked: save mismatch",
+	MsgROMLocked:          "ROM in use, not replaced: {game}",
+	MsgScriptIncompatible: "Script update needs protocol {required} (client has {supported})",
+	MsgSaveKeyMismatch:    "Save passphrase mismatch: {file}",
+	MsgTokenInUse:         "Token in use on another PC!",
+	MsgReadyCheck:         "READY CHECK: press the ready hotkey ({seconds}s)",
+	MsgReadyCheckTimeout:  "Ready check timed out",
+	MsgServerRestarting:   "Server restarting, back in {seconds}s",
+	MsgDiskLow:            "Low disk space: {free} free (floor {floor})",
+	MsgHardcoreOn:         "Hardcore mode: pause and savestates are locked",
+	MsgHardcoreOff:        "Hardcore mode off",
+	MsgSpectating:         "You are now spectating; your final save was uploaded",
+	MsgPlayingAgain:       "You are a player again",
+
+	MsgRecoveredFromSleep: "Resumed from sleep",
+	MsgReconnected:        "Reconnected",
+	MsgRecoveryMissedSwap: "{prefix}: missed swap to {game}",
+	MsgRecoveryNewState:   "{prefix}: game is now {state}",
+	MsgRecoveryNoChange:   "{prefix}: nothing missed",
+
+	MsgNotifySwapFailed:    "Swap failed",
+	MsgNotifySwapBlocked:   "Swap blocked",
+	MsgNotifyKicked:        "Kicked from session",
+	MsgNotifyGameState:     "Game {state}",
+	MsgNotifyScheduledAt:   "Scheduled for {time}",
+	MsgNotifyTokenInUse:    "Token in use elsewhere",
+	MsgNotifyDisconnected:  "Disconnected",
+	MsgNotifyDisconnectMsg: "Lost connection to the game server for over {seconds} seconds.",
+	MsgNotifyDiskLow:       "Low disk space",
+}
+
+// MsgVars are the template variables substituted into a message.
+type MsgVars map[string]string
+
+// MessageCatalog renders client-originated text from defaults and config
+// overrides.
+type MessageCatalog struct {
+	texts map[string]string
+}
+
+// messages is the active catalog; NewApp replaces it once config is loaded.
+var messages = NewMessageCatalog(nil)
+
+// NewMessageCatalog layers overrides over the defaults. Unknown keys are
+// logged, since they are almost always typos.
+func NewMessageCatalog(overrides map[string]string) *MessageCatalog {
+	texts := make(map[string]string, len(defaultMessages))
+	for k, v := range defaultMessages {
+		texts[k] = v
+	}
+	var unknown []string
+	for k, v := range overrides {
+		if _, ok := defaultMessages[k]; !ok {
+			unknown = append(unknown, k)
+			continue
+		}
+		texts[k] = v
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		log.Printf("Ignoring unknown message keys in config: %s", strings.Join(unknown, ", "))
+	}
+	return &MessageCatalog{texts: texts}
+}
+
+// Render expands {name} placeholders from vars. Unknown placeholders are
+// left as written. It returns "" when the message is disabled.
+func (c *MessageCatalog) Render(key string, vars MsgVars) string {
+	tmpl := c.texts[key]
+	if tmpl == "" || len(vars) == 0 {
+		return tmpl
+	}
+	pairs := make([]string, 0, 2*len(vars))
+	for k, v := range vars {
+		pairs = append(pairs, "{"+k+"}", v)
+	}
+	return strings.NewReplacer(pairs...).Replace(tmpl)
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMessageCatalogRender(t *testing.T) {
+	c := NewMessageCatalog(map[string]string{
+		MsgWelcome:      "Hi {player}, {unknown} stays",
+		MsgSessionEnded: "",
+		"no_such_key":   "typo",
+	})
+	tests := []struct {
+		name string
+		key  string
+		vars MsgVars
+		want string
+	}{
+		{"default", MsgROMLocked, MsgVars{"game": "mario.nes"}, "ROM in use, not replaced: mario.nes"},
+		{"default without vars", MsgHardcoreOff, nil, "Hardcore mode off"},
+		{"override", MsgWelcome, MsgVars{"player": "Sam"}, "Hi Sam, {unknown} stays"},
+		// Substituted values are not expanded again.
+		{"value with braces", MsgWelcome, MsgVars{"player": "{unknown}"}, "Hi {unknown}, {unknown} stays"},
+		{"disabled", MsgSessionEnded, nil, ""},
+		{"unknown key", "no_such_key", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := c.Render(tt.key, tt.vars); got != tt.want {
+			t.Errorf("%s: Render(%q) = %q; want %q", tt.name, tt.key, got, tt.want)
+		}
+	}
+	// Overrides do not leak into the defaults.
+	if got := NewMessageCatalog(nil).Render(MsgSessionEnded, nil); got == "" {
+		t.Error("default catalog lost the session_ended text")
+	}
+}
+
+func TestSendMessageIsFrameSafe(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	b, _ := startTestIPC(t, func(id, cmd string) string {
+		mu.Lock()
+		got = append(got, cmd)
+		mu.Unlock()
+		return "ACK|" + id
+	})
+	old := messages
+	messages = NewMessageCatalog(map[string]string{MsgKicked: "", MsgWelcome: "Welcome {player}"})
+	t.Cleanup(func() { messages = old })
+
+	b.SendMessage("server says|PAUSE\nnow")
+	b.SendText(MsgKicked, nil)
+	b.SendText(MsgWelcome, MsgVars{"player": "a|b"})
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"MSG|server says/PAUSEnow", "MSG|Welcome a/b"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("sent %q; want %q with the disabled message skipped", got, want)
+	}
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const maxNameLength = 64
+
+// validateName applies the rules shared by player and session names:
+// non-empty, bounded length, printable, and no path separators (names end
+// up in URL path segments and, for sessions, local file names).
+func validateName(kind, name string) error {
+	if name == "" {
+		return fmt.Errorf("%s name must not be empty", kind)
+	}
+	if utf8.RuneCountInString(name) > maxNameLength {
+		return fmt.Errorf("%s name is longer than %d characters", kind, maxNameLength)
+	}
+	if strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("%s name must not contain '/' or '\\'", kind)
+	}
+	for _, r := range name {
+		if !unicode.IsPrint(r) {
+			return fmt.Errorf("%s name contains a non-printable character", kind)
+		}
+	}
+	return nil
+}
+
+// canonicalName folds case and runs of whitespace so a display name such
+// as "Alice  Smith" matches the server's canonical "alice smith".
+func canonicalName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+func validateSessionName(name string) error {
+	return validateName("session", name)
+}
+
+// validateROMName rejects game file names that are not a single path
+// element. They become local file paths under the ROM directory as well as
+// URL path segments, so a separator or ".." could escape either.
+func validateROMName(file string) error {
+	switch {
+	case file == "", file == ".", file == "..":
+		return fmt.Errorf("invalid game file name %q", file)
+	case strings.ContainsAny(file, "/\\\x00"):
+		return fmt.Errorf("game file name %q must not contain a path separator", file)
+	}
+	return nil
+}
+
+// romURL is the download URL of a game file, with the name escaped so
+// spaces, '#', '?' and '%' reach the server intact.
+func romURL(serverURL, file string) (string, error) {
+	if err := validateROMName(file); err != nil {
+		return "", err
+	}
+	return serverURL + "/api/roms/" + url.PathEscape(file), nil
+}
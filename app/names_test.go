@@ -0,0 +1,116 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestValidateROMName(t *testing.T) {
+	for _, ok := range []string{"mario.nes", "Zelda #3 (50% off?).sfc", "..hidden.nes", "a..b.md", "ゼルダ.sfc"} {
+		if err := validateROMName(ok); err != nil {
+			t.Errorf("validateROMName(%q) = %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"", ".", "..", "../config.json", "roms/mario.nes", `..\bizhawk\EmuHawk.exe`, "mario.nes\x00.txt", "/etc/passwd"} {
+		if err := validateROMName(bad); err == nil {
+			t.Errorf("validateROMName(%q) accepted", bad)
+		}
+	}
+}
+
+// escapingServer serves rawBody for any ROM and records the raw request
+// URIs, to show what reached the server before decoding.
+func escapingServer(t *testing.T) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var uris []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		uris = append(uris, r.RequestURI)
+		mu.Unlock()
+		_, _ = w.Write([]byte(romBytes))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(uris)
+	}
+}
+
+// TestROMDownloadsEscapeNames runs each path that downloads a game with a
+// name needing escaping, and one that must be refused before any request.
+func TestROMDownloadsEscapeNames(t *testing.T) {
+	const name = "Zelda #3 (50% off?).sfc"
+	const escaped = "/api/roms/Zelda%20%233%20%2850%25%20off%3F%29.sfc"
+	const evil = "../evil.sfc"
+
+	paths := []struct {
+		name     string
+		download func(t *testing.T, serverURL, romDir, file string) error
+	}{
+		{"download_rom event", func(t *testing.T, serverURL, romDir, file string) error {
+			f := newHandlerFixture(t)
+			f.cfg.ServerURL, f.cfg.RomDir = serverURL, romDir
+			f.dispatch("download_rom", `{"file":`+strconv.Quote(file)+`}`)
+			if len(f.server.acks) != 1 || f.server.acks[0].Outcome != AckSuccess {
+				return fmt.Errorf("acks %+v", f.server.acks)
+			}
+			return nil
+		}},
+		{"swap retry", func(t *testing.T, serverURL, romDir, file string) error {
+			f := newHandlerFixture(t)
+			f.cfg.ServerURL, f.cfg.RomDir = serverURL, romDir
+			return f.h.fetchROM(DownloadUrgent, file)
+		}},
+		{"prefetch", func(t *testing.T, serverURL, romDir, file string) error {
+			cfg := &Config{ServerURL: serverURL, RomDir: romDir}
+			return prefetchGame(NewDownloadManager(http.DefaultClient, NewClientState(), cfg), cfg, LibraryGame{File: file})
+		}},
+		{"bootstrap", func(t *testing.T, serverURL, romDir, file string) error {
+			withRomHashes(t)
+			cfg := &Config{ServerURL: serverURL, RomDir: romDir, BearerToken: "t"}
+			m := &SessionManifest{Games: []ManifestGame{{ID: 1, File: file}}}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			return downloadMissingGames(ctx, cfg, NewClientState(), NewAPI(cfg), m)[file]
+		}},
+	}
+	for _, p := range paths {
+		t.Run(p.name, func(t *testing.T) {
+			root := t.TempDir()
+			romDir := filepath.Join(root, "roms")
+			fakeScanner(t, romDir, func(string, int) {})
+			srv, uris := escapingServer(t)
+
+			if err := p.download(t, srv.URL, romDir, name); err != nil {
+				t.Fatal(err)
+			}
+			if got := uris(); len(got) != 1 || got[0] != escaped {
+				t.Errorf("requests %q; want one for %s", got, escaped)
+			}
+			if data, err := os.ReadFile(filepath.Join(romDir, name)); err != nil || string(data) != romBytes {
+				t.Errorf("%s: %v", name, err)
+			}
+
+			if err := p.download(t, srv.URL, romDir, evil); err == nil {
+				t.Errorf("%s accepted", evil)
+			}
+			if got := uris(); len(got) != 1 {
+				t.Errorf("unsafe name requested: %q", got[1:])
+			}
+			if _, err := os.Stat(filepath.Join(root, "evil.sfc")); !os.IsNotExist(err) {
+				t.Errorf("file written outside the ROM directory: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bareHost strips the brackets from an IPv6 literal ("[::1]" -> "::1").
+func bareHost(host string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
+// urlHost returns host in the form that can precede ":port" in a URL,
+// bracketing IPv6 literals. Names and IPv4 literals are returned as-is.
+func urlHost(host string) string {
+	h := bareHost(host)
+	if ip := net.ParseIP(h); ip != nil && ip.To4() == nil {
+		return "[" + h + "]"
+	}
+	return h
+}
+
+// hostPort joins a host (bracketed or not) and port for dialing or URLs.
+func hostPort(host string, port int) string {
+	return net.JoinHostPort(bareHost(host), strconv.Itoa(port))
+}
+
+// familyProbe is the result of dialing the server over one address family.
+type familyProbe struct {
+	Network string
+	Addrs   []string
+	Err     error
+	RTT     time.Duration
+}
+
+// probeFamilies resolves host and dials it separately over IPv4 and IPv6,
+// so the doctor can tell a broken family apart from a down server.
+func probeFamilies(ctx context.Context, host string, port int) []familyProbe {
+	ips, lookupErr := net.DefaultResolver.LookupIPAddr(ctx, bareHost(host))
+	var probes []familyProbe
+	for _, network := range []string{"tcp4", "tcp6"} {
+		p := familyProbe{Network: network}
+		for _, ip := range ips {
+			if (ip.IP.To4() != nil) == (network == "tcp4") {
+				p.Addrs = append(p.Addrs, ip.String())
+			}
+		}
+		switch {
+		case lookupErr != nil:
+			p.Err = lookupErr
+		case len(p.Addrs) == 0:
+			p.Err = fmt.Errorf("no %s address", map[string]string{"tcp4": "A", "tcp6": "AAAA"}[network])
+		default:
+			var d net.Dialer
+			dctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			start := time.Now()
+			conn, err := d.DialContext(dctx, network, hostPort(p.Addrs[0], port))
+			cancel()
+			p.RTT = time.Since(start)
+			if err != nil {
+				p.Err = err
+			} else {
+				conn.Close()
+			}
+		}
+		probes = append(probes, p)
+	}
+	return probes
+}
@@ -0,0 +1,106 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newIPv6Server starts h on [::1], skipping the test on hosts without
+// IPv6 loopback.
+func newIPv6Server(t *testing.T, h http.Handler) (*httptest.Server, int) {
+	t.Helper()
+	ln, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("no IPv6 loopback: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(h)
+	srv.Listener.Close()
+	srv.Listener = ln
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv, ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestHostForms(t *testing.T) {
+	tests := []struct {
+		host      string
+		bare, url string
+		joined    string
+	}{
+		{"::1", "::1", "[::1]", "[::1]:80"},
+		{"[::1]", "::1", "[::1]", "[::1]:80"},
+		{"fe80::1%eth0", "fe80::1%eth0", "fe80::1%eth0", "[fe80::1%eth0]:80"},
+		{"127.0.0.1", "127.0.0.1", "127.0.0.1", "127.0.0.1:80"},
+		{"example.com", "example.com", "example.com", "example.com:80"},
+	}
+	for _, tt := range tests {
+		if got := bareHost(tt.host); got != tt.bare {
+			t.Errorf("bareHost(%q) = %q; want %q", tt.host, got, tt.bare)
+		}
+		if got := urlHost(tt.host); got != tt.url {
+			t.Errorf("urlHost(%q) = %q; want %q", tt.host, got, tt.url)
+		}
+		if got := hostPort(tt.host, 80); got != tt.joined {
+			t.Errorf("hostPort(%q) = %q; want %q", tt.host, got, tt.joined)
+		}
+	}
+}
+
+func TestAPIOverIPv6(t *testing.T) {
+	_, port := newIPv6Server(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"server_time_ms":1700000000000}`)
+	}))
+	for _, host := range []string{"::1", "[::1]"} {
+		cfg := &Config{ServerScheme: "http", ServerHost: host, ServerPort: port, BearerToken: "t"}
+		cfg.ComputeURLs()
+		if want := "http://[::1]:" + strconv.Itoa(port); cfg.ServerURL != want {
+			t.Errorf("host %q: ServerURL = %s; want %s", host, cfg.ServerURL, want)
+		}
+		got, err := NewAPI(cfg).ServerTime(context.Background())
+		if err != nil || got.UnixMilli() != 1700000000000 {
+			t.Errorf("host %q: ServerTime = %v, %v", host, got, err)
+		}
+	}
+}
+
+func TestStatusServerOverIPv6(t *testing.T) {
+	if got := statusAddr(&Config{BizhawkIPCHost: "[::1]", StatusPort: 55356}); got != "[::1]:55356" {
+		t.Errorf("statusAddr([::1]) = %s", got)
+	}
+	s, _, _ := newTestStatusServer(t, testControlToken)
+	srv, _ := newIPv6Server(t, s.Handler())
+
+	resp, err := http.Get(srv.URL + "/api/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"current_game":"mario.nes"`) {
+		t.Errorf("GET %s/api/status = %s %s", srv.URL, resp.Status, body)
+	}
+}
+
+func TestProbeFamiliesIPv6Only(t *testing.T) {
+	_, port := newIPv6Server(t, http.NotFoundHandler())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	probes := probeFamilies(ctx, "[::1]", port)
+	if len(probes) != 2 {
+		t.Fatalf("probes = %+v", probes)
+	}
+	if p := probes[0]; p.Network != "tcp4" || p.Err == nil || !strings.Contains(p.Err.Error(), "no A address") {
+		t.Errorf("tcp4 probe = %+v; want no A address", p)
+	}
+	if p := probes[1]; p.Network != "tcp6" || p.Err != nil || len(p.Addrs) != 1 || p.Addrs[0] != "::1" {
+		t.Errorf("tcp6 probe = %+v; want a connection to ::1", p)
+	}
+}
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Notifier delivers important events outside the emulator window.
+type Notifier interface {
+	Notify(kind NotifyKind, title, body string)
+}
+
+// NotifyKind classifies events worth interrupting the player for.
+type NotifyKind string
+
+const (
+	NotifyKicked         NotifyKind = "kicked"
+	NotifySessionStart   NotifyKind = "session_start"
+	NotifyDisconnected   NotifyKind = "disconnected"
+	NotifySwapFailed     NotifyKind = "swap_failed"
+	NotifyInstanceClash  NotifyKind = "instance_conflict"
+	NotifyDiskLow        NotifyKind = "disk_low"
+	disconnectNotifyWait            = 30 * time.Second
+)
+
+// nopNotifier discards everything; used when notifications are disabled.
+type nopNotifier struct{}
+
+func (nopNotifier) Notify(NotifyKind, string, string) {}
+
+// rateLimitedNotifier forwards at most one notification per kind per
+// interval so a failure loop cannot spam the desktop.
+type rateLimitedNotifier struct {
+	next     Notifier
+	interval time.Duration
+	now      func() time.Time
+
+	mu   sync.Mutex
+	last map[NotifyKind]time.Time
+}
+
+func newRateLimitedNotifier(next Notifier, interval time.Duration) *rateLimitedNotifier {
+	return &rateLimitedNotifier{
+		next:     next,
+		interval: interval,
+		now:      time.Now,
+		last:     make(map[NotifyKind]time.Time),
+	}
+}
+
+// Notify drops notifications whose title the host disabled in the message
+// catalog without using up the kind's rate-limit slot.
+func (r *rateLimitedNotifier) Notify(kind NotifyKind, title, body string) {
+	if title == "" {
+		return
+	}
+	r.mu.Lock()
+	now := r.now()
+	if last, ok := r.last[kind]; ok && now.Sub(last) < r.interval {
+		r.mu.Unlock()
+		return
+	}
+	r.last[kind] = now
+	r.mu.Unlock()
+	r.next.Notify(kind, title, body)
+}
+
+// desktopNotifier shows OS-level notifications. Failures are logged once
+// and otherwise ignored, since not every platform has a notification daemon.
+type desktopNotifier struct {
+	failOnce sync.Once
+}
+
+func (d *desktopNotifier) Notify(kind NotifyKind, title, body string) {
+	go func() {
+		if err := showDesktopNotification(title, body); err != nil {
+			d.failOnce.Do(func() {
+				log.Printf("Desktop notifications unavailable: %v", err)
+			})
+		}
+	}()
+}
+
+// NewNotifier builds the configured notifier.
+func NewNotifier(cfg *Config) Notifier {
+	if !cfg.DesktopNotifications {
+		return nopNotifier{}
+	}
+	return newRateLimitedNotifier(&desktopNotifier{}, 10*time.Second)
+}
+
+// watchDisconnects notifies when the client stays disconnected for longer
+// than wait.
+func watchDisconnects(state *ClientState, n Notifier, wait time.Duration, done <-chan struct{}) {
+	events := state.Subscribe(8)
+	defer state.Unsubscribe(events)
+
+	var timer *time.Timer
+	var fire <-chan time.Time
+	for {
+		select {
+		case <-done:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case ev := <-events:
+			switch ev.Type {
+			case EventDisconnected:
+				if timer == nil {
+					timer = time.NewTimer(wait)
+					fire = timer.C
+				}
+			case EventConnected:
+				if timer != nil {
+					timer.Stop()
+					timer, fire = nil, nil
+				}
+			}
+		case <-fire:
+			// An announced server restart is expected downtime; only
+			// alarm if we are still disconnected once it is over.
+			if g := state.Grace(); g != nil && g.Window == GraceServerRestart {
+				timer = time.NewTimer(time.Until(g.Until))
+				fire = timer.C
+				continue
+			}
+			timer, fire = nil, nil
+			n.Notify(
+				NotifyDisconnected,
+				messages.Render(MsgNotifyDisconnected, nil),
+				messages.Render(MsgNotifyDisconnectMsg, MsgVars{
+					"seconds": strconv.Itoa(int(wait.Seconds())),
+				}),
+			)
+		}
+	}
+}
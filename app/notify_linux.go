@@ -0,0 +1,10 @@
+//go:build linux
+
+package app
+
+import "os/exec"
+
+// showDesktopNotification uses the freedesktop notify-send helper.
+func showDesktopNotification(title, body string) error {
+	return exec.Command("notify-send", "--app-name=Game Client", title, body).Run()
+}
@@ -0,0 +1,9 @@
+//go:build !windows && !linux
+
+package app
+
+import "fmt"
+
+func showDesktopNotification(title, body string) error {
+	return fmt.Errorf("desktop notifications not supported on this platform")
+}
@@ -0,0 +1,191 @@
+package app
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSink records the kinds of the notifications it is given.
+type fakeSink struct {
+	mu    sync.Mutex
+	kinds []NotifyKind
+}
+
+func (f *fakeSink) Notify(kind NotifyKind, title, body string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.kinds = append(f.kinds, kind)
+}
+
+func (f *fakeSink) Kinds() []NotifyKind {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.kinds)
+}
+
+func TestRateLimitedNotifier(t *testing.T) {
+	now := goldenTime
+	sink := &fakeSink{}
+	n := newRateLimitedNotifier(sink, 10*time.Second)
+	n.now = func() time.Time { return now }
+
+	// A disabled message does not use up the kind's slot.
+	n.Notify(NotifySwapFailed, "", "disabled")
+	n.Notify(NotifySwapFailed, "Swap failed", "1")
+	now = now.Add(5 * time.Second)
+	n.Notify(NotifySwapFailed, "Swap failed", "2")
+	n.Notify(NotifyKicked, "Kicked", "")
+	now = now.Add(5 * time.Second)
+	n.Notify(NotifySwapFailed, "Swap failed", "3")
+
+	want := []NotifyKind{NotifySwapFailed, NotifyKicked, NotifySwapFailed}
+	if got := sink.Kinds(); !slices.Equal(got, want) {
+		t.Errorf("delivered %v; want %v", got, want)
+	}
+}
+
+func TestNewNotifierDisabled(t *testing.T) {
+	if _, ok := NewNotifier(&Config{}).(nopNotifier); !ok {
+		t.Error("notifications on without desktop_notifications")
+	}
+	if _, ok := NewNotifier(&Config{DesktopNotifications: true}).(*rateLimitedNotifier); !ok {
+		t.Error("desktop notifications are not rate limited")
+	}
+}
+
+func TestHandlerNotifications(t *testing.T) {
+	soon := time.Now().Add(2 * time.Second).Unix()
+	later := time.Now().Add(2 * time.Minute).Unix()
+	tests := []struct {
+		name    string
+		typ     string
+		payload string
+		want    []NotifyKind
+	}{
+		{"kick", "kick", `{"reason":"afk"}`, []NotifyKind{NotifyKicked}},
+		{"scheduled start", "change_game_state",
+			fmt.Sprintf(`{"state":"running","state_at":%d,"seq":2}`, later), []NotifyKind{NotifySessionStart}},
+		{"imminent start", "change_game_state",
+			fmt.Sprintf(`{"state":"running","state_at":%d,"seq":2}`, soon), nil},
+		{"server message", "message", `{"text":"hello"}`, nil},
+		{"ready check", "ready_check", `{}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newHandlerFixture(t)
+			sink := &fakeSink{}
+			f.h.notify = newRateLimitedNotifier(sink, time.Minute)
+			f.dispatch(tt.typ, tt.payload)
+			if got := sink.Kinds(); !slices.Equal(got, tt.want) {
+				t.Errorf("notified %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSwapFailureNotificationsAreRateLimited(t *testing.T) {
+	f := newHandlerFixture(t)
+	sink := &fakeSink{}
+	f.h.notify = newRateLimitedNotifier(sink, time.Minute)
+	f.emu.swapErr = &NackError{Command: "SWAP", Reason: "rom not found"}
+	f.h.prepares.timeout = 10 * time.Millisecond
+
+	for round := 1; round <= 3; round++ {
+		f.dispatch("prepare_swap", fmt.Sprintf(`{"round_number":%d,"new_game":"zelda.sfc"}`, round))
+		f.dispatch("swap", fmt.Sprintf(`{"round_number":%d,"new_game":"zelda.sfc","swap_at":%d}`, round, time.Now().Unix()))
+	}
+	waitFor(t, "three failed swaps", func() bool {
+		n := 0
+		for _, c := range f.server.Calls() {
+			if c == "SwapFailed "+SwapFailedEmulator {
+				n++
+			}
+		}
+		return n == 3
+	})
+	if got := sink.Kinds(); !slices.Equal(got, []NotifyKind{NotifySwapFailed}) {
+		t.Errorf("notified %v; want one swap failure for the burst", got)
+	}
+}
+
+// startDisconnectWatch runs watchDisconnects on f's state with a short
+// wait and returns the sink it notifies.
+func startDisconnectWatch(t *testing.T, f *handlerFixture, wait time.Duration) *fakeSink {
+	t.Helper()
+	subscribers := func() int {
+		f.state.subMu.Lock()
+		defer f.state.subMu.Unlock()
+		return len(f.state.subs)
+	}
+	before := subscribers()
+	sink := &fakeSink{}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		watchDisconnects(f.state, sink, wait, done)
+	}()
+	t.Cleanup(func() {
+		close(done)
+		<-stopped
+	})
+	waitFor(t, "the watcher to subscribe", func() bool { return subscribers() > before })
+	return sink
+}
+
+func TestDisconnectAlarm(t *testing.T) {
+	f := newHandlerFixture(t)
+	sink := startDisconnectWatch(t, f, 50*time.Millisecond)
+
+	// A blip shorter than the wait stays quiet.
+	f.state.SetConnected(false)
+	f.state.SetConnected(true)
+	time.Sleep(150 * time.Millisecond)
+	if got := sink.Kinds(); len(got) > 0 {
+		t.Fatalf("notified %v for a short blip", got)
+	}
+
+	f.state.SetConnected(false)
+	waitFor(t, "the disconnect alarm", func() bool { return len(sink.Kinds()) > 0 })
+	time.Sleep(150 * time.Millisecond)
+	if got := sink.Kinds(); !slices.Equal(got, []NotifyKind{NotifyDisconnected}) {
+		t.Errorf("notified %v; want one disconnect alarm", got)
+	}
+}
+
+func TestDisconnectAlarmQuietDuringServerRestart(t *testing.T) {
+	const window = time.Second
+	tests := []struct {
+		name      string
+		reconnect bool
+		want      []NotifyKind
+	}{
+		// Back within the announced window: no alarm at all.
+		{"back in time", true, nil},
+		// Still gone once the window is over: alarm then, not before.
+		{"still down", false, []NotifyKind{NotifyDisconnected}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newHandlerFixture(t)
+			sink := startDisconnectWatch(t, f, 50*time.Millisecond)
+			f.dispatch("server_restarting", `{"down_seconds":1}`)
+			f.state.SetConnected(false)
+
+			time.Sleep(window / 2)
+			if got := sink.Kinds(); len(got) > 0 {
+				t.Fatalf("notified %v during the restart window", got)
+			}
+			if tt.reconnect {
+				f.state.SetConnected(true)
+			}
+			time.Sleep(window)
+			if got := sink.Kinds(); !slices.Equal(got, tt.want) {
+				t.Errorf("notified %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package app
+
+import (
+	"os"
+	"os/exec"
+)
+
+const toastScript = `
+[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$t = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$x = $t.GetElementsByTagName("text")
+$x.Item(0).AppendChild($t.CreateTextNode($env:GGC_TITLE)) > $null
+$x.Item(1).AppendChild($t.CreateTextNode($env:GGC_BODY)) > $null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier("Game Client").Show([Windows.UI.Notifications.ToastNotification]::new($t))
+`
+
+// showDesktopNotification raises a Windows toast via PowerShell. Title and
+// body travel in environment variables so they never need script escaping.
+func showDesktopNotification(title, body string) error {
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", toastScript)
+	cmd.Env = append(os.Environ(), "GGC_TITLE="+title, "GGC_BODY="+body)
+	return cmd.Run()
+}
@@ -0,0 +1,339 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// outboxFlushGrace bounds the final delivery attempt at shutdown.
+const outboxFlushGrace = 3 * time.Second
+
+// Report types queued through the outbox.
+const (
+	ReportSwapComplete  = "swap_complete"
+	ReportSwapFailed    = "swap_failed"
+	ReportGameStopped   = "game_stopped"
+	ReportGameStarted   = "game_started"
+	ReportSkippedAction = "skipped_action"
+	ReportReadyCheck    = "ready_check"
+	ReportRejectedGame  = "rejected_game"
+	ReportStaleState    = "stale_state"
+	ReportClientError   = "client_error"
+	ReportDownloadAck   = "download_ack"
+	ReportRoleRejected  = "role_rejected"
+
+	ReportStartupWarnings = "startup_warnings"
+)
+
+// outboxPolicy sets the per-type queue cap, whether the type is valuable
+// enough to persist across restarts in the runtime state, and whether its
+// reports carry an idempotency key so the server can discard repeats of
+// one that changes session state.
+type outboxPolicy struct {
+	cap        int
+	durable    bool
+	idempotent bool
+}
+
+var outboxPolicies = map[string]outboxPolicy{
+	ReportSwapComplete:  {cap: 50, durable: true, idempotent: true},
+	ReportSwapFailed:    {cap: 50, durable: true, idempotent: true},
+	ReportGameStopped:   {cap: 5, durable: true, idempotent: true},
+	ReportGameStarted:   {cap: 5, durable: true},
+	ReportSkippedAction: {cap: 20},
+	ReportReadyCheck:    {cap: 5},
+	ReportRejectedGame:  {cap: 20},
+	ReportStaleState:    {cap: 20},
+	ReportClientError:   {cap: 10},
+	ReportDownloadAck:   {cap: 50, durable: true},
+	ReportRoleRejected:  {cap: 20},
+
+	ReportStartupWarnings: {cap: 1},
+}
+
+// OutboxReport is a server report awaiting delivery. CreatedAt travels with
+// it so the server can tell late deliveries apart.
+type OutboxReport struct {
+	Type      string          `json:"type"`
+	Method    string          `json:"method"`
+	Path      string          `json:"path"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+	Attempts  int             `json:"attempts"`
+	// IdempotencyKey is the same on every delivery attempt of the report,
+	// including after a restart.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// errRetryable marks delivery failures worth retrying later.
+var errRetryable = errors.New("retryable")
+
+// Outbox delivers reports to the server, queueing those that fail with
+// retryable errors and retrying them in order with backoff.
+type Outbox struct {
+	api *API
+
+	mu    sync.Mutex
+	queue []*OutboxReport
+	wake  chan struct{}
+	// notBefore holds deliveries back while the server's Retry-After
+	// window from a 429 or 5xx lasts.
+	notBefore time.Time
+}
+
+func NewOutbox(api *API) *Outbox {
+	return &Outbox{api: api, wake: make(chan struct{}, 1)}
+}
+
+// Submit attempts immediate delivery and queues the report on a retryable
+// failure, returning nil. Non-retryable failures (4xx) are returned as-is.
+func (o *Outbox) Submit(ctx context.Context, typ, path string, payload any) error {
+	r := &OutboxReport{
+		Type:      typ,
+		Method:    http.MethodPost,
+		Path:      path,
+		CreatedAt: time.Now(),
+	}
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("marshal %s: %w", typ, err)
+		}
+		r.Payload = b
+	}
+	if outboxPolicies[typ].idempotent {
+		if err := r.setIdempotencyKey(); err != nil {
+			return fmt.Errorf("%s idempotency key: %w", typ, err)
+		}
+	}
+	if wait := o.held(); wait > 0 {
+		debugf("outbox: %s queued; server asked to retry after %s", typ, wait.Round(time.Second))
+		o.enqueue(r)
+		return nil
+	}
+	err := o.deliver(ctx, r)
+	if errors.Is(err, errRetryable) {
+		log.Printf("outbox: %s queued for retry: %v", typ, err)
+		o.enqueue(r)
+		return nil
+	}
+	return err
+}
+
+// setIdempotencyKey gives r a fresh key, sent as the Idempotency-Key
+// header and as idempotency_key in the JSON body.
+func (r *OutboxReport) setIdempotencyKey() error {
+	key, err := newUUID()
+	if err != nil {
+		return err
+	}
+	body := make(map[string]json.RawMessage)
+	if len(r.Payload) > 0 {
+		if err := json.Unmarshal(r.Payload, &body); err != nil {
+			return err
+		}
+	}
+	body["idempotency_key"], _ = json.Marshal(key)
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	r.Payload, r.IdempotencyKey = b, key
+	return nil
+}
+
+func (o *Outbox) enqueue(r *OutboxReport) {
+	policy := outboxPolicies[r.Type]
+	if policy.cap == 0 {
+		policy.cap = 10
+	}
+	o.mu.Lock()
+	count := 0
+	oldest := -1
+	for i, q := range o.queue {
+		if q.Type == r.Type {
+			if oldest < 0 {
+				oldest = i
+			}
+			count++
+		}
+	}
+	if count >= policy.cap && oldest >= 0 {
+		if policy.durable {
+			log.Printf("WARNING: outbox full for %s; dropping oldest report from %s",
+				r.Type, o.queue[oldest].CreatedAt.Format(time.RFC3339))
+		}
+		o.queue = append(o.queue[:oldest], o.queue[oldest+1:]...)
+	}
+	o.queue = append(o.queue, r)
+	o.mu.Unlock()
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver sends one report; errors wrapping errRetryable should be queued.
+func (o *Outbox) deliver(ctx context.Context, r *OutboxReport) error {
+	r.Attempts++
+	var payload any
+	if len(r.Payload) > 0 {
+		payload = r.Payload
+	}
+	req, err := o.api.newRequest(ctx, r.Method, r.Path, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Report-Created-At", r.CreatedAt.UTC().Format(time.RFC3339Nano))
+	if r.IdempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", r.IdempotencyKey)
+	}
+
+	resp, _, err := o.api.do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s send error: %v", errRetryable, r.Type, err)
+	}
+	if resp == nil {
+		return fmt.Errorf("%w: nil %s response", errRetryable, r.Type)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		apiErr := newAPIError(r.Type, resp)
+		o.hold(apiErr.RetryAfter)
+		return fmt.Errorf("%w: %w", errRetryable, apiErr)
+	default:
+		return newAPIError(r.Type, resp)
+	}
+}
+
+// hold defers deliveries for d, as asked by a Retry-After header.
+func (o *Outbox) hold(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	o.mu.Lock()
+	if until := time.Now().Add(d); until.After(o.notBefore) {
+		o.notBefore = until
+	}
+	o.mu.Unlock()
+	log.Printf("outbox: server asked to retry after %s; holding reports", d.Round(time.Second))
+}
+
+// held returns how long deliveries are still held back.
+func (o *Outbox) held() time.Duration {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return time.Until(o.notBefore)
+}
+
+// Run drains the queue in order until ctx is cancelled.
+func (o *Outbox) Run(ctx context.Context) {
+	backoff := 2 * time.Second
+	for {
+		wait := max(backoff, o.held())
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.wake:
+		case <-time.After(wait):
+		}
+		if o.held() > 0 {
+			continue
+		}
+		if o.drain(ctx) {
+			backoff = 2 * time.Second
+		} else if backoff < time.Minute {
+			backoff *= 2
+		}
+	}
+}
+
+// drain sends queued reports oldest first, stopping at the first
+// retryable failure. It reports whether the queue was emptied.
+func (o *Outbox) drain(ctx context.Context) bool {
+	for {
+		o.mu.Lock()
+		if len(o.queue) == 0 {
+			o.mu.Unlock()
+			return true
+		}
+		r := o.queue[0]
+		o.mu.Unlock()
+
+		err := o.deliver(ctx, r)
+		if errors.Is(err, errRetryable) {
+			return false
+		}
+		if err != nil {
+			log.Printf("outbox: dropping %s: %v", r.Type, err)
+		} else {
+			log.Printf("outbox: delivered %s from %s", r.Type, r.CreatedAt.Format(time.RFC3339))
+		}
+		o.mu.Lock()
+		if len(o.queue) > 0 && o.queue[0] == r {
+			o.queue = o.queue[1:]
+		}
+		o.mu.Unlock()
+	}
+}
+
+// Flush makes one delivery pass, bounded by ctx, before shutdown.
+func (o *Outbox) Flush(ctx context.Context) {
+	if !o.drain(ctx) {
+		log.Printf("outbox: %d reports undelivered at shutdown", o.Len())
+	}
+}
+
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.queue)
+}
+
+// PendingByType returns queued report counts per type.
+func (o *Outbox) PendingByType() map[string]int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.queue) == 0 {
+		return nil
+	}
+	out := make(map[string]int)
+	for _, r := range o.queue {
+		out[r.Type]++
+	}
+	return out
+}
+
+// Durable returns the queued reports worth persisting across a restart.
+func (o *Outbox) Durable() []OutboxReport {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var out []OutboxReport
+	for _, r := range o.queue {
+		if outboxPolicies[r.Type].durable {
+			out = append(out, *r)
+		}
+	}
+	return out
+}
+
+// Restore re-queues reports persisted by a previous run.
+func (o *Outbox) Restore(reports []OutboxReport) {
+	for i := range reports {
+		r := reports[i]
+		o.enqueue(&r)
+	}
+	if len(reports) > 0 {
+		log.Printf("outbox: restored %d undelivered reports", len(reports))
+	}
+}
@@ -0,0 +1,259 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// keyServer fails the first failures requests with 503 and records the
+// Idempotency-Key header and idempotency_key body field of every request.
+type keyServer struct {
+	mu       sync.Mutex
+	failures int
+	headers  []string
+	bodyKeys []string
+}
+
+func (s *keyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		IdempotencyKey string `json:"idempotency_key"`
+	}
+	data, _ := io.ReadAll(r.Body)
+	_ = json.Unmarshal(data, &body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.headers = append(s.headers, r.Header.Get("Idempotency-Key"))
+	s.bodyKeys = append(s.bodyKeys, body.IdempotencyKey)
+	if len(s.headers) <= s.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestIdempotencyKeyStableAcrossRetries(t *testing.T) {
+	ks := &keyServer{failures: 2}
+	srv := httptest.NewServer(ks)
+	defer srv.Close()
+	ctx := context.Background()
+
+	// First attempt fails and the report is queued.
+	o := NewAPI(&Config{ServerURL: srv.URL, BearerToken: "t"}).Outbox()
+	if err := o.Submit(ctx, ReportSwapComplete, "/api/swap-complete", map[string]int{"round_number": 3}); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	// The retry fails too.
+	if o.drain(ctx) {
+		t.Fatal("drain emptied the queue while the server is failing")
+	}
+
+	// A restart persists the report and replays it from a fresh outbox.
+	b, err := json.Marshal(o.Durable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved []OutboxReport
+	if err := json.Unmarshal(b, &saved); err != nil {
+		t.Fatal(err)
+	}
+	replay := NewAPI(&Config{ServerURL: srv.URL, BearerToken: "t"}).Outbox()
+	replay.Restore(saved)
+	if !replay.drain(ctx) {
+		t.Fatal("replayed report was not delivered")
+	}
+
+	if len(ks.headers) != 3 {
+		t.Fatalf("server saw %d requests; want 3", len(ks.headers))
+	}
+	key := ks.headers[0]
+	if key == "" {
+		t.Fatal("swap_complete sent without an Idempotency-Key")
+	}
+	for i := range ks.headers {
+		if ks.headers[i] != key || ks.bodyKeys[i] != key {
+			t.Errorf("attempt %d: header %q, body %q; want %q in both", i+1, ks.headers[i], ks.bodyKeys[i], key)
+		}
+	}
+}
+
+func TestIdempotencyKeyOnlyForStateChanges(t *testing.T) {
+	ks := &keyServer{}
+	srv := httptest.NewServer(ks)
+	defer srv.Close()
+	ctx := context.Background()
+
+	o := NewAPI(&Config{ServerURL: srv.URL, BearerToken: "t"}).Outbox()
+	for _, typ := range []string{ReportGameStopped, ReportGameStopped, ReportGameStarted} {
+		if err := o.Submit(ctx, typ, "/api/"+typ, map[string]string{"game": "mario.nes"}); err != nil {
+			t.Fatalf("Submit %s: %v", typ, err)
+		}
+	}
+	// Each report gets its own key; reports that change no state get none.
+	if ks.headers[0] == "" || ks.headers[0] == ks.headers[1] {
+		t.Errorf("game_stopped keys = %q, %q; want two distinct keys", ks.headers[0], ks.headers[1])
+	}
+	if ks.headers[2] != "" || ks.bodyKeys[2] != "" {
+		t.Errorf("game_started sent with key %q", ks.headers[2])
+	}
+}
+
+// pathServer records the path of every request and answers it with
+// status(path).
+func pathServer(t *testing.T, status func(path string) int) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		w.WriteHeader(status(r.URL.Path))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(paths)
+	}
+}
+
+func queuedPaths(o *Outbox) []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var out []string
+	for _, r := range o.queue {
+		out = append(out, r.Path)
+	}
+	return out
+}
+
+func TestOutboxQueuesOnlyRetryableFailures(t *testing.T) {
+	srv, _ := pathServer(t, func(path string) int {
+		if path == "/api/rejected" {
+			return http.StatusUnprocessableEntity
+		}
+		return http.StatusServiceUnavailable
+	})
+	o := NewAPI(&Config{ServerURL: srv.URL, BearerToken: "t"}).Outbox()
+	ctx := context.Background()
+
+	if err := o.Submit(ctx, ReportGameStarted, "/api/started", nil); err != nil {
+		t.Errorf("Submit on 503 = %v; want it queued", err)
+	}
+	if err := o.Submit(ctx, ReportRejectedGame, "/api/rejected", nil); err == nil {
+		t.Error("Submit on 422 returned nil; want the error")
+	}
+	if got := queuedPaths(o); !slices.Equal(got, []string{"/api/started"}) {
+		t.Errorf("queue = %v; want only the 503 report", got)
+	}
+}
+
+func TestOutboxDrainsOldestFirst(t *testing.T) {
+	failing := true
+	var mu sync.Mutex
+	srv, sent := pathServer(t, func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		if path == "/api/b" && failing {
+			return http.StatusBadGateway
+		}
+		return http.StatusNoContent
+	})
+	o := NewAPI(&Config{ServerURL: srv.URL, BearerToken: "t"}).Outbox()
+	for _, path := range []string{"/api/a", "/api/b", "/api/c"} {
+		o.enqueue(&OutboxReport{Type: ReportSkippedAction, Method: http.MethodPost, Path: path})
+	}
+	ctx := context.Background()
+
+	// A retryable failure stops the pass so later reports keep their place.
+	if o.drain(ctx) {
+		t.Fatal("drain reported an empty queue after a 502")
+	}
+	if got := queuedPaths(o); !slices.Equal(got, []string{"/api/b", "/api/c"}) {
+		t.Errorf("queue after failure = %v", got)
+	}
+
+	mu.Lock()
+	failing = false
+	mu.Unlock()
+	if !o.drain(ctx) {
+		t.Fatal("drain left reports behind")
+	}
+	if got := sent(); !slices.Equal(got, []string{"/api/a", "/api/b", "/api/b", "/api/c"}) {
+		t.Errorf("delivery order = %v", got)
+	}
+}
+
+func TestOutboxEnqueueEvictsOldestOfType(t *testing.T) {
+	o := NewOutbox(nil)
+	limit := outboxPolicies[ReportReadyCheck].cap
+	o.enqueue(&OutboxReport{Type: ReportGameStarted, Path: "/api/started"})
+	for i := 0; i <= limit; i++ {
+		o.enqueue(&OutboxReport{Type: ReportReadyCheck, Path: fmt.Sprintf("/api/ready/%d", i)})
+	}
+
+	if got := o.PendingByType(); got[ReportReadyCheck] != limit || got[ReportGameStarted] != 1 {
+		t.Errorf("pending = %v; want %d ready checks and the other report kept", got, limit)
+	}
+	got := queuedPaths(o)
+	if got[0] != "/api/started" || got[1] != "/api/ready/1" || got[len(got)-1] != fmt.Sprintf("/api/ready/%d", limit) {
+		t.Errorf("queue = %v; want the oldest ready check evicted", got)
+	}
+
+	// Types without a policy are capped too.
+	for i := 0; i < 20; i++ {
+		o.enqueue(&OutboxReport{Type: "unknown"})
+	}
+	if n := o.PendingByType()["unknown"]; n != 10 {
+		t.Errorf("%d unknown reports queued; want the default cap of 10", n)
+	}
+}
+
+func TestOutboxDurableRestore(t *testing.T) {
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	o := NewOutbox(nil)
+	for _, r := range []OutboxReport{
+		{Type: ReportSwapComplete, Path: "/api/swap-complete", CreatedAt: created, Attempts: 2, IdempotencyKey: "k1"},
+		{Type: ReportReadyCheck, Path: "/api/ready"},
+		{Type: ReportDownloadAck, Path: "/api/download-ack", Payload: json.RawMessage(`{"game":"mario.nes"}`)},
+		{Type: ReportClientError, Path: "/api/client-error"},
+	} {
+		o.enqueue(&r)
+	}
+
+	durable := o.Durable()
+	if len(durable) != 2 || durable[0].Type != ReportSwapComplete || durable[1].Type != ReportDownloadAck {
+		t.Fatalf("durable = %+v; want swap_complete then download_ack", durable)
+	}
+
+	// Reports survive the round trip through the runtime state.
+	b, err := json.Marshal(durable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved []OutboxReport
+	if err := json.Unmarshal(b, &saved); err != nil {
+		t.Fatal(err)
+	}
+	restored := NewOutbox(nil)
+	restored.Restore(saved)
+	got := restored.Durable()
+	if len(got) != 2 {
+		t.Fatalf("restored %d reports; want 2", len(got))
+	}
+	first := got[0]
+	if !first.CreatedAt.Equal(created) || first.Attempts != 2 || first.IdempotencyKey != "k1" {
+		t.Errorf("restored swap_complete = %+v", first)
+	}
+	if string(got[1].Payload) != `{"game":"mario.nes"}` {
+		t.Errorf("restored payload = %s", got[1].Payload)
+	}
+}
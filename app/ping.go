@@ -0,0 +1,97 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const (
+	// pingSamples round trips are made per measurement; the median is
+	// reported so one slow request does not skew it.
+	pingSamples  = 3
+	pingInterval = 15 * time.Second
+)
+
+// Ping measures the network round trip to the server with small GET
+// /api/ping requests and returns the median. It returns
+// ErrEndpointUnsupported if the server has no ping route.
+func (a *API) Ping(ctx context.Context) (time.Duration, error) {
+	rtts := make([]time.Duration, 0, pingSamples)
+	var lastErr error
+	for range pingSamples {
+		rtt, err := a.pingOnce(ctx)
+		if errors.Is(err, ErrEndpointUnsupported) {
+			return 0, err
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		rtts = append(rtts, rtt)
+	}
+	if len(rtts) == 0 {
+		return 0, fmt.Errorf("no ping samples: %w", lastErr)
+	}
+	slices.Sort(rtts)
+	return rtts[len(rtts)/2], nil
+}
+
+func (a *API) pingOnce(ctx context.Context) (time.Duration, error) {
+	req, err := a.newRequest(ctx, http.MethodGet, "/api/ping", nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, rtt, err := a.do(req)
+	if err != nil {
+		return 0, fmt.Errorf("ping send error: %w", err)
+	}
+	if resp == nil {
+		return 0, fmt.Errorf("nil ping response")
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return rtt, nil
+	case resp.StatusCode == http.StatusNotFound:
+		return 0, ErrEndpointUnsupported
+	default:
+		return 0, newAPIError("ping", resp)
+	}
+}
+
+// startPingLoop keeps the reported ping current with Ping. Servers without
+// the ping route, or ping_via_heartbeat in the config, fall back to
+// timing the heartbeat POST.
+func (a *App) startPingLoop(ctx context.Context) {
+	if a.cfg.PingViaHeartbeat {
+		return
+	}
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		rtt, err := a.api.Ping(ctx)
+		switch {
+		case errors.Is(err, ErrEndpointUnsupported):
+			log.Println("Server has no /api/ping; measuring ping from heartbeats")
+			a.api.pingFromHeartbeat.Store(true)
+			return
+		case err != nil:
+			debugf("Ping failed: %v", err)
+		default:
+			a.state.SetPing(int(rtt.Milliseconds()))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package app
+
+import "time"
+
+// isPlayingState reports whether a game state counts as active play.
+func isPlayingState(state string) bool {
+	return state != "" && actionKindForState(state) != ActionPause
+}
+
+// playingLocked reports whether playtime is currently accruing.
+// Callers must hold s.mu.
+func (s *ClientState) playingLocked() bool {
+	return s.currentGame != "" && s.ipcConnected && isPlayingState(s.state)
+}
+
+// accrueLocked credits the current game with time played since the last
+// accrual, then restarts the segment. It must be called (with s.mu held)
+// before any field that affects playingLocked changes.
+func (s *ClientState) accrueLocked() {
+	now := s.now()
+	if s.playingLocked() && !s.segmentStart.IsZero() {
+		start := s.segmentStart
+		// A state scheduled for the future only starts counting at its time.
+		if s.stateAt.After(start) {
+			start = s.stateAt
+		}
+		if now.After(start) {
+			s.playtime[s.currentGame] += now.Sub(start)
+		}
+	}
+	s.segmentStart = now
+}
+
+// SetIPCConnected records whether the Lua script is connected; time while
+// disconnected does not count as playtime.
+func (s *ClientState) SetIPCConnected(c bool) {
+	s.mu.Lock()
+	s.accrueLocked()
+	s.ipcConnected = c
+	s.mu.Unlock()
+}
+
+// Playtime returns accumulated active playtime per game.
+func (s *ClientState) Playtime() map[string]time.Duration {
+	s.mu.Lock()
+	s.accrueLocked()
+	out := make(map[string]time.Duration, len(s.playtime))
+	for g, d := range s.playtime {
+		out[g] = d
+	}
+	s.mu.Unlock()
+	return out
+}
+
+// CurrentGamePlaytime returns accumulated playtime for the current game.
+func (s *ClientState) CurrentGamePlaytime() time.Duration {
+	s.mu.Lock()
+	s.accrueLocked()
+	d := s.playtime[s.currentGame]
+	s.mu.Unlock()
+	return d
+}
+
+func playtimeSeconds(m map[string]time.Duration) map[string]int64 {
+	if len(m) == 0 {
+		return nil
+	}
+	out := make(map[string]int64, len(m))
+	for g, d := range m {
+		out[g] = int64(d.Seconds())
+	}
+	return out
+}
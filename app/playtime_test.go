@@ -0,0 +1,90 @@
+package app
+
+import (
+	"maps"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// manualClockState returns a ClientState on a manual clock and a function
+// that advances it.
+func manualClockState() (*ClientState, func(time.Duration)) {
+	now := goldenTime
+	s := NewClientState()
+	s.now = func() time.Time { return now }
+	return s, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestPlaytimeAccrual(t *testing.T) {
+	s, advance := manualClockState()
+	s.SetCurrentGame("mario.nes")
+	s.SetState(goldenTime, "running")
+	advance(time.Minute)
+	if d := s.CurrentGamePlaytime(); d != 0 {
+		t.Errorf("playtime without the Lua script = %s; want 0", d)
+	}
+
+	s.SetIPCConnected(true)
+	advance(2 * time.Minute)
+	s.SetState(goldenTime, "paused")
+	advance(time.Hour)
+	s.SetState(goldenTime, "running")
+	advance(time.Minute)
+	s.SetCurrentGame("zelda.sfc")
+	advance(30 * time.Second)
+	s.SetIPCConnected(false)
+	advance(time.Hour)
+
+	want := map[string]time.Duration{"mario.nes": 3 * time.Minute, "zelda.sfc": 30 * time.Second}
+	if got := s.Playtime(); !maps.Equal(got, want) {
+		t.Errorf("playtime = %v; want %v", got, want)
+	}
+	if got := playtimeSeconds(s.Playtime()); got["mario.nes"] != 180 || got["zelda.sfc"] != 30 {
+		t.Errorf("playtimeSeconds = %v", got)
+	}
+	if playtimeSeconds(nil) != nil {
+		t.Error("empty playtime reported")
+	}
+}
+
+func TestPlaytimeScheduledStart(t *testing.T) {
+	s, advance := manualClockState()
+	s.SetCurrentGame("mario.nes")
+	s.SetIPCConnected(true)
+	// A start scheduled a minute ahead counts only from its time.
+	s.SetState(goldenTime.Add(time.Minute), "running")
+	advance(30 * time.Second)
+	if d := s.CurrentGamePlaytime(); d != 0 {
+		t.Errorf("playtime before the scheduled start = %s; want 0", d)
+	}
+	advance(90 * time.Second)
+	if d := s.CurrentGamePlaytime(); d != time.Minute {
+		t.Errorf("playtime a minute after the start = %s; want 1m", d)
+	}
+}
+
+func TestPlaytimeSurvivesRestart(t *testing.T) {
+	s, advance := manualClockState()
+	s.SetCurrentGame("mario.nes")
+	s.SetIPCConnected(true)
+	s.SetState(goldenTime, "running")
+	advance(90 * time.Second)
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := s.SaveToFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Time while the client was not running does not count.
+	advance(time.Hour)
+	r, _ := manualClockState()
+	r.now = s.now
+	if err := r.LoadFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	r.SetIPCConnected(true)
+	advance(time.Minute)
+	if d := r.CurrentGamePlaytime(); d != 2*time.Minute+30*time.Second {
+		t.Errorf("playtime after restart = %s; want 2m30s", d)
+	}
+}
@@ -0,0 +1,123 @@
+package app
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// prepareArrivalGrace is how long a swap waits for a prepare_swap that has
+// not arrived yet (events reordered across reconnects).
+const prepareArrivalGrace = 2 * time.Second
+
+// prepareWaitTimeout is how long a swap waits for its prepare_swap to
+// finish: the SAVE command plus everything uploadPreparedSave may spend,
+// so a swap never overtakes a save upload that is still being retried.
+func prepareWaitTimeout() time.Duration {
+	d := clientIPCTimings.Save + saveWriteTimeout
+	for attempt := 0; attempt <= saveUploadRetries; attempt++ {
+		d += saveUploadTimeout + saveUploadBackoff(attempt)
+	}
+	return d
+}
+
+type prepareOp struct {
+	round   *int
+	done    chan struct{}
+	started time.Time
+}
+
+// prepareTracker lets a swap wait for the prepare_swap of the same round
+// (or, when the server omits round numbers, the most recent one) so the
+// outgoing save is captured before the game changes.
+type prepareTracker struct {
+	mu      sync.Mutex
+	byRound map[int]*prepareOp
+	latest  *prepareOp
+	changed chan struct{}
+	// timeout is how long a swap waits for a running prepare.
+	timeout time.Duration
+}
+
+func newPrepareTracker() *prepareTracker {
+	return &prepareTracker{
+		byRound: make(map[int]*prepareOp),
+		changed: make(chan struct{}),
+		timeout: prepareWaitTimeout(),
+	}
+}
+
+// begin registers an in-flight prepare. round may be nil for servers that
+// don't send it yet.
+func (t *prepareTracker) begin(round *int) *prepareOp {
+	op := &prepareOp{round: round, done: make(chan struct{}), started: time.Now()}
+	t.mu.Lock()
+	if round != nil {
+		t.byRound[*round] = op
+	}
+	t.latest = op
+	close(t.changed)
+	t.changed = make(chan struct{})
+	t.mu.Unlock()
+	return op
+}
+
+func (t *prepareTracker) finish(op *prepareOp) {
+	close(op.done)
+	t.mu.Lock()
+	for r, o := range t.byRound {
+		if o != op && time.Since(o.started) > time.Hour {
+			delete(t.byRound, r)
+		}
+	}
+	t.mu.Unlock()
+}
+
+func (t *prepareTracker) find(round int) (*prepareOp, bool) {
+	if op, ok := t.byRound[round]; ok {
+		return op, true
+	}
+	// Fallback for prepares without a round: use the most recent one if
+	// it started recently enough to belong to this swap.
+	if t.latest != nil && t.latest.round == nil &&
+		time.Since(t.latest.started) < t.timeout {
+		return t.latest, false
+	}
+	return nil, false
+}
+
+// wait blocks until the prepare for round completes, the timeout elapses,
+// or no prepare shows up within the arrival grace period. It reports false
+// only when it gave up on a prepare that is still running.
+func (t *prepareTracker) wait(round int) bool {
+	deadline := time.Now().Add(t.timeout)
+	grace := time.NewTimer(prepareArrivalGrace)
+	defer grace.Stop()
+
+	for {
+		t.mu.Lock()
+		op, exact := t.find(round)
+		changed := t.changed
+		t.mu.Unlock()
+
+		if op != nil {
+			if !exact {
+				log.Printf("Swap round %d: prepare_swap carried no round; using most recent", round)
+			}
+			select {
+			case <-op.done:
+				return true
+			case <-time.After(time.Until(deadline)):
+				log.Printf("Swap round %d: timed out waiting for prepare_swap to finish; swapping anyway", round)
+				return false
+			}
+		}
+
+		select {
+		case <-changed:
+		case <-grace.C:
+			log.Printf("Swap round %d: no prepare_swap received; swapping without it", round)
+			return true
+		}
+	}
+}
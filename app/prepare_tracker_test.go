@@ -0,0 +1,56 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPrepareWaitCoversSaveUpload(t *testing.T) {
+	budget := clientIPCTimings.Save + saveWriteTimeout + (saveUploadRetries+1)*saveUploadTimeout
+	if got := prepareWaitTimeout(); got < budget {
+		t.Errorf("prepareWaitTimeout() = %v; shorter than the save upload budget %v", got, budget)
+	}
+}
+
+func TestPrepareWaitForRound(t *testing.T) {
+	tr := newPrepareTracker()
+	round := 3
+	op := tr.begin(&round)
+
+	done := make(chan bool, 1)
+	go func() { done <- tr.wait(round) }()
+	select {
+	case <-done:
+		t.Fatal("wait returned before the prepare finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	tr.finish(op)
+	select {
+	case ok := <-done:
+		if !ok {
+			t.Error("wait = false after the prepare finished")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("wait did not return after the prepare finished")
+	}
+}
+
+func TestPrepareWaitForLateArrival(t *testing.T) {
+	tr := newPrepareTracker()
+	done := make(chan bool, 1)
+	go func() { done <- tr.wait(4) }()
+
+	// A prepare without a round that arrives within the grace period is
+	// still waited for.
+	time.Sleep(20 * time.Millisecond)
+	op := tr.begin(nil)
+	select {
+	case <-done:
+		t.Fatal("wait returned before the late prepare finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	tr.finish(op)
+	if ok := <-done; !ok {
+		t.Error("wait = false after the late prepare finished")
+	}
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	prereqMarker = ".prereqs_installed"
+	// fastCrashWindow is how soon after launch an exit counts as a
+	// startup crash, which usually means missing prerequisites.
+	fastCrashWindow = 15 * time.Second
+)
+
+// installPrereqs runs the installer; tests replace it with a stub.
+var installPrereqs = runPrereqInstaller
+
+// findPrereqInstaller looks for the prerequisite installer that
+// BizhawkFiles.zip ships alongside EmuHawk.
+func findPrereqInstaller(installDir string) string {
+	entries, err := os.ReadDir(installDir)
+	if err != nil {
+		return ""
+	}
+	for _, e := range entries {
+		name := strings.ToLower(e.Name())
+		if !e.IsDir() && strings.Contains(name, "prereq") && strings.HasSuffix(name, ".exe") {
+			return filepath.Join(installDir, e.Name())
+		}
+	}
+	return ""
+}
+
+func prereqsInstalled(installDir string) bool {
+	_, err := os.Stat(filepath.Join(installDir, prereqMarker))
+	return err == nil
+}
+
+// ensurePrereqs runs the prerequisite installer once per install dir.
+// Failures are reported but not fatal; BizHawk may already work.
+func ensurePrereqs(cfg *Config, installDir string) {
+	if cfg.SkipPrereqInstall || prereqsInstalled(installDir) {
+		return
+	}
+	installer := findPrereqInstaller(installDir)
+	if installer == "" {
+		log.Printf("No BizHawk prerequisite installer found in %s", installDir)
+		return
+	}
+	fmt.Println("Installing BizHawk prerequisites (an elevation prompt may appear)...")
+	if err := installPrereqs(installer); err != nil {
+		log.Printf("Prerequisite installer failed: %v", err)
+		fmt.Println("Prerequisite install failed; BizHawk may not start. See client.log.")
+		return
+	}
+	marker := filepath.Join(installDir, prereqMarker)
+	if err := os.WriteFile(marker, []byte(time.Now().Format(time.RFC3339)+"\n"), 0o644); err != nil {
+		log.Printf("Failed to write prerequisite marker: %v", err)
+	}
+	fmt.Println("BizHawk prerequisites installed.")
+}
+
+// suggestPrereqs explains a BizHawk startup crash on machines where the
+// prerequisite installer has not run.
+func suggestPrereqs(cfg *Config, uptime time.Duration) {
+	installDir := filepath.Dir(cfg.EmuHawkPath)
+	if uptime > fastCrashWindow || prereqsInstalled(installDir) {
+		return
+	}
+	msg := "BizHawk exited right after starting. This usually means the " +
+		".NET/VC++ prerequisites are missing."
+	if installer := findPrereqInstaller(installDir); installer != "" {
+		msg += " Run " + installer + " and restart the client."
+	}
+	log.Print(msg)
+	fmt.Fprintln(os.Stderr, msg)
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package app
+
+import "fmt"
+
+func runPrereqInstaller(path string) error {
+	return fmt.Errorf("prerequisite installer is only supported on Windows")
+}
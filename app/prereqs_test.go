@@ -0,0 +1,77 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// stubPrereqInstaller replaces the installer run, recording each path
+// and returning err.
+func stubPrereqInstaller(t *testing.T, err error) *[]string {
+	t.Helper()
+	var ran []string
+	old := installPrereqs
+	installPrereqs = func(path string) error {
+		ran = append(ran, path)
+		return err
+	}
+	t.Cleanup(func() { installPrereqs = old })
+	return &ran
+}
+
+func prereqInstallDir(t *testing.T, files ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestEnsurePrereqsRunsOnce(t *testing.T) {
+	ran := stubPrereqInstaller(t, nil)
+	dir := prereqInstallDir(t, "EmuHawk.exe", "bizhawk_prereqs.exe", "prereqs.txt")
+
+	ensurePrereqs(&Config{}, dir)
+	ensurePrereqs(&Config{}, dir)
+	if want := []string{filepath.Join(dir, "bizhawk_prereqs.exe")}; !slices.Equal(*ran, want) {
+		t.Errorf("installer runs = %v; want %v", *ran, want)
+	}
+	if !prereqsInstalled(dir) {
+		t.Error("no marker after a successful install")
+	}
+}
+
+func TestEnsurePrereqsFailureRetries(t *testing.T) {
+	ran := stubPrereqInstaller(t, errors.New("exit status 1603"))
+	dir := prereqInstallDir(t, "BizHawk-Prereqs.EXE")
+
+	ensurePrereqs(&Config{}, dir)
+	if prereqsInstalled(dir) {
+		t.Error("marker written after a failed install")
+	}
+	ensurePrereqs(&Config{}, dir)
+	if len(*ran) != 2 {
+		t.Errorf("installer ran %d times; want a retry on the next start", len(*ran))
+	}
+}
+
+func TestEnsurePrereqsSkipped(t *testing.T) {
+	ran := stubPrereqInstaller(t, nil)
+
+	ensurePrereqs(&Config{SkipPrereqInstall: true}, prereqInstallDir(t, "prereqs.exe"))
+	// Without an installer there is nothing to run, and nothing is marked.
+	bare := prereqInstallDir(t, "EmuHawk.exe")
+	ensurePrereqs(&Config{}, bare)
+	if len(*ran) != 0 {
+		t.Errorf("installer ran: %v", *ran)
+	}
+	if prereqsInstalled(bare) {
+		t.Error("marker written without an installer")
+	}
+}
@@ -0,0 +1,29 @@
+//go:build windows
+
+package app
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// runPrereqInstaller runs the installer elevated and silent, waiting for it
+// to finish. Start-Process -Verb RunAs triggers the UAC prompt.
+func runPrereqInstaller(path string) error {
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", prereqScript(path))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// prereqScript is the PowerShell command that runs the installer at path,
+// quoted as a single-quoted string literal.
+func prereqScript(path string) string {
+	return fmt.Sprintf(
+		"$p = Start-Process -FilePath '%s' -ArgumentList '/quiet','/norestart' -Verb RunAs -Wait -PassThru; exit $p.ExitCode",
+		strings.ReplaceAll(path, "'", "''"),
+	)
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package app
+
+import "testing"
+
+func TestPrereqScriptQuotesPath(t *testing.T) {
+	got := prereqScript(`C:\Games\O'Brien's BizHawk\prereqs.exe`)
+	want := `$p = Start-Process -FilePath 'C:\Games\O''Brien''s BizHawk\prereqs.exe' -ArgumentList '/quiet','/norestart' -Verb RunAs -Wait -PassThru; exit $p.ExitCode`
+	if got != want {
+		t.Errorf("prereqScript =\n%s\nwant\n%s", got, want)
+	}
+}
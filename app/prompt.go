@@ -0,0 +1,203 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed web/prompt.html
+var promptPage []byte
+
+// hiddenAccessFile is where hidden mode writes the URL and control token of
+// the local web UI, so the player can find it without a console.
+const hiddenAccessFile = "web_ui_access.txt"
+
+// Prompter asks the player for a value during Bootstrap. The console
+// prompter reads stdin; in hidden mode the web prompter serves a form.
+type Prompter interface {
+	Ask(ctx context.Context, key, label string) (string, error)
+}
+
+// prompter is the backend used by Bootstrap's interactive questions.
+var prompter Prompter = newConsolePrompter(os.Stdin, os.Stdout)
+
+// consolePrompter reads answers in a goroutine so a cancelled Ask returns
+// at once; a line typed afterwards answers the next question.
+type consolePrompter struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	once  sync.Once
+	lines chan consoleLine
+}
+
+type consoleLine struct {
+	text string
+	err  error
+}
+
+func newConsolePrompter(in io.Reader, out io.Writer) *consolePrompter {
+	return &consolePrompter{in: bufio.NewReader(in), out: out, lines: make(chan consoleLine)}
+}
+
+func (p *consolePrompter) read() {
+	for {
+		line, err := p.in.ReadString('\n')
+		p.lines <- consoleLine{line, err}
+		if err != nil {
+			close(p.lines)
+			return
+		}
+	}
+}
+
+func (p *consolePrompter) Ask(ctx context.Context, key, label string) (string, error) {
+	p.once.Do(func() { go p.read() })
+	fmt.Fprintf(p.out, "%s: ", label)
+	select {
+	case <-ctx.Done():
+		fmt.Fprintln(p.out)
+		return "", ctx.Err()
+	case l, ok := <-p.lines:
+		if !ok || (l.err != nil && l.text == "") {
+			if l.err == nil {
+				l.err = io.EOF
+			}
+			return "", l.err
+		}
+		return strings.TrimSpace(l.text), nil
+	}
+}
+
+// pendingPrompt is the question the web form currently shows.
+type pendingPrompt struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+
+	answer chan string
+}
+
+// webPrompter answers Bootstrap's questions through a form on the local
+// web UI. Answers require the control token.
+type webPrompter struct {
+	token string
+
+	mu      sync.Mutex
+	pending *pendingPrompt
+}
+
+func newWebPrompter(token string) *webPrompter {
+	return &webPrompter{token: token}
+}
+
+func (p *webPrompter) Ask(ctx context.Context, key, label string) (string, error) {
+	q := &pendingPrompt{Key: key, Label: label, answer: make(chan string, 1)}
+	p.mu.Lock()
+	p.pending = q
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		if p.pending == q {
+			p.pending = nil
+		}
+		p.mu.Unlock()
+	}()
+	log.Printf("Waiting for %q from the web UI", key)
+	select {
+	case v := <-q.answer:
+		return strings.TrimSpace(v), nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Handler serves the prompt form and its endpoints.
+func (p *webPrompter) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(promptPage)
+	})
+	mux.HandleFunc("GET /api/prompt", p.handleGet)
+	mux.Handle("POST /api/control/prompt", controlTokenGuard(p.token, http.HandlerFunc(p.handleAnswer)))
+	return localOnly(mux)
+}
+
+func (p *webPrompter) handleGet(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	q := p.pending
+	p.mu.Unlock()
+	writeJSON(w, q)
+}
+
+func (p *webPrompter) handleAnswer(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&data); err != nil {
+		http.Error(w, "bad payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.mu.Lock()
+	q := p.pending
+	p.mu.Unlock()
+	if q == nil || q.Key != data.Key {
+		http.Error(w, "no such question pending", http.StatusConflict)
+		return
+	}
+	select {
+	case q.answer <- data.Value:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "already answered", http.StatusConflict)
+	}
+}
+
+// servePrompts serves the web prompter on addr until ctx is done. If addr
+// is taken it falls back to any free loopback port. The effective URL and
+// token are written to hiddenAccessFile either way.
+func servePrompts(ctx context.Context, p *webPrompter, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		host, _, _ := net.SplitHostPort(addr)
+		log.Printf("Web UI port unavailable (%v); using a random port", err)
+		if ln, err = net.Listen("tcp", hostPort(host, 0)); err != nil {
+			return fmt.Errorf("listen for web UI: %w", err)
+		}
+	}
+	url := "http://" + ln.Addr().String() + "/"
+	if err := writeHiddenAccess(url, p.token); err != nil {
+		log.Printf("Could not write %s: %v", hiddenAccessFile, err)
+	}
+	log.Printf("Setup form on %s", url)
+
+	srv := &http.Server{Handler: p.Handler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// writeHiddenAccess records how to reach the web UI when there is no
+// console to print it on.
+func writeHiddenAccess(url, token string) error {
+	body := fmt.Sprintf("url=%s\ntoken=%s\nopen=%s?token=%s\n", url, token, url, token)
+	return os.WriteFile(hiddenAccessFile, []byte(body), 0o600)
+}
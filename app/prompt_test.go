@@ -0,0 +1,192 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConsolePrompter(t *testing.T) {
+	in, typed := io.Pipe()
+	var out strings.Builder
+	p := newConsolePrompter(in, &out)
+
+	go func() { _, _ = io.WriteString(typed, "  ana \r\n") }()
+	if v, err := p.Ask(context.Background(), "player_name", "Player name"); v != "ana" || err != nil {
+		t.Errorf("Ask = %q, %v; want the trimmed line", v, err)
+	}
+
+	// A cancelled question returns at once; the line typed afterwards
+	// answers the next one.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.Ask(ctx, "session_name", "Session"); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled Ask = %v", err)
+	}
+	go func() {
+		_, _ = io.WriteString(typed, "relay\nlast")
+		typed.Close()
+	}()
+	if v, err := p.Ask(context.Background(), "session_name", "Session"); v != "relay" || err != nil {
+		t.Errorf("Ask after cancel = %q, %v", v, err)
+	}
+	// An unterminated last line still counts; after it the input is done.
+	if v, err := p.Ask(context.Background(), "server", "Server"); v != "last" || err != nil {
+		t.Errorf("Ask on the unterminated line = %q, %v", v, err)
+	}
+	if _, err := p.Ask(context.Background(), "server", "Server"); err != io.EOF {
+		t.Errorf("Ask at end of input = %v; want io.EOF", err)
+	}
+	if got := out.String(); !strings.HasPrefix(got, "Player name: Session: \nSession: Server: ") {
+		t.Errorf("console output %q", got)
+	}
+}
+
+// startWebPrompts serves p from a temp directory and returns the URL it
+// recorded in hiddenAccessFile.
+func startWebPrompts(t *testing.T, p *webPrompter, addr string) string {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- servePrompts(ctx, p, addr) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("servePrompts: %v", err)
+		}
+	})
+	var access []byte
+	waitFor(t, "the web UI access file", func() bool {
+		var err error
+		access, err = os.ReadFile(hiddenAccessFile)
+		return err == nil
+	})
+	for _, line := range strings.Split(string(access), "\n") {
+		if url, ok := strings.CutPrefix(line, "url="); ok {
+			if !strings.Contains(string(access), "token="+p.token+"\n") {
+				t.Errorf("access file %q does not carry the token", access)
+			}
+			return url
+		}
+	}
+	t.Fatalf("no url in %q", access)
+	return ""
+}
+
+// answerPrompt posts an answer and returns the response status.
+func answerPrompt(t *testing.T, url, token, key, value string) int {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"key": key, "value": value})
+	req, _ := http.NewRequest(http.MethodPost, url+"api/control/prompt", strings.NewReader(string(body)))
+	if token != "" {
+		req.Header.Set("X-Control-Token", token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func pendingKey(t *testing.T, url string) string {
+	t.Helper()
+	resp, err := http.Get(url + "api/prompt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var q *pendingPrompt
+	if err := json.NewDecoder(resp.Body).Decode(&q); err != nil {
+		t.Fatal(err)
+	}
+	if q == nil {
+		return ""
+	}
+	return q.Key + "|" + q.Label
+}
+
+func TestWebPromptFlow(t *testing.T) {
+	p := newWebPrompter(testControlToken)
+	url := startWebPrompts(t, p, "127.0.0.1:0")
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("form page: %s %s", resp.Status, resp.Header.Get("Content-Type"))
+	}
+	if q := pendingKey(t, url); q != "" {
+		t.Errorf("pending question %q before any Ask", q)
+	}
+
+	answered := make(chan string, 1)
+	go func() {
+		v, err := p.Ask(context.Background(), "player_name", "Player name")
+		if err != nil {
+			v = "error: " + err.Error()
+		}
+		answered <- v
+	}()
+	waitFor(t, "the question on the form", func() bool { return pendingKey(t, url) == "player_name|Player name" })
+
+	if code := answerPrompt(t, url, "", "player_name", "ana"); code != http.StatusUnauthorized {
+		t.Errorf("answer without the token = %d; want 401", code)
+	}
+	if code := answerPrompt(t, url, testControlToken, "session_name", "ana"); code != http.StatusConflict {
+		t.Errorf("answer to another question = %d; want 409", code)
+	}
+	if code := answerPrompt(t, url, testControlToken, "player_name", " ana "); code != http.StatusNoContent {
+		t.Fatalf("answer = %d; want 204", code)
+	}
+	select {
+	case v := <-answered:
+		if v != "ana" {
+			t.Errorf("Ask = %q; want the trimmed answer", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Ask did not return after the answer")
+	}
+	if q := pendingKey(t, url); q != "" {
+		t.Errorf("question %q still pending after its answer", q)
+	}
+	if code := answerPrompt(t, url, testControlToken, "player_name", "bo"); code != http.StatusConflict {
+		t.Errorf("late answer = %d; want 409", code)
+	}
+}
+
+func TestWebPromptCancel(t *testing.T) {
+	p := newWebPrompter(testControlToken)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := p.Ask(ctx, "player_name", "Player name"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Ask = %v; want the context error", err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending != nil {
+		t.Errorf("question %q left pending", p.pending.Key)
+	}
+}
+
+func TestServePromptsPortTaken(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+	url := startWebPrompts(t, newWebPrompter(testControlToken), taken.Addr().String())
+	if url == "http://"+taken.Addr().String()+"/" || !strings.HasPrefix(url, "http://127.0.0.1:") {
+		t.Errorf("fallback URL %s; want another loopback port", url)
+	}
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// configureProxy routes the shared transports (see configureTLS) through
+// proxy_url when set, and otherwise through the proxy named by the
+// HTTP_PROXY/HTTPS_PROXY environment variables, if any. Like TLS, the
+// Pusher websocket is dialled by the library directly and cannot use the
+// proxy; while it is down, commands are polled over HTTP instead.
+func configureProxy(cfg *Config) error {
+	proxy := http.ProxyFromEnvironment
+	if cfg.ProxyURL != "" {
+		u, err := url.Parse(cfg.ProxyURL)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("invalid proxy_url %q", cfg.ProxyURL)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("proxy_url %q: unsupported scheme %q", cfg.ProxyURL, u.Scheme)
+		}
+		proxy = http.ProxyURL(u)
+		log.Printf("Using proxy %s from proxy_url", u.Redacted())
+	} else if env := proxyFromEnv(); env != "" {
+		log.Printf("Using proxy from the environment: %s", env)
+	} else {
+		log.Println("No proxy configured; connecting directly")
+		return nil
+	}
+	http.DefaultTransport.(*http.Transport).Proxy = proxy
+	downloadClient.Transport.(*http.Transport).Proxy = proxy
+	log.Println("Note: the websocket connection does not go through the proxy")
+	return nil
+}
+
+// proxyFromEnv names the proxy environment variables that are set.
+func proxyFromEnv() string {
+	var set string
+	for _, name := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"} {
+		if v := os.Getenv(name); v != "" {
+			if set != "" {
+				set += ", "
+			}
+			if u, err := url.Parse(v); err == nil {
+				v = u.Redacted()
+			}
+			set += name + "=" + v
+		}
+	}
+	return set
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const pusherAuthTTL = 30 * time.Second
+
+type authCacheEntry struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// pusherAuthCache is an http.RoundTripper that caches channel auth responses.
+// The pusher library authenticates through http.DefaultClient with no hook of
+// its own, so the cache is installed as that client's transport and only
+// intercepts POSTs to the auth URL; everything else passes straight through.
+//
+// Entries are keyed by socket ID (one per websocket generation), channel,
+// and bearer token, so a token rotation never serves a stale signature.
+type pusherAuthCache struct {
+	next    http.RoundTripper
+	authURL string
+
+	mu      sync.Mutex
+	entries map[string]authCacheEntry
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+var (
+	authCacheOnce   sync.Once
+	sharedAuthCache *pusherAuthCache
+)
+
+// installPusherAuthCache wraps http.DefaultClient's transport with the auth
+// cache for authURL. Repeated calls update the URL and drop cached entries.
+func installPusherAuthCache(authURL string) *pusherAuthCache {
+	authCacheOnce.Do(func() {
+		next := http.DefaultClient.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		sharedAuthCache = &pusherAuthCache{
+			next:    next,
+			entries: make(map[string]authCacheEntry),
+		}
+		http.DefaultClient.Transport = sharedAuthCache
+	})
+	sharedAuthCache.mu.Lock()
+	if sharedAuthCache.authURL != authURL {
+		sharedAuthCache.authURL = authURL
+		sharedAuthCache.entries = make(map[string]authCacheEntry)
+	}
+	sharedAuthCache.mu.Unlock()
+	return sharedAuthCache
+}
+
+// Invalidate drops every cached signature (token rotation, app-key refresh).
+func (c *pusherAuthCache) Invalidate() {
+	c.mu.Lock()
+	c.entries = make(map[string]authCacheEntry)
+	c.mu.Unlock()
+}
+
+// Stats returns cache hit and miss counts.
+func (c *pusherAuthCache) Stats() (hits, misses int64) {
+	return c.hits.Load(), c.misses.Load()
+}
+
+func (c *pusherAuthCache) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	authURL := c.authURL
+	c.mu.Unlock()
+	if req.Method != http.MethodPost || req.URL.String() != authURL || req.Body == nil {
+		return c.next.RoundTrip(req)
+	}
+
+	raw, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(raw))
+	form, _ := url.ParseQuery(string(raw))
+	key := form.Get("socket_id") + "|" + form.Get("channel_name") + "|" +
+		req.Header.Get("Authorization")
+
+	now := time.Now()
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		hits := c.hits.Add(1)
+		debugf("Pusher auth cache hit for %s (hits=%d misses=%d)",
+			form.Get("channel_name"), hits, c.misses.Load())
+		return &http.Response{
+			Status:     http.StatusText(entry.status),
+			StatusCode: entry.status,
+			Header:     entry.header.Clone(),
+			Body:       io.NopCloser(bytes.NewReader(entry.body)),
+			Request:    req,
+		}, nil
+	}
+	c.misses.Add(1)
+
+	resp, err := c.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	c.mu.Lock()
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = authCacheEntry{
+		status:  resp.StatusCode,
+		header:  resp.Header.Clone(),
+		body:    body,
+		expires: now.Add(pusherAuthTTL),
+	}
+	c.mu.Unlock()
+	return resp, nil
+}
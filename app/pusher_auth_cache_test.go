@@ -0,0 +1,115 @@
+package app
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPusherAuthCache(t *testing.T) {
+	var authHits, otherHits atomic.Int32
+	var failing atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/broadcasting/auth" {
+			otherHits.Add(1)
+			return
+		}
+		authHits.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_ = r.ParseForm()
+		_, _ = io.WriteString(w, `{"auth":"sig:`+r.PostForm.Get("channel_name")+`"}`)
+	}))
+	defer srv.Close()
+
+	authURL := srv.URL + "/broadcasting/auth"
+	cache := &pusherAuthCache{
+		next:    http.DefaultTransport,
+		authURL: authURL,
+		entries: make(map[string]authCacheEntry),
+	}
+	client := &http.Client{Transport: cache}
+	auth := func(socket, channel, token string) string {
+		t.Helper()
+		form := url.Values{"socket_id": {socket}, "channel_name": {channel}}
+		req, _ := http.NewRequest(http.MethodPost, authURL, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			return resp.Status
+		}
+		return string(body)
+	}
+
+	steps := []struct {
+		name                   string
+		socket, channel, token string
+		wantHits               int32
+	}{
+		{"first request", "1.1", "private-a", "t1", 1},
+		{"repeat is cached", "1.1", "private-a", "t1", 1},
+		{"other channel", "1.1", "private-b", "t1", 2},
+		{"new socket", "2.2", "private-a", "t1", 3},
+		{"rotated token", "1.1", "private-a", "t2", 4},
+		{"rotated token cached", "1.1", "private-a", "t2", 4},
+	}
+	for _, s := range steps {
+		if got := auth(s.socket, s.channel, s.token); got != `{"auth":"sig:`+s.channel+`"}` {
+			t.Errorf("%s: body %s", s.name, got)
+		}
+		if n := authHits.Load(); n != s.wantHits {
+			t.Errorf("%s: server saw %d auth requests; want %d", s.name, n, s.wantHits)
+		}
+	}
+	if hits, misses := cache.Stats(); hits != 2 || misses != 4 {
+		t.Errorf("stats = %d hits, %d misses; want 2, 4", hits, misses)
+	}
+
+	// Expired and invalidated entries go back to the server.
+	cache.mu.Lock()
+	for k, e := range cache.entries {
+		e.expires = time.Now().Add(-time.Second)
+		cache.entries[k] = e
+	}
+	cache.mu.Unlock()
+	auth("1.1", "private-a", "t1")
+	cache.Invalidate()
+	auth("1.1", "private-a", "t1")
+	if n := authHits.Load(); n != 6 {
+		t.Errorf("server saw %d auth requests; want 6 after expiry and invalidation", n)
+	}
+
+	// Refusals are not cached.
+	failing.Store(true)
+	auth("3.3", "private-a", "t1")
+	failing.Store(false)
+	auth("3.3", "private-a", "t1")
+	if n := authHits.Load(); n != 8 {
+		t.Errorf("server saw %d auth requests; want the 403 retried", n)
+	}
+
+	// Other requests pass straight through.
+	for i := 0; i < 2; i++ {
+		resp, err := client.Post(srv.URL+"/api/other", "text/plain", strings.NewReader("x"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if n := otherHits.Load(); n != 2 {
+		t.Errorf("server saw %d other requests; want 2", n)
+	}
+}
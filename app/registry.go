@@ -0,0 +1,83 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+)
+
+// HandlerFunc processes the payload of a single server event type.
+type HandlerFunc func(payload json.RawMessage)
+
+// Registry maps server event types to their handlers.
+type Registry struct {
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+}
+
+func NewRegistry() *Registry {
+	return &Registry{handlers: make(map[string]HandlerFunc)}
+}
+
+// Register installs fn for eventType, replacing (and logging) any
+// existing handler so forks can deliberately override built-ins.
+func (r *Registry) Register(eventType string, fn HandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.handlers[eventType]; exists {
+		log.Printf("[WARN] Handler for %q replaced", eventType)
+	}
+	r.handlers[eventType] = fn
+}
+
+// Lookup returns the handler for eventType.
+func (r *Registry) Lookup(eventType string) (HandlerFunc, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	fn, ok := r.handlers[eventType]
+	return fn, ok
+}
+
+// Types returns the registered event types in sorted order.
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]string, 0, len(r.handlers))
+	for t := range r.handlers {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// ServerAPI is the subset of API available to out-of-tree handlers.
+type ServerAPI interface {
+	SwapComplete(ctx context.Context, roundNumber int) error
+	GameStarted(ctx context.Context, gameName string, round *int) error
+	GameStopped(ctx context.Context) error
+	SessionState(ctx context.Context, state *ClientState) error
+}
+
+// EmulatorIPC is the subset of BizhawkIPC available to out-of-tree handlers.
+type EmulatorIPC interface {
+	SendCommand(parts ...string) error
+	Supports(cmd string) bool
+	SendSync() error
+	SendSwap(at int64, game string)
+	SendSave(path string)
+	SendPause(at *int64)
+	SendResume(at *int64)
+	SendMessage(msg string)
+}
+
+// Deps is what custom handlers receive. Stability contract: fields and
+// interface methods are only ever added, never removed or changed, within
+// a major version, so out-of-tree handlers keep compiling across updates.
+type Deps struct {
+	API    ServerAPI
+	IPC    EmulatorIPC
+	State  *ClientState
+	Config *Config
+}
@@ -0,0 +1,133 @@
+package app
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RecoveryTrigger names what started a session recovery.
+type RecoveryTrigger string
+
+const (
+	TriggerResume   RecoveryTrigger = "resume"
+	TriggerWatchdog RecoveryTrigger = "watchdog"
+
+	TriggerServerRestart RecoveryTrigger = "server_restart"
+)
+
+// clockJumpThreshold is how far the wall clock may run ahead of the
+// monitor's tick interval before we assume the machine was asleep.
+const clockJumpThreshold = 30 * time.Second
+
+// recoveryRequest asks the recovery loop to resynchronize the session.
+type recoveryRequest struct {
+	trigger RecoveryTrigger
+	gap     time.Duration
+}
+
+// requestRecovery queues a recovery; one already pending absorbs the new one.
+func (a *App) requestRecovery(trigger RecoveryTrigger, gap time.Duration) {
+	select {
+	case a.recoveries <- recoveryRequest{trigger: trigger, gap: gap}:
+	default:
+	}
+}
+
+// watchClockJumps sends the wall-clock gap on jumps whenever a tick
+// arrives much later than expected, which is how sleep looks from inside
+// the process. Wall time is compared because the monotonic clock may not
+// advance while suspended. now is the wall clock.
+func watchClockJumps(ctx context.Context, interval time.Duration, now func() time.Time, jumps chan<- time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := now().Round(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t := now().Round(0)
+			if gap := t.Sub(last); gap > interval+clockJumpThreshold {
+				select {
+				case jumps <- gap:
+				default:
+				}
+			}
+			last = t
+		}
+	}
+}
+
+// runRecoveries serializes recovery requests from the clock-jump monitor,
+// OS power notifications, and the watchdog.
+func (a *App) runRecoveries(ctx context.Context) {
+	jumps := make(chan time.Duration, 1)
+	go watchClockJumps(ctx, 5*time.Second, time.Now, jumps)
+	go watchPowerResume(ctx, func() { a.requestRecovery(TriggerResume, 0) })
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case gap := <-jumps:
+			a.requestRecovery(TriggerResume, gap)
+		case req := <-a.recoveries:
+			a.recoverSession(ctx, req.trigger, req.gap)
+		}
+	}
+}
+
+// recoverSession pauses the emulator, resynchronizes with the server,
+// reconnects Pusher, and resumes with a summary of what changed.
+func (a *App) recoverSession(ctx context.Context, trigger RecoveryTrigger, gap time.Duration) {
+	if gap > 0 {
+		log.Printf("Recovering session after %s (gap %s)", trigger, gap.Round(time.Second))
+	} else {
+		log.Printf("Recovering session after %s", trigger)
+	}
+	a.ipc.SendPause(nil)
+	before := a.state.Snapshot()
+
+	// Events already queued by Pusher still go through the catch-up policy
+	// in their handlers; this fetch replaces whatever they would have done.
+	rctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	err := a.api.SessionState(rctx, a.state)
+	cancel()
+	if err != nil {
+		log.Printf("Recovery resync failed: %v", err)
+	}
+	if p := a.pusher.Load(); p != nil {
+		p.Reconnect()
+	}
+	after := a.state.Snapshot()
+
+	if err := a.ipc.SendSync(); err != nil {
+		log.Printf("[IPC] Failed to send SYNC: %v", err)
+	}
+	msg := recoverySummary(trigger, before, after)
+	if msg == "" {
+		log.Printf("Recovered after %s (overlay message disabled)", trigger)
+		return
+	}
+	log.Print(msg)
+	a.ipc.SendMessage(msg)
+}
+
+// recoverySummary describes what changed while the client was away. It
+// returns "" when the host disabled the message.
+func recoverySummary(trigger RecoveryTrigger, before, after ClientStateSnapshot) string {
+	prefix := messages.Render(MsgReconnected, nil)
+	if trigger == TriggerResume {
+		prefix = messages.Render(MsgRecoveredFromSleep, nil)
+	}
+	vars := MsgVars{"prefix": prefix, "game": after.CurrentGame, "state": after.State}
+	switch {
+	case before.CurrentGame != after.CurrentGame && after.CurrentGame != "":
+		return messages.Render(MsgRecoveryMissedSwap, vars)
+	case before.State != after.State:
+		return messages.Render(MsgRecoveryNewState, vars)
+	default:
+		return messages.Render(MsgRecoveryNoChange, vars)
+	}
+}
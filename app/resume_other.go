@@ -0,0 +1,9 @@
+//go:build !windows
+
+package app
+
+import "context"
+
+// watchPowerResume is a no-op where no power notification API is wired up;
+// the clock-jump monitor covers resume detection.
+func watchPowerResume(ctx context.Context, onResume func()) {}
@@ -0,0 +1,112 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchClockJumps(t *testing.T) {
+	// Each tick reads the clock once; the fourth reading jumps ahead as
+	// if the machine slept through it.
+	var reads atomic.Int64
+	now := func() time.Time {
+		n := reads.Add(1)
+		at := goldenTime.Add(time.Duration(n) * time.Second)
+		if n >= 4 {
+			at = at.Add(time.Hour)
+		}
+		return at
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	jumps := make(chan time.Duration, 1)
+	go watchClockJumps(ctx, time.Millisecond, now, jumps)
+
+	select {
+	case gap := <-jumps:
+		if gap != time.Hour+time.Second {
+			t.Errorf("gap = %s; want 1h0m1s", gap)
+		}
+		if n := reads.Load(); n < 4 {
+			t.Errorf("jump reported after %d clock reads; want it on the fourth", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("clock jump not reported")
+	}
+
+	// Ticks after the jump are back to normal spacing.
+	select {
+	case gap := <-jumps:
+		t.Errorf("second jump %s reported", gap)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRecoverSessionAfterSleep(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/session-state" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"game_file":"zelda.sfc","state":"running"}`))
+	}))
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var cmds []string
+	ipc, _ := startTestIPC(t, func(id, cmd string) string {
+		mu.Lock()
+		cmds = append(cmds, cmd)
+		mu.Unlock()
+		return "ACK|" + id
+	})
+	state := ipc.state
+	state.SetCurrentGame("mario.nes")
+	state.SetState(goldenTime, "running")
+	cfg := &Config{ServerURL: srv.URL, BearerToken: "t"}
+	a := &App{cfg: cfg, state: state, api: NewAPI(cfg), ipc: ipc}
+
+	a.recoverSession(context.Background(), TriggerResume, time.Hour)
+	if got := state.GetCurrentGame(); got != "zelda.sfc" {
+		t.Errorf("current game after recovery = %s; want the server's", got)
+	}
+	waitFor(t, "overlay message", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(cmds) == 3
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if !strings.HasPrefix(cmds[0], "PAUSE") || !strings.HasPrefix(cmds[1], "SYNC|zelda.sfc|running|") {
+		t.Errorf("commands = %q; want PAUSE then SYNC to the server's game", cmds)
+	}
+	if want := "MSG|Resumed from sleep: missed swap to zelda.sfc"; cmds[2] != want {
+		t.Errorf("message = %q; want %q", cmds[2], want)
+	}
+}
+
+func TestRecoverySummary(t *testing.T) {
+	before := ClientStateSnapshot{CurrentGame: "mario.nes", State: "running"}
+	tests := []struct {
+		trigger RecoveryTrigger
+		after   ClientStateSnapshot
+		want    string
+	}{
+		{TriggerResume, ClientStateSnapshot{CurrentGame: "zelda.sfc", State: "running"}, "Resumed from sleep: missed swap to zelda.sfc"},
+		{TriggerWatchdog, ClientStateSnapshot{CurrentGame: "mario.nes", State: "paused"}, "Reconnected: game is now paused"},
+		{TriggerServerRestart, before, "Reconnected: nothing missed"},
+		// Losing the current game is a state change, not a swap.
+		{TriggerResume, ClientStateSnapshot{State: "stopped"}, "Resumed from sleep: game is now stopped"},
+	}
+	for _, tt := range tests {
+		if got := recoverySummary(tt.trigger, before, tt.after); got != tt.want {
+			t.Errorf("recoverySummary(%s, %+v) = %q; want %q", tt.trigger, tt.after, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+//go:build windows
+
+package app
+
+import (
+	"context"
+	"log"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	deviceNotifyCallback  = 2
+	pbtAPMResumeSuspend   = 0x7
+	pbtAPMResumeAutomatic = 0x12
+)
+
+type deviceNotifySubscribeParameters struct {
+	callback uintptr
+	context  uintptr
+}
+
+// watchPowerResume registers for suspend/resume notifications via
+// PowerRegisterSuspendResumeNotification and calls onResume on wake.
+func watchPowerResume(ctx context.Context, onResume func()) {
+	powrprof := syscall.NewLazyDLL("powrprof.dll")
+	register := powrprof.NewProc("PowerRegisterSuspendResumeNotification")
+	unregister := powrprof.NewProc("PowerUnregisterSuspendResumeNotification")
+	if register.Find() != nil {
+		return
+	}
+
+	params := &deviceNotifySubscribeParameters{
+		callback: syscall.NewCallback(func(_, typ, _ uintptr) uintptr {
+			if typ == pbtAPMResumeSuspend || typ == pbtAPMResumeAutomatic {
+				onResume()
+			}
+			return 0
+		}),
+	}
+	var handle uintptr
+	r, _, err := register.Call(
+		deviceNotifyCallback,
+		uintptr(unsafe.Pointer(params)),
+		uintptr(unsafe.Pointer(&handle)),
+	)
+	if r != 0 {
+		log.Printf("Power notifications unavailable: %v", err)
+		return
+	}
+	<-ctx.Done()
+	unregister.Call(handle)
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// ChangeRole moves the client between player and spectator mid-session. A
+// leaving player's final save is uploaded and its game reported stopped
+// before swaps stop being accepted; a returning spectator must have every
+// session ROM in place before it is a player again.
+func (h *Handlers) ChangeRole(payload json.RawMessage) {
+	var data struct {
+		Role string `json:"role"`
+		// CloseEmulator closes BizHawk when becoming a spectator rather
+		// than leaving it open and idle.
+		CloseEmulator bool `json:"close_emulator"`
+	}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		log.Printf("handleChangeRole: bad payload: %v", err)
+		return
+	}
+	current := h.state.Role()
+	switch {
+	case data.Role == current:
+		debugf("handleChangeRole: already %s", current)
+	case data.Role == RoleSpectator:
+		h.becomeSpectator(data.CloseEmulator)
+	case data.Role == RolePlayer:
+		if err := h.becomePlayer(); err != nil {
+			log.Printf("handleChangeRole: staying %s: %v", current, err)
+			h.reportRoleRejected("change_role", err.Error())
+		}
+	default:
+		log.Printf("handleChangeRole: unknown role %q", data.Role)
+	}
+}
+
+func (h *Handlers) becomeSpectator(closeEmulator bool) {
+	log.Println("Becoming a spectator")
+	h.schedule.Cancel(slotSwap)
+	h.schedule.Cancel(slotState)
+	h.uploadFinalSave("role change")
+	h.ipc.SendPause(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := h.api.GameStopped(ctx); err != nil {
+		log.Printf("game-stopped error: %v", err)
+	}
+	cancel()
+
+	// From here on gameplay commands to the emulator are dropped (see
+	// spectatorMuted) and swap events are refused.
+	h.state.SetRole(RoleSpectator)
+	h.sendText(MsgSpectating, nil)
+	if closeEmulator && h.closeEmulator != nil {
+		if err := h.closeEmulator(); err != nil {
+			log.Printf("handleChangeRole: closing BizHawk failed: %v", err)
+		}
+	}
+}
+
+// becomePlayer re-runs Bootstrap's ROM checks, downloading anything
+// missing or corrupt, and reopens BizHawk if it was closed.
+func (h *Handlers) becomePlayer() error {
+	log.Println("Becoming a player again")
+	h.manifestMu.RLock()
+	m := h.manifest
+	h.manifestMu.RUnlock()
+	if m == nil {
+		return fmt.Errorf("no session manifest to check ROMs against")
+	}
+	for _, file := range m.Files() {
+		path := h.romPath(file)
+		if _, err := os.Stat(path); err == nil && checkROMHash(path, m.Checksum(file)) == nil {
+			continue
+		}
+		log.Printf("ROM %s missing or corrupt; downloading before playing", file)
+		if err := h.fetchROM(DownloadUrgent, file); err != nil {
+			h.state.FlagMissingGame(file)
+			return err
+		}
+	}
+	if h.launchEmulator != nil {
+		if err := h.launchEmulator(); err != nil {
+			return fmt.Errorf("reopen BizHawk: %w", err)
+		}
+	}
+	h.state.SetRole(RolePlayer)
+	if err := h.ipc.SendSync(); err != nil {
+		debugf("[IPC] SYNC after role change failed: %v", err)
+	}
+	h.sendText(MsgPlayingAgain, nil)
+	return nil
+}
+
+// rejectSpectator refuses event while the client is a spectator and
+// reports the refusal. It reports whether event was refused.
+func (h *Handlers) rejectSpectator(event string) bool {
+	if !h.state.Spectating() {
+		return false
+	}
+	log.Printf("Ignoring %s: this client is a spectator", event)
+	h.reportRoleRejected(event, "client is a spectator")
+	return true
+}
+
+func (h *Handlers) reportRoleRejected(event, reason string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.reports.ReportRoleRejected(ctx, event, h.state.Role(), reason); err != nil {
+		log.Printf("role-rejected report error: %v", err)
+	}
+}
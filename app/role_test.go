@@ -0,0 +1,141 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBecomeSpectator(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		closed  int
+	}{
+		{"leave BizHawk open", `{"role":"spectator"}`, 0},
+		{"close BizHawk", `{"role":"spectator","close_emulator":true}`, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newHandlerFixture(t)
+			f.state.SetCurrentGame("mario.nes")
+			closed := 0
+			f.h.closeEmulator = func() error { closed++; return nil }
+
+			f.dispatch("change_role", tt.payload)
+			// The final save is uploaded and the game reported stopped
+			// before the client stops playing.
+			if got, want := f.server.Calls(), []string{"UploadSave", "GameStopped"}; !slices.Equal(got, want) {
+				t.Errorf("server calls = %v; want %v", got, want)
+			}
+			if got, want := f.emu.Sent(), []string{"SAVE", "PAUSE", "MSG"}; !slices.Equal(got, want) {
+				t.Errorf("emulator got %v; want %v", got, want)
+			}
+			if f.state.Role() != RoleSpectator || closed != tt.closed {
+				t.Errorf("role %q, BizHawk closed %d times; want spectator, %d", f.state.Role(), closed, tt.closed)
+			}
+
+			// The heartbeat carries the new role.
+			snap := BuildSnapshotExtended(SnapshotSources{State: f.state, Config: f.cfg})
+			if snap.Role != RoleSpectator {
+				t.Errorf("snapshot role = %q", snap.Role)
+			}
+
+			// Swaps and prepares are now refused and reported.
+			before := len(f.server.Calls())
+			f.dispatch("prepare_swap", `{"round_number":4,"save_path":"x.state"}`)
+			f.dispatch("swap", fmt.Sprintf(`{"new_game":"zelda.sfc","round_number":4,"swap_at":%d}`, time.Now().Unix()))
+			want := []string{"ReportRoleRejected", "ReportRoleRejected"}
+			if got := f.server.Calls()[before:]; !slices.Equal(got, want) {
+				t.Errorf("server calls after refusing = %v; want %v", got, want)
+			}
+			if got := f.emu.Sent(); len(got) != 3 {
+				t.Errorf("emulator got %v after refusing", got)
+			}
+		})
+	}
+}
+
+func TestBecomePlayer(t *testing.T) {
+	tests := []struct {
+		name      string
+		onDisk    bool
+		served    bool
+		launchErr error
+		wantRole  string
+		wantHits  int32
+		rejected  bool
+	}{
+		{"ROMs in place", true, false, nil, RolePlayer, 0, false},
+		{"missing ROM downloaded", false, true, nil, RolePlayer, 1, false},
+		{"missing ROM unavailable", false, false, nil, RoleSpectator, 1, true},
+		{"BizHawk fails to open", true, false, errors.New("no EmuHawk"), RoleSpectator, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newHandlerFixture(t)
+			f.state.SetRole(RoleSpectator)
+			files := map[string]string{}
+			if tt.served {
+				files["/api/roms/mario.nes"] = romBytes
+			}
+			var hits atomic.Int32
+			f.cfg.ServerURL = romServer(t, files, &hits).URL
+
+			// A one-game session keeps the ROM checks to mario.nes.
+			m := &SessionManifest{SessionName: "relay", Games: []ManifestGame{
+				{ID: 11, File: "mario.nes", SHA256: sha256Hex(romBytes)},
+			}}
+			f.h.setManifest(m)
+			if tt.onDisk {
+				if err := os.MkdirAll(f.cfg.RomDir, 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(f.h.romPath("mario.nes"), []byte(romBytes), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			launched := 0
+			f.h.launchEmulator = func() error { launched++; return tt.launchErr }
+
+			f.dispatch("change_role", `{"role":"player"}`)
+			if f.state.Role() != tt.wantRole {
+				t.Errorf("role = %q; want %q", f.state.Role(), tt.wantRole)
+			}
+			if hits.Load() != tt.wantHits {
+				t.Errorf("server saw %d downloads; want %d", hits.Load(), tt.wantHits)
+			}
+			if got := slices.Contains(f.server.Calls(), "ReportRoleRejected"); got != tt.rejected {
+				t.Errorf("role change rejected = %v; want %v", got, tt.rejected)
+			}
+			if tt.wantRole == RolePlayer {
+				if launched != 1 || !slices.Equal(f.emu.Sent(), []string{"SYNC", "MSG"}) {
+					t.Errorf("launched %d, emulator got %v; want BizHawk reopened and synced", launched, f.emu.Sent())
+				}
+			}
+			if !tt.onDisk && !tt.served && !f.state.IsGameMissing("mario.nes") {
+				t.Error("undownloadable ROM not flagged missing")
+			}
+		})
+	}
+}
+
+func TestSpectatorMutesGameplayCommands(t *testing.T) {
+	state := NewClientState()
+	state.SetRole(RoleSpectator)
+	ipc := NewBizhawkIPC("127.0.0.1", 0, state)
+	// Muted commands are dropped as if acknowledged, even with no
+	// emulator connected.
+	for _, cmd := range []string{"PAUSE", "RESUME", "START", "SWAP"} {
+		if err := ipc.SendCommand(cmd); err != nil {
+			t.Errorf("%s while spectating: %v", cmd, err)
+		}
+	}
+	if err := ipc.SendCommand("SYNC"); err == nil {
+		t.Error("SYNC while spectating was dropped too")
+	}
+}
@@ -0,0 +1,270 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// packFile is one file found in a ROM pack.
+type packFile struct {
+	Path   string // on disk (extracted, for zips)
+	Name   string // path within the pack, for reporting
+	SHA256 string // empty when the manifest has no hashes to match
+}
+
+// importPlan is the outcome of matching a pack against the manifest.
+type importPlan struct {
+	Import    map[string]packFile // canonical file -> pack file
+	HashMatch map[string]bool     // imported entries matched by hash, not name
+	Present   []string            // already in RomDir with the right contents
+	Corrupt   map[string]packFile // matched by name but the hash differs
+	Missing   []string            // neither present nor in the pack
+	Unmatched []packFile          // pack files the session does not use
+}
+
+// planImport matches pack files to session files, by hash where the
+// manifest has one and by base name (case-insensitively) otherwise.
+// present reports whether a session file is already installed intact.
+func planImport(m *SessionManifest, pack []packFile, present func(file string) bool) importPlan {
+	plan := importPlan{
+		Import:    make(map[string]packFile),
+		HashMatch: make(map[string]bool),
+		Corrupt:   make(map[string]packFile),
+	}
+	used := make([]bool, len(pack))
+	for _, file := range m.Files() {
+		want := m.Checksum(file)
+		match := -1
+		if want != "" {
+			for i, p := range pack {
+				if strings.EqualFold(p.SHA256, want) {
+					match = i
+					break
+				}
+			}
+		}
+		if match >= 0 {
+			used[match] = true
+			if present(file) {
+				plan.Present = append(plan.Present, file)
+			} else {
+				plan.Import[file] = pack[match]
+				plan.HashMatch[file] = true
+			}
+			continue
+		}
+		for i, p := range pack {
+			if used[i] || !strings.EqualFold(filepath.Base(p.Name), file) {
+				continue
+			}
+			used[i] = true
+			switch {
+			case present(file):
+				plan.Present = append(plan.Present, file)
+			case want != "":
+				plan.Corrupt[file] = p
+			default:
+				plan.Import[file] = p
+			}
+			match = i
+			break
+		}
+		if match < 0 {
+			if present(file) {
+				plan.Present = append(plan.Present, file)
+			} else {
+				plan.Missing = append(plan.Missing, file)
+			}
+		}
+	}
+	for i, p := range pack {
+		if !used[i] {
+			plan.Unmatched = append(plan.Unmatched, p)
+		}
+	}
+	sort.Strings(plan.Present)
+	sort.Strings(plan.Missing)
+	return plan
+}
+
+// scanPack lists the regular files under dir, hashing them when hash is
+// set.
+func scanPack(dir string, hash bool) ([]packFile, error) {
+	var pack []packFile
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			rel = d.Name()
+		}
+		p := packFile{Path: path, Name: filepath.ToSlash(rel)}
+		if hash {
+			if p.SHA256, err = fileSHA256(path); err != nil {
+				return err
+			}
+		}
+		pack = append(pack, p)
+		return nil
+	})
+	return pack, err
+}
+
+// installPackFile copies (or moves) src to dest via a temporary file, so
+// an interrupted import never leaves a truncated ROM under its real name.
+func installPackFile(src, dest string, move bool) error {
+	if move {
+		if err := replaceFile(src, dest); err == nil {
+			return nil
+		}
+		// Different volume; fall back to copying.
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := dest + partSuffix
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := replaceFile(tmp, dest); err != nil {
+		return err
+	}
+	if move {
+		_ = os.Remove(src)
+	}
+	return nil
+}
+
+// runImport installs the session's ROMs from a pack handed out offline (a
+// zip or a directory), so Bootstrap finds them present instead of
+// downloading them.
+func runImport(args []string, configPath string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	move := fs.Bool("move", false, "Move files out of a directory pack instead of copying them")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: import [--move] <zip file or directory>")
+	}
+	src := fs.Arg(0)
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	manifest, err := LoadManifest(manifestFile)
+	if err != nil {
+		return fmt.Errorf("no session manifest (%v); start the client once to join a session first", err)
+	}
+	manifest.AssignLocalNames(cfg.RomDir, pathLimit(cfg))
+	if err := os.MkdirAll(cfg.RomDir, 0o755); err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	dir := src
+	if !fi.IsDir() {
+		// Extract next to RomDir so installing is a rename, not a copy.
+		tmp, err := os.MkdirTemp(cfg.RomDir, ".import-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmp)
+		if err := checkFreeSpace("extract "+filepath.Base(src), tmp, uint64(fi.Size())); err != nil {
+			return err
+		}
+		fmt.Printf("Extracting %s...\n", src)
+		if err := extractZip(src, tmp); err != nil {
+			return fmt.Errorf("extract %s: %w", src, err)
+		}
+		dir, *move = tmp, true
+	}
+
+	hashed := false
+	for _, f := range manifest.Files() {
+		if manifest.Checksum(f) != "" {
+			hashed = true
+			break
+		}
+	}
+	pack, err := scanPack(dir, hashed)
+	if err != nil {
+		return err
+	}
+	localPath := func(file string) string {
+		return filepath.Join(cfg.RomDir, manifest.LocalName(file))
+	}
+	present := func(file string) bool {
+		if _, err := os.Stat(localPath(file)); err != nil {
+			return false
+		}
+		return checkROMHash(localPath(file), manifest.Checksum(file)) == nil
+	}
+	plan := planImport(manifest, pack, present)
+
+	imported, failed := 0, 0
+	for _, file := range slices.Sorted(maps.Keys(plan.Import)) {
+		p := plan.Import[file]
+		dest := localPath(file)
+		if err := installPackFile(p.Path, dest, *move); err != nil {
+			fmt.Printf("FAIL      %s: %v\n", file, err)
+			failed++
+			continue
+		}
+		if p.SHA256 != "" {
+			recordSHA256(dest, p.SHA256)
+		}
+		how := "by name"
+		if plan.HashMatch[file] {
+			how = "by hash"
+		}
+		if p.Name != file {
+			how += " from " + p.Name
+		}
+		fmt.Printf("IMPORTED  %s (%s)\n", file, how)
+		imported++
+	}
+	saveRomHashes()
+
+	for _, file := range plan.Present {
+		fmt.Printf("SKIPPED   %s (already present)\n", file)
+	}
+	for _, file := range slices.Sorted(maps.Keys(plan.Corrupt)) {
+		fmt.Printf("CORRUPT   %s: %s does not match the session checksum\n", file, plan.Corrupt[file].Name)
+	}
+	for _, file := range plan.Missing {
+		fmt.Printf("MISSING   %s (not in pack; will be downloaded)\n", file)
+	}
+	for _, p := range plan.Unmatched {
+		fmt.Printf("UNMATCHED %s\n", p.Name)
+	}
+	fmt.Printf("%d imported, %d already present, %d corrupt, %d missing, %d unmatched\n",
+		imported, len(plan.Present), len(plan.Corrupt), len(plan.Missing), len(plan.Unmatched))
+	if failed > 0 {
+		return fmt.Errorf("import: %d file(s) could not be installed", failed)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package app
+
+import (
+	"archive/zip"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// packContents is the fixture pack as handed out offline: renamed and
+// re-cased files in subdirectories, a bad dump, a readme.
+var packContents = map[string]string{
+	"nes/Super Mario Bros (USA).nes": "mario rom",
+	"snes/ZELDA.SFC":                 "zelda rom",
+	"SONIC.MD":                       "sonic rom",
+	"gb/kirby.gb":                    "bad dump",
+	"gb/tetris.gb":                   "tetris rom",
+	"readme.txt":                     "have fun",
+}
+
+// packManifest is the session the pack is imported into. tetris.gb is
+// already installed and metroid.nes is not in the pack.
+func packManifest() *SessionManifest {
+	return &SessionManifest{Games: []ManifestGame{
+		{ID: 1, File: "mario.nes", SHA256: sha256Hex("mario rom")},
+		{ID: 2, File: "zelda.sfc"},
+		{ID: 3, File: "sonic.md"},
+		{ID: 4, File: "kirby.gb", SHA256: sha256Hex("kirby rom")},
+		{ID: 5, File: "tetris.gb", SHA256: sha256Hex("tetris rom")},
+		{ID: 6, File: "metroid.nes", SHA256: sha256Hex("metroid rom")},
+	}}
+}
+
+func writePackDir(t *testing.T, dir string) {
+	t.Helper()
+	for name, body := range packContents {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func writePackZip(t *testing.T, path string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, name := range slices.Sorted(maps.Keys(packContents)) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.WriteString(w, packContents[name])
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlanImport(t *testing.T) {
+	dir := t.TempDir()
+	writePackDir(t, dir)
+	pack, err := scanPack(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := planImport(packManifest(), pack, func(file string) bool { return file == "tetris.gb" })
+
+	imports := map[string]string{}
+	for file, p := range plan.Import {
+		imports[file] = p.Name
+	}
+	want := map[string]string{
+		"mario.nes": "nes/Super Mario Bros (USA).nes",
+		"zelda.sfc": "snes/ZELDA.SFC",
+		"sonic.md":  "SONIC.MD",
+	}
+	if !maps.Equal(imports, want) {
+		t.Errorf("imports = %v; want %v", imports, want)
+	}
+	if got := slices.Sorted(maps.Keys(plan.HashMatch)); !slices.Equal(got, []string{"mario.nes"}) {
+		t.Errorf("matched by hash: %v; want mario.nes", got)
+	}
+	if p, ok := plan.Corrupt["kirby.gb"]; !ok || len(plan.Corrupt) != 1 || p.Name != "gb/kirby.gb" {
+		t.Errorf("corrupt = %v; want the bad kirby.gb dump", plan.Corrupt)
+	}
+	if !slices.Equal(plan.Present, []string{"tetris.gb"}) || !slices.Equal(plan.Missing, []string{"metroid.nes"}) {
+		t.Errorf("present %v, missing %v", plan.Present, plan.Missing)
+	}
+	if len(plan.Unmatched) != 1 || plan.Unmatched[0].Name != "readme.txt" {
+		t.Errorf("unmatched = %v; want readme.txt", plan.Unmatched)
+	}
+}
+
+// TestPlanImportHashBeatsName checks a file named like one game but
+// holding another is imported as the game it holds.
+func TestPlanImportHashBeatsName(t *testing.T) {
+	m := &SessionManifest{Games: []ManifestGame{
+		{ID: 1, File: "mario.nes", SHA256: sha256Hex("mario rom")},
+		{ID: 2, File: "luigi.nes", SHA256: sha256Hex("luigi rom")},
+	}}
+	pack := []packFile{
+		{Path: "/p/luigi.nes", Name: "luigi.nes", SHA256: sha256Hex("mario rom")},
+		{Path: "/p/other.nes", Name: "other.nes", SHA256: sha256Hex("luigi rom")},
+	}
+	plan := planImport(m, pack, func(string) bool { return false })
+	if plan.Import["mario.nes"].Name != "luigi.nes" || plan.Import["luigi.nes"].Name != "other.nes" || len(plan.Corrupt) > 0 {
+		t.Errorf("plan = %+v", plan)
+	}
+}
+
+// runImportFixture runs the import command on src with the fixture
+// manifest and tetris.gb already installed, returning the ROM directory
+// and the summary line printed.
+func runImportFixture(t *testing.T, args ...string) (string, string) {
+	t.Helper()
+	withRomHashes(t)
+	romDir := filepath.Join(t.TempDir(), "roms")
+	if err := os.MkdirAll(romDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(romDir, "tetris.gb"), []byte("tetris rom"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveManifest(packManifest(), manifestFile); err != nil {
+		t.Fatal(err)
+	}
+	cfg := strings.Replace(twoServerConfig, `"active_server": "home"`, `"active_server": "home", "rom_dir": `+strconv.Quote(romDir), 1)
+
+	out := captureStdout(t, func() {
+		if err := runImport(args, writeTestConfig(t, cfg)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	return romDir, lines[len(lines)-1]
+}
+
+// captureStdout returns what fn prints.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = old }()
+	done := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- string(data)
+	}()
+	fn()
+	w.Close()
+	return <-done
+}
+
+func checkImported(t *testing.T, romDir string) {
+	t.Helper()
+	want := map[string]string{
+		"mario.nes": "mario rom",
+		"zelda.sfc": "zelda rom",
+		"sonic.md":  "sonic rom",
+		"tetris.gb": "tetris rom",
+	}
+	entries, err := os.ReadDir(romDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, e := range entries {
+		data, _ := os.ReadFile(filepath.Join(romDir, e.Name()))
+		got[e.Name()] = string(data)
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("ROM directory = %v; want %v", got, want)
+	}
+}
+
+const importSummary = "3 imported, 1 already present, 1 corrupt, 1 missing, 1 unmatched"
+
+func TestImportDirectoryPack(t *testing.T) {
+	pack := t.TempDir()
+	writePackDir(t, pack)
+	romDir, summary := runImportFixture(t, pack)
+	checkImported(t, romDir)
+	if summary != importSummary {
+		t.Errorf("summary %q; want %q", summary, importSummary)
+	}
+	// Copying leaves the pack as it was.
+	after, err := scanPack(pack, false)
+	if err != nil || len(after) != len(packContents) {
+		t.Errorf("pack has %d files after a copy import (%v); want %d", len(after), err, len(packContents))
+	}
+	// Imported hashes are remembered so startup does not rehash them.
+	romHashes.mu.Lock()
+	e, ok := romHashes.entries[filepath.Join(romDir, "mario.nes")]
+	romHashes.mu.Unlock()
+	if !ok || e.SHA256 != sha256Hex("mario rom") {
+		t.Errorf("mario.nes hash not recorded: %+v", e)
+	}
+}
+
+func TestImportDirectoryPackMove(t *testing.T) {
+	pack := t.TempDir()
+	writePackDir(t, pack)
+	romDir, _ := runImportFixture(t, "--move", pack)
+	checkImported(t, romDir)
+	for _, gone := range []string{"nes/Super Mario Bros (USA).nes", "snes/ZELDA.SFC", "SONIC.MD"} {
+		if _, err := os.Stat(filepath.Join(pack, filepath.FromSlash(gone))); !os.IsNotExist(err) {
+			t.Errorf("%s not moved out of the pack: %v", gone, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(pack, "gb", "kirby.gb")); err != nil {
+		t.Errorf("unimported file moved: %v", err)
+	}
+}
+
+func TestImportZipPack(t *testing.T) {
+	zipPath := filepath.Join(t.TempDir(), "relay-pack.zip")
+	writePackZip(t, zipPath)
+	romDir, summary := runImportFixture(t, zipPath)
+	checkImported(t, romDir)
+	if summary != importSummary {
+		t.Errorf("summary %q; want %q", summary, importSummary)
+	}
+	if _, err := os.Stat(zipPath); err != nil {
+		t.Errorf("zip pack removed: %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	saveChunkRetries = 3
+	defaultChunkSize = 4 << 20
+)
+
+// SaveTooLargeError is returned when the server rejects a savestate that
+// cannot be shrunk or chunked below its upload limit.
+type SaveTooLargeError struct {
+	Path  string
+	Size  int64
+	Limit int64
+}
+
+func (e *SaveTooLargeError) Error() string {
+	const mb = 1 << 20
+	if e.Limit > 0 {
+		return fmt.Sprintf(
+			"savestate too large (%.1f MB > limit %.1f MB): %s",
+			float64(e.Size)/mb, float64(e.Limit)/mb, filepath.Base(e.Path),
+		)
+	}
+	return fmt.Sprintf(
+		"savestate too large (%.1f MB): %s",
+		float64(e.Size)/mb, filepath.Base(e.Path),
+	)
+}
+
+// uploadLimit is the optional body of a 413 response.
+type uploadLimit struct {
+	LimitBytes    int64 `json:"limit_bytes"`
+	ChunkedUpload bool  `json:"chunked_upload"`
+	ChunkBytes    int64 `json:"chunk_bytes"`
+}
+
+// SetSaveCipher enables encryption of uploaded savestates.
+func (a *API) SetSaveCipher(c *SaveCipher) {
+	a.saveCipher = c
+}
+
+// UploadSave uploads a savestate for the given round. On 413 it retries
+// once gzip-compressed, then falls back to chunked upload when the server
+// advertises it, and otherwise returns a *SaveTooLargeError.
+func (a *API) UploadSave(ctx context.Context, localPath string, roundNumber int) error {
+	plain, err := os.ReadFile(localPath)
+	if err != nil {
+		return fmt.Errorf("read savestate: %w", err)
+	}
+	if a.saveCipher != nil {
+		sum := sha256.Sum256(plain)
+		if err := recordSaveHash(localPath, hex.EncodeToString(sum[:])); err != nil {
+			log.Printf("Could not record savestate hash: %v", err)
+		}
+	}
+	compress := a.compressSaves
+	body, err := a.encodeSave(plain, compress)
+	if err != nil {
+		return err
+	}
+
+	limit, err := a.postSave(ctx, localPath, roundNumber, body, compress)
+	if err == nil || limit == nil {
+		return err
+	}
+	if !compress {
+		compress = true
+		if body, err = a.encodeSave(plain, compress); err != nil {
+			return err
+		}
+		limit, err = a.postSave(ctx, localPath, roundNumber, body, compress)
+		if err == nil || limit == nil {
+			return err
+		}
+	}
+	if limit.ChunkedUpload {
+		return a.uploadSaveChunked(ctx, localPath, roundNumber, body, compress, limit)
+	}
+	return &SaveTooLargeError{Path: localPath, Size: int64(len(body)), Limit: limit.LimitBytes}
+}
+
+// saveKey is the slash-separated path of a savestate relative to the save
+// directory, which is the template-rendered name both ends agree on.
+func (a *API) saveKey(localPath string) string {
+	rel, err := filepath.Rel(a.saveDir, localPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filepath.Base(localPath)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// encodeSave compresses then encrypts (if configured) the savestate.
+func (a *API) encodeSave(plain []byte, compress bool) ([]byte, error) {
+	if a.saveCipher != nil {
+		return a.saveCipher.SealWith(plain, compress)
+	}
+	if !compress {
+		return plain, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(plain); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func saveEncoding(compress, encrypted bool) string {
+	switch {
+	case encrypted:
+		return "ggcsave"
+	case compress:
+		return "gzip"
+	default:
+		return "identity"
+	}
+}
+
+// postSave sends a single-part upload. A 413 is reported as a non-nil
+// uploadLimit alongside the error.
+func (a *API) postSave(
+	ctx context.Context,
+	localPath string,
+	roundNumber int,
+	data []byte,
+	compress bool,
+) (*uploadLimit, error) {
+	fields := map[string]string{
+		"round_number": strconv.Itoa(roundNumber),
+		"encoding":     saveEncoding(compress, a.saveCipher != nil),
+		"save_key":     a.saveKey(localPath),
+	}
+	resp, err := a.postMultipart(ctx, "/api/saves/upload", fields, filepath.Base(localPath), data)
+	if err != nil {
+		return nil, fmt.Errorf("save upload send error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return nil, nil
+	case http.StatusRequestEntityTooLarge:
+		var limit uploadLimit
+		_ = json.NewDecoder(resp.Body).Decode(&limit)
+		return &limit, &SaveTooLargeError{Path: localPath, Size: int64(len(data)), Limit: limit.LimitBytes}
+	default:
+		return nil, newAPIError("save upload", resp)
+	}
+}
+
+// uploadSaveChunked sends data in pieces to the chunk endpoint, retrying
+// each chunk on transient failure so a dropped final chunk is resumable.
+func (a *API) uploadSaveChunked(
+	ctx context.Context,
+	localPath string,
+	roundNumber int,
+	data []byte,
+	compress bool,
+	limit *uploadLimit,
+) error {
+	chunkSize := limit.ChunkBytes
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+		if limit.LimitBytes > 0 && limit.LimitBytes/2 < chunkSize {
+			chunkSize = limit.LimitBytes / 2
+		}
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	total := (int64(len(data)) + chunkSize - 1) / chunkSize
+
+	for i := int64(0); i < total; i++ {
+		start := i * chunkSize
+		end := min(start+chunkSize, int64(len(data)))
+		fields := map[string]string{
+			"round_number": strconv.Itoa(roundNumber),
+			"encoding":     saveEncoding(compress, a.saveCipher != nil),
+			"index":        strconv.FormatInt(i, 10),
+			"total":        strconv.FormatInt(total, 10),
+			"hash":         hash,
+			"save_key":     a.saveKey(localPath),
+		}
+		var lastErr error
+		for attempt := 0; attempt < saveChunkRetries; attempt++ {
+			if attempt > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(time.Duration(attempt) * time.Second):
+				}
+			}
+			resp, err := a.postMultipart(
+				ctx, "/api/saves/upload-chunk", fields,
+				filepath.Base(localPath), data[start:end],
+			)
+			if err != nil {
+				lastErr = fmt.Errorf("chunk %d/%d send error: %w", i+1, total, err)
+				continue
+			}
+			status := resp.StatusCode
+			msg := readErrorBody(resp.Body)
+			resp.Body.Close()
+			if status == http.StatusOK || status == http.StatusCreated {
+				lastErr = nil
+				break
+			}
+			lastErr = fmt.Errorf("chunk %d/%d failed: %d: %s", i+1, total, status, msg)
+			if status < 500 {
+				return lastErr
+			}
+		}
+		if lastErr != nil {
+			return lastErr
+		}
+	}
+	return nil
+}
+
+func (a *API) postMultipart(
+	ctx context.Context,
+	path string,
+	fields map[string]string,
+	fileName string,
+	data []byte,
+) (*http.Response, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		if err := mw.WriteField(k, v); err != nil {
+			return nil, err
+		}
+	}
+	part, err := mw.CreateFormFile("file", fileName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := a.newRequest(ctx, http.MethodPost, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	// GetBody lets a request rejected with 401 be resent after the token
+	// is refreshed.
+	body := buf.Bytes()
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.Body, _ = req.GetBody()
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp, _, err := a.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, fmt.Errorf("nil %s response", path)
+	}
+	return resp, nil
+}
@@ -0,0 +1,306 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// tokenServer answers 401 to anything not sent with want and records the
+// file of each accepted multipart upload.
+func tokenServer(t *testing.T, want string, got *[]string, attempts *atomic.Int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		if r.Header.Get("Authorization") != "Bearer "+want {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		data, _ := io.ReadAll(f)
+		*got = append(*got, string(data))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestUploadSaveRetriesAfterTokenRefresh(t *testing.T) {
+	var got []string
+	var attempts atomic.Int32
+	srv := tokenServer(t, "fresh", &got, &attempts)
+	dir := t.TempDir()
+	a := NewAPI(&Config{ServerURL: srv.URL, BearerToken: "stale", SaveDir: dir})
+	a.OnUnauthorized(func(ctx context.Context) (string, error) { return "fresh", nil })
+
+	path := filepath.Join(dir, "relay", "mario.state")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("savestate bytes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.UploadSave(context.Background(), path, 3); err != nil {
+		t.Fatalf("UploadSave: %v", err)
+	}
+	if attempts.Load() != 2 {
+		t.Errorf("server saw %d requests; want the rejected one and its retry", attempts.Load())
+	}
+	// The retry carries the whole multipart body again.
+	if len(got) != 1 || got[0] != "savestate bytes" {
+		t.Errorf("uploaded files = %q", got)
+	}
+}
+
+func TestUnreplayableBodyIsNotRetried(t *testing.T) {
+	var got []string
+	var attempts atomic.Int32
+	srv := tokenServer(t, "fresh", &got, &attempts)
+	a := NewAPI(&Config{ServerURL: srv.URL, BearerToken: "stale"})
+	refreshed := false
+	a.OnUnauthorized(func(ctx context.Context) (string, error) {
+		refreshed = true
+		return "fresh", nil
+	})
+
+	req, err := a.newRequest(context.Background(), http.MethodPost, "/api/anything", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Body = io.NopCloser(strings.NewReader("read once"))
+	resp, _, err := a.do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || attempts.Load() != 1 || refreshed {
+		t.Errorf("status %d after %d requests, refreshed %v; want the 401 unretried",
+			resp.StatusCode, attempts.Load(), refreshed)
+	}
+
+	// A body with GetBody is resent after the refresh.
+	req, _ = a.newRequest(context.Background(), http.MethodPost, "/api/anything", nil)
+	body := []byte("replayable")
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	req.Body, _ = req.GetBody()
+	resp, _, err = a.do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !refreshed || attempts.Load() != 3 {
+		t.Errorf("refreshed %v after %d requests; want a retry", refreshed, attempts.Load())
+	}
+}
+
+// uploadPart is one multipart upload as the server saw it.
+type uploadPart struct {
+	path   string
+	fields map[string]string
+	data   []byte
+}
+
+// uploadServer records every save upload and answers it with
+// respond(part, nth), where nth counts earlier uploads to the same path
+// with the same chunk index.
+func uploadServer(t *testing.T, respond func(p uploadPart, nth int) (int, string)) (*httptest.Server, func() []uploadPart) {
+	t.Helper()
+	var mu sync.Mutex
+	var parts []uploadPart
+	seen := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("%s: %v", r.URL.Path, err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(f)
+		p := uploadPart{path: r.URL.Path, fields: map[string]string{}, data: data}
+		for k, v := range r.MultipartForm.Value {
+			p.fields[k] = v[0]
+		}
+		mu.Lock()
+		key := p.path + "#" + p.fields["index"]
+		nth := seen[key]
+		seen[key]++
+		parts = append(parts, p)
+		mu.Unlock()
+		status, body := respond(p, nth)
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []uploadPart {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]uploadPart(nil), parts...)
+	}
+}
+
+// writeTestSave writes a savestate that gzip shrinks well.
+func writeTestSave(t *testing.T, dir string) (string, []byte) {
+	t.Helper()
+	plain := bytes.Repeat([]byte("savestate "), 200)
+	path := filepath.Join(dir, "mario.state")
+	if err := os.WriteFile(path, plain, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path, plain
+}
+
+func gunzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestUploadSaveRetriesGzippedAfter413(t *testing.T) {
+	srv, parts := uploadServer(t, func(p uploadPart, nth int) (int, string) {
+		if p.fields["encoding"] == "identity" {
+			return http.StatusRequestEntityTooLarge, `{"limit_bytes": 500}`
+		}
+		return http.StatusCreated, ""
+	})
+	dir := t.TempDir()
+	a := NewAPI(&Config{ServerURL: srv.URL, SaveDir: dir})
+	path, plain := writeTestSave(t, dir)
+
+	if err := a.UploadSave(context.Background(), path, 2); err != nil {
+		t.Fatalf("UploadSave: %v", err)
+	}
+	got := parts()
+	if len(got) != 2 || got[0].fields["encoding"] != "identity" || got[1].fields["encoding"] != "gzip" {
+		t.Fatalf("uploads = %+v; want identity then gzip", got)
+	}
+	if !bytes.Equal(gunzipBytes(t, got[1].data), plain) {
+		t.Error("gzipped retry does not decompress to the savestate")
+	}
+	if got[1].fields["round_number"] != "2" || got[1].fields["save_key"] != "mario.state" {
+		t.Errorf("retry fields = %v", got[1].fields)
+	}
+}
+
+func TestUploadSaveFallsBackToChunks(t *testing.T) {
+	srv, parts := uploadServer(t, func(p uploadPart, nth int) (int, string) {
+		if p.path == "/api/saves/upload" {
+			return http.StatusRequestEntityTooLarge, `{"limit_bytes": 16, "chunked_upload": true, "chunk_bytes": 16}`
+		}
+		return http.StatusOK, ""
+	})
+	dir := t.TempDir()
+	a := NewAPI(&Config{ServerURL: srv.URL, SaveDir: dir, CompressSaves: true})
+	path, plain := writeTestSave(t, dir)
+
+	if err := a.UploadSave(context.Background(), path, 4); err != nil {
+		t.Fatalf("UploadSave: %v", err)
+	}
+	got := parts()
+	// Saves already compressed are not retried whole before chunking.
+	if got[0].path != "/api/saves/upload" || got[1].path != "/api/saves/upload-chunk" {
+		t.Fatalf("first uploads went to %s, %s", got[0].path, got[1].path)
+	}
+	var body []byte
+	chunks := got[1:]
+	for i, c := range chunks {
+		if c.fields["index"] != strconv.Itoa(i) || c.fields["total"] != strconv.Itoa(len(chunks)) {
+			t.Errorf("chunk %d fields = %v", i, c.fields)
+		}
+		if len(c.data) > 16 {
+			t.Errorf("chunk %d is %d bytes; limit 16", i, len(c.data))
+		}
+		body = append(body, c.data...)
+	}
+	sum := sha256.Sum256(body)
+	if h := chunks[0].fields["hash"]; h != hex.EncodeToString(sum[:]) {
+		t.Errorf("hash = %s; want the hash of the whole upload", h)
+	}
+	if !bytes.Equal(gunzipBytes(t, body), plain) {
+		t.Error("chunks do not reassemble into the savestate")
+	}
+}
+
+func TestUploadSaveTooLarge(t *testing.T) {
+	srv, parts := uploadServer(t, func(p uploadPart, nth int) (int, string) {
+		return http.StatusRequestEntityTooLarge, `{"limit_bytes": 10}`
+	})
+	dir := t.TempDir()
+	a := NewAPI(&Config{ServerURL: srv.URL, SaveDir: dir})
+	path, _ := writeTestSave(t, dir)
+
+	err := a.UploadSave(context.Background(), path, 1)
+	var tooLarge *SaveTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("UploadSave = %v; want SaveTooLargeError", err)
+	}
+	if tooLarge.Limit != 10 || tooLarge.Path != path {
+		t.Errorf("error = %+v", tooLarge)
+	}
+	// The size reported is that of the compressed retry.
+	if got := parts(); len(got) != 2 || tooLarge.Size != int64(len(got[1].data)) {
+		t.Errorf("%d uploads, size %d", len(got), tooLarge.Size)
+	}
+}
+
+func TestUploadSaveChunkedRetriesAndResumes(t *testing.T) {
+	srv, parts := uploadServer(t, func(p uploadPart, nth int) (int, string) {
+		if p.fields["index"] == "1" && nth == 0 {
+			return http.StatusServiceUnavailable, "busy"
+		}
+		return http.StatusCreated, ""
+	})
+	a := NewAPI(&Config{ServerURL: srv.URL})
+	data := []byte("0123456789abcdefghij")
+
+	limit := &uploadLimit{ChunkBytes: 8}
+	if err := a.uploadSaveChunked(context.Background(), "x.state", 1, data, false, limit); err != nil {
+		t.Fatalf("uploadSaveChunked: %v", err)
+	}
+	var indexes []string
+	for _, p := range parts() {
+		indexes = append(indexes, p.fields["index"])
+	}
+	// Only the failed chunk is sent again, and the upload carries on.
+	if strings.Join(indexes, ",") != "0,1,1,2" {
+		t.Errorf("chunks sent = %v; want 0,1,1,2", indexes)
+	}
+}
+
+func TestUploadSaveChunkedStopsOnClientError(t *testing.T) {
+	srv, parts := uploadServer(t, func(p uploadPart, nth int) (int, string) {
+		return http.StatusUnprocessableEntity, "bad hash"
+	})
+	a := NewAPI(&Config{ServerURL: srv.URL})
+
+	err := a.uploadSaveChunked(context.Background(), "x.state", 1, []byte("data"), false, &uploadLimit{ChunkBytes: 2})
+	if err == nil || !strings.Contains(err.Error(), "bad hash") {
+		t.Errorf("err = %v; want the server message", err)
+	}
+	if n := len(parts()); n != 1 {
+		t.Errorf("%d chunk requests; a 4xx is not retried", n)
+	}
+}
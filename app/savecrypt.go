@@ -0,0 +1,174 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Encrypted savestate layout:
+//
+//	magic (8) | flags (1) | key fingerprint (8) | nonce (12) | ciphertext
+//
+// The magic and fingerprint are cleartext so a client holding the wrong key
+// can reject the file before attempting to decrypt it.
+var saveMagic = []byte("GGCSAVE1")
+
+const (
+	saveFlagGzip       byte = 1 << 0
+	saveFingerprintLen      = 8
+	saveKDFIterations       = 200_000
+)
+
+var ErrSaveKeyMismatch = errors.New("savestate was encrypted with a different passphrase")
+
+var ErrSaveHashMismatch = errors.New("decrypted savestate does not match its recorded hash")
+
+// SaveCipher encrypts savestates before upload and decrypts them after download.
+type SaveCipher struct {
+	aead        cipher.AEAD
+	fingerprint []byte
+	compress    bool
+}
+
+// NewSaveCipher derives a key from the session passphrase. The session name
+// salts the derivation so the same passphrase yields different keys per session.
+func NewSaveCipher(passphrase, sessionName string, compress bool) (*SaveCipher, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("empty save passphrase")
+	}
+	key, err := pbkdf2.Key(
+		sha256.New,
+		passphrase,
+		[]byte("go-game-client/save/"+sessionName),
+		saveKDFIterations,
+		32,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("derive save key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	fp := sha256.Sum256(append([]byte("fingerprint:"), key...))
+	return &SaveCipher{
+		aead:        aead,
+		fingerprint: fp[:saveFingerprintLen],
+		compress:    compress,
+	}, nil
+}
+
+// IsEncryptedSave reports whether data starts with the encrypted save magic.
+func IsEncryptedSave(data []byte) bool {
+	return bytes.HasPrefix(data, saveMagic)
+}
+
+// Seal compresses (if enabled) and encrypts plain.
+func (c *SaveCipher) Seal(plain []byte) ([]byte, error) {
+	return c.SealWith(plain, c.compress)
+}
+
+// SealWith is Seal with an explicit compression choice.
+func (c *SaveCipher) SealWith(plain []byte, compress bool) ([]byte, error) {
+	var flags byte
+	body := plain
+	if compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(plain); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		body = buf.Bytes()
+		flags |= saveFlagGzip
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, len(saveMagic)+1+saveFingerprintLen)
+	header = append(header, saveMagic...)
+	header = append(header, flags)
+	header = append(header, c.fingerprint...)
+
+	out := append(header, nonce...)
+	return c.aead.Seal(out, nonce, body, header), nil
+}
+
+// Open verifies the header, decrypts, and decompresses data.
+func (c *SaveCipher) Open(data []byte) ([]byte, error) {
+	headerLen := len(saveMagic) + 1 + saveFingerprintLen
+	nonceLen := c.aead.NonceSize()
+	if !IsEncryptedSave(data) {
+		return nil, fmt.Errorf("savestate is not encrypted")
+	}
+	if len(data) < headerLen+nonceLen {
+		return nil, fmt.Errorf("encrypted savestate truncated")
+	}
+	header := data[:headerLen]
+	flags := header[len(saveMagic)]
+	if !bytes.Equal(header[len(saveMagic)+1:], c.fingerprint) {
+		return nil, ErrSaveKeyMismatch
+	}
+
+	nonce := data[headerLen : headerLen+nonceLen]
+	body, err := c.aead.Open(nil, nonce, data[headerLen+nonceLen:], header)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt savestate: %w", err)
+	}
+	if flags&saveFlagGzip == 0 {
+		return body, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("decompress savestate: %w", err)
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// OpenFile decrypts a downloaded savestate in place and returns the hex
+// SHA-256 of the recovered plaintext. Unencrypted files are left untouched.
+// When want is set, a plaintext with another hash is not written and
+// ErrSaveHashMismatch is returned.
+func (c *SaveCipher) OpenFile(path, want string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if !IsEncryptedSave(data) {
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:]), nil
+	}
+	plain, err := c.Open(data)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	sum := sha256.Sum256(plain)
+	got := hex.EncodeToString(sum[:])
+	if want != "" && got != want {
+		return got, fmt.Errorf("%s: %w (sha256 %s, recorded %s)", path, ErrSaveHashMismatch, got, want)
+	}
+	if err := os.WriteFile(path, plain, 0o644); err != nil {
+		return "", err
+	}
+	return got, nil
+}
@@ -0,0 +1,146 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestCipher(t *testing.T, passphrase, session string) *SaveCipher {
+	t.Helper()
+	c, err := NewSaveCipher(passphrase, session, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestSaveCipherRoundTrip(t *testing.T) {
+	c := newTestCipher(t, "hunter2", "relay")
+	plain := bytes.Repeat([]byte("savestate "), 200)
+	for _, compress := range []bool{false, true} {
+		sealed, err := c.SealWith(plain, compress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsEncryptedSave(sealed) {
+			t.Errorf("compress=%v: sealed save lacks the magic header", compress)
+		}
+		if bytes.Contains(sealed, []byte("savestate")) {
+			t.Errorf("compress=%v: sealed save contains plaintext", compress)
+		}
+		if compress && len(sealed) >= len(plain) {
+			t.Errorf("compress=true: sealed %d bytes, plaintext %d", len(sealed), len(plain))
+		}
+		got, err := c.Open(sealed)
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Errorf("compress=%v: Open = %d bytes, %v", compress, len(got), err)
+		}
+	}
+}
+
+func TestSaveCipherWrongKey(t *testing.T) {
+	sealed, err := newTestCipher(t, "hunter2", "relay").Seal([]byte("state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		passphrase string
+		session    string
+	}{
+		{"other passphrase", "hunter3", "relay"},
+		// The session salts the key, so the same passphrase differs.
+		{"other session", "hunter2", "marathon"},
+	}
+	for _, tt := range tests {
+		_, err := newTestCipher(t, tt.passphrase, tt.session).Open(sealed)
+		if !errors.Is(err, ErrSaveKeyMismatch) {
+			t.Errorf("%s: Open error = %v; want ErrSaveKeyMismatch", tt.name, err)
+		}
+	}
+}
+
+func TestSaveCipherRejectsTampering(t *testing.T) {
+	c := newTestCipher(t, "hunter2", "relay")
+	sealed, err := c.Seal([]byte("state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	flipped := bytes.Clone(sealed)
+	flipped[len(flipped)-1] ^= 1
+	if _, err := c.Open(flipped); err == nil {
+		t.Error("Open accepted a modified ciphertext")
+	}
+	if _, err := c.Open(sealed[:len(saveMagic)+4]); err == nil {
+		t.Error("Open accepted a truncated save")
+	}
+	if _, err := c.Open([]byte("plain state")); err == nil {
+		t.Error("Open accepted an unencrypted save")
+	}
+}
+
+func TestOpenFileVerifiesHash(t *testing.T) {
+	c := newTestCipher(t, "hunter2", "relay")
+	plain := []byte("round 3 state")
+	sum := sha256.Sum256(plain)
+	hash := hex.EncodeToString(sum[:])
+	sealed, err := c.Seal(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr error
+		written []byte
+	}{
+		{"matching hash", hash, nil, plain},
+		{"no recorded hash", "", nil, plain},
+		{"other hash", hex.EncodeToString(make([]byte, 32)), ErrSaveHashMismatch, sealed},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, "game.State")
+		if err := os.WriteFile(path, sealed, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.OpenFile(path, tt.want)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: OpenFile error = %v; want %v", tt.name, err, tt.wantErr)
+		}
+		if got != hash {
+			t.Errorf("%s: OpenFile hash = %s; want %s", tt.name, got, hash)
+		}
+		// A mismatch leaves the file encrypted.
+		if data, _ := os.ReadFile(path); !bytes.Equal(data, tt.written) {
+			t.Errorf("%s: file holds %q", tt.name, data)
+		}
+	}
+}
+
+func TestSaveHashBookkeeping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "relay", "3", "game.State")
+	meta := SaveMeta{Session: "relay", Round: 3, Game: "game.nes"}
+	if err := WriteSaveMeta(path, meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordSaveHash(path, "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if got := savedHash(path); got != "abc" {
+		t.Errorf("savedHash = %q; want %q", got, "abc")
+	}
+	// The recorded hash does not take part in the hand-off check.
+	if err := ValidateSave(path, meta); err != nil {
+		t.Errorf("ValidateSave with a recorded hash: %v", err)
+	}
+	if got := savedHash(filepath.Join(filepath.Dir(path), "other.State")); got != "" {
+		t.Errorf("savedHash without metadata = %q", got)
+	}
+}
@@ -0,0 +1,181 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultSaveTemplate is the naming convention this client proposes at
+// Ready time. The server may answer with its own template.
+const defaultSaveTemplate = "{session}/{round}/{game}.State"
+
+const saveMetaSuffix = ".meta.json"
+
+// SaveMeta identifies which round and game a savestate belongs to. It is
+// written next to each savestate so a hand-off can be checked before loading.
+type SaveMeta struct {
+	Session string `json:"session"`
+	Round   int    `json:"round"`
+	Game    string `json:"game"`
+
+	// SHA256 is the hash of the plaintext of an encrypted savestate,
+	// recorded when it is uploaded. The sidecar is never uploaded.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+func (m SaveMeta) String() string {
+	return fmt.Sprintf("session %q round %d game %q", m.Session, m.Round, m.Game)
+}
+
+// RenderSavePath expands a save template into a relative, slash-separated
+// path. {game} is the ROM filename without its extension.
+func RenderSavePath(tmpl string, meta SaveMeta) (string, error) {
+	if tmpl == "" {
+		tmpl = defaultSaveTemplate
+	}
+	game := strings.TrimSuffix(meta.Game, filepath.Ext(meta.Game))
+	values := map[string]string{
+		"session": meta.Session,
+		"round":   strconv.Itoa(meta.Round),
+		"game":    game,
+	}
+
+	var out strings.Builder
+	rest := tmpl
+	for {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			out.WriteString(rest)
+			break
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("save template %q: unterminated placeholder", tmpl)
+		}
+		name := rest[open+1 : open+end]
+		value, ok := values[name]
+		if !ok {
+			return "", fmt.Errorf("save template %q: unknown placeholder {%s}", tmpl, name)
+		}
+		if err := checkSavePathComponent(name, value); err != nil {
+			return "", fmt.Errorf("save template %q: %w", tmpl, err)
+		}
+		out.WriteString(rest[:open])
+		out.WriteString(value)
+		rest = rest[open+end+1:]
+	}
+
+	path := out.String()
+	if filepath.IsAbs(path) || strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("save template %q renders an absolute path", tmpl)
+	}
+	for _, part := range strings.Split(path, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", fmt.Errorf("save template %q renders invalid path %q", tmpl, path)
+		}
+	}
+	return path, nil
+}
+
+func checkSavePathComponent(name, value string) error {
+	switch {
+	case value == "":
+		return fmt.Errorf("{%s} is empty", name)
+	case value == "." || value == "..":
+		return fmt.Errorf("{%s} is %q", name, value)
+	case strings.ContainsAny(value, `/\`):
+		return fmt.Errorf("{%s} value %q contains a path separator", name, value)
+	}
+	return nil
+}
+
+// SaveMismatchError reports a savestate whose metadata does not match the
+// round and game the swap expects.
+type SaveMismatchError struct {
+	Path string
+	Want SaveMeta
+	Got  SaveMeta
+}
+
+func (e *SaveMismatchError) Error() string {
+	var diffs []string
+	if e.Got.Session != e.Want.Session {
+		diffs = append(diffs, fmt.Sprintf("session %q, expected %q", e.Got.Session, e.Want.Session))
+	}
+	if e.Got.Round != e.Want.Round {
+		diffs = append(diffs, fmt.Sprintf("round %d, expected %d", e.Got.Round, e.Want.Round))
+	}
+	if e.Got.Game != e.Want.Game {
+		diffs = append(diffs, fmt.Sprintf("game %q, expected %q", e.Got.Game, e.Want.Game))
+	}
+	return fmt.Sprintf("savestate %s does not match swap: %s", e.Path, strings.Join(diffs, "; "))
+}
+
+// WriteSaveMeta records meta alongside the savestate at path.
+func WriteSaveMeta(path string, meta SaveMeta) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path+saveMetaSuffix, b, 0o644)
+}
+
+// ValidateSave checks the metadata stored beside a savestate against what
+// the swap expects. A missing savestate or sidecar is not an error; the
+// caller decides whether a save is required.
+func ValidateSave(path string, want SaveMeta) error {
+	b, err := os.ReadFile(path + saveMetaSuffix)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var got SaveMeta
+	if err := json.Unmarshal(b, &got); err != nil {
+		return fmt.Errorf("savestate %s: bad metadata: %w", path, err)
+	}
+	if got.Session != want.Session || got.Round != want.Round || got.Game != want.Game {
+		return &SaveMismatchError{Path: path, Want: want, Got: got}
+	}
+	return nil
+}
+
+// readSaveMeta returns the metadata stored beside the savestate at path.
+func readSaveMeta(path string) (SaveMeta, error) {
+	var meta SaveMeta
+	b, err := os.ReadFile(path + saveMetaSuffix)
+	if err != nil {
+		return meta, err
+	}
+	err = json.Unmarshal(b, &meta)
+	return meta, err
+}
+
+// recordSaveHash stores the plaintext hash of the savestate at path in its
+// metadata, keeping what is already there.
+func recordSaveHash(path, sum string) error {
+	meta, err := readSaveMeta(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	meta.SHA256 = sum
+	return WriteSaveMeta(path, meta)
+}
+
+// savedHash returns the plaintext hash recorded for the savestate at path,
+// or "" if none was.
+func savedHash(path string) string {
+	meta, err := readSaveMeta(path)
+	if err != nil {
+		return ""
+	}
+	return meta.SHA256
+}
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderSavePath(t *testing.T) {
+	meta := SaveMeta{Session: "relay", Round: 3, Game: "Super Mario (U).nes"}
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{"", "relay/3/Super Mario (U).State"},
+		{defaultSaveTemplate, "relay/3/Super Mario (U).State"},
+		{"{game}-r{round}.State", "Super Mario (U)-r3.State"},
+		{"saves/{session}/{game}/{round}", "saves/relay/Super Mario (U)/3"},
+		{"fixed.State", "fixed.State"},
+	}
+	for _, tt := range tests {
+		got, err := RenderSavePath(tt.tmpl, meta)
+		if err != nil || got != tt.want {
+			t.Errorf("RenderSavePath(%q) = %q, %v; want %q", tt.tmpl, got, err, tt.want)
+		}
+	}
+}
+
+func TestRenderSavePathRejects(t *testing.T) {
+	good := SaveMeta{Session: "relay", Round: 1, Game: "mario.nes"}
+	tests := []struct {
+		name string
+		tmpl string
+		meta SaveMeta
+		want string // in the error
+	}{
+		{"unterminated", "{session}/{round", good, "unterminated"},
+		{"unknown placeholder", "{player}/{round}", good, "unknown placeholder {player}"},
+		{"absolute", "/{session}/{round}", good, "absolute"},
+		{"parent dir", "../{session}/{round}", good, "invalid path"},
+		{"empty segment", "{session}//{round}", good, "invalid path"},
+		{"trailing slash", "{session}/", good, "invalid path"},
+		{"empty value", "{session}/{round}", SaveMeta{Round: 1, Game: "g"}, "{session} is empty"},
+		{"dot-dot value", "{session}/{round}", SaveMeta{Session: "..", Round: 1}, `{session} is ".."`},
+		{"separator in value", "{game}", SaveMeta{Game: `a\b.nes`}, "path separator"},
+		{"extension only", "{game}", SaveMeta{Game: ".nes"}, "{game} is empty"},
+	}
+	for _, tt := range tests {
+		if got, err := RenderSavePath(tt.tmpl, tt.meta); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: RenderSavePath(%q) = %q, %v; want an error containing %q", tt.name, tt.tmpl, got, err, tt.want)
+		}
+	}
+}
+
+func TestValidateSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "relay", "2", "mario.State")
+	want := SaveMeta{Session: "relay", Round: 2, Game: "mario.nes"}
+
+	// A savestate without a sidecar is left to the caller.
+	if err := ValidateSave(path, want); err != nil {
+		t.Errorf("no sidecar: %v", err)
+	}
+	if err := WriteSaveMeta(path, want); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateSave(path, want); err != nil {
+		t.Errorf("matching sidecar: %v", err)
+	}
+	// The recorded hash is not part of the match.
+	if err := recordSaveHash(path, "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateSave(path, want); err != nil || savedHash(path) != "abc" {
+		t.Errorf("after recordSaveHash: %v, hash %q", err, savedHash(path))
+	}
+
+	err := ValidateSave(path, SaveMeta{Session: "relay", Round: 3, Game: "zelda.sfc"})
+	var mismatch *SaveMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("mismatch: %v; want a SaveMismatchError", err)
+	}
+	if want := `round 2, expected 3; game "mario.nes", expected "zelda.sfc"`; !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("error = %q; want it to end %q", err, want)
+	}
+
+	if err := os.WriteFile(path+saveMetaSuffix, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateSave(path, want); err == nil || !strings.Contains(err.Error(), "bad metadata") {
+		t.Errorf("corrupt sidecar: %v", err)
+	}
+}
+
+func TestServerSaveTemplate(t *testing.T) {
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{"", defaultSaveTemplate},
+		{"{session}-{round}-{game}.State", "{session}-{round}-{game}.State"},
+		// Templates that cannot render are ignored.
+		{"../{game}", defaultSaveTemplate},
+		{"{player}/{game}", defaultSaveTemplate},
+	}
+	for _, tt := range tests {
+		state := NewClientState()
+		body := fmt.Sprintf(`{"state":"running","save_template":%q}`, tt.tmpl)
+		if err := applySessionState(strings.NewReader(body), state, "ready", state.Versions()); err != nil {
+			t.Fatal(err)
+		}
+		if got := state.GetSaveTemplate(); got != tt.want {
+			t.Errorf("server template %q: using %q; want %q", tt.tmpl, got, tt.want)
+		}
+	}
+}
+
+func TestSwapUsesAgreedSaveTemplate(t *testing.T) {
+	f := newHandlerFixture(t)
+	f.state.SetSaveTemplate("{session}_{game}_{round}.State")
+	f.h.prepares.timeout = 10 * time.Millisecond
+
+	// A save left over from another round, at the path this round renders to.
+	path := filepath.Join(f.cfg.SaveDir, "relay_zelda_2.State")
+	if err := WriteSaveMeta(path, SaveMeta{Session: "relay", Round: 1, Game: "zelda.sfc"}); err != nil {
+		t.Fatal(err)
+	}
+	f.dispatch("prepare_swap", `{"round_number":2,"new_game":"zelda.sfc"}`)
+	f.dispatch("swap", fmt.Sprintf(`{"round_number":2,"new_game":"zelda.sfc","swap_at":%d}`, time.Now().Unix()))
+	waitFor(t, "swap failure", func() bool {
+		return slices.Contains(f.server.Calls(), "SwapFailed "+SwapFailedSaveMismatch)
+	})
+	if slices.Contains(f.emu.Sent(), "SWAP") {
+		t.Error("swap went ahead onto a save from another round")
+	}
+}
@@ -0,0 +1,200 @@
+package app
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scheduleCoalesce batches schedule changes into one SCHEDULE frame.
+const scheduleCoalesce = 250 * time.Millisecond
+
+// Schedule slots. A new action in a slot replaces the armed one, since the
+// server only ever has one pending swap and one pending state change.
+const (
+	slotSwap  = "swap"
+	slotState = "state"
+)
+
+// ScheduledAction is one armed action. At is in server time.
+type ScheduledAction struct {
+	Type string    `json:"type"`
+	At   time.Time `json:"at"`
+	Game string    `json:"game,omitempty"`
+}
+
+// Schedule is the client's view of the actions armed in the emulator, used
+// for the overlay timeline and the status page. Actions drop out once
+// their fire time has passed.
+type Schedule struct {
+	mu      sync.Mutex
+	actions map[string]ScheduledAction
+	subs    []chan struct{}
+	timer   *time.Timer
+	now     func() time.Time
+}
+
+func NewSchedule() *Schedule {
+	return &Schedule{actions: make(map[string]ScheduledAction), now: time.Now}
+}
+
+// Arm records a in slot, replacing what was there.
+func (s *Schedule) Arm(slot string, a ScheduledAction) {
+	s.mu.Lock()
+	s.actions[slot] = a
+	s.changedLocked()
+	s.mu.Unlock()
+}
+
+// Cancel removes the action in slot, if any.
+func (s *Schedule) Cancel(slot string) {
+	s.mu.Lock()
+	if _, ok := s.actions[slot]; ok {
+		delete(s.actions, slot)
+		s.changedLocked()
+	}
+	s.mu.Unlock()
+}
+
+// Rearm tells subscribers the fire times must be re-evaluated, e.g. after
+// the clock offset changed.
+func (s *Schedule) Rearm() {
+	s.mu.Lock()
+	s.changedLocked()
+	s.mu.Unlock()
+}
+
+// List returns the pending actions ordered by fire time.
+func (s *Schedule) List() []ScheduledAction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked()
+	out := make([]ScheduledAction, 0, len(s.actions))
+	for _, a := range s.actions {
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].At.Before(out[j].At) })
+	return out
+}
+
+// Subscribe returns a channel that receives a value (coalesced) whenever
+// the schedule changes, including when an action expires.
+func (s *Schedule) Subscribe() <-chan struct{} {
+	ch := make(chan struct{}, 1)
+	s.mu.Lock()
+	s.subs = append(s.subs, ch)
+	s.mu.Unlock()
+	return ch
+}
+
+func (s *Schedule) pruneLocked() {
+	now := s.now()
+	for slot, a := range s.actions {
+		if !a.At.After(now) {
+			delete(s.actions, slot)
+		}
+	}
+}
+
+// changedLocked notifies subscribers and arms a timer for the next
+// expiry so expired actions are announced too.
+func (s *Schedule) changedLocked() {
+	for _, ch := range s.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.pruneLocked()
+	var next time.Time
+	for _, a := range s.actions {
+		if next.IsZero() || a.At.Before(next) {
+			next = a.At
+		}
+	}
+	if !next.IsZero() {
+		s.timer = time.AfterFunc(next.Sub(s.now())+time.Millisecond, func() {
+			s.mu.Lock()
+			s.changedLocked()
+			s.mu.Unlock()
+		})
+	}
+}
+
+// trackStateSchedule keeps the state slot in step with the client state,
+// whichever path (event, resync, ready) changed it.
+func trackStateSchedule(state *ClientState, s *Schedule, done <-chan struct{}) {
+	events := state.Subscribe(8)
+	defer state.Unsubscribe(events)
+	for {
+		select {
+		case <-done:
+			return
+		case ev := <-events:
+			if ev.Type != EventStateChanged && ev.Type != EventStateTimeChanged {
+				continue
+			}
+			name, at := state.GetState(), state.GetStateTime()
+			if name == "" || at.IsZero() {
+				s.Cancel(slotState)
+				continue
+			}
+			s.Arm(slotState, ScheduledAction{Type: actionKindForState(name), At: at})
+		}
+	}
+}
+
+// encodeSchedule renders actions as SCHEDULE arguments, one
+// "<type>,<local unix>,<game>" per action, converting fire times to the
+// local clock Lua uses.
+func encodeSchedule(actions []ScheduledAction, localUnix func(int64) int64) []string {
+	args := make([]string, 0, len(actions))
+	for _, a := range actions {
+		args = append(args, strings.Join([]string{
+			a.Type,
+			strconv.FormatInt(localUnix(a.At.Unix()), 10),
+			a.Game,
+		}, ","))
+	}
+	return args
+}
+
+// PublishSchedule sends a SCHEDULE frame whenever the schedule's encoding
+// changes, and again after Lua reconnects. Bursts of changes within
+// scheduleCoalesce produce one frame.
+func (b *BizhawkIPC) PublishSchedule(ctx context.Context, s *Schedule) {
+	b.schedule.Store(s)
+	changes := s.Subscribe()
+	s.Rearm()      // publish whatever was armed before we subscribed
+	last := "\x00" // never equal to a real encoding, so the first change is sent
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changes:
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(scheduleCoalesce):
+		}
+		args := encodeSchedule(s.List(), b.state.localUnix)
+		enc := strings.Join(args, "|")
+		if !b.Supports("SCHEDULE") || (enc == last && !b.resendSchedule.Swap(false)) {
+			continue
+		}
+		if err := b.SendCommand(append([]string{"SCHEDULE"}, args...)...); err != nil {
+			log.Printf("[IPC] SCHEDULE send failed: %v", err)
+			continue
+		}
+		last = enc
+	}
+}
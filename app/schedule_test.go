@@ -0,0 +1,139 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEncodeSchedule(t *testing.T) {
+	s := NewSchedule()
+	now := goldenTime
+	s.now = func() time.Time { return now }
+	s.Arm(slotState, ScheduledAction{Type: "pause", At: now.Add(2 * time.Minute)})
+	s.Arm(slotSwap, ScheduledAction{Type: "swap", At: now.Add(time.Minute), Game: "zelda.sfc"})
+	// A newer swap replaces the armed one.
+	s.Arm(slotSwap, ScheduledAction{Type: "swap", At: now.Add(30 * time.Second), Game: "sonic.md"})
+
+	// Lua fires on the local clock, here 10s behind the server.
+	local := func(at int64) int64 { return at - 10 }
+	got := encodeSchedule(s.List(), local)
+	base := now.Unix() - 10
+	want := []string{
+		fmt.Sprintf("swap,%d,sonic.md", base+30),
+		fmt.Sprintf("pause,%d,", base+120),
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("encodeSchedule = %q; want %q", got, want)
+	}
+
+	now = now.Add(time.Minute)
+	if got := encodeSchedule(s.List(), local); !slices.Equal(got, want[1:]) {
+		t.Errorf("after the swap fired = %q; want %q", got, want[1:])
+	}
+}
+
+// scheduleFrames starts IPC with a peer that ACKs everything and records
+// the arguments of each SCHEDULE frame, then publishes s on it once setup
+// has run.
+func scheduleFrames(t *testing.T, s *Schedule, setup func(b *BizhawkIPC)) (*BizhawkIPC, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var frames []string
+	b, _ := startTestIPC(t, func(id, cmd string) string {
+		if args, ok := strings.CutPrefix(cmd, "SCHEDULE"); ok {
+			mu.Lock()
+			frames = append(frames, strings.TrimPrefix(args, "|"))
+			mu.Unlock()
+		}
+		return "ACK|" + id
+	})
+	setup(b)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.PublishSchedule(ctx, s)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return b, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(frames)
+	}
+}
+
+func TestPublishSchedule(t *testing.T) {
+	s := NewSchedule()
+	swapAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	s.Arm(slotSwap, ScheduledAction{Type: "swap", At: swapAt, Game: "zelda.sfc"})
+	b, frames := scheduleFrames(t, s, func(b *BizhawkIPC) { b.state.SetClockOffset(5 * time.Second) })
+	swapFrame := fmt.Sprintf("swap,%d,zelda.sfc", swapAt.Unix()-5)
+
+	// What was armed before publishing started goes out first.
+	waitFor(t, "the first frame", func() bool { return len(frames()) == 1 })
+	if got := frames()[0]; got != swapFrame {
+		t.Errorf("first frame %q; want %q", got, swapFrame)
+	}
+
+	// A burst of changes is one frame with the final schedule.
+	pauseAt := swapAt.Add(time.Minute)
+	s.Arm(slotState, ScheduledAction{Type: "resume", At: pauseAt})
+	s.Cancel(slotState)
+	s.Arm(slotState, ScheduledAction{Type: "pause", At: pauseAt})
+	waitFor(t, "the burst frame", func() bool { return len(frames()) == 2 })
+	both := swapFrame + fmt.Sprintf("|pause,%d,", pauseAt.Unix()-5)
+	if got := frames()[1]; got != both {
+		t.Errorf("burst frame %q; want %q", got, both)
+	}
+
+	// Changes that leave the encoding as it was send nothing.
+	s.Arm(slotState, ScheduledAction{Type: "pause", At: pauseAt})
+	s.Rearm()
+	time.Sleep(3 * scheduleCoalesce)
+	if got := frames(); len(got) != 2 {
+		t.Fatalf("frames after no-op changes: %q", got)
+	}
+
+	// A clock re-sync moves the local fire times.
+	b.state.SetClockOffset(0)
+	s.Rearm()
+	waitFor(t, "the re-synced frame", func() bool { return len(frames()) == 3 })
+	if got, want := frames()[2], fmt.Sprintf("swap,%d,zelda.sfc|pause,%d,", swapAt.Unix(), pauseAt.Unix()); got != want {
+		t.Errorf("re-synced frame %q; want %q", got, want)
+	}
+
+	// A restarted script gets the unchanged schedule again.
+	b.handleResponse("HELLO")
+	waitFor(t, "the frame after HELLO", func() bool { return len(frames()) == 4 })
+	if got := frames(); got[3] != got[2] {
+		t.Errorf("frame after HELLO %q; want %q", got[3], got[2])
+	}
+
+	// An action dropping out when it fires is published too.
+	s.Cancel(slotState)
+	s.Arm(slotSwap, ScheduledAction{Type: "swap", At: time.Now().Add(300 * time.Millisecond), Game: "zelda.sfc"})
+	waitFor(t, "the frame after the swap fired", func() bool {
+		got := frames()
+		return got[len(got)-1] == ""
+	})
+}
+
+func TestPublishScheduleNeedsOverlay(t *testing.T) {
+	s := NewSchedule()
+	s.Arm(slotSwap, ScheduledAction{Type: "swap", At: time.Now().Add(time.Hour), Game: "zelda.sfc"})
+	_, frames := scheduleFrames(t, s, func(b *BizhawkIPC) { b.setCapabilities(map[string]bool{CapQuery: true}) })
+	time.Sleep(3 * scheduleCoalesce)
+	s.Rearm()
+	time.Sleep(3 * scheduleCoalesce)
+	if got := frames(); len(got) > 0 {
+		t.Errorf("SCHEDULE sent to a script without the overlay: %q", got)
+	}
+}
@@ -0,0 +1,377 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-client/internal/luapeer"
+)
+
+// Subsystems a self-test failure is attributed to.
+const (
+	subsystemNetwork    = "network"
+	subsystemIPC        = "ipc"
+	subsystemFilesystem = "filesystem"
+)
+
+const (
+	selftestSession = "selftest"
+	selftestGame    = "selftest.nes"
+	selftestTimeout = 10 * time.Second
+)
+
+// selftestROM is the content served as the fake session's only game.
+var selftestROM = bytes.Repeat([]byte("NES\x1a"), 256)
+
+// selftestStep is one timed stage of the self-test.
+type selftestStep struct {
+	Name      string
+	Subsystem string
+	Run       func(ctx context.Context) error
+}
+
+// selftestEnv is the in-process stand-in for a session: a fake server, the
+// real IPC listener and a fake Lua peer connected to it.
+type selftestEnv struct {
+	dir    string
+	cfg    *Config
+	state  *ClientState
+	api    *API
+	ipc    *BizhawkIPC
+	server *httptest.Server
+	peer   *luapeer.Peer
+
+	stopIPC context.CancelFunc
+}
+
+// runSelftest exercises the local pipeline end to end without joining a
+// real session and prints each step with its duration.
+func runSelftest() error {
+	printVersion(false)
+	env := &selftestEnv{}
+	defer env.close()
+
+	err := env.run(func(step selftestStep, took time.Duration, err error) {
+		if err != nil {
+			fmt.Printf("FAIL  %-22s %8s  [%s] %v\n", step.Name, took, step.Subsystem, err)
+			return
+		}
+		fmt.Printf("PASS  %-22s %8s\n", step.Name, took)
+	})
+	if err != nil {
+		return fmt.Errorf("selftest failed")
+	}
+	fmt.Println("All self-test steps passed.")
+	return nil
+}
+
+// run times each step and passes the result to report. Later steps depend
+// on earlier ones, so it stops at the first failure, leaving the subsystem
+// named the one actually at fault. The test suite runs the same steps.
+func (e *selftestEnv) run(report func(step selftestStep, took time.Duration, err error)) error {
+	for _, step := range e.steps() {
+		ctx, cancel := context.WithTimeout(context.Background(), selftestTimeout)
+		start := time.Now()
+		err := step.Run(ctx)
+		cancel()
+		report(step, time.Since(start).Round(time.Millisecond), err)
+		if err != nil {
+			return fmt.Errorf("%s: %w", step.Name, err)
+		}
+	}
+	return nil
+}
+
+func (e *selftestEnv) steps() []selftestStep {
+	return []selftestStep{
+		{"prepare directories", subsystemFilesystem, e.prepare},
+		{"start fake server", subsystemNetwork, e.startServer},
+		{"register", subsystemNetwork, e.register},
+		{"join session", subsystemNetwork, e.join},
+		{"download rom", subsystemNetwork, e.downloadROM},
+		{"verify rom", subsystemFilesystem, e.verifyROM},
+		{"connect lua peer", subsystemIPC, e.connectPeer},
+		{"ready", subsystemNetwork, e.ready},
+		{"scheduled start", subsystemIPC, e.start},
+		{"save for swap", subsystemIPC, e.save},
+		{"upload save", subsystemNetwork, e.uploadSave},
+		{"swap", subsystemIPC, e.swap},
+		{"pause and resume", subsystemIPC, e.pauseResume},
+		{"shutdown", subsystemIPC, e.shutdown},
+	}
+}
+
+func (e *selftestEnv) prepare(ctx context.Context) error {
+	dir, err := os.MkdirTemp("", "bizhawk-selftest-")
+	if err != nil {
+		return err
+	}
+	e.dir = dir
+	port, err := freeLocalPort()
+	if err != nil {
+		return fmt.Errorf("reserve ipc port: %w", err)
+	}
+	e.cfg = &Config{
+		PlayerName:     "selftest",
+		SessionName:    selftestSession,
+		RomDir:         filepath.Join(dir, "roms"),
+		SaveDir:        filepath.Join(dir, "saves"),
+		BizhawkIPCHost: defaultIPCHost,
+		BizhawkIPCPort: port,
+	}
+	for _, d := range []string{e.cfg.RomDir, e.cfg.SaveDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			return err
+		}
+	}
+	probe := filepath.Join(dir, "probe")
+	if err := os.WriteFile(probe, []byte("ok"), 0o644); err != nil {
+		return err
+	}
+	return replaceFile(probe, probe+".moved")
+}
+
+func (e *selftestEnv) startServer(ctx context.Context) error {
+	e.server = httptest.NewServer(newSelftestServer())
+	e.cfg.ServerURL = e.server.URL
+	e.api = NewAPI(e.cfg)
+	return nil
+}
+
+func (e *selftestEnv) register(ctx context.Context) error {
+	token, appKey, err := e.api.RegisterPlayer(ctx, e.cfg.PlayerName)
+	if err != nil {
+		return err
+	}
+	e.cfg.BearerToken, e.cfg.AppKey = token, appKey
+	e.api.SetToken(token)
+	return nil
+}
+
+func (e *selftestEnv) join(ctx context.Context) error {
+	manifest, err := e.api.JoinSession(ctx, e.cfg.SessionName)
+	if err != nil {
+		return err
+	}
+	if files := manifest.Files(); len(files) != 1 || files[0] != selftestGame {
+		return fmt.Errorf("unexpected manifest %v", files)
+	}
+	return nil
+}
+
+func (e *selftestEnv) downloadROM(ctx context.Context) error {
+	dest := filepath.Join(e.cfg.RomDir, selftestGame)
+	_, err := downloadResumable(ctx, downloadClient, e.cfg.ServerURL+"/api/roms/"+selftestGame, dest, downloadOptions{})
+	return err
+}
+
+func (e *selftestEnv) verifyROM(ctx context.Context) error {
+	got, err := os.ReadFile(filepath.Join(e.cfg.RomDir, selftestGame))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, selftestROM) {
+		return fmt.Errorf("downloaded rom differs (%d bytes, want %d)", len(got), len(selftestROM))
+	}
+	return nil
+}
+
+func (e *selftestEnv) connectPeer(ctx context.Context) error {
+	e.state = NewClientState()
+	e.ipc = NewBizhawkIPC(e.cfg.BizhawkIPCHost, e.cfg.BizhawkIPCPort, e.state)
+	ipcCtx, cancel := context.WithCancel(context.Background())
+	e.stopIPC = cancel
+	listenErr := make(chan error, 1)
+	go func() { listenErr <- e.ipc.Listen(ipcCtx) }()
+
+	peer, err := dialLuaPeer(ctx, hostPort(e.cfg.BizhawkIPCHost, e.cfg.BizhawkIPCPort), listenErr)
+	if err != nil {
+		return err
+	}
+	e.peer = peer
+	// The client answers HELLO with SYNC; seeing it proves both directions.
+	return peer.Expect(ctx, "SYNC")
+}
+
+func (e *selftestEnv) ready(ctx context.Context) error {
+	return e.api.Ready(ctx, e.state, BuildCapabilities(nil, e.ipc.Capabilities(), e.cfg))
+}
+
+func (e *selftestEnv) start(ctx context.Context) error {
+	at := time.Now().Add(time.Second).Unix()
+	if err := e.ipc.SendCommand("START", strconv.FormatInt(at, 10), selftestGame); err != nil {
+		return err
+	}
+	return e.peer.Expect(ctx, "START")
+}
+
+func (e *selftestEnv) save(ctx context.Context) error {
+	path := filepath.Join(e.cfg.SaveDir, "selftest.State")
+	if err := e.ipc.SendCommand("SAVE", path); err != nil {
+		return err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("lua peer acknowledged SAVE but wrote nothing: %w", err)
+	}
+	if fi.Size() == 0 {
+		return fmt.Errorf("savestate %s is empty", path)
+	}
+	return nil
+}
+
+func (e *selftestEnv) uploadSave(ctx context.Context) error {
+	return e.api.UploadSave(ctx, filepath.Join(e.cfg.SaveDir, "selftest.State"), 1)
+}
+
+func (e *selftestEnv) swap(ctx context.Context) error {
+	at := time.Now().Unix()
+	if err := e.ipc.SendCommand("SWAP", strconv.FormatInt(at, 10), selftestGame); err != nil {
+		return err
+	}
+	return e.peer.Expect(ctx, "SWAP")
+}
+
+func (e *selftestEnv) pauseResume(ctx context.Context) error {
+	if err := e.ipc.SendCommand("PAUSE"); err != nil {
+		return err
+	}
+	if err := e.ipc.SendCommand("RESUME"); err != nil {
+		return err
+	}
+	if err := e.peer.Expect(ctx, "PAUSE"); err != nil {
+		return err
+	}
+	return e.peer.Expect(ctx, "RESUME")
+}
+
+func (e *selftestEnv) shutdown(ctx context.Context) error {
+	if err := e.ipc.Close(ctx); err != nil {
+		return err
+	}
+	if err := e.ipc.SendCommand("PAUSE"); !errors.Is(err, ErrShuttingDown) {
+		return fmt.Errorf("command after Close: got %v, want %v", err, ErrShuttingDown)
+	}
+	return e.peer.WaitClosed(ctx)
+}
+
+func (e *selftestEnv) close() {
+	if e.stopIPC != nil {
+		e.stopIPC()
+	}
+	if e.peer != nil {
+		_ = e.peer.Close()
+	}
+	if e.server != nil {
+		e.server.Close()
+	}
+	if e.dir != "" {
+		_ = os.RemoveAll(e.dir)
+	}
+}
+
+// freeLocalPort asks the OS for an unused loopback port.
+func freeLocalPort() (int, error) {
+	ln, err := net.Listen("tcp", hostPort(defaultIPCHost, 0))
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
+
+// selftestScript is the Lua script the fake server hands out.
+const selftestScript = "-- protocol: 2\n-- Stand-in for the session's script\n"
+
+// newSelftestServer fakes the server endpoints the self-test touches, and
+// those a full Run against it needs. Other routes answer 404, which the
+// client takes as a server that predates them.
+func newSelftestServer() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/register-player", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{"bearer_token": "selftest-token", "reverb_app_key": "selftest"})
+	})
+	authed := func(fn http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer selftest-token" {
+				http.Error(w, "unauthenticated", http.StatusUnauthorized)
+				return
+			}
+			fn(w, r)
+		}
+	}
+	mux.HandleFunc("POST /api/check-token", authed(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{})
+	}))
+	mux.HandleFunc("GET /api/check-session/{name}", authed(func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("name") != selftestSession {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, map[string]string{"name": selftestSession})
+	}))
+	mux.HandleFunc("GET /api/scripts/latest", authed(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "swap_latest.lua", time.Time{}, strings.NewReader(selftestScript))
+	}))
+	mux.HandleFunc("POST /api/join-session/{name}", authed(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"games": []ManifestGame{{ID: 1, File: selftestGame}}})
+	}))
+	mux.HandleFunc("GET /api/roms/{file}", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, r.PathValue("file"), time.Time{}, bytes.NewReader(selftestROM))
+	})
+	mux.HandleFunc("POST /api/ready", authed(func(w http.ResponseWriter, r *http.Request) {
+		var caps struct {
+			Capabilities Capabilities `json:"capabilities"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&caps); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, map[string]any{})
+	}))
+	mux.HandleFunc("POST /api/saves/upload", authed(func(w http.ResponseWriter, r *http.Request) {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		if n, _ := io.Copy(io.Discard, file); n == 0 {
+			http.Error(w, "empty save", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	return mux
+}
+
+// dialLuaPeer connects the bundled happy-path Lua peer to the IPC
+// listener, giving up early if the listener itself failed.
+func dialLuaPeer(ctx context.Context, addr string, listenErr <-chan error) (*luapeer.Peer, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go func() {
+		select {
+		case err := <-listenErr:
+			cancel(fmt.Errorf("ipc listener: %w", err))
+		case <-ctx.Done():
+		}
+	}()
+	peer, err := luapeer.Dial(ctx, addr, luapeer.MustLoad("happy-path"), nil)
+	if err != nil && context.Cause(ctx) != ctx.Err() {
+		return nil, context.Cause(ctx)
+	}
+	return peer, err
+}
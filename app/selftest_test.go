@@ -0,0 +1,52 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSelftestPipeline(t *testing.T) {
+	env := &selftestEnv{}
+	var passed []string
+	err := env.run(func(step selftestStep, took time.Duration, err error) {
+		if err != nil {
+			t.Errorf("%s [%s]: %v", step.Name, step.Subsystem, err)
+			return
+		}
+		passed = append(passed, step.Name)
+	})
+	dir := env.dir
+	env.close()
+	if err != nil {
+		t.FailNow()
+	}
+	if len(passed) != len(env.steps()) {
+		t.Errorf("passed %d of %d steps", len(passed), len(env.steps()))
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("selftest left %s behind: %v", dir, err)
+	}
+}
+
+func TestDialLuaPeerListenerFailure(t *testing.T) {
+	port, err := freeLocalPort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listenErr := make(chan error, 1)
+	listenErr <- errors.New("address in use")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	_, err = dialLuaPeer(ctx, hostPort(defaultIPCHost, port), listenErr)
+	if err == nil || err.Error() != "ipc listener: address in use" {
+		t.Errorf("dialLuaPeer = %v; want the listener's error", err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("gave up after %s; want at once", took)
+	}
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"runtime"
+)
+
+// IPCStatus summarizes the BizHawk Lua connection.
+type IPCStatus struct {
+	Connected    bool     `json:"connected"`
+	Capabilities []string `json:"capabilities"`
+	Pending      int      `json:"pending_commands"`
+
+	// NackStreaks counts consecutive NACKs per command; Escalations the
+	// script reloads they triggered.
+	NackStreaks map[string]int `json:"nack_streaks,omitempty"`
+	Escalations int64          `json:"escalations,omitempty"`
+}
+
+// SnapshotExtended is the single consolidated view of the client used for
+// the heartbeat payload and local status/debug output. JSON names match
+// what the server's heartbeat consumer expects; add fields here rather
+// than assembling ad-hoc views elsewhere.
+type SnapshotExtended struct {
+	Ping            int               `json:"ping"`
+	CurrentGame     string            `json:"current_game"`
+	CurrentGameMeta *GameMeta         `json:"current_game_meta,omitempty"`
+	PlaytimeSec     int64             `json:"playtime_sec"`
+	Connected       bool              `json:"connected"`
+	Ready           bool              `json:"ready"`
+	State           string            `json:"state"`
+	StateAt         int64             `json:"state_at"`
+	SessionName     string            `json:"session_name,omitempty"`
+	LastError       string            `json:"last_error,omitempty"`
+	InstanceID      string            `json:"instance_id"`
+	OSArch          string            `json:"os_arch"`
+	ClientVersion   string            `json:"client_version"`
+	ClientArch      string            `json:"client_arch"`
+	BizHawkPID      int               `json:"bizhawk_pid,omitempty"`
+	RoundsPlayed    int               `json:"rounds_played"`
+	IPC             IPCStatus         `json:"ipc"`
+	LogLevel        LogLevelStatus    `json:"log_level"`
+	PlaytimeSeconds map[string]int64  `json:"playtime_seconds,omitempty"`
+	OutboxPending   map[string]int    `json:"outbox_pending,omitempty"`
+	Grace           *GraceStatus      `json:"grace,omitempty"`
+	Schedule        []ScheduledAction `json:"schedule,omitempty"`
+	Disk            *DiskStatus       `json:"disk,omitempty"`
+
+	HeartbeatsSkipped int64  `json:"heartbeats_skipped,omitempty"`
+	Hardcore          bool   `json:"hardcore"`
+	Role              string `json:"role"`
+}
+
+// ipcStatusProvider is implemented by BizhawkIPC.
+type ipcStatusProvider interface {
+	Status() IPCStatus
+}
+
+// SnapshotSources are the components a SnapshotExtended is assembled from.
+// Nil sources contribute zero values.
+type SnapshotSources struct {
+	State      *ClientState
+	IPC        ipcStatusProvider
+	Config     *Config
+	BizHawkPID func() int
+	Rounds     func() int
+	Outbox     *Outbox
+	Schedule   *Schedule
+	GameMeta   *GameMetaCache
+	Disk       func() *DiskStatus
+}
+
+// BuildSnapshotExtended assembles a consistent extended snapshot.
+func BuildSnapshotExtended(src SnapshotSources) SnapshotExtended {
+	out := SnapshotExtended{
+		ClientArch:    runtime.GOARCH,
+		ClientVersion: version,
+		LogLevel:      logLevels.Status(),
+	}
+	if src.State != nil {
+		snap := src.State.Snapshot()
+		out.Ping = snap.Ping
+		out.CurrentGame = snap.CurrentGame
+		out.Connected = snap.Connected
+		out.Ready = snap.Ready
+		out.State = snap.State
+		out.StateAt = snap.StateAt.Unix()
+		out.SessionName = snap.SessionName
+		out.LastError = snap.LastError
+		out.PlaytimeSeconds = snap.PlaytimeSeconds
+		out.PlaytimeSec = out.PlaytimeSeconds[snap.CurrentGame]
+		out.Grace = src.State.Grace()
+		out.HeartbeatsSkipped = snap.HeartbeatsSkipped
+		out.Hardcore = snap.Hardcore
+		out.Role = snap.Role
+	}
+	if src.Config != nil {
+		out.InstanceID = src.Config.InstanceID
+		out.OSArch = src.Config.HostArch
+	}
+	if src.IPC != nil {
+		out.IPC = src.IPC.Status()
+	}
+	if src.BizHawkPID != nil {
+		out.BizHawkPID = src.BizHawkPID()
+	}
+	if src.Rounds != nil {
+		out.RoundsPlayed = src.Rounds()
+	}
+	if src.Outbox != nil {
+		out.OutboxPending = src.Outbox.PendingByType()
+	}
+	if src.Schedule != nil {
+		out.Schedule = src.Schedule.List()
+	}
+	if src.Disk != nil {
+		out.Disk = src.Disk()
+	}
+	if src.GameMeta != nil && out.CurrentGame != "" {
+		out.CurrentGameMeta = src.GameMeta.Lookup(out.CurrentGame)
+	}
+	return out
+}
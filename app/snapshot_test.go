@@ -0,0 +1,132 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// checkGolden compares v's indented JSON with testdata/name. Run the tests
+// with -update to accept a deliberate change.
+func checkGolden(t *testing.T, name string, v any) {
+	t.Helper()
+	got, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	want = bytes.ReplaceAll(want, []byte("\r\n"), []byte("\n"))
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s changed; JSON field names are a contract, only ever add fields.\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+var goldenTime = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// fillValue sets every field reachable from v to a fixed non-zero value, so
+// omitempty fields show up in golden output too.
+func fillValue(v reflect.Value) {
+	if v.Type() == reflect.TypeOf(time.Time{}) {
+		v.Set(reflect.ValueOf(goldenTime))
+		return
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1)
+	case reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+		fillValue(v.Elem())
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fillValue(v.Index(0))
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		key := reflect.New(v.Type().Key()).Elem()
+		elem := reflect.New(v.Type().Elem()).Elem()
+		fillValue(key)
+		fillValue(elem)
+		m.SetMapIndex(key, elem)
+		v.Set(m)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				fillValue(v.Field(i))
+			}
+		}
+	}
+}
+
+func TestSnapshotExtendedGolden(t *testing.T) {
+	var snap SnapshotExtended
+	fillValue(reflect.ValueOf(&snap).Elem())
+	checkGolden(t, "snapshot_extended.json", snap)
+}
+
+type fakeIPCStatus IPCStatus
+
+func (f fakeIPCStatus) Status() IPCStatus { return IPCStatus(f) }
+
+func TestBuildSnapshotExtended(t *testing.T) {
+	state := NewClientState()
+	state.SetCurrentGame("mario.nes")
+	state.SetSessionName("relay")
+	cfg := &Config{InstanceID: "inst-1", HostArch: "arm64"}
+
+	snap := BuildSnapshotExtended(SnapshotSources{
+		State:      state,
+		Config:     cfg,
+		IPC:        fakeIPCStatus{Connected: true, Pending: 2},
+		BizHawkPID: func() int { return 4242 },
+		Rounds:     func() int { return 7 },
+	})
+	if snap.CurrentGame != "mario.nes" || snap.SessionName != "relay" {
+		t.Errorf("state fields = %q, %q", snap.CurrentGame, snap.SessionName)
+	}
+	if snap.InstanceID != "inst-1" || snap.OSArch != "arm64" {
+		t.Errorf("config fields = %q, %q", snap.InstanceID, snap.OSArch)
+	}
+	if !snap.IPC.Connected || snap.IPC.Pending != 2 {
+		t.Errorf("IPC = %+v", snap.IPC)
+	}
+	if snap.BizHawkPID != 4242 || snap.RoundsPlayed != 7 {
+		t.Errorf("BizHawkPID, RoundsPlayed = %d, %d", snap.BizHawkPID, snap.RoundsPlayed)
+	}
+	if snap.ClientVersion != version {
+		t.Errorf("ClientVersion = %q", snap.ClientVersion)
+	}
+
+	// Missing sources contribute zero values instead of panicking.
+	empty := BuildSnapshotExtended(SnapshotSources{})
+	if empty.CurrentGame != "" || empty.IPC.Connected || empty.Schedule != nil {
+		t.Errorf("empty snapshot = %+v", empty)
+	}
+}
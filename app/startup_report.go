@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// strictBootstrap makes every Bootstrap failure fatal (-strict).
+var strictBootstrap bool
+
+// Bootstrap steps. Critical steps always abort startup; the rest are
+// collected into a StartupReport unless -strict is set.
+const (
+	StepDirectories    = "directories"
+	StepBizHawk        = "bizhawk_install"
+	StepRegister       = "registration"
+	StepSessionJoin    = "session_join"
+	StepManifest       = "manifest"
+	StepROMDownload    = "rom_download"
+	StepResumeDownload = "resume_download"
+	StepLuaScript      = "lua_script"
+)
+
+var criticalSteps = map[string]bool{
+	StepDirectories: true,
+	StepBizHawk:     true,
+	StepRegister:    true,
+	StepSessionJoin: true,
+	StepManifest:    true,
+	StepLuaScript:   true,
+}
+
+// isCriticalStep reports whether a failure in step must abort startup.
+func isCriticalStep(step string) bool {
+	return strictBootstrap || criticalSteps[step]
+}
+
+// StartupWarning is one non-critical Bootstrap failure.
+type StartupWarning struct {
+	Step  string `json:"step"`
+	Item  string `json:"item,omitempty"`
+	Error string `json:"error"`
+}
+
+// StartupReport collects non-critical Bootstrap failures.
+type StartupReport struct {
+	mu       sync.Mutex
+	Warnings []StartupWarning `json:"warnings"`
+}
+
+// check returns err if step is critical, otherwise records it as a warning
+// and returns nil.
+func (r *StartupReport) check(step, item string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if isCriticalStep(step) {
+		return err
+	}
+	r.mu.Lock()
+	r.Warnings = append(r.Warnings, StartupWarning{Step: step, Item: item, Error: err.Error()})
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *StartupReport) Empty() bool {
+	if r == nil {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.Warnings) == 0
+}
+
+// Print shows the warnings on the console and in the log.
+func (r *StartupReport) Print() {
+	if r.Empty() {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintf(os.Stderr, "\nStarted with %d warning(s):\n", len(r.Warnings))
+	for _, w := range r.Warnings {
+		line := fmt.Sprintf("  - %s %s: %s", w.Step, w.Item, w.Error)
+		fmt.Fprintln(os.Stderr, line)
+		log.Printf("Startup warning: %s", line)
+	}
+	fmt.Fprintln(os.Stderr, "Affected games will be retried if they come up in a swap.")
+	fmt.Fprintln(os.Stderr)
+}
+
+// ReportStartupWarnings sends the non-critical Bootstrap failures to the
+// server. Delivery goes through the outbox.
+func (a *API) ReportStartupWarnings(ctx context.Context, r *StartupReport) error {
+	if r.Empty() {
+		return nil
+	}
+	r.mu.Lock()
+	payload := map[string]any{"warnings": append([]StartupWarning(nil), r.Warnings...)}
+	r.mu.Unlock()
+	return a.outbox.Submit(ctx, ReportStartupWarnings, "/api/startup-warnings", payload)
+}
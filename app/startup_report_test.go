@@ -0,0 +1,122 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStartupReportCheck(t *testing.T) {
+	boom := errors.New("boom")
+	tests := []struct {
+		step   string
+		strict bool
+		fatal  bool
+	}{
+		{StepROMDownload, false, false},
+		{StepResumeDownload, false, false},
+		{StepROMDownload, true, true},
+		{StepLuaScript, false, true},
+		{StepManifest, false, true},
+		{StepBizHawk, false, true},
+	}
+	for _, tt := range tests {
+		old := strictBootstrap
+		strictBootstrap = tt.strict
+		r := &StartupReport{}
+		err := r.check(tt.step, "mario.nes", boom)
+		strictBootstrap = old
+
+		if fatal := err != nil; fatal != tt.fatal {
+			t.Errorf("check(%s, strict=%v) = %v; want fatal %v", tt.step, tt.strict, err, tt.fatal)
+		}
+		want := []StartupWarning{{Step: tt.step, Item: "mario.nes", Error: "boom"}}
+		if tt.fatal {
+			want = nil
+		}
+		if !slices.Equal(r.Warnings, want) {
+			t.Errorf("check(%s, strict=%v) recorded %v; want %v", tt.step, tt.strict, r.Warnings, want)
+		}
+	}
+
+	r := &StartupReport{}
+	if err := r.check(StepManifest, "", nil); err != nil || !r.Empty() {
+		t.Errorf("nil error: %v, empty %v", err, r.Empty())
+	}
+	if !(*StartupReport)(nil).Empty() {
+		t.Error("nil report not empty")
+	}
+}
+
+func TestSwapRetriesGameMissingAtStartup(t *testing.T) {
+	tests := []struct {
+		name   string
+		served bool
+	}{
+		{"download recovers", true},
+		{"still unavailable", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newHandlerFixture(t)
+			f.h.prepares.timeout = 10 * time.Millisecond
+			files := map[string]string{}
+			if tt.served {
+				files["/api/roms/zelda.sfc"] = romBytes
+			}
+			var hits atomic.Int32
+			f.cfg.ServerURL = romServer(t, files, &hits).URL
+			f.state.FlagMissingGame("zelda.sfc")
+
+			f.dispatch("prepare_swap", `{"round_number":2,"new_game":"zelda.sfc"}`)
+			f.dispatch("swap", fmt.Sprintf(`{"round_number":2,"new_game":"zelda.sfc","swap_at":%d}`, time.Now().Unix()))
+			if tt.served {
+				waitFor(t, "swap", func() bool { return slices.Contains(f.emu.Sent(), "SWAP") })
+				if f.state.IsGameMissing("zelda.sfc") {
+					t.Error("game still flagged after its download")
+				}
+			} else {
+				waitFor(t, "swap failure", func() bool {
+					return slices.Contains(f.server.Calls(), "SwapFailed "+SwapFailedROMMissing)
+				})
+				if slices.Contains(f.emu.Sent(), "SWAP") {
+					t.Error("swapped to a game that is not on disk")
+				}
+				if !f.state.IsGameMissing("zelda.sfc") {
+					t.Error("flag cleared though the download failed")
+				}
+			}
+			if n := hits.Load(); n != 1 {
+				t.Errorf("server saw %d downloads; want one retry", n)
+			}
+
+			// Games downloaded at startup are not fetched again.
+			hits.Store(0)
+			if err := os.WriteFile(f.h.romPath("sonic.md"), []byte(romBytes), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			f.dispatch("prepare_swap", `{"round_number":3,"new_game":"sonic.md"}`)
+			f.dispatch("swap", fmt.Sprintf(`{"round_number":3,"new_game":"sonic.md","swap_at":%d}`, time.Now().Unix()))
+			swaps := 1
+			if tt.served {
+				swaps = 2
+			}
+			waitFor(t, "swap to sonic.md", func() bool {
+				n := 0
+				for _, c := range f.emu.Sent() {
+					if c == "SWAP" {
+						n++
+					}
+				}
+				return n == swaps
+			})
+			if n := hits.Load(); n != 0 {
+				t.Errorf("unflagged game downloaded %d times", n)
+			}
+		})
+	}
+}
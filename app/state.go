@@ -0,0 +1,716 @@
+package app
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StateEventType enumerates the event types emitted by ClientState.
+type StateEventType string
+
+const (
+	EventPingUpdated        StateEventType = "ping_updated"
+	EventConnected          StateEventType = "connected"
+	EventDisconnected       StateEventType = "disconnected"
+	EventCurrentGameChanged StateEventType = "current_game_changed"
+	EventReadyChanged       StateEventType = "ready_changed"
+	EventStateChanged       StateEventType = "state_changed"
+	EventStateTimeChanged   StateEventType = "state_time_changed"
+	EventHardcoreChanged    StateEventType = "hardcore_changed"
+	EventRoleChanged        StateEventType = "role_changed"
+	EventDownloadProgress   StateEventType = "download_progress"
+	EventCircuitChanged     StateEventType = "circuit_changed"
+	EventError              StateEventType = "error"
+)
+
+// Session roles. Spectators stay connected and visible but take no part
+// in swaps.
+const (
+	RolePlayer    = "player"
+	RoleSpectator = "spectator"
+)
+
+// StateEvent is a small event sent to subscribers.
+type StateEvent struct {
+	Type StateEventType `json:"type"`
+	Old  interface{}    `json:"old,omitempty"`
+	New  interface{}    `json:"new,omitempty"`
+	When time.Time      `json:"when"`
+}
+
+// ClientStateSnapshot is a serializable snapshot of important fields.
+type ClientStateSnapshot struct {
+	Ping          int       `json:"ping"`
+	Connected     bool      `json:"connected"`
+	CurrentGame   string    `json:"current_game"`
+	LastHeartbeat time.Time `json:"last_heartbeat"`
+	Ready         bool      `json:"ready"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorAt   time.Time `json:"last_error_at,omitzero"`
+	StateAt       time.Time `json:"state_at"`
+	State         string    `json:"state"`
+	SessionName   string    `json:"session_name,omitempty"`
+
+	PlaytimeSeconds map[string]int64 `json:"playtime_seconds,omitempty"`
+	PendingReports  []OutboxReport   `json:"pending_reports,omitempty"`
+
+	InterruptedDownloads []InterruptedDownload `json:"interrupted_downloads,omitempty"`
+
+	// HeartbeatsSkipped counts heartbeats dropped this run because the
+	// previous one was still pending. It is not restored on load.
+	HeartbeatsSkipped int64 `json:"heartbeats_skipped,omitempty"`
+
+	// Hardcore is the ranked-session lock on local controls. It is not
+	// restored on load; the server sends it again with ready.
+	Hardcore bool `json:"hardcore,omitempty"`
+
+	// Role is RolePlayer or RoleSpectator. Like Hardcore it is not
+	// restored on load.
+	Role string `json:"role,omitempty"`
+
+	// API counts this run's server calls. It is not restored on load.
+	API APIStats `json:"api"`
+
+	// SwapTimings summarizes how late recent swaps ran. It is not
+	// restored on load.
+	SwapTimings *SwapTimingReport `json:"swap_timings,omitempty"`
+}
+
+// ClientState holds ephemeral runtime state (concurrency safe).
+type ClientState struct {
+	mu sync.RWMutex
+
+	ping          int
+	connected     bool
+	currentGame   string
+	lastHeartbeat time.Time
+	ready         bool
+	lastError     string
+	lastErrorAt   time.Time
+	stateAt       time.Time
+	state         string
+	sessionName   string
+	saveTemplate  string
+	hardcore      bool
+	role          string
+	sessionEnded  bool
+
+	// Games whose startup download failed; retried on demand.
+	missingGames map[string]bool
+
+	// Playtime accounting (see playtime.go)
+	now          func() time.Time
+	ipcConnected bool
+	segmentStart time.Time
+	playtime     map[string]time.Duration
+
+	// Undelivered high-value server reports (see outbox.go)
+	pendingReports []OutboxReport
+
+	// Downloads cut short by shutdown (see downloads.go)
+	interruptedDownloads []InterruptedDownload
+
+	// Disconnect-handling suppression (see grace.go)
+	grace graceWindows
+
+	// Server time minus local time (see clock.go)
+	clockOffset time.Duration
+
+	// Change counters for compare-and-set updates from slow responses.
+	gameVersion  uint64
+	stateVersion uint64
+
+	// stateSeq is the server sequence number of the last state applied
+	// from a change_game_state event, or 0 (see ApplyStateOrdered).
+	stateSeq int64
+
+	// Heartbeats skipped while one was in flight (see api_client.go)
+	heartbeatsSkipped atomic.Int64
+
+	// API call counters (see apistats.go)
+	api apiCounters
+
+	// Recent swap timings (see swap_timing.go)
+	swaps swapTimings
+
+	subMu sync.Mutex
+	subs  map[chan StateEvent]struct{}
+}
+
+// NewClientState constructs an empty ClientState.
+func NewClientState() *ClientState {
+	return &ClientState{
+		subs:     make(map[chan StateEvent]struct{}),
+		now:      time.Now,
+		playtime: make(map[string]time.Duration),
+
+		missingGames: make(map[string]bool),
+	}
+}
+
+// Subscribe returns a buffered channel that receives StateEvent.
+// Unsubscribe must be called to stop and close the channel.
+func (s *ClientState) Subscribe(buf int) chan StateEvent {
+	if buf <= 0 {
+		buf = 4
+	}
+	ch := make(chan StateEvent, buf)
+	s.subMu.Lock()
+	s.subs[ch] = struct{}{}
+	s.subMu.Unlock()
+	return ch
+}
+
+// Unsubscribe closes and removes the subscription channel.
+func (s *ClientState) Unsubscribe(ch chan StateEvent) {
+	s.subMu.Lock()
+	if _, ok := s.subs[ch]; ok {
+		delete(s.subs, ch)
+		close(ch)
+	}
+	s.subMu.Unlock()
+}
+
+func (s *ClientState) notify(ev StateEvent) {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	for ch := range s.subs {
+		select {
+		case ch <- ev:
+		default:
+			// drop on slow subscriber
+		}
+	}
+}
+
+// DownloadProgress is the New value of an EventDownloadProgress. Total is
+// -1 when the server did not send the size.
+type DownloadProgress struct {
+	File    string `json:"file"`
+	Written int64  `json:"written"`
+	Total   int64  `json:"total"`
+}
+
+// ReportDownloadProgress publishes how far a download has got.
+func (s *ClientState) ReportDownloadProgress(p DownloadProgress) {
+	s.notify(StateEvent{Type: EventDownloadProgress, New: p, When: time.Now()})
+}
+
+// SetPing updates the measured round trip to the server.
+func (s *ClientState) SetPing(p int) {
+	s.mu.Lock()
+	old := s.ping
+	s.ping = p
+	s.mu.Unlock()
+
+	s.notify(StateEvent{Type: EventPingUpdated, Old: old, New: p, When: time.Now()})
+}
+
+// MarkHeartbeat records a heartbeat the server accepted.
+func (s *ClientState) MarkHeartbeat() {
+	s.mu.Lock()
+	s.lastHeartbeat = time.Now()
+	s.grace.heartbeatSeen = true
+	s.mu.Unlock()
+}
+
+// SetConnected sets connection state and emits an event.
+func (s *ClientState) SetConnected(c bool) {
+	s.mu.Lock()
+	old := s.connected
+	s.connected = c
+	s.mu.Unlock()
+
+	typ := EventDisconnected
+	if c {
+		typ = EventConnected
+	}
+	s.notify(StateEvent{Type: typ, Old: old, New: c, When: time.Now()})
+}
+
+// ReportCircuit publishes a circuit breaker transition (see breaker.go).
+func (s *ClientState) ReportCircuit(from, to string) {
+	s.notify(StateEvent{Type: EventCircuitChanged, Old: from, New: to, When: time.Now()})
+}
+
+// StateVersions identifies the current game and scheduled state at one
+// moment; see ApplyCurrentGameIfNewer and ApplyStateIfNewer.
+type StateVersions struct {
+	Game  uint64
+	State uint64
+}
+
+// Versions returns the change counters to pass to the ApplyIfNewer
+// helpers. Take it before sending a request whose response carries state.
+func (s *ClientState) Versions() StateVersions {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return StateVersions{Game: s.gameVersion, State: s.stateVersion}
+}
+
+// SetCurrentGame updates current game and emits event.
+func (s *ClientState) SetCurrentGame(name string) {
+	s.mu.Lock()
+	old := s.setCurrentGameLocked(name)
+	s.mu.Unlock()
+	s.notifyCurrentGame(old, name)
+}
+
+// ApplyCurrentGameIfNewer sets the current game from a response only if
+// nothing changed it since since was taken, so a slow Ready cannot undo
+// a swap that happened meanwhile. It reports whether it applied.
+func (s *ClientState) ApplyCurrentGameIfNewer(name string, since StateVersions) bool {
+	s.mu.Lock()
+	if s.gameVersion != since.Game {
+		s.mu.Unlock()
+		return false
+	}
+	old := s.setCurrentGameLocked(name)
+	s.mu.Unlock()
+	s.notifyCurrentGame(old, name)
+	return true
+}
+
+func (s *ClientState) setCurrentGameLocked(name string) string {
+	s.accrueLocked()
+	old := s.currentGame
+	s.currentGame = name
+	s.gameVersion++
+	return old
+}
+
+func (s *ClientState) notifyCurrentGame(old, name string) {
+
+	s.notify(StateEvent{
+		Type: EventCurrentGameChanged,
+		Old:  old,
+		New:  name,
+		When: time.Now(),
+	})
+}
+
+// AddSkippedHeartbeat counts a heartbeat skipped while one was pending.
+func (s *ClientState) AddSkippedHeartbeat() {
+	s.heartbeatsSkipped.Add(1)
+}
+
+// SetLastError records the most recent failure worth surfacing to the
+// player, prefixed with where it happened, and emits an EventError. A nil
+// err clears it.
+func (s *ClientState) SetLastError(source string, err error) {
+	msg := ""
+	if err != nil {
+		msg = source + ": " + err.Error()
+	}
+	now := time.Now()
+	s.mu.Lock()
+	old := s.lastError
+	s.lastError = msg
+	s.lastErrorAt = now
+	s.mu.Unlock()
+
+	if err != nil {
+		s.notify(StateEvent{Type: EventError, Old: old, New: msg, When: now})
+	}
+}
+
+// GetLastError returns the most recent recorded failure.
+func (s *ClientState) GetLastError() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastError
+}
+
+// SetReady sets ready flag.
+func (s *ClientState) SetReady(r bool) {
+	s.mu.Lock()
+	old := s.ready
+	s.ready = r
+	s.mu.Unlock()
+
+	s.notify(StateEvent{
+		Type: EventReadyChanged,
+		Old:  old,
+		New:  r,
+		When: time.Now(),
+	})
+}
+
+// SetHardcore turns the ranked-session lock on local controls on or off,
+// emitting an event when it changes.
+func (s *ClientState) SetHardcore(on bool) {
+	s.mu.Lock()
+	old := s.hardcore
+	s.hardcore = on
+	s.mu.Unlock()
+	if old == on {
+		return
+	}
+	s.notify(StateEvent{
+		Type: EventHardcoreChanged,
+		Old:  old,
+		New:  on,
+		When: time.Now(),
+	})
+}
+
+// Hardcore reports whether local pause and practice controls are locked.
+func (s *ClientState) Hardcore() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.hardcore
+}
+
+// MarkSessionEnded records that the server ended the session.
+func (s *ClientState) MarkSessionEnded() {
+	s.mu.Lock()
+	s.sessionEnded = true
+	s.mu.Unlock()
+}
+
+// SessionEnded reports whether the server ended the session this run.
+func (s *ClientState) SessionEnded() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sessionEnded
+}
+
+// SetRole switches between RolePlayer and RoleSpectator, emitting an
+// event when it changes.
+func (s *ClientState) SetRole(role string) {
+	s.mu.Lock()
+	old := s.roleLocked()
+	s.role = role
+	s.mu.Unlock()
+	if old == role {
+		return
+	}
+	s.notify(StateEvent{
+		Type: EventRoleChanged,
+		Old:  old,
+		New:  role,
+		When: time.Now(),
+	})
+}
+
+// Role returns the client's role in the session; RolePlayer by default.
+func (s *ClientState) Role() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.roleLocked()
+}
+
+// Spectating reports whether the client is a spectator.
+func (s *ClientState) Spectating() bool {
+	return s.Role() == RoleSpectator
+}
+
+func (s *ClientState) roleLocked() string {
+	if s.role == "" {
+		return RolePlayer
+	}
+	return s.role
+}
+
+// SetState sets the scheduled state and its time and emits events.
+func (s *ClientState) SetState(t time.Time, state string) {
+	s.mu.Lock()
+	oldStateAt, oldState := s.setStateLocked(t, state)
+	s.mu.Unlock()
+	s.notifyState(oldStateAt, oldState, t)
+}
+
+// ApplyStateIfNewer is the SetState counterpart of
+// ApplyCurrentGameIfNewer.
+func (s *ClientState) ApplyStateIfNewer(t time.Time, state string, since StateVersions) bool {
+	s.mu.Lock()
+	if s.stateVersion != since.State {
+		s.mu.Unlock()
+		return false
+	}
+	oldStateAt, oldState := s.setStateLocked(t, state)
+	s.mu.Unlock()
+	s.notifyState(oldStateAt, oldState, t)
+	return true
+}
+
+func (s *ClientState) setStateLocked(t time.Time, state string) (time.Time, string) {
+	s.accrueLocked()
+	oldStateAt, oldState := s.stateAt, s.state
+	s.stateAt, s.state = t, state
+	s.stateVersion++
+	s.stateSeq = 0
+	return oldStateAt, oldState
+}
+
+// StateOrder is the logical clock of the scheduled state: its state_at,
+// with the server's sequence number (0 if none) breaking ties.
+type StateOrder struct {
+	At  time.Time
+	Seq int64
+}
+
+// Before reports whether o is older than other. Equal times are only
+// ordered when both carry a sequence number; otherwise neither is older.
+func (o StateOrder) Before(other StateOrder) bool {
+	if !o.At.Equal(other.At) {
+		return o.At.Before(other.At)
+	}
+	return o.Seq > 0 && other.Seq > 0 && o.Seq <= other.Seq
+}
+
+// ApplyStateOrdered sets the state unless the current one is newer by
+// StateOrder, so events delivered out of order cannot roll it back. force
+// applies it regardless. It returns whether the state was applied and the
+// order it was compared against.
+func (s *ClientState) ApplyStateOrdered(t time.Time, state string, seq int64, force bool) (bool, StateOrder) {
+	s.mu.Lock()
+	current := StateOrder{At: s.stateAt, Seq: s.stateSeq}
+	if !force && (StateOrder{At: t, Seq: seq}).Before(current) {
+		s.mu.Unlock()
+		return false, current
+	}
+	oldStateAt, oldState := s.setStateLocked(t, state)
+	s.stateSeq = seq
+	s.mu.Unlock()
+	s.notifyState(oldStateAt, oldState, t)
+	return true, current
+}
+
+// CurrentStateOrder returns the order of the scheduled state.
+func (s *ClientState) CurrentStateOrder() StateOrder {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return StateOrder{At: s.stateAt, Seq: s.stateSeq}
+}
+
+func (s *ClientState) notifyState(oldStateAt time.Time, oldState string, t time.Time) {
+
+	s.notify(StateEvent{
+		Type: EventStateTimeChanged,
+		Old:  oldStateAt,
+		New:  t,
+		When: time.Now(),
+	})
+
+	s.notify(StateEvent{
+		Type: EventStateChanged,
+		Old:  oldState,
+		New:  t,
+		When: time.Now(),
+	})
+}
+
+// Snapshot returns a copy of important runtime info.
+func (s *ClientState) Snapshot() ClientStateSnapshot {
+	playtime := playtimeSeconds(s.Playtime())
+	s.mu.RLock()
+	snap := ClientStateSnapshot{
+		Ping:          s.ping,
+		Connected:     s.connected,
+		CurrentGame:   s.currentGame,
+		LastHeartbeat: s.lastHeartbeat,
+		Ready:         s.ready,
+		LastError:     s.lastError,
+		LastErrorAt:   s.lastErrorAt,
+		StateAt:       s.stateAt,
+		State:         s.state,
+		SessionName:   s.sessionName,
+
+		PlaytimeSeconds: playtime,
+		PendingReports:  s.pendingReports,
+
+		InterruptedDownloads: s.interruptedDownloads,
+
+		HeartbeatsSkipped: s.heartbeatsSkipped.Load(),
+		Hardcore:          s.hardcore,
+		Role:              s.roleLocked(),
+		API:               s.apiStatsLocked(),
+		SwapTimings:       s.swapTimingLocked(),
+	}
+	s.mu.RUnlock()
+	return snap
+}
+
+// SaveToFile persists a snapshot to disk atomically, with a checksum
+// footer and the previous version kept as a backup (see jsonfile.go).
+func (s *ClientState) SaveToFile(path string) error {
+	body, err := json.MarshalIndent(s.Snapshot(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeChecksummed(path, body)
+}
+
+// LoadFromFile restores from the saved snapshot (best-effort), falling
+// back to the backup when the file is corrupt.
+func (s *ClientState) LoadFromFile(path string) error {
+	var snap ClientStateSnapshot
+	if err := readChecksummed(path, &snap); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.ping = snap.Ping
+	s.connected = snap.Connected
+	s.currentGame = snap.CurrentGame
+	s.lastHeartbeat = snap.LastHeartbeat
+	s.ready = snap.Ready
+	s.lastError = snap.LastError
+	s.lastErrorAt = snap.LastErrorAt
+	s.stateAt = snap.StateAt
+	s.state = snap.State
+	s.sessionName = snap.SessionName
+	s.pendingReports = snap.PendingReports
+	s.interruptedDownloads = snap.InterruptedDownloads
+	s.playtime = make(map[string]time.Duration, len(snap.PlaytimeSeconds))
+	for g, sec := range snap.PlaytimeSeconds {
+		s.playtime[g] = time.Duration(sec) * time.Second
+	}
+	s.segmentStart = s.now()
+	s.mu.Unlock()
+	return nil
+}
+
+// SetSessionName records the session this client has joined.
+func (s *ClientState) SetSessionName(name string) {
+	s.mu.Lock()
+	s.sessionName = name
+	s.mu.Unlock()
+}
+
+// FlagMissingGame marks a game whose download failed at startup.
+func (s *ClientState) FlagMissingGame(file string) {
+	s.mu.Lock()
+	s.missingGames[file] = true
+	s.mu.Unlock()
+}
+
+// ClearMissingGame removes the flag once the game has been downloaded.
+func (s *ClientState) ClearMissingGame(file string) {
+	s.mu.Lock()
+	delete(s.missingGames, file)
+	s.mu.Unlock()
+}
+
+// IsGameMissing reports whether file was flagged by FlagMissingGame.
+func (s *ClientState) IsGameMissing(file string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.missingGames[file]
+}
+
+// SetSaveTemplate records the save naming template agreed with the server.
+func (s *ClientState) SetSaveTemplate(tmpl string) {
+	s.mu.Lock()
+	s.saveTemplate = tmpl
+	s.mu.Unlock()
+}
+
+// GetSaveTemplate returns the agreed save template, or the client default.
+func (s *ClientState) GetSaveTemplate() string {
+	s.mu.RLock()
+	t := s.saveTemplate
+	s.mu.RUnlock()
+	if t == "" {
+		return defaultSaveTemplate
+	}
+	return t
+}
+
+// SetPendingReports records outbox reports to persist with the runtime state.
+func (s *ClientState) SetPendingReports(reports []OutboxReport) {
+	s.mu.Lock()
+	s.pendingReports = reports
+	s.mu.Unlock()
+}
+
+// RecordInterruptedDownload remembers a download to resume on next start,
+// replacing any earlier record for the same destination.
+func (s *ClientState) RecordInterruptedDownload(d InterruptedDownload) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, old := range s.interruptedDownloads {
+		if old.Dest == d.Dest {
+			s.interruptedDownloads[i] = d
+			return
+		}
+	}
+	s.interruptedDownloads = append(s.interruptedDownloads, d)
+}
+
+// ClearInterruptedDownload drops the record for dest.
+func (s *ClientState) ClearInterruptedDownload(dest string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := s.interruptedDownloads[:0]
+	for _, d := range s.interruptedDownloads {
+		if d.Dest != dest {
+			out = append(out, d)
+		}
+	}
+	s.interruptedDownloads = out
+}
+
+// interruptedValidator returns the resume validator recorded for dest.
+func (s *ClientState) interruptedValidator(dest string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, d := range s.interruptedDownloads {
+		if d.Dest == dest {
+			return d.Validator
+		}
+	}
+	return ""
+}
+
+// Convenience getters
+func (s *ClientState) GetInterruptedDownloads() []InterruptedDownload {
+	s.mu.RLock()
+	d := append([]InterruptedDownload(nil), s.interruptedDownloads...)
+	s.mu.RUnlock()
+	return d
+}
+
+func (s *ClientState) GetPendingReports() []OutboxReport {
+	s.mu.RLock()
+	r := s.pendingReports
+	s.mu.RUnlock()
+	return r
+}
+
+func (s *ClientState) GetSessionName() string {
+	s.mu.RLock()
+	n := s.sessionName
+	s.mu.RUnlock()
+	return n
+}
+
+func (s *ClientState) GetCurrentGame() string {
+	s.mu.RLock()
+	g := s.currentGame
+	s.mu.RUnlock()
+	return g
+}
+
+func (s *ClientState) GetPing() int {
+	s.mu.RLock()
+	p := s.ping
+	s.mu.RUnlock()
+	return p
+}
+
+func (s *ClientState) GetStateTime() time.Time {
+	s.mu.RLock()
+	t := s.stateAt
+	s.mu.RUnlock()
+	return t
+}
+
+func (s *ClientState) GetState() string {
+	s.mu.RLock()
+	state := s.state
+	s.mu.RUnlock()
+	return state
+}
@@ -0,0 +1,275 @@
+package app
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed web/index.html
+var statusPage []byte
+
+const (
+	// defaultStatusPort is used when hidden mode needs the web UI but
+	// config.json does not enable it.
+	defaultStatusPort = 55356
+
+	statusPingHistory  = 120
+	statusRecentEvents = 50
+)
+
+// pingSample is one point of the ping sparkline.
+type pingSample struct {
+	At time.Time `json:"at"`
+	Ms int       `json:"ms"`
+}
+
+// StatusServer serves the read-only status page and its JSON endpoints on
+// localhost. Mutating control endpoints require the local control token.
+type StatusServer struct {
+	addr     string
+	token    string
+	snapshot func() SnapshotExtended
+	state    *ClientState
+	ctl      *Control
+
+	mu     sync.Mutex
+	pings  []pingSample
+	events []StateEvent
+}
+
+func NewStatusServer(
+	cfg *Config,
+	state *ClientState,
+	ipc EmulatorIPC,
+	dl *DownloadManager,
+	snapshot func() SnapshotExtended,
+) *StatusServer {
+	return &StatusServer{
+		addr:     statusAddr(cfg),
+		token:    cfg.ControlToken,
+		snapshot: snapshot,
+		state:    state,
+		ctl:      newControl(state, ipc, dl),
+	}
+}
+
+// statusAddr is where the status page listens: the IPC host when that is
+// a loopback address (::1 on IPv6-only setups), else 127.0.0.1, so the
+// page is never reachable from other machines.
+func statusAddr(cfg *Config) string {
+	host := bareHost(cfg.BizhawkIPCHost)
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		host = defaultIPCHost
+	}
+	return hostPort(host, cfg.StatusPort)
+}
+
+// Handler returns the HTTP routes of the status server.
+func (s *StatusServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handlePage)
+	mux.HandleFunc("GET /api/status", s.handleStatus)
+	mux.HandleFunc("GET /api/history", s.handleHistory)
+	mux.HandleFunc("GET /api/events", s.handleEvents)
+	mux.HandleFunc("GET /api/download-limits", s.handleDownloadLimits)
+	mux.Handle("POST /api/control/pause", s.requireControlToken(http.HandlerFunc(s.handlePause)))
+	mux.Handle("POST /api/control/resume", s.requireControlToken(http.HandlerFunc(s.handleResume)))
+	mux.Handle("POST /api/control/message", s.requireControlToken(http.HandlerFunc(s.handleMessage)))
+	mux.Handle("POST /api/control/download-limit", s.requireControlToken(http.HandlerFunc(s.handleSetDownloadLimit)))
+	return localOnly(mux)
+}
+
+// Run serves until ctx is cancelled, recording ping and state history.
+func (s *StatusServer) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("listen %s: %w", s.addr, err)
+	}
+	log.Printf("Status page on http://%s/", s.addr)
+
+	go s.record(ctx)
+	srv := &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *StatusServer) record(ctx context.Context) {
+	events := s.state.Subscribe(16)
+	defer s.state.Unsubscribe(events)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-events:
+			s.mu.Lock()
+			if ev.Type == EventPingUpdated {
+				if ms, ok := ev.New.(int); ok {
+					s.pings = appendBounded(s.pings, pingSample{At: ev.When, Ms: ms}, statusPingHistory)
+				}
+			}
+			s.events = appendBounded(s.events, ev, statusRecentEvents)
+			s.mu.Unlock()
+		}
+	}
+}
+
+func appendBounded[T any](list []T, v T, max int) []T {
+	list = append(list, v)
+	if len(list) > max {
+		list = list[len(list)-max:]
+	}
+	return list
+}
+
+// localOnly rejects requests that do not come from this machine, and those
+// whose Host is not a loopback name, so a web page on another origin
+// cannot reach the server through DNS rebinding.
+func localOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remote, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(remote); err != nil || ip == nil || !ip.IsLoopback() {
+			http.Error(w, "forbidden client", http.StatusForbidden)
+			return
+		}
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if host != "localhost" && host != "127.0.0.1" && host != "::1" {
+			http.Error(w, "forbidden host", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireControlToken guards mutating endpoints. With no token configured
+// the controls are disabled entirely.
+func (s *StatusServer) requireControlToken(next http.Handler) http.Handler {
+	return controlTokenGuard(s.token, next)
+}
+
+func controlTokenGuard(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.Error(w, "controls disabled: no control_token configured", http.StatusForbidden)
+			return
+		}
+		got := r.Header.Get("X-Control-Token")
+		if got == "" {
+			got = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "invalid control token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("status server: encode response: %v", err)
+	}
+}
+
+func (s *StatusServer) handlePage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline' 'self'; style-src 'unsafe-inline'; img-src 'self' https: http:")
+	_, _ = w.Write(statusPage)
+}
+
+func (s *StatusServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.snapshot())
+}
+
+func (s *StatusServer) handleHistory(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	pings := append([]pingSample{}, s.pings...)
+	s.mu.Unlock()
+	writeJSON(w, map[string]any{"ping": pings})
+}
+
+func (s *StatusServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	events := append([]StateEvent{}, s.events...)
+	s.mu.Unlock()
+	writeJSON(w, events)
+}
+
+// writeControlResult answers a control request with the outcome of the
+// Control operation that served it.
+func writeControlResult(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, ErrHardcoreLocked):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrNotRunning):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+func (s *StatusServer) handlePause(w http.ResponseWriter, r *http.Request) {
+	log.Println("Pause requested from status page")
+	writeControlResult(w, s.ctl.Pause())
+}
+
+func (s *StatusServer) handleResume(w http.ResponseWriter, r *http.Request) {
+	log.Println("Resume requested from status page")
+	writeControlResult(w, s.ctl.Resume())
+}
+
+func (s *StatusServer) handleMessage(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&data); err != nil {
+		http.Error(w, "bad payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeControlResult(w, s.ctl.Message(data.Text))
+}
+
+func (s *StatusServer) handleDownloadLimits(w http.ResponseWriter, r *http.Request) {
+	limits, err := s.ctl.DownloadLimits()
+	if err != nil {
+		writeControlResult(w, err)
+		return
+	}
+	writeJSON(w, limits)
+}
+
+func (s *StatusServer) handleSetDownloadLimit(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Class string `json:"class"`
+		KBps  int    `json:"kbps"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&data); err != nil {
+		http.Error(w, "bad payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeControlResult(w, s.ctl.SetDownloadLimit(data.Class, data.KBps))
+}
@@ -0,0 +1,210 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingIPC is an EmulatorIPC that records what it was asked to send.
+type recordingIPC struct {
+	mu       sync.Mutex
+	pauses   int
+	resumes  int
+	messages []string
+}
+
+func (f *recordingIPC) SendCommand(parts ...string) error { return nil }
+func (f *recordingIPC) Supports(cmd string) bool          { return true }
+func (f *recordingIPC) SendSync() error                   { return nil }
+func (f *recordingIPC) SendSwap(at int64, game string)    {}
+func (f *recordingIPC) SendSave(path string)              {}
+
+func (f *recordingIPC) SendPause(at *int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pauses++
+}
+
+func (f *recordingIPC) SendResume(at *int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.resumes++
+}
+
+func (f *recordingIPC) SendMessage(msg string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages = append(f.messages, msg)
+}
+
+const testControlToken = "local-secret"
+
+func newTestStatusServer(t *testing.T, token string) (*StatusServer, *recordingIPC, *ClientState) {
+	t.Helper()
+	state := NewClientState()
+	state.SetCurrentGame("mario.nes")
+	ipc := &recordingIPC{}
+	cfg := &Config{StatusPort: 55356, ControlToken: token, BizhawkIPCHost: defaultIPCHost}
+	snapshot := func() SnapshotExtended {
+		return BuildSnapshotExtended(SnapshotSources{State: state, Config: cfg})
+	}
+	return NewStatusServer(cfg, state, ipc, nil, snapshot), ipc, state
+}
+
+func localRequest(method, target, body string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Host = "127.0.0.1:55356"
+	r.RemoteAddr = "127.0.0.1:40000"
+	return r
+}
+
+func TestStatusServerLocalOnly(t *testing.T) {
+	s, _, _ := newTestStatusServer(t, testControlToken)
+	h := s.Handler()
+	tests := []struct {
+		name   string
+		host   string
+		remote string
+		want   int
+	}{
+		{"loopback", "127.0.0.1:55356", "127.0.0.1:40000", http.StatusOK},
+		{"localhost name", "localhost:55356", "127.0.0.1:40000", http.StatusOK},
+		{"ipv6 loopback", "[::1]:55356", "[::1]:40000", http.StatusOK},
+		// A loopback Host header does not make a remote client local.
+		{"remote client", "127.0.0.1:55356", "192.0.2.7:40000", http.StatusForbidden},
+		{"rebound name", "evil.example:55356", "127.0.0.1:40000", http.StatusForbidden},
+		{"bad remote", "127.0.0.1:55356", "garbage", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/status", nil)
+		r.Host = tt.host
+		r.RemoteAddr = tt.remote
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d; want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
+
+func TestStatusServerControlAuth(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured string
+		header     string
+		value      string
+		want       int
+		pauses     int
+	}{
+		{"control token header", testControlToken, "X-Control-Token", testControlToken, http.StatusNoContent, 1},
+		{"bearer header", testControlToken, "Authorization", "Bearer " + testControlToken, http.StatusNoContent, 1},
+		{"missing token", testControlToken, "", "", http.StatusUnauthorized, 0},
+		{"wrong token", testControlToken, "X-Control-Token", "guess", http.StatusUnauthorized, 0},
+		{"controls disabled", "", "X-Control-Token", "", http.StatusForbidden, 0},
+	}
+	for _, tt := range tests {
+		s, ipc, _ := newTestStatusServer(t, tt.configured)
+		r := localRequest("POST", "/api/control/pause", "")
+		if tt.header != "" {
+			r.Header.Set(tt.header, tt.value)
+		}
+		w := httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, r)
+		if w.Code != tt.want || ipc.pauses != tt.pauses {
+			t.Errorf("%s: status %d, pauses %d; want %d, %d", tt.name, w.Code, ipc.pauses, tt.want, tt.pauses)
+		}
+	}
+}
+
+func TestStatusServerHardcoreLocksPause(t *testing.T) {
+	s, ipc, state := newTestStatusServer(t, testControlToken)
+	state.SetHardcore(true)
+	r := localRequest("POST", "/api/control/resume", "")
+	r.Header.Set("X-Control-Token", testControlToken)
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden || ipc.resumes != 0 {
+		t.Errorf("status %d, resumes %d; want 403 and none", w.Code, ipc.resumes)
+	}
+}
+
+func TestStatusServerMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+		sent string
+	}{
+		{"plain", `{"text":"hello"}`, http.StatusNoContent, "hello"},
+		// A '|' or newline would otherwise start a new IPC field or frame.
+		{"field separator", `{"text":"gg|SWAP|0|x.nes"}`, http.StatusNoContent, "gg/SWAP/0/x.nes"},
+		{"frame separator", `{"text":"hi\nCMD|1|PAUSE"}`, http.StatusNoContent, "hiCMD/1/PAUSE"},
+		{"only control characters", `{"text":"\r\n\t"}`, http.StatusBadRequest, ""},
+		{"malformed", `{"text":`, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		s, ipc, _ := newTestStatusServer(t, testControlToken)
+		r := localRequest("POST", "/api/control/message", tt.body)
+		r.Header.Set("X-Control-Token", testControlToken)
+		w := httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d; want %d", tt.name, w.Code, tt.want)
+		}
+		var sent string
+		if len(ipc.messages) > 0 {
+			sent = ipc.messages[0]
+		}
+		if sent != tt.sent {
+			t.Errorf("%s: sent %q; want %q", tt.name, sent, tt.sent)
+		}
+	}
+}
+
+func TestStatusServerStatusJSON(t *testing.T) {
+	s, _, _ := newTestStatusServer(t, testControlToken)
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, localRequest("GET", "/api/status", ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	// The page reads these fields; see web/index.html.
+	var got map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"current_game", "connected", "ready", "state", "ping", "ipc", "rounds_played"} {
+		if _, ok := got[field]; !ok {
+			t.Errorf("status JSON lacks %q", field)
+		}
+	}
+	if got["current_game"] != "mario.nes" {
+		t.Errorf("current_game = %v", got["current_game"])
+	}
+}
+
+func TestStatusAddrStaysLocal(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"127.0.0.1", "127.0.0.1:55356"},
+		{"::1", "[::1]:55356"},
+		{"0.0.0.0", "127.0.0.1:55356"},
+		{"192.168.1.20", "127.0.0.1:55356"},
+		{"", "127.0.0.1:55356"},
+	}
+	for _, tt := range tests {
+		got := statusAddr(&Config{BizhawkIPCHost: tt.host, StatusPort: 55356})
+		if got != tt.want {
+			t.Errorf("statusAddr(%q) = %q; want %q", tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package app
+
+import (
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// swapTimingSamples is how many recent swaps the percentiles in
+	// SwapTimingReport cover.
+	swapTimingSamples = 50
+	// swapLateWarn and ipcDelayWarn are the scheduling error and one-way
+	// delay beyond which a swap is logged as an outlier.
+	swapLateWarn = 250 * time.Millisecond
+	ipcDelayWarn = 100 * time.Millisecond
+)
+
+// SwapTiming is how one swap went on the clock. Lua reports, with its SWAP
+// ACK (protocol 2), when it received the frame and when it executed the
+// swap; both are on this machine's clock, like SentAt. ScheduledAt is the
+// server's swap_at converted to the local clock.
+type SwapTiming struct {
+	Game        string    `json:"game"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+	SentAt      time.Time `json:"sent_at"`
+	ReceivedAt  time.Time `json:"received_at"`
+	ExecutedAt  time.Time `json:"executed_at,omitzero"`
+	// OneWayMS is the IPC delay from sending SWAP to Lua receiving it.
+	OneWayMS int64 `json:"one_way_ms"`
+	// ErrorMS is how late (negative: early) Lua executed the swap.
+	ErrorMS int64 `json:"error_ms,omitempty"`
+}
+
+// SwapTimingReport summarizes the last swapTimingSamples swaps.
+type SwapTimingReport struct {
+	Last        SwapTiming `json:"last"`
+	Samples     int        `json:"samples"`
+	OneWayP50MS int64      `json:"one_way_p50_ms"`
+	OneWayP95MS int64      `json:"one_way_p95_ms"`
+	ErrorP50MS  int64      `json:"error_p50_ms"`
+	ErrorP95MS  int64      `json:"error_p95_ms"`
+}
+
+// parseSwapAck reads the timestamps a protocol 2 script sends with its
+// SWAP ACK ("recv=<unix ms>,exec=<unix ms>"). ok is false when the ACK
+// carries no receive time, as with protocol 1 scripts.
+func parseSwapAck(data string) (recv, exec time.Time, ok bool) {
+	for _, kv := range strings.FieldsFunc(data, func(r rune) bool { return r == ',' || r == '|' }) {
+		name, value, found := strings.Cut(strings.TrimSpace(kv), "=")
+		if !found {
+			continue
+		}
+		ms, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || ms <= 0 {
+			continue
+		}
+		switch name {
+		case "recv":
+			recv = time.UnixMilli(ms)
+		case "exec":
+			exec = time.UnixMilli(ms)
+		}
+	}
+	return recv, exec, !recv.IsZero()
+}
+
+// newSwapTiming combines the client's send time with Lua's timestamps.
+// swapAt is in server time; offset is server time minus local time.
+func newSwapTiming(game string, swapAt time.Time, offset time.Duration, sent, recv, exec time.Time) SwapTiming {
+	t := SwapTiming{
+		Game:        game,
+		ScheduledAt: swapAt.Add(-offset),
+		SentAt:      sent,
+		ReceivedAt:  recv,
+		ExecutedAt:  exec,
+		OneWayMS:    recv.Sub(sent).Milliseconds(),
+	}
+	if !exec.IsZero() {
+		t.ErrorMS = exec.Sub(t.ScheduledAt).Milliseconds()
+	}
+	return t
+}
+
+// logOutlier names the likely cause of a swap that ran late or whose
+// frame took long to reach Lua.
+func (t SwapTiming) logOutlier() {
+	oneWay := time.Duration(t.OneWayMS) * time.Millisecond
+	late := time.Duration(t.ErrorMS) * time.Millisecond
+	switch {
+	case oneWay > ipcDelayWarn:
+		log.Printf("[IPC] SWAP to %s took %s to reach Lua (%s late); the emulator's frame loop was stalled, likely a GC pause or a slow core",
+			t.Game, oneWay, late)
+	case late > swapLateWarn:
+		log.Printf("[IPC] SWAP to %s ran %s late (one-way IPC %s); likely a disk stall loading the savestate or a GC pause in Lua",
+			t.Game, late, oneWay)
+	case late < -swapLateWarn:
+		log.Printf("[IPC] SWAP to %s ran %s early (one-way IPC %s); the script's clock or schedule disagrees with the client's",
+			t.Game, -late, oneWay)
+	}
+}
+
+// swapTimings is the ClientState side of SwapTimingReport.
+type swapTimings struct {
+	recent []SwapTiming
+}
+
+// RecordSwapTiming adds a swap's timing to the report.
+func (s *ClientState) RecordSwapTiming(t SwapTiming) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.swaps.recent = append(s.swaps.recent, t)
+	if len(s.swaps.recent) > swapTimingSamples {
+		s.swaps.recent = s.swaps.recent[1:]
+	}
+}
+
+func (s *ClientState) swapTimingLocked() *SwapTimingReport {
+	n := len(s.swaps.recent)
+	if n == 0 {
+		return nil
+	}
+	var oneWay, errs []int64
+	for _, t := range s.swaps.recent {
+		oneWay = append(oneWay, t.OneWayMS)
+		if !t.ExecutedAt.IsZero() {
+			errs = append(errs, t.ErrorMS)
+		}
+	}
+	return &SwapTimingReport{
+		Last:        s.swaps.recent[n-1],
+		Samples:     n,
+		OneWayP50MS: percentile(oneWay, 50),
+		OneWayP95MS: percentile(oneWay, 95),
+		ErrorP50MS:  percentile(errs, 50),
+		ErrorP95MS:  percentile(errs, 95),
+	}
+}
+
+// percentile returns the nearest-rank pth percentile of values, or 0 for
+// none. values is sorted in place.
+func percentile(values []int64, p int) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	slices.Sort(values)
+	i := (p*len(values)+99)/100 - 1
+	return values[max(i, 0)]
+}
@@ -0,0 +1,166 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSwapAck(t *testing.T) {
+	tests := []struct {
+		data       string
+		recv, exec int64
+		ok         bool
+	}{
+		{"recv=1700000000100,exec=1700000002000", 1700000000100, 1700000002000, true},
+		{"recv=1700000000100|exec=1700000002000", 1700000000100, 1700000002000, true},
+		{" exec=1700000002000 , recv=1700000000100 ", 1700000000100, 1700000002000, true},
+		{"recv=1700000000100", 1700000000100, 0, true},
+		{"exec=1700000002000", 0, 1700000002000, false},
+		{"recv=soon", 0, 0, false},
+		{"recv=-5", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tt := range tests {
+		recv, exec, ok := parseSwapAck(tt.data)
+		if ok != tt.ok || unixMilli(recv) != tt.recv || unixMilli(exec) != tt.exec {
+			t.Errorf("parseSwapAck(%q) = %d, %d, %v; want %d, %d, %v",
+				tt.data, unixMilli(recv), unixMilli(exec), ok, tt.recv, tt.exec, tt.ok)
+		}
+	}
+}
+
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func TestNewSwapTiming(t *testing.T) {
+	local := time.UnixMilli(1_700_000_000_000)
+	ms := func(d int64) time.Time { return local.Add(time.Duration(d) * time.Millisecond) }
+	tests := []struct {
+		name     string
+		offset   time.Duration // server minus local
+		swapAt   time.Time     // server time
+		sent     time.Time
+		recv     time.Time
+		exec     time.Time
+		oneWayMS int64
+		errorMS  int64
+	}{
+		{
+			name:     "in sync",
+			swapAt:   ms(2000),
+			sent:     ms(0),
+			recv:     ms(3),
+			exec:     ms(2016),
+			oneWayMS: 3,
+			errorMS:  16,
+		},
+		{
+			name:     "server ahead",
+			offset:   1500 * time.Millisecond,
+			swapAt:   ms(3500),
+			sent:     ms(0),
+			recv:     ms(2),
+			exec:     ms(2300),
+			oneWayMS: 2,
+			errorMS:  300,
+		},
+		{
+			name:     "server behind",
+			offset:   -4 * time.Second,
+			swapAt:   ms(-2000),
+			sent:     ms(0),
+			recv:     ms(120),
+			exec:     ms(1950),
+			oneWayMS: 120,
+			errorMS:  -50,
+		},
+		{
+			name:     "not executed yet",
+			offset:   -time.Second,
+			swapAt:   ms(1000),
+			sent:     ms(0),
+			recv:     ms(5),
+			oneWayMS: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newSwapTiming("a.nes", tt.swapAt, tt.offset, tt.sent, tt.recv, tt.exec)
+			if got.OneWayMS != tt.oneWayMS || got.ErrorMS != tt.errorMS {
+				t.Errorf("one-way %dms, error %dms; want %dms, %dms", got.OneWayMS, got.ErrorMS, tt.oneWayMS, tt.errorMS)
+			}
+			if want := tt.swapAt.Add(-tt.offset); !got.ScheduledAt.Equal(want) {
+				t.Errorf("scheduled at %s, want %s", got.ScheduledAt, want)
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	values := []int64{40, 10, -20, 30, 20}
+	tests := []struct {
+		p    int
+		want int64
+	}{
+		{0, -20},
+		{50, 20},
+		{95, 40},
+		{100, 40},
+	}
+	for _, tt := range tests {
+		if got := percentile(values, tt.p); got != tt.want {
+			t.Errorf("percentile(%d) = %d, want %d", tt.p, got, tt.want)
+		}
+	}
+	if got := percentile(nil, 95); got != 0 {
+		t.Errorf("percentile of nothing = %d, want 0", got)
+	}
+}
+
+func TestSwapTimingReport(t *testing.T) {
+	s := NewClientState()
+	if s.Snapshot().SwapTimings != nil {
+		t.Fatal("report before any swap")
+	}
+	base := time.UnixMilli(1_700_000_000_000)
+	for i := range swapTimingSamples + 10 {
+		s.RecordSwapTiming(SwapTiming{
+			Game:       "a.nes",
+			OneWayMS:   int64(i),
+			ErrorMS:    int64(-i),
+			ExecutedAt: base,
+		})
+	}
+	// One swap whose ACK carried no execution time.
+	s.RecordSwapTiming(SwapTiming{Game: "b.nes", OneWayMS: 1000})
+
+	r := s.Snapshot().SwapTimings
+	if r.Samples != swapTimingSamples {
+		t.Errorf("samples = %d, want %d", r.Samples, swapTimingSamples)
+	}
+	if r.Last.Game != "b.nes" {
+		t.Errorf("last = %s, want b.nes", r.Last.Game)
+	}
+	// Samples 11 to 59 are kept, then the 1000ms outlier.
+	if r.OneWayP50MS != 35 || r.OneWayP95MS != 58 {
+		t.Errorf("one-way p50/p95 = %d/%d, want 35/58", r.OneWayP50MS, r.OneWayP95MS)
+	}
+	// The swap without an execution time does not count as on time.
+	if r.ErrorP50MS != -35 || r.ErrorP95MS != -13 {
+		t.Errorf("error p50/p95 = %d/%d, want -35/-13", r.ErrorP50MS, r.ErrorP95MS)
+	}
+}
+
+func TestSwapAckDataReachesCommand(t *testing.T) {
+	b := NewBizhawkIPC("127.0.0.1", 0, NewClientState())
+	ch := make(chan string, 1)
+	b.pending[4] = &pendingCmd{ch: ch}
+	b.handleResponse("ACK|4|recv=1700000000100,exec=1700000002000")
+	if got, want := <-ch, "ACK|recv=1700000000100,exec=1700000002000"; got != want {
+		t.Errorf("pending command got %q, want %q", got, want)
+	}
+}
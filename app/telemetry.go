@@ -0,0 +1,140 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Telemetry consent values stored in config.json. The zero value means
+// the player has not been asked yet.
+const (
+	TelemetryUnasked = ""
+	TelemetryGranted = "granted"
+	TelemetryDenied  = "denied"
+)
+
+// telemetryTimeout bounds the single end-of-session POST so it can never
+// hold up shutdown noticeably.
+const telemetryTimeout = 3 * time.Second
+
+// usageCounters are the only figures the usage report contains besides
+// version, platform and session duration.
+type usageCounters struct {
+	reconnects       atomic.Int64
+	ipcTimeouts      atomic.Int64
+	downloadFailures atomic.Int64
+}
+
+// usage accumulates counters for the optional usage report.
+var usage usageCounters
+
+// UsageReport is the anonymous end-of-session report. It carries nothing
+// identifying beyond a random install ID.
+type UsageReport struct {
+	InstallID        string `json:"install_id"`
+	Version          string `json:"version"`
+	OS               string `json:"os"`
+	Arch             string `json:"arch"`
+	SessionSeconds   int64  `json:"session_seconds"`
+	Swaps            int    `json:"swaps"`
+	Reconnects       int64  `json:"reconnects"`
+	IPCTimeouts      int64  `json:"ipc_timeouts"`
+	DownloadFailures int64  `json:"download_failures"`
+}
+
+func buildUsageReport(installID string, duration time.Duration, swaps int) UsageReport {
+	return UsageReport{
+		InstallID:        installID,
+		Version:          version,
+		OS:               runtime.GOOS,
+		Arch:             runtime.GOARCH,
+		SessionSeconds:   int64(duration.Seconds()),
+		Swaps:            swaps,
+		Reconnects:       usage.reconnects.Load(),
+		IPCTimeouts:      usage.ipcTimeouts.Load(),
+		DownloadFailures: usage.downloadFailures.Load(),
+	}
+}
+
+// parseTelemetryFlag maps the -telemetry flag to a consent value; "" keeps
+// the stored one.
+func parseTelemetryFlag(v string) (string, error) {
+	switch strings.ToLower(v) {
+	case "":
+		return "", nil
+	case "on", "true", "yes":
+		return TelemetryGranted, nil
+	case "off", "false", "no":
+		return TelemetryDenied, nil
+	}
+	return "", fmt.Errorf("-telemetry: want on or off, got %q", v)
+}
+
+// setTelemetryConsent records consent, creating the install ID on grant.
+func setTelemetryConsent(cfg *Config, consent string) {
+	cfg.Telemetry = consent
+	if consent == TelemetryGranted && cfg.TelemetryID == "" {
+		id, err := newUUID()
+		if err != nil {
+			log.Printf("Telemetry install ID unavailable: %v", err)
+			cfg.Telemetry = TelemetryDenied
+			return
+		}
+		cfg.TelemetryID = id
+	}
+	if consent == TelemetryDenied {
+		cfg.TelemetryID = ""
+	}
+}
+
+// askTelemetryConsent asks once, when a report endpoint is configured and
+// the player has never answered. Anything but an explicit yes is a no.
+func askTelemetryConsent(ctx context.Context, cfg *Config) {
+	if cfg.Telemetry != TelemetryUnasked || cfg.TelemetryURL == "" {
+		return
+	}
+	answer, err := prompter.Ask(ctx, "telemetry",
+		"Send an anonymous end-of-session usage report (version, platform, counts of swaps and errors) to help the maintainer? [y/N]")
+	if err != nil {
+		return
+	}
+	consent := TelemetryDenied
+	if a := strings.ToLower(answer); a == "y" || a == "yes" {
+		consent = TelemetryGranted
+	}
+	setTelemetryConsent(cfg, consent)
+}
+
+// sendUsageReport posts the report once if the player opted in.
+func sendUsageReport(cfg *Config, report UsageReport) {
+	if cfg.Telemetry != TelemetryGranted || cfg.TelemetryURL == "" {
+		return
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), telemetryTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.TelemetryURL, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Usage report not sent: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		log.Printf("Usage report not sent: %v", err)
+		return
+	}
+	resp.Body.Close()
+	debugf("Usage report sent: %s", resp.Status)
+}
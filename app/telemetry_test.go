@@ -0,0 +1,171 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scriptedPrompter answers every question with answer (or err) and
+// records the keys it was asked.
+type scriptedPrompter struct {
+	answer string
+	err    error
+	asked  []string
+}
+
+func (p *scriptedPrompter) Ask(ctx context.Context, key, label string) (string, error) {
+	p.asked = append(p.asked, key)
+	return p.answer, p.err
+}
+
+func usePrompter(t *testing.T, p Prompter) {
+	t.Helper()
+	old := prompter
+	prompter = p
+	t.Cleanup(func() { prompter = old })
+}
+
+func TestParseTelemetryFlag(t *testing.T) {
+	for in, want := range map[string]string{
+		"": "", "on": TelemetryGranted, "YES": TelemetryGranted, "true": TelemetryGranted,
+		"off": TelemetryDenied, "No": TelemetryDenied, "false": TelemetryDenied,
+	} {
+		if got, err := parseTelemetryFlag(in); got != want || err != nil {
+			t.Errorf("parseTelemetryFlag(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := parseTelemetryFlag("maybe"); err == nil {
+		t.Error("parseTelemetryFlag accepted maybe")
+	}
+}
+
+func TestSetTelemetryConsent(t *testing.T) {
+	cfg := &Config{}
+	setTelemetryConsent(cfg, TelemetryGranted)
+	id := cfg.TelemetryID
+	if cfg.Telemetry != TelemetryGranted || len(id) != 36 {
+		t.Fatalf("granted: consent %q, install ID %q", cfg.Telemetry, id)
+	}
+	setTelemetryConsent(cfg, TelemetryGranted)
+	if cfg.TelemetryID != id {
+		t.Errorf("install ID changed on a repeated grant: %q -> %q", id, cfg.TelemetryID)
+	}
+	setTelemetryConsent(cfg, TelemetryDenied)
+	if cfg.Telemetry != TelemetryDenied || cfg.TelemetryID != "" {
+		t.Errorf("denied: consent %q, install ID %q; want the ID dropped", cfg.Telemetry, cfg.TelemetryID)
+	}
+	setTelemetryConsent(cfg, TelemetryGranted)
+	if cfg.TelemetryID == "" || cfg.TelemetryID == id {
+		t.Errorf("install ID after re-granting = %q; want a fresh one", cfg.TelemetryID)
+	}
+}
+
+func TestAskTelemetryConsent(t *testing.T) {
+	tests := []struct {
+		name    string
+		stored  string
+		url     string
+		answer  string
+		err     error
+		asked   bool
+		consent string
+	}{
+		{"yes", TelemetryUnasked, "https://t.example", "y", nil, true, TelemetryGranted},
+		{"yes in capitals", TelemetryUnasked, "https://t.example", "YES", nil, true, TelemetryGranted},
+		{"empty answer", TelemetryUnasked, "https://t.example", "", nil, true, TelemetryDenied},
+		{"anything else", TelemetryUnasked, "https://t.example", "sure", nil, true, TelemetryDenied},
+		{"prompt failed", TelemetryUnasked, "https://t.example", "", io.EOF, true, TelemetryUnasked},
+		{"already answered", TelemetryDenied, "https://t.example", "y", nil, false, TelemetryDenied},
+		{"no endpoint", TelemetryUnasked, "", "y", nil, false, TelemetryUnasked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &scriptedPrompter{answer: tt.answer, err: tt.err}
+			usePrompter(t, p)
+			cfg := &Config{Telemetry: tt.stored, TelemetryURL: tt.url}
+			askTelemetryConsent(context.Background(), cfg)
+			if asked := len(p.asked) > 0; asked != tt.asked {
+				t.Errorf("asked = %v; want %v", asked, tt.asked)
+			}
+			if cfg.Telemetry != tt.consent {
+				t.Errorf("consent = %q; want %q", cfg.Telemetry, tt.consent)
+			}
+			if (cfg.TelemetryID != "") != (tt.consent == TelemetryGranted) {
+				t.Errorf("install ID %q with consent %q", cfg.TelemetryID, cfg.Telemetry)
+			}
+		})
+	}
+}
+
+func TestSendUsageReport(t *testing.T) {
+	saved := [3]int64{usage.reconnects.Load(), usage.ipcTimeouts.Load(), usage.downloadFailures.Load()}
+	t.Cleanup(func() {
+		usage.reconnects.Store(saved[0])
+		usage.ipcTimeouts.Store(saved[1])
+		usage.downloadFailures.Store(saved[2])
+	})
+	usage.reconnects.Store(2)
+	usage.ipcTimeouts.Store(1)
+	usage.downloadFailures.Store(0)
+
+	reports := make(chan map[string]any, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("report sent as %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		reports <- body
+	}))
+	defer srv.Close()
+
+	report := buildUsageReport("install-1", 90*time.Minute+30*time.Second, 7)
+	for _, consent := range []string{TelemetryUnasked, TelemetryDenied} {
+		sendUsageReport(&Config{Telemetry: consent, TelemetryURL: srv.URL}, report)
+	}
+	sendUsageReport(&Config{Telemetry: TelemetryGranted}, report)
+	select {
+	case got := <-reports:
+		t.Fatalf("report sent without consent and endpoint: %v", got)
+	default:
+	}
+
+	sendUsageReport(&Config{Telemetry: TelemetryGranted, TelemetryURL: srv.URL}, report)
+	var got map[string]any
+	select {
+	case got = <-reports:
+	default:
+		t.Fatal("no report sent with consent")
+	}
+	want := map[string]any{
+		"install_id": "install-1", "version": version, "os": runtime.GOOS, "arch": runtime.GOARCH,
+		"session_seconds": 5430.0, "swaps": 7.0,
+		"reconnects": 2.0, "ipc_timeouts": 1.0, "download_failures": 0.0,
+	}
+	// Exactly these fields: anything more would need a new consent text.
+	if !maps.Equal(got, want) {
+		t.Errorf("report = %v\nwant %v", got, want)
+	}
+}
+
+func TestSendUsageReportUnreachable(t *testing.T) {
+	logs := captureLog(t)
+	start := time.Now()
+	sendUsageReport(&Config{Telemetry: TelemetryGranted, TelemetryURL: "http://127.0.0.1:1/report"}, UsageReport{})
+	if took := time.Since(start); took > telemetryTimeout+time.Second {
+		t.Errorf("unreachable endpoint held shutdown for %s", took)
+	}
+	if !strings.Contains(logs.String(), "Usage report not sent") {
+		t.Errorf("failure not logged: %q", logs)
+	}
+}
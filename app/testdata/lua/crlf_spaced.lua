@@ -0,0 +1,2 @@
+  --  ipc_protocol:2
+local socket = comm.socketServerSend
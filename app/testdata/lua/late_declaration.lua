@@ -0,0 +1,7 @@
+-- 1
+-- 2
+-- 3
+-- 4
+-- 5
+-- protocol: 9
+local socket = comm.socketServerSend
@@ -0,0 +1,3 @@
+-- BizHawk relay script
+-- protocol: 2
+local socket = comm.socketServerSend
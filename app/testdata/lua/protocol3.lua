@@ -0,0 +1,3 @@
+-- ipc-protocol = 3
+-- Needs the save-slot commands
+local socket = comm.socketServerSend
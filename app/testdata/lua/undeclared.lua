@@ -0,0 +1,2 @@
+-- BizHawk relay script
+local socket = comm.socketServerSend
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// DownloadClass groups downloads that share one bandwidth limit.
+type DownloadClass string
+
+const (
+	// DownloadUrgent is a download a swap is waiting on; never throttled
+	// unless the user asks for it.
+	DownloadUrgent DownloadClass = "urgent"
+	// DownloadBackground covers prefetches and server-pushed ROMs that
+	// are not needed yet.
+	DownloadBackground DownloadClass = "background"
+)
+
+var downloadClasses = []DownloadClass{DownloadUrgent, DownloadBackground}
+
+func parseDownloadClass(s string) (DownloadClass, error) {
+	for _, c := range downloadClasses {
+		if string(c) == s {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("unknown download class %q (want urgent or background)", s)
+}
+
+// rateLimiter is a token bucket shared by all downloads of one class. A
+// rate of zero means unlimited. The rate can change while downloads run.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   int64 // bytes per second
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	return &rateLimiter{rate: bytesPerSec, now: time.Now}
+}
+
+// SetRate changes the limit; zero removes it.
+func (l *rateLimiter) SetRate(bytesPerSec int64) {
+	l.mu.Lock()
+	l.rate = bytesPerSec
+	l.tokens = 0
+	l.last = time.Time{}
+	l.mu.Unlock()
+}
+
+// Rate returns the current limit in bytes per second (0 = unlimited).
+func (l *rateLimiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// burst is how many bytes may be read in one go: a quarter second's worth,
+// so throughput stays smooth enough not to starve other traffic.
+func (l *rateLimiter) burst() float64 {
+	return max(float64(l.rate)/4, 1)
+}
+
+// take blocks until n bytes may be consumed or ctx is done.
+func (l *rateLimiter) take(ctx context.Context, n int) error {
+	for {
+		l.mu.Lock()
+		if l.rate <= 0 {
+			l.mu.Unlock()
+			return nil
+		}
+		now := l.now()
+		if l.last.IsZero() {
+			l.last = now
+		}
+		l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*float64(l.rate), l.burst())
+		l.last = now
+		// The rate may have dropped since the caller sized its read.
+		need := min(float64(n), l.burst())
+		if l.tokens >= need {
+			l.tokens -= need
+			l.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((need - l.tokens) / float64(l.rate) * float64(time.Second))
+		l.mu.Unlock()
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// throttledReader paces reads from r through a shared limiter.
+type throttledReader struct {
+	ctx context.Context
+	r   io.Reader
+	lim *rateLimiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if t.lim.Rate() > 0 {
+		t.lim.mu.Lock()
+		if burst := int(t.lim.burst()); len(p) > burst {
+			p = p[:burst]
+		}
+		t.lim.mu.Unlock()
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if werr := t.lim.take(t.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// throttle wraps r with lim; a nil limiter leaves r as is.
+func throttle(ctx context.Context, r io.Reader, lim *rateLimiter) io.Reader {
+	if lim == nil {
+		return r
+	}
+	return &throttledReader{ctx: ctx, r: r, lim: lim}
+}
@@ -0,0 +1,119 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testRate = 64 << 10 // bytes per second
+
+// timedCopy drains r and returns how long it took.
+func timedCopy(t *testing.T, r io.Reader) time.Duration {
+	t.Helper()
+	start := time.Now()
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+	return time.Since(start)
+}
+
+// checkDuration allows for scheduling slack above the expected time and
+// the initial burst below it.
+func checkDuration(t *testing.T, what string, got, want time.Duration) {
+	t.Helper()
+	if got < want-300*time.Millisecond || got > want+time.Second {
+		t.Errorf("%s took %s; want about %s", what, got.Round(time.Millisecond), want)
+	}
+}
+
+func TestThrottleThroughput(t *testing.T) {
+	lim := newRateLimiter(testRate)
+	body := bytes.Repeat([]byte("x"), testRate)
+	got := timedCopy(t, throttle(context.Background(), bytes.NewReader(body), lim))
+	checkDuration(t, "64 KiB at 64 KiB/s", got, time.Second)
+
+	// Unlimited and nil limiters do not pace at all.
+	if got := timedCopy(t, throttle(context.Background(), bytes.NewReader(body), newRateLimiter(0))); got > 100*time.Millisecond {
+		t.Errorf("unlimited copy took %s", got)
+	}
+	if rd := bytes.NewReader(body); throttle(context.Background(), rd, nil) != io.Reader(rd) {
+		t.Error("nil limiter wrapped the reader")
+	}
+}
+
+func TestThrottleSharedByClass(t *testing.T) {
+	lim := newRateLimiter(testRate)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := bytes.Repeat([]byte("x"), testRate/2)
+			_, _ = io.Copy(io.Discard, throttle(context.Background(), bytes.NewReader(body), lim))
+		}()
+	}
+	wg.Wait()
+	checkDuration(t, "two 32 KiB readers sharing 64 KiB/s", time.Since(start), time.Second)
+}
+
+func TestThrottleRateChangeAndCancel(t *testing.T) {
+	lim := newRateLimiter(1024)
+	ctx, cancel := context.WithCancel(context.Background())
+	r := throttle(ctx, bytes.NewReader(bytes.Repeat([]byte("x"), 1<<20)), lim)
+
+	// Lifting the limit mid-download lets the rest through at once.
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		lim.SetRate(0)
+	}()
+	if got := timedCopy(t, r); got > time.Second {
+		t.Errorf("copy after lifting the limit took %s", got)
+	}
+
+	lim.SetRate(1)
+	r = throttle(ctx, bytes.NewReader([]byte("slow")), lim)
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if _, err := io.Copy(io.Discard, r); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled copy = %v", err)
+	}
+}
+
+func TestDownloadManagerLimits(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), testRate)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(body)
+	}))
+	defer srv.Close()
+	m := NewDownloadManager(http.DefaultClient, NewClientState(), &Config{
+		DownloadLimitsKBps: map[string]int{string(DownloadBackground): testRate >> 10},
+	})
+	dir := t.TempDir()
+	fetch := func(class DownloadClass, name string) time.Duration {
+		start := time.Now()
+		if err := m.Fetch(class, srv.URL, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+		return time.Since(start)
+	}
+
+	checkDuration(t, "background download", fetch(DownloadBackground, "a.nes"), time.Second)
+	if got := fetch(DownloadUrgent, "b.nes"); got > 500*time.Millisecond {
+		t.Errorf("urgent download took %s; want it unthrottled", got)
+	}
+	m.SetLimit(DownloadBackground, 0)
+	if got := m.Limits(); got[DownloadBackground] != 0 || got[DownloadUrgent] != 0 {
+		t.Errorf("limits = %v", got)
+	}
+	if got := fetch(DownloadBackground, "c.nes"); got > 500*time.Millisecond {
+		t.Errorf("background download after lifting the limit took %s", got)
+	}
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+)
+
+// buildTLSConfig returns the TLS settings for talking to the game server,
+// or nil when the config asks for nothing beyond the system defaults.
+func buildTLSConfig(cfg *Config) (*tls.Config, error) {
+	if cfg.TLSCAFile == "" && !cfg.TLSSkipVerify {
+		return nil, nil
+	}
+	tc := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls_ca_file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls_ca_file %s contains no PEM certificates", cfg.TLSCAFile)
+		}
+		tc.RootCAs = pool
+	}
+	if cfg.TLSSkipVerify {
+		tc.InsecureSkipVerify = true
+	}
+	return tc, nil
+}
+
+// configureTLS applies tls_ca_file and tls_skip_verify to the transports
+// every HTTP client shares: http.DefaultTransport (httpClient and the
+// Pusher channel auth requests) and downloadClient's. It must run before
+// the first request. The Pusher websocket itself is dialled by the
+// library with system defaults and cannot be configured.
+func configureTLS(cfg *Config) error {
+	tc, err := buildTLSConfig(cfg)
+	if err != nil || tc == nil {
+		return err
+	}
+	if tc.InsecureSkipVerify {
+		log.Println("WARNING: ******************************************************")
+		log.Println("WARNING: tls_skip_verify is on; the server's certificate is NOT checked")
+		log.Println("WARNING: and anyone on the network path can impersonate it.")
+		log.Println("WARNING: ******************************************************")
+	}
+	if cfg.TLSCAFile != "" {
+		log.Printf("Trusting extra CA certificates from %s", cfg.TLSCAFile)
+	}
+	if cfg.ServerScheme == "https" {
+		log.Println("Note: the websocket connection still verifies against the system roots")
+	}
+	http.DefaultTransport.(*http.Transport).TLSClientConfig = tc
+	downloadClient.Transport.(*http.Transport).TLSClientConfig = tc.Clone()
+	return nil
+}
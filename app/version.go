@@ -0,0 +1,106 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+)
+
+// Set at build time with -ldflags "-X go-client/app.version=...
+// -X go-client/app.commit=... -X go-client/app.buildDate=...". Commit and
+// date fall back to the VCS stamp Go embeds when building from a checkout.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// userAgent identifies this build in requests to the server.
+func userAgent() string {
+	return fmt.Sprintf("go-game-client/%s (%s/%s)", version, runtime.GOOS, runtime.GOARCH)
+}
+
+// VersionReport describes exactly what this binary supports. Field names
+// are a contract for packagers' tooling; only ever add fields.
+type VersionReport struct {
+	Version      string       `json:"version"`
+	Commit       string       `json:"commit"`
+	BuildDate    string       `json:"build_date"`
+	GoVersion    string       `json:"go_version"`
+	GOOS         string       `json:"goos"`
+	GOARCH       string       `json:"goarch"`
+	BuildTags    []string     `json:"build_tags"`
+	IPCProtocols []int        `json:"ipc_protocols"`
+	Capabilities Capabilities `json:"capabilities"`
+}
+
+// buildTags lists the optional build tags compiled into this binary.
+func buildTags() []string {
+	tags := []string{}
+	if customHandlersBuild {
+		tags = append(tags, "custom_handlers")
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// BuildVersionReport assembles the report from the same sources as the
+// Ready capabilities payload, using the default config.
+func BuildVersionReport() VersionReport {
+	rev, date := commit, buildDate
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && rev == "":
+				rev = s.Value
+			case s.Key == "vcs.time" && date == "":
+				date = s.Value
+			}
+		}
+	}
+
+	h := &Handlers{registry: NewRegistry()}
+	h.registerBuiltins()
+	RegisterCustomHandlers(h.registry, Deps{})
+
+	protocols := make([]int, 0, ipcProtocolVersion)
+	for v := 1; v <= ipcProtocolVersion; v++ {
+		protocols = append(protocols, v)
+	}
+	return VersionReport{
+		Version:      version,
+		Commit:       rev,
+		BuildDate:    date,
+		GoVersion:    runtime.Version(),
+		GOOS:         runtime.GOOS,
+		GOARCH:       runtime.GOARCH,
+		BuildTags:    buildTags(),
+		IPCProtocols: protocols,
+		Capabilities: BuildCapabilities(h.registry, nil, DefaultConfig()),
+	}
+}
+
+// printVersion writes the version line, or the full report as JSON.
+func printVersion(asJSON bool) {
+	r := BuildVersionReport()
+	if !asJSON {
+		fmt.Printf("go-game-client %s (%s, %s/%s)\n", r.Version, shortCommit(r.Commit), r.GOOS, r.GOARCH)
+		return
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(r)
+}
+
+func shortCommit(c string) string {
+	if c == "" {
+		return "unknown commit"
+	}
+	if len(c) > 12 {
+		return c[:12]
+	}
+	return c
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestVersionReportGolden(t *testing.T) {
+	var r VersionReport
+	fillValue(reflect.ValueOf(&r).Elem())
+	checkGolden(t, "version_report.json", r)
+}
+
+func TestBuildVersionReport(t *testing.T) {
+	r := BuildVersionReport()
+	if r.Version != version || r.GOOS == "" || r.GOARCH == "" || r.GoVersion == "" {
+		t.Errorf("report = %+v", r)
+	}
+	if want := ipcProtocolVersion; len(r.IPCProtocols) != want || r.IPCProtocols[want-1] != want {
+		t.Errorf("IPCProtocols = %v; want 1..%d", r.IPCProtocols, want)
+	}
+	if r.BuildTags == nil {
+		t.Error("BuildTags is nil; it must encode as [] for packagers")
+	}
+	if got := slices.Contains(r.BuildTags, "custom_handlers"); got != customHandlersBuild {
+		t.Errorf("custom_handlers tag listed = %v; built with it = %v", got, customHandlersBuild)
+	}
+	// The capability list is the one Ready sends with the default config.
+	if r.Capabilities.Version != capabilitiesVersion || !slices.Contains(r.Capabilities.Events, "swap") {
+		t.Errorf("Capabilities = %+v", r.Capabilities)
+	}
+	if !slices.Equal(r.Capabilities.Emulator, emulatorCommands) {
+		t.Errorf("Emulator = %v; want %v", r.Capabilities.Emulator, emulatorCommands)
+	}
+}
+
+func TestShortCommit(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"", "unknown commit"},
+		{"abc123", "abc123"},
+		{"0123456789abcdef0123", "0123456789ab"},
+	}
+	for _, tt := range tests {
+		if got := shortCommit(tt.in); got != tt.want {
+			t.Errorf("shortCommit(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRequestsCarryClientVersion(t *testing.T) {
+	var mu sync.Mutex
+	agents := map[string]string{}
+	versions := map[string]any{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("%s body %s: %v", r.URL.Path, data, err)
+		}
+		mu.Lock()
+		agents[r.URL.Path] = r.Header.Get("User-Agent")
+		versions[r.URL.Path] = body["client_version"]
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"state":"idle"}`))
+	}))
+	defer srv.Close()
+
+	a := NewAPI(&Config{ServerURL: srv.URL, BearerToken: "t"})
+	state := NewClientState()
+	snap := BuildSnapshotExtended(SnapshotSources{State: state, Config: DefaultConfig()})
+	if _, err := a.Heartbeat(context.Background(), state, snap); err != nil {
+		t.Fatalf("Heartbeat: %v", err)
+	}
+	if err := a.Ready(context.Background(), state, Capabilities{}); err != nil {
+		t.Fatalf("Ready: %v", err)
+	}
+
+	wantAgent := fmt.Sprintf("go-game-client/%s (%s/%s)", version, runtime.GOOS, runtime.GOARCH)
+	for _, path := range []string{"/api/heartbeat", "/api/ready"} {
+		if agents[path] != wantAgent {
+			t.Errorf("%s User-Agent = %q; want %q", path, agents[path], wantAgent)
+		}
+		if versions[path] != version {
+			t.Errorf("%s client_version = %v; want %q", path, versions[path], version)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Command fakelua stands in for the BizHawk Lua script: it connects to a
+// running client's IPC port and answers commands according to a scenario,
+// logging every frame. Use it to exercise the IPC path without BizHawk.
+//
+//	go run ./cmd/fakelua -scenario slow-saver
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"go-client/internal/luapeer"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:55355", "client IPC address")
+	scenario := flag.String("scenario", "happy-path", "bundled scenario name or path to a scenario JSON file")
+	protocol := flag.Int("protocol", 0, "override the protocol version announced in HELLO")
+	caps := flag.String("caps", "", "override the comma-separated capabilities announced in HELLO")
+	list := flag.Bool("list", false, "list bundled scenarios and exit")
+	flag.Parse()
+
+	if *list {
+		fmt.Println(strings.Join(luapeer.Builtin(), "\n"))
+		return
+	}
+
+	s, err := luapeer.Load(*scenario)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *protocol > 0 {
+		s.Protocol = *protocol
+	}
+	if *caps != "" {
+		s.Caps = strings.Split(*caps, ",")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	dialCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	log.Printf("Running scenario %q against %s", s.Name, *addr)
+	peer, err := luapeer.Dial(dialCtx, *addr, s, log.Printf)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	select {
+	case <-ctx.Done():
+		_ = peer.Close()
+		log.Println("Interrupted")
+	case <-peer.Closed():
+		log.Println("Client closed the connection")
+	}
+}
@@ -0,0 +1,202 @@
+// Package luapeer is a scriptable stand-in for the BizHawk Lua script. It
+// speaks the Lua side of the client's IPC protocol so the IPC path can be
+// exercised without Windows or BizHawk, both by the selftest subcommand and
+// by the cmd/fakelua binary.
+package luapeer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// savestateContent is what the peer writes for SAVE when asked to.
+var savestateContent = []byte("fakelua savestate")
+
+// Peer is one connection to the client's IPC listener.
+type Peer struct {
+	conn     net.Conn
+	scenario *Scenario
+	logf     func(format string, args ...any)
+
+	writeMu   sync.Mutex
+	closeOnce sync.Once
+	seen      map[string]int
+	reloaded  bool
+	cmds      chan string
+	closed    chan struct{}
+	done      chan struct{}
+}
+
+// Dial connects to addr, retrying until ctx is done, then starts the peer.
+func Dial(ctx context.Context, addr string, s *Scenario, logf func(string, ...any)) (*Peer, error) {
+	var d net.Dialer
+	for {
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			return Start(conn, s, logf)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("connect to ipc listener: %w", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// Start runs the scenario on an established connection: it sends HELLO,
+// schedules the scenario's events and answers commands until the
+// connection closes. logf may be nil.
+func Start(conn net.Conn, s *Scenario, logf func(string, ...any)) (*Peer, error) {
+	if logf == nil {
+		logf = func(string, ...any) {}
+	}
+	p := &Peer{
+		conn:     conn,
+		scenario: s,
+		logf:     logf,
+		seen:     make(map[string]int),
+		cmds:     make(chan string, 16),
+		closed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if err := p.send(s.hello()); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	go p.serve()
+	for _, ev := range s.Events {
+		go p.emit(ev)
+	}
+	return p, nil
+}
+
+func (p *Peer) send(line string) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	p.logf("-> %s", line)
+	_, err := p.conn.Write([]byte(line + "\n"))
+	return err
+}
+
+func (p *Peer) emit(ev Event) {
+	select {
+	case <-p.closed:
+		return
+	case <-time.After(ev.delay()):
+	}
+	_ = p.send("EVENT|" + ev.Name + "|" + ev.Data)
+}
+
+func (p *Peer) serve() {
+	defer close(p.closed)
+	scanner := bufio.NewScanner(p.conn)
+	for scanner.Scan() {
+		line := scanner.Text()
+		p.logf("<- %s", line)
+		// CMD|<id>|<name>|<args...>
+		parts := strings.Split(line, "|")
+		if len(parts) < 3 || parts[0] != "CMD" {
+			continue
+		}
+		id, name := parts[1], parts[2]
+		p.seen[name]++
+		r := p.scenario.rule(name, p.seen[name])
+		if r.UntilReload && p.reloaded {
+			r = p.scenario.Default
+		}
+		if !p.handle(r, id, name, parts[3:]) {
+			return
+		}
+		select {
+		case p.cmds <- name:
+		default:
+		}
+	}
+}
+
+// handle answers one command and reports whether to keep serving.
+func (p *Peer) handle(r Rule, id, name string, args []string) bool {
+	if d := r.delay(); d > 0 {
+		select {
+		case <-p.done:
+			return false
+		case <-time.After(d):
+		}
+	}
+	var reply string
+	switch r.Reply {
+	case ReplyDrop:
+		p.logf("dropping %s %s", name, id)
+		return true
+	case ReplyDisconnect:
+		p.logf("disconnecting during %s %s", name, id)
+		_ = p.conn.Close()
+		return false
+	case ReplyNack:
+		reply = "NACK|" + id + "|" + r.Reason
+	default:
+		reply = "ACK|" + id
+	}
+	if r.WriteSave && name == "SAVE" && len(args) > 0 {
+		if err := os.WriteFile(args[0], savestateContent, 0o644); err != nil {
+			reply = "NACK|" + id + "|" + err.Error()
+		}
+	}
+	if err := p.send(reply); err != nil {
+		return false
+	}
+	if r.Duplicate {
+		_ = p.send(reply)
+	}
+	// A reloaded script starts over and announces itself again.
+	if name == "RELOAD" && strings.HasPrefix(reply, "ACK") {
+		p.reloaded = true
+		_ = p.send(p.scenario.hello())
+	}
+	for _, ev := range r.Emit {
+		go p.emit(ev)
+	}
+	return true
+}
+
+// Expect waits until the peer has received the named command, skipping
+// others (such as resends) in between.
+func (p *Peer) Expect(ctx context.Context, name string) error {
+	for {
+		select {
+		case got := <-p.cmds:
+			if got == name {
+				return nil
+			}
+		case <-p.closed:
+			return fmt.Errorf("connection closed before %s arrived", name)
+		case <-ctx.Done():
+			return fmt.Errorf("%s not received: %w", name, ctx.Err())
+		}
+	}
+}
+
+// Closed is closed once the connection has ended.
+func (p *Peer) Closed() <-chan struct{} { return p.closed }
+
+// WaitClosed waits for the client to hang up.
+func (p *Peer) WaitClosed(ctx context.Context) error {
+	select {
+	case <-p.closed:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("lua connection still open after shutdown: %w", ctx.Err())
+	}
+}
+
+// Close ends the connection from the peer's side.
+func (p *Peer) Close() error {
+	p.closeOnce.Do(func() { close(p.done) })
+	return p.conn.Close()
+}
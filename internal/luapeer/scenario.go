@@ -0,0 +1,128 @@
+package luapeer
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Replies a Rule can give to a command.
+const (
+	ReplyAck        = "ack"
+	ReplyNack       = "nack"
+	ReplyDrop       = "drop"       // never answer; the client times out
+	ReplyDisconnect = "disconnect" // hang up mid-command
+)
+
+// Scenario describes how the fake peer behaves for one run.
+type Scenario struct {
+	Name     string          `json:"name"`
+	Protocol int             `json:"protocol,omitempty"`
+	Caps     []string        `json:"caps,omitempty"`
+	Timings  string          `json:"timings,omitempty"` // raw HELLO field, e.g. "cmd:5000,save:5000,swap:5000"
+	Commands map[string]Rule `json:"commands,omitempty"`
+	Default  Rule            `json:"default"`
+	Events   []Event         `json:"events,omitempty"`
+}
+
+// Rule is the reaction to one command name. Every > 1 applies the rule only
+// to every Nth occurrence; the others get the scenario default.
+// UntilReload applies the rule only until the client sends RELOAD.
+type Rule struct {
+	Reply       string  `json:"reply,omitempty"`
+	Reason      string  `json:"reason,omitempty"`
+	DelayMS     int     `json:"delay_ms,omitempty"`
+	Duplicate   bool    `json:"duplicate,omitempty"`
+	WriteSave   bool    `json:"write_save,omitempty"`
+	Every       int     `json:"every,omitempty"`
+	UntilReload bool    `json:"until_reload,omitempty"`
+	Emit        []Event `json:"emit,omitempty"`
+}
+
+// Event is an EVENT frame sent AfterMS after the trigger (connect for
+// scenario events, the reply for rule events).
+type Event struct {
+	AfterMS int    `json:"after_ms,omitempty"`
+	Name    string `json:"name"`
+	Data    string `json:"data,omitempty"`
+}
+
+func (r Rule) delay() time.Duration { return time.Duration(r.DelayMS) * time.Millisecond }
+
+func (e Event) delay() time.Duration { return time.Duration(e.AfterMS) * time.Millisecond }
+
+// hello builds the HELLO line announcing the scenario's protocol and caps.
+func (s *Scenario) hello() string {
+	fields := []string{"HELLO"}
+	if s.Protocol > 0 {
+		fields = append(fields, fmt.Sprintf("protocol=%d", s.Protocol))
+	}
+	fields = append(fields, "caps="+strings.Join(s.Caps, ","))
+	if s.Timings != "" {
+		fields = append(fields, "timings="+s.Timings)
+	}
+	return strings.Join(fields, "|")
+}
+
+// rule picks the reaction to the nth (1-based) occurrence of name.
+func (s *Scenario) rule(name string, n int) Rule {
+	r, ok := s.Commands[name]
+	if !ok {
+		r, ok = s.Commands["*"]
+	}
+	if !ok || (r.Every > 1 && n%r.Every != 0) {
+		return s.Default
+	}
+	return r
+}
+
+//go:embed scenarios/*.json
+var builtin embed.FS
+
+// Builtin lists the names of the bundled scenarios.
+func Builtin() []string {
+	entries, _ := builtin.ReadDir("scenarios")
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Load returns a bundled scenario by name, or reads one from a JSON file.
+func Load(nameOrPath string) (*Scenario, error) {
+	data, err := builtin.ReadFile(path.Join("scenarios", nameOrPath+".json"))
+	if err != nil {
+		data, err = os.ReadFile(nameOrPath)
+		if err != nil {
+			return nil, fmt.Errorf("scenario %q is neither bundled (%s) nor a readable file: %w",
+				nameOrPath, strings.Join(Builtin(), ", "), err)
+		}
+	}
+	var s Scenario
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse scenario %s: %w", nameOrPath, err)
+	}
+	if s.Default.Reply == "" {
+		s.Default.Reply = ReplyAck
+	}
+	if s.Name == "" {
+		s.Name = nameOrPath
+	}
+	return &s, nil
+}
+
+// MustLoad is Load for bundled scenarios, which are known to be valid.
+func MustLoad(name string) *Scenario {
+	s, err := Load(name)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}